@@ -0,0 +1,65 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package artifacts
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// magic contains the signatures of the file types that are common for
+// malware, which http.DetectContentType doesn't know about.
+var magic = []struct {
+	prefix []byte
+	mime   string
+}{
+	{[]byte("\x7fELF"), "application/x-executable"},
+	{[]byte("MZ"), "application/x-dosexec"},
+	{[]byte("\xca\xfe\xba\xbe"), "application/x-mach-binary"},
+	{[]byte("\xcf\xfa\xed\xfe"), "application/x-mach-binary"},
+	{[]byte("\xfe\xed\xfa\xcf"), "application/x-mach-binary"},
+	{[]byte("#!"), "text/x-shellscript"},
+	{[]byte("7z\xbc\xaf\x27\x1c"), "application/x-7z-compressed"},
+	{[]byte("BZh"), "application/x-bzip2"},
+	{[]byte("\xfd7zXZ\x00"), "application/x-xz"},
+	{[]byte("\x28\xb5\x2f\xfd"), "application/zstd"},
+}
+
+// DetectType returns the mime type of the data.
+func DetectType(data []byte) string {
+	for _, m := range magic {
+		if bytes.HasPrefix(data, m.prefix) {
+			return m.mime
+		}
+	}
+
+	return http.DetectContentType(data)
+}
@@ -0,0 +1,78 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package artifacts
+
+import (
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Enricher moves the payloads larger than the inline size from the events
+// into the store, replacing them with the hashes of the artifact. The
+// payloads are stored by the worker of the store, the events don't wait for
+// the ssdeep hash and the disk.
+type Enricher struct {
+	*Store
+}
+
+// NewEnricher returns an enricher for the store.
+func NewEnricher(s *Store) *Enricher {
+	return &Enricher{s}
+}
+
+// Enrich implements enrichers.Enricher.
+func (en *Enricher) Enrich(e event.Event) error {
+	data, ok := e.GetPayload()
+	if !ok || len(data) <= en.InlineSize {
+		return nil
+	}
+
+	o := Origin{}
+	o.Session, _ = e.GetString("session-id")
+	o.Source, _ = e.GetString("source-ip")
+	o.Name, _ = e.GetString("http.url")
+
+	a, err := en.Queue(data, o)
+	if err != nil {
+		// the payload stays in the event
+		log.Warningf("Could not store artifact %s (%d bytes): %s", a.SHA256, a.Size, err.Error())
+		return nil
+	}
+
+	e.Delete("payload")
+	e.Delete("payload-hex")
+
+	e.Store("artifact.sha256", a.SHA256)
+	e.Store("artifact.sha1", a.SHA1)
+	e.Store("artifact.md5", a.MD5)
+	e.Store("artifact.size", a.Size)
+	e.Store("artifact.mime", a.MIME)
+	return nil
+}
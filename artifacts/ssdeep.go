@@ -0,0 +1,156 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package artifacts
+
+const (
+	spamsumLength = 64
+	minBlockSize  = 3
+	rollingWindow = 7
+
+	hashPrime = 0x01000193
+	hashInit  = 0x28021967
+
+	b64 = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+type rollingHash struct {
+	window     [rollingWindow]byte
+	h1, h2, h3 uint32
+	n          uint32
+}
+
+func (r *rollingHash) roll(c byte) uint32 {
+	r.h2 -= r.h1
+	r.h2 += rollingWindow * uint32(c)
+
+	r.h1 += uint32(c)
+	r.h1 -= uint32(r.window[r.n%rollingWindow])
+
+	r.window[r.n%rollingWindow] = c
+	r.n++
+
+	r.h3 <<= 5
+	r.h3 ^= uint32(c)
+
+	return r.h1 + r.h2 + r.h3
+}
+
+func sumHash(c byte, h uint32) uint32 {
+	return (h * hashPrime) ^ uint32(c)
+}
+
+// SSDeep returns the context triggered piecewise hash of the data, in the
+// format of ssdeep: blocksize:hash:hash.
+func SSDeep(data []byte) string {
+	blockSize := uint32(minBlockSize)
+	for blockSize*spamsumLength < uint32(len(data)) {
+		blockSize *= 2
+	}
+
+	for {
+		var (
+			roll   rollingHash
+			h      uint32
+			p1, p2 []byte
+		)
+
+		h1, h2 := uint32(hashInit), uint32(hashInit)
+
+		for _, c := range data {
+			h = roll.roll(c)
+
+			h1 = sumHash(c, h1)
+			h2 = sumHash(c, h2)
+
+			if h%blockSize == blockSize-1 {
+				// the last character is replaced until the end
+				if len(p1) < spamsumLength-1 {
+					p1 = append(p1, b64[h1%64])
+					h1 = hashInit
+				} else if len(p1) == spamsumLength-1 {
+					p1 = append(p1, b64[h1%64])
+				} else {
+					p1[spamsumLength-1] = b64[h1%64]
+				}
+			}
+
+			if h%(blockSize*2) == blockSize*2-1 {
+				if len(p2) < spamsumLength/2-1 {
+					p2 = append(p2, b64[h2%64])
+					h2 = hashInit
+				} else if len(p2) == spamsumLength/2-1 {
+					p2 = append(p2, b64[h2%64])
+				} else {
+					p2[spamsumLength/2-1] = b64[h2%64]
+				}
+			}
+		}
+
+		// the block size is too large when the hash is too short
+		short := len(p1) < spamsumLength/2
+
+		if h != 0 {
+			p1 = appendLast(p1, b64[h1%64], spamsumLength)
+			p2 = appendLast(p2, b64[h2%64], spamsumLength/2)
+		}
+
+		if blockSize > minBlockSize && short {
+			blockSize /= 2
+			continue
+		}
+
+		return itoa(blockSize) + ":" + string(p1) + ":" + string(p2)
+	}
+}
+
+// appendLast sets the character following the hash, or replaces the last
+// character when the hash has its maximum length.
+func appendLast(p []byte, c byte, max int) []byte {
+	if len(p) < max {
+		return append(p, c)
+	}
+
+	p[max-1] = c
+	return p
+}
+
+func itoa(n uint32) string {
+	if n == 0 {
+		return "0"
+	}
+
+	buf := []byte{}
+	for ; n > 0; n /= 10 {
+		buf = append([]byte{byte('0' + n%10)}, buf...)
+	}
+
+	return string(buf)
+}
@@ -0,0 +1,593 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package artifacts
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/zstd"
+	"github.com/honeytrap/honeytrap/storage"
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:artifacts")
+
+var (
+	// ErrNotFound is returned for unknown artifacts.
+	ErrNotFound = errors.New("artifact not found")
+
+	// ErrQuota is returned when the artifact would exceed the size of the
+	// store.
+	ErrQuota = errors.New("artifact store full")
+
+	// ErrTooLarge is returned for artifacts larger than the maximum
+	// artifact size.
+	ErrTooLarge = errors.New("artifact too large")
+
+	// ErrBusy is returned when too many artifacts are queued.
+	ErrBusy = errors.New("artifact queue full")
+)
+
+// maxRefs limits the number of sessions, sources and names kept per
+// artifact.
+const maxRefs = 100
+
+// queueSize is the number of artifacts queued for storing.
+const queueSize = 16
+
+// Config contains the configuration of the artifact store.
+type Config struct {
+	Enabled bool `toml:"enabled"`
+
+	Path            string `toml:"path"`
+	MaxSize         int64  `toml:"max-size"`
+	MaxArtifactSize int64  `toml:"max-artifact-size"`
+	// Compression is none, zstd or gzip
+	Compression string `toml:"compression"`
+
+	// InlineSize is the size of payloads which are kept in the events,
+	// larger payloads are stored
+	InlineSize int `toml:"inline-size"`
+}
+
+// DefaultConfig contains the default configuration, the artifacts are
+// stored in the honeytrap home dir.
+var DefaultConfig = Config{
+	MaxSize:         10 * 1024 * 1024 * 1024,
+	MaxArtifactSize: 64 * 1024 * 1024,
+	Compression:     "none",
+	InlineSize:      1024,
+}
+
+// Validate returns an error when the configuration is invalid.
+func (c Config) Validate() error {
+	switch c.Compression {
+	case "", "none", "zstd", "gzip":
+	default:
+		return fmt.Errorf("invalid compression %q, expected zstd, gzip or none", c.Compression)
+	}
+
+	if c.MaxSize <= 0 {
+		return fmt.Errorf("invalid max-size %d", c.MaxSize)
+	} else if c.MaxArtifactSize <= 0 {
+		return fmt.Errorf("invalid max-artifact-size %d", c.MaxArtifactSize)
+	} else if c.InlineSize < 0 {
+		return fmt.Errorf("invalid inline-size %d", c.InlineSize)
+	}
+
+	return nil
+}
+
+// Dir returns the directory of the store.
+func (c Config) Dir() string {
+	if c.Path != "" {
+		return c.Path
+	}
+
+	return filepath.Join(storage.HomeDir(), "artifacts")
+}
+
+// Artifact contains the metadata of a stored artifact.
+type Artifact struct {
+	SHA256 string `json:"sha256"`
+	SHA1   string `json:"sha1"`
+	MD5    string `json:"md5"`
+	SSDeep string `json:"ssdeep"`
+
+	Size int64  `json:"size"`
+	MIME string `json:"mime"`
+
+	// Compression of the stored artifact, and the size on disk
+	Compression string `json:"compression"`
+	StoredSize  int64  `json:"stored-size"`
+
+	FirstSeen time.Time `json:"first-seen"`
+	LastSeen  time.Time `json:"last-seen"`
+	Count     int       `json:"count"`
+
+	// Sessions, Sources and Names contain the session ids, source
+	// addresses and names (like urls) the artifact has been seen with
+	Sessions []string `json:"sessions"`
+	Sources  []string `json:"sources"`
+	Names    []string `json:"names"`
+}
+
+// Origin describes where an artifact has been seen.
+type Origin struct {
+	Session string
+	Source  string
+	Name    string
+}
+
+func addRef(refs []string, s string) []string {
+	if s == "" || len(refs) >= maxRefs {
+		return refs
+	}
+
+	for _, ref := range refs {
+		if ref == s {
+			return refs
+		}
+	}
+
+	return append(refs, s)
+}
+
+func (a *Artifact) seen(o Origin, t time.Time) {
+	if a.FirstSeen.IsZero() {
+		a.FirstSeen = t
+	}
+
+	a.LastSeen = t
+	a.Count++
+
+	a.Sessions = addRef(a.Sessions, o.Session)
+	a.Sources = addRef(a.Sources, o.Source)
+	a.Names = addRef(a.Names, o.Name)
+}
+
+// Hashes returns the artifact metadata with the hashes of data.
+func Hashes(data []byte) *Artifact {
+	a := digest(data)
+	a.SSDeep = SSDeep(data)
+	return a
+}
+
+// digest returns the artifact metadata with the hashes of data, except for
+// the ssdeep hash.
+func digest(data []byte) *Artifact {
+	md5sum := md5.Sum(data)
+	sha1sum := sha1.Sum(data)
+	sha256sum := sha256.Sum256(data)
+
+	return &Artifact{
+		SHA256:   hex.EncodeToString(sha256sum[:]),
+		SHA1:     hex.EncodeToString(sha1sum[:]),
+		MD5:      hex.EncodeToString(md5sum[:]),
+		Size:     int64(len(data)),
+		MIME:     DetectType(data),
+		Sessions: []string{},
+		Sources:  []string{},
+		Names:    []string{},
+	}
+}
+
+// Stats contains the counters of the store.
+type Stats struct {
+	Count    int    `json:"count"`
+	Size     int64  `json:"size"`
+	MaxSize  int64  `json:"max-size"`
+	Rejected uint64 `json:"rejected"`
+}
+
+// Store stores artifacts by their sha256 hash, every artifact is stored
+// once. The metadata is stored next to the artifact.
+type Store struct {
+	Config
+
+	m sync.Mutex
+
+	dir string
+
+	count    int
+	size     int64
+	rejected uint64
+
+	// reserved is the size of the queued artifacts
+	reserved int64
+
+	queue chan queued
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// queued is an artifact waiting to be stored, its size is reserved.
+type queued struct {
+	a    *Artifact
+	data []byte
+	o    Origin
+}
+
+var sha256Regexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Open opens the store in the directory of the configuration, and counts
+// the size of the stored artifacts.
+func Open(c Config) (*Store, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		Config: c,
+		dir:    c.Dir(),
+		queue:  make(chan queued, queueSize),
+		done:   make(chan struct{}),
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+
+	artifacts, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range artifacts {
+		s.count++
+		s.size += a.StoredSize
+	}
+
+	log.Infof("Opened artifact store %s, %d artifacts (%d bytes)", s.dir, s.count, s.size)
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s, nil
+}
+
+// run stores the queued artifacts.
+func (s *Store) run() {
+	defer s.wg.Done()
+
+	store := func(q queued) {
+		q.a.SSDeep = SSDeep(q.data)
+
+		if _, err := s.put(q.a, q.data, q.o, q.a.Size); err != nil {
+			log.Errorf("Could not store artifact %s (%d bytes): %s", q.a.SHA256, q.a.Size, err.Error())
+		}
+	}
+
+	for {
+		select {
+		case q := <-s.queue:
+			store(q)
+		case <-s.done:
+			// store the artifacts queued already
+			for {
+				select {
+				case q := <-s.queue:
+					store(q)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Close stores the queued artifacts.
+func (s *Store) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Store) path(sha256 string) string {
+	return filepath.Join(s.dir, sha256[:2], sha256)
+}
+
+// writeFile writes the file atomically.
+func writeFile(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
+
+func (s *Store) saveMeta(a *Artifact) error {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(s.path(a.SHA256)+".json", data)
+}
+
+func (s *Store) loadMeta(sha256 string) (*Artifact, error) {
+	data, err := ioutil.ReadFile(s.path(sha256) + ".json")
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	a := &Artifact{}
+	if err := json.Unmarshal(data, a); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func compress(data []byte, compression string) ([]byte, error) {
+	switch compression {
+	case "zstd":
+		return zstd.Compress(nil, data)
+	case "gzip":
+		buf := &bytes.Buffer{}
+
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		} else if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	default:
+		return data, nil
+	}
+}
+
+// Queue queues the data to be stored, and returns the hashes of the
+// artifact, without the ssdeep hash. The size of the data is reserved, an
+// error is returned when the artifact would exceed the limits or too many
+// artifacts are queued. The ssdeep hash, compression and writing are done
+// by the worker of the store, the caller doesn't wait for these.
+func (s *Store) Queue(data []byte, o Origin) (*Artifact, error) {
+	a := digest(data)
+
+	s.m.Lock()
+
+	if a.Size > s.MaxArtifactSize {
+		s.rejected++
+		s.m.Unlock()
+		return a, ErrTooLarge
+	} else if s.size+s.reserved+a.Size > s.MaxSize {
+		s.rejected++
+		s.m.Unlock()
+		return a, ErrQuota
+	}
+
+	s.reserved += a.Size
+
+	s.m.Unlock()
+
+	select {
+	case s.queue <- queued{a, data, o}:
+		return a, nil
+	default:
+	}
+
+	s.m.Lock()
+	s.reserved -= a.Size
+	s.rejected++
+	s.m.Unlock()
+
+	return a, ErrBusy
+}
+
+// Put stores the data, artifacts which have been stored before only get
+// their metadata updated.
+func (s *Store) Put(data []byte, o Origin) (*Artifact, error) {
+	return s.put(Hashes(data), data, o, 0)
+}
+
+// put stores the artifact, and releases the reserved size.
+func (s *Store) put(a *Artifact, data []byte, o Origin, reserved int64) (*Artifact, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.reserved -= reserved
+
+	now := time.Now()
+
+	if existing, err := s.loadMeta(a.SHA256); err == nil {
+		existing.seen(o, now)
+		return existing, s.saveMeta(existing)
+	} else if err != ErrNotFound {
+		return nil, err
+	}
+
+	if a.Size > s.MaxArtifactSize {
+		s.rejected++
+		return a, ErrTooLarge
+	}
+
+	compression := s.Compression
+	if compression == "" {
+		compression = "none"
+	}
+
+	stored, err := compress(data, compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.size+s.reserved+int64(len(stored)) > s.MaxSize {
+		s.rejected++
+		return a, ErrQuota
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path(a.SHA256)), 0700); err != nil {
+		return nil, err
+	}
+
+	if err := writeFile(s.path(a.SHA256), stored); err != nil {
+		return nil, err
+	}
+
+	a.Compression = compression
+	a.StoredSize = int64(len(stored))
+	a.seen(o, now)
+
+	if err := s.saveMeta(a); err != nil {
+		os.Remove(s.path(a.SHA256))
+		return nil, err
+	}
+
+	s.count++
+	s.size += a.StoredSize
+
+	return a, nil
+}
+
+// Stat returns the metadata of the artifact.
+func (s *Store) Stat(sha256 string) (*Artifact, error) {
+	sha256 = strings.ToLower(sha256)
+	if !sha256Regexp.MatchString(sha256) {
+		return nil, ErrNotFound
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.loadMeta(sha256)
+}
+
+type readCloser struct {
+	io.Reader
+
+	closers []io.Closer
+}
+
+func (rc readCloser) Close() error {
+	for _, c := range rc.closers {
+		c.Close()
+	}
+
+	return nil
+}
+
+// Open returns the metadata and the contents of the artifact.
+func (s *Store) Open(sha256 string) (*Artifact, io.ReadCloser, error) {
+	a, err := s.Stat(sha256)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(s.path(a.SHA256))
+	if os.IsNotExist(err) {
+		return nil, nil, ErrNotFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	switch a.Compression {
+	case "zstd":
+		r := zstd.NewReader(f)
+		return a, readCloser{r, []io.Closer{r, f}}, nil
+	case "gzip":
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+
+		return a, readCloser{r, []io.Closer{r, f}}, nil
+	default:
+		return a, f, nil
+	}
+}
+
+// List returns the metadata of the artifacts, the last seen first.
+func (s *Store) List() ([]*Artifact, error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := []*Artifact{}
+
+	for _, name := range names {
+		sha256 := strings.TrimSuffix(filepath.Base(name), ".json")
+		if !sha256Regexp.MatchString(sha256) {
+			continue
+		}
+
+		a, err := s.loadMeta(sha256)
+		if err != nil {
+			log.Errorf("Error reading metadata of artifact %s: %s", sha256, err.Error())
+			continue
+		}
+
+		artifacts = append(artifacts, a)
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].LastSeen.After(artifacts[j].LastSeen)
+	})
+
+	return artifacts, nil
+}
+
+// Stats returns the counters of the store.
+func (s *Store) Stats() Stats {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return Stats{
+		Count:    s.count,
+		Size:     s.size,
+		MaxSize:  s.MaxSize,
+		Rejected: s.rejected,
+	}
+}
@@ -0,0 +1,236 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package artifacts
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func TestSSDeep(t *testing.T) {
+	if s := SSDeep(nil); s != "3::" {
+		t.Errorf("Expected 3:: for empty input, got %s", s)
+	}
+
+	data := bytes.Repeat([]byte("honeytrap ssdeep test data, "), 4096)
+
+	parts := strings.Split(SSDeep(data), ":")
+	if len(parts) != 3 {
+		t.Fatalf("Expected blocksize:hash:hash, got %v", parts)
+	} else if parts[0] == "3" {
+		t.Errorf("Expected the blocksize to grow with the input")
+	} else if len(parts[1]) == 0 || len(parts[1]) > 64 {
+		t.Errorf("Expected a hash of at most 64 characters, got %q", parts[1])
+	}
+
+	if SSDeep(data) != SSDeep(append([]byte{}, data...)) {
+		t.Errorf("Expected ssdeep to be deterministic")
+	}
+
+	// known answers for pseudo random data, from the reference results of
+	// github.com/glaslos/ssdeep
+	r := rand.New(rand.NewSource(1))
+
+	for _, v := range []struct {
+		size     int
+		expected string
+	}{
+		{4097, "96:yNDH/iNQaSXRLmOSxu1aQP4iWgC8JbkiA5Ix:yNLaNQhSxEgVYkiA5Ix"},
+		{45056, "768:mlHmRZnCRFRwSuK/UiwY37TMbsDEsb1Jqi6dcXoWpKXIUxpQDOAvWpPK:mqhCJwjmJD31DzbDwd+oGo9AvOi"},
+		{86016, "1536:Jdr3F6yZG0agLg/b6G6REjI+WUhWDKRSpzKjSUT4plmjvX6ex7RwdsHIGV:PrVbZG0BuuGzc+WcdRilmbPx7RwGV"},
+		{126976, "3072:pwP2ZmVLsvDAyshOZIzFkGxIE++3ysSsZCj3JwAjpn:ps2/DAyKIaRyE++RSsUj3JwaJ"},
+	} {
+		data := make([]byte, v.size)
+		r.Read(data)
+
+		if s := SSDeep(data); s != v.expected {
+			t.Errorf("Expected %s for %d bytes, got %s", v.expected, v.size, s)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	c := DefaultConfig
+	c.Path = dir
+	c.Compression = "gzip"
+	c.MaxArtifactSize = 4096
+
+	s, err := Open(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := append([]byte("\x7fELF"), bytes.Repeat([]byte{0x90}, 2000)...)
+
+	a, err := s.Put(data, Origin{Session: "a", Source: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	} else if a.MIME != "application/x-executable" {
+		t.Errorf("Expected elf mime type, got %s", a.MIME)
+	}
+
+	if _, err := s.Put(data, Origin{Session: "b", Source: "192.0.2.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Put(make([]byte, 8192), Origin{}); err != ErrTooLarge {
+		t.Errorf("Expected artifact to be too large, got %v", err)
+	}
+
+	// reopen, the counters are restored from disk
+	s, err = Open(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := s.Stats(); stats.Count != 1 || stats.Size != a.StoredSize {
+		t.Errorf("Expected 1 artifact of %d bytes, got %+v", a.StoredSize, stats)
+	}
+
+	meta, rc, err := s.Open(a.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rc.Close()
+
+	if got, _ := ioutil.ReadAll(rc); !bytes.Equal(got, data) {
+		t.Errorf("Expected artifact to equal the stored data")
+	} else if meta.Count != 2 || len(meta.Sessions) != 2 || len(meta.Sources) != 1 {
+		t.Errorf("Expected 2 sightings in 2 sessions from 1 source, got %+v", meta)
+	}
+
+	if _, err := s.Stat("../../etc/passwd"); err != ErrNotFound {
+		t.Errorf("Expected invalid hash to be not found, got %v", err)
+	}
+
+	e := event.New(event.Payload(data))
+	if err := NewEnricher(s).Enrich(e); err != nil {
+		t.Fatal(err)
+	} else if e.Has("payload") || e.Get("artifact.sha256") != a.SHA256 {
+		t.Errorf("Expected payload to be replaced with the artifact")
+	}
+
+	// queued payloads are stored by the worker, with the ssdeep hash
+	queued := append([]byte("MZ"), bytes.Repeat([]byte{0xcc}, 3000)...)
+
+	e = event.New(event.Payload(queued))
+	if err := NewEnricher(s).Enrich(e); err != nil {
+		t.Fatal(err)
+	} else if e.Has("payload") {
+		t.Errorf("Expected payload to be replaced with the artifact")
+	}
+
+	s.Close()
+
+	if meta, err := s.Stat(e.Get("artifact.sha256")); err != nil {
+		t.Fatal(err)
+	} else if meta.SSDeep != SSDeep(queued) || meta.Count != 1 {
+		t.Errorf("Expected the queued artifact to be stored with its ssdeep hash, got %+v", meta)
+	}
+
+	if _, err := s.Queue(make([]byte, 8192), Origin{}); err != ErrTooLarge {
+		t.Errorf("Expected queued artifact to be too large, got %v", err)
+	}
+
+	e = event.New(event.Payload([]byte("small")))
+	if err := NewEnricher(s).Enrich(e); err != nil {
+		t.Fatal(err)
+	} else if !e.Has("payload") || e.Has("artifact.sha256") {
+		t.Errorf("Expected small payload to stay inline")
+	}
+}
+
+func TestStoreCompression(t *testing.T) {
+	data := bytes.Repeat([]byte("GET /shell.php HTTP/1.1\r\n"), 100)
+
+	for _, compression := range []string{"none", "zstd", "gzip"} {
+		dir, err := ioutil.TempDir("", "artifacts")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer os.RemoveAll(dir)
+
+		c := DefaultConfig
+		c.Path = dir
+		c.Compression = compression
+
+		s, err := Open(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer s.Close()
+
+		a, err := s.Put(data, Origin{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if compression == "none" && a.StoredSize != int64(len(data)) {
+			t.Errorf("%s: expected %d bytes stored, got %d", compression, len(data), a.StoredSize)
+		} else if compression != "none" && a.StoredSize >= int64(len(data)) {
+			t.Errorf("%s: expected compressed artifact, got %d bytes", compression, a.StoredSize)
+		}
+
+		_, rc, err := s.Open(a.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, _ := ioutil.ReadAll(rc); !bytes.Equal(got, data) {
+			t.Errorf("%s: expected artifact to equal the stored data", compression)
+		}
+
+		rc.Close()
+	}
+
+	c := DefaultConfig
+	c.Compression = "lz4"
+
+	if err := c.Validate(); err == nil {
+		t.Error("Expected unknown compression to be invalid")
+	}
+}
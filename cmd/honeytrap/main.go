@@ -33,13 +33,23 @@ package honeytrap
 import (
 	"context"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/BurntSushi/toml"
 	"github.com/fatih/color"
+	"github.com/honeytrap/honeytrap/artifacts"
 	"github.com/honeytrap/honeytrap/cmd"
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/director"
+	"github.com/honeytrap/honeytrap/enrichers"
 	"github.com/honeytrap/honeytrap/listener"
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/honeytrap/honeytrap/server"
@@ -83,6 +93,8 @@ var globalFlags = []cli.Flag{
 	cli.BoolFlag{Name: "list-services", Usage: "List the available services"},
 	cli.BoolFlag{Name: "list-channels", Usage: "List the available channels"},
 	cli.BoolFlag{Name: "list-listeners", Usage: "List the available listeners"},
+	cli.BoolFlag{Name: "list-directors", Usage: "List the available directors"},
+	cli.BoolFlag{Name: "list-enrichers", Usage: "List the available enrichers"},
 }
 
 // Cmd defines a struct for defining a command.
@@ -122,31 +134,31 @@ func serve(c *cli.Context) error {
 
 	// enumerate the available services
 	if c.GlobalBool("list-services") {
-		fmt.Println("services")
-		fmt.Println("=======")
-		services.Range(func(name string) {
-			fmt.Printf("* %s\n", name)
-		})
+		list("services", services.Range, services.Description)
 		return nil
 	}
 
 	// enumerate the available channels
 	if c.GlobalBool("list-channels") {
-		fmt.Println("channels")
-		fmt.Println("=======")
-		pushers.Range(func(name string) {
-			fmt.Printf("* %s\n", name)
-		})
+		list("channels", pushers.Range, pushers.Description)
 		return nil
 	}
 
 	// enumerate the available listeners
 	if c.GlobalBool("list-listeners") {
-		fmt.Println("listeners")
-		fmt.Println("=======")
-		listener.Range(func(name string) {
-			fmt.Printf("* %s\n", name)
-		})
+		list("listeners", listener.Range, listener.Description)
+		return nil
+	}
+
+	// enumerate the available directors
+	if c.GlobalBool("list-directors") {
+		list("directors", director.Range, director.Description)
+		return nil
+	}
+
+	// enumerate the available enrichers
+	if c.GlobalBool("list-enrichers") {
+		list("enrichers", enrichers.Range, enrichers.Description)
 		return nil
 	}
 
@@ -156,10 +168,17 @@ func serve(c *cli.Context) error {
 		s := make(chan os.Signal, 1)
 		signal.Notify(s, os.Interrupt)
 		signal.Notify(s, syscall.SIGTERM)
+		signal.Notify(s, syscall.SIGHUP)
 
-		select {
-		case <-s:
-			cancel()
+		for sig := range s {
+			if sig != syscall.SIGHUP {
+				cancel()
+				return
+			}
+
+			if err := srvr.Reload(); err != nil {
+				log.Errorf("Error reloading configuration: %s", err.Error())
+			}
 		}
 	}()
 
@@ -168,6 +187,235 @@ func serve(c *cli.Context) error {
 	return nil
 }
 
+// list prints the registered components with their description.
+func list(title string, rangeFn func(func(string)), describe func(string) (config.Description, bool)) {
+	fmt.Println(title)
+	fmt.Println("=======")
+
+	names := []string{}
+	rangeFn(func(name string) {
+		names = append(names, name)
+	})
+
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	for _, name := range names {
+		d, _ := describe(name)
+
+		if d.Port == "" {
+			fmt.Fprintf(w, "* %s\t%s\n", name, d.Description)
+		} else {
+			fmt.Fprintf(w, "* %s\t%s (%s)\n", name, d.Description, d.Port)
+		}
+	}
+}
+
+// describe prints the description and the configuration fields of the
+// components with the type given as argument.
+func describe(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.NewExitError("type not set", 1)
+	}
+
+	typ := c.Args().First()
+
+	registries := []struct {
+		kind     string
+		describe func(string) (config.Description, bool)
+	}{
+		{"service", services.Description},
+		{"channel", pushers.Description},
+		{"listener", listener.Description},
+		{"director", director.Description},
+		{"enricher", enrichers.Description},
+	}
+
+	found := false
+
+	for _, r := range registries {
+		d, ok := r.describe(typ)
+		if !ok {
+			continue
+		}
+
+		if found {
+			fmt.Println()
+		}
+
+		found = true
+
+		fmt.Printf("%s (%s)\n", color.YellowString(d.Name), r.kind)
+
+		if d.Description != "" {
+			fmt.Println(d.Description)
+		}
+
+		if d.Port != "" {
+			fmt.Printf("Port: %s\n", d.Port)
+		}
+
+		if len(d.Platforms) > 0 {
+			fmt.Printf("Platforms: %s\n", strings.Join(d.Platforms, ", "))
+		}
+
+		fmt.Println()
+
+		fields := d.Fields()
+		if len(fields) == 0 {
+			fmt.Println("No configuration options.")
+			continue
+		}
+
+		fmt.Println("Options:")
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "  NAME\tTYPE\tDEFAULT\tDESCRIPTION")
+
+		for _, f := range fields {
+			doc := f.Doc
+			if f.Required {
+				doc += " (required)"
+			}
+
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", f.Name, f.Type, f.Default, strings.TrimSpace(doc))
+		}
+
+		w.Flush()
+	}
+
+	if !found {
+		return cli.NewExitError(fmt.Sprintf("type %s not found", typ), 1)
+	}
+
+	return nil
+}
+
+// configFile returns the configuration file given as argument, or with the
+// global config flag.
+func configFile(c *cli.Context) string {
+	if c.NArg() > 0 {
+		return c.Args().First()
+	}
+
+	return c.GlobalString("config")
+}
+
+func validate(c *cli.Context) error {
+	f, err := os.Open(configFile(c))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	defer f.Close()
+
+	errs := server.Validate(f)
+	for _, err := range errs {
+		fmt.Println(color.RedString(err.Error()))
+	}
+
+	if len(errs) > 0 {
+		return cli.NewExitError(fmt.Sprintf("%s: %d problems found", f.Name(), len(errs)), 1)
+	}
+
+	fmt.Println(color.GreenString("%s: configuration valid", f.Name()))
+	return nil
+}
+
+func dump(c *cli.Context) error {
+	f, err := os.Open(configFile(c))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	defer f.Close()
+
+	if err := server.Dump(f, os.Stdout); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// openArtifacts opens the artifact store of the configuration.
+func openArtifacts(c *cli.Context) (*artifacts.Store, error) {
+	conf := config.Config{}
+	if _, err := toml.DecodeFile(c.GlobalString("config"), &conf); err != nil {
+		return nil, err
+	}
+
+	ac := artifacts.DefaultConfig
+	if err := toml.PrimitiveDecode(conf.Artifacts, &ac); err != nil {
+		return nil, err
+	}
+
+	return artifacts.Open(ac)
+}
+
+func listArtifacts(c *cli.Context) error {
+	store, err := openArtifacts(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	list, err := store.List()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "SHA256\tSIZE\tMIME\tCOUNT\tLAST SEEN")
+
+	for _, a := range list {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%s\n", a.SHA256, a.Size, a.MIME, a.Count, a.LastSeen.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// getArtifact writes the artifact to stdout, or to the file given with the
+// output flag.
+func getArtifact(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.NewExitError("sha256 not set", 1)
+	}
+
+	store, err := openArtifacts(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	_, rc, err := store.Open(c.Args().First())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	defer rc.Close()
+
+	var w io.Writer = os.Stdout
+
+	if name := c.String("output"); name != "" {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		defer f.Close()
+
+		w = f
+	}
+
+	if _, err := io.Copy(w, rc); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	return nil
+}
+
 func New() *cli.App {
 	cli.VersionPrinter = func(c *cli.Context) {
 		fmt.Fprintf(c.App.Writer,
@@ -184,7 +432,52 @@ Commit-ID: %s
 	app.Flags = globalFlags
 	app.Description = `honeytrap: The honeypot server.`
 	app.CustomAppHelpTemplate = helpTemplate
-	app.Commands = []cli.Command{}
+	app.Commands = []cli.Command{
+		{
+			Name:      "validate",
+			Usage:     "Validate the configuration",
+			ArgsUsage: "[FILE]",
+			Action:    validate,
+		},
+		{
+			Name:      "describe",
+			Usage:     "Describe a service, channel, listener, director or enricher and its options",
+			ArgsUsage: "TYPE",
+			Action:    describe,
+		},
+		{
+			Name:  "config",
+			Usage: "Configuration commands",
+			Subcommands: []cli.Command{
+				{
+					Name:      "dump",
+					Usage:     "Print the effective configuration, with defaults",
+					ArgsUsage: "[FILE]",
+					Action:    dump,
+				},
+			},
+		},
+		{
+			Name:  "artifacts",
+			Usage: "Artifact store commands",
+			Subcommands: []cli.Command{
+				{
+					Name:   "list",
+					Usage:  "List the stored artifacts",
+					Action: listArtifacts,
+				},
+				{
+					Name:      "get",
+					Usage:     "Write the contents of an artifact",
+					ArgsUsage: "SHA256",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "output, o", Usage: "Write the artifact to `FILE`"},
+					},
+					Action: getArtifact,
+				},
+			},
+		},
+	}
 	app.Before = func(c *cli.Context) error {
 		return nil
 	}
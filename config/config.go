@@ -58,26 +58,86 @@ type Config struct {
 
 	Filters []toml.Primitive `toml:"filter"`
 
+	// Enrichers are applied in order, before events are delivered to the
+	// channels
+	Enrichers []toml.Primitive `toml:"enricher"`
+
+	Limits toml.Primitive `toml:"limits"`
+
+	// Queue configures the queue of the events to the enrichers, before
+	// these are queued for the channels
+	Queue toml.Primitive `toml:"queue"`
+
+	// Artifacts configures the store for payloads and downloaded files
+	Artifacts toml.Primitive `toml:"artifacts"`
+
+	// Profiles configures the aggregation of the events per attacker
+	Profiles toml.Primitive `toml:"profiles"`
+
+	// Credentials configures the tracking of the credentials of logins
+	Credentials toml.Primitive `toml:"credentials"`
+
+	// Web configures the web interface and its api
+	Web toml.Primitive `toml:"web"`
+
+	// GracePeriod is the time active sessions get to finish on shutdown
+	GracePeriod Delay `toml:"grace-period"`
+
 	Logging []struct {
 		Output string `toml:"output"`
 		Level  string `toml:"level"`
 	} `toml:"logging"`
+
+	backends []logging.Backend
+
+	// outputs contains the opened logging files
+	outputs []*os.File
 }
 
 // DefaultConfig defines the default Config to be used to set default values.
 var Default = Config{}
 
-// Load attempts to load the giving toml configuration file.
+// Load attempts to load the giving toml configuration file, and sets the
+// logging backends.
 func (c *Config) Load(r io.Reader) error {
+	if err := c.Parse(r); err != nil {
+		return err
+	}
+
+	if err := c.OpenLogging(); err != nil {
+		return err
+	}
+
+	logging.SetBackend(c.backends...)
+
+	return nil
+}
+
+// Parse parses the toml configuration file and checks the logging levels,
+// without opening the logging outputs. A reload opens them once the
+// configuration has been accepted.
+func (c *Config) Parse(r io.Reader) error {
 	_, err := toml.DecodeReader(r, c)
 	if err != nil {
 		return err
 	}
 
-	logBackends := []logging.Backend{}
 	for _, log := range c.Logging {
-		var err error
+		if _, err := logging.LogLevel(log.Level); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OpenLogging opens the logging outputs and prepares the logging backends,
+// without setting them.
+func (c *Config) OpenLogging() error {
+	logBackends := []logging.Backend{}
+	outputs := []*os.File{}
 
+	for _, log := range c.Logging {
 		var output io.Writer
 
 		switch log.Output {
@@ -86,28 +146,47 @@ func (c *Config) Load(r io.Reader) error {
 		case "stderr":
 			output = os.Stderr
 		default:
-			output, err = os.OpenFile(os.ExpandEnv(log.Output), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0660)
-		}
+			f, err := os.OpenFile(os.ExpandEnv(log.Output), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0660)
+			if err != nil {
+				for _, f := range outputs {
+					f.Close()
+				}
 
-		if err != nil {
-			panic(err)
+				return err
+			}
+
+			outputs = append(outputs, f)
+			output = f
 		}
 
 		backend := logging.NewLogBackend(output, "", 0)
 		backendFormatter := logging.NewBackendFormatter(backend, format)
 		backendLeveled := logging.AddModuleLevel(backendFormatter)
 
-		level, err := logging.LogLevel(log.Level)
-		if err != nil {
-			panic(err)
-		}
-
+		// the level has been checked by Parse
+		level, _ := logging.LogLevel(log.Level)
 		backendLeveled.SetLevel(level, "")
 
 		logBackends = append(logBackends, backendLeveled)
 	}
 
-	logging.SetBackend(logBackends...)
+	c.backends = logBackends
+	c.outputs = outputs
 
 	return nil
 }
+
+// CloseLogging closes the logging files, after the backends have been
+// replaced.
+func (c *Config) CloseLogging() {
+	for _, f := range c.outputs {
+		f.Close()
+	}
+
+	c.outputs = nil
+}
+
+// LoggingBackends returns the configured logging backends.
+func (c *Config) LoggingBackends() []logging.Backend {
+	return append([]logging.Backend{}, c.backends...)
+}
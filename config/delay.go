@@ -53,3 +53,8 @@ func (t *Delay) UnmarshalText(text []byte) error {
 	*t = Delay(d)
 	return nil
 }
+
+// MarshalText returns the duration as text, like 1m30s.
+func (t Delay) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(t).String()), nil
+}
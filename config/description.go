@@ -0,0 +1,218 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Description describes a component (service, director, listener or
+// channel) and its configuration.
+type Description struct {
+	Name        string
+	Description string
+
+	// Port is the default port of a service, like TCP/22
+	Port string
+
+	// Platforms contains the platforms the component supports, all
+	// platforms when empty
+	Platforms []string
+
+	// Config returns the configuration struct of the component, with the
+	// defaults set. Fields are described with the toml, doc, required and
+	// secret tags.
+	Config func() interface{}
+}
+
+// Field describes a configuration field.
+type Field struct {
+	Name     string
+	Type     string
+	Default  string
+	Required bool
+	Doc      string
+
+	// Secret fields, like tokens and passwords, are redacted from the
+	// dumped configuration
+	Secret bool
+}
+
+// Fields returns the configuration fields of the component.
+func (d Description) Fields() []Field {
+	if d.Config == nil {
+		return []Field{}
+	}
+
+	return Fields(d.Config())
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func typeName(t reflect.Type) (string, bool) {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		if t == reflect.TypeOf(Delay(0)) {
+			return "duration", true
+		}
+
+		return "string", true
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string", true
+	case reflect.Bool:
+		return "bool", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int", true
+	case reflect.Float32, reflect.Float64:
+		return "float", true
+	case reflect.Interface:
+		return "any", true
+	case reflect.Slice, reflect.Array:
+		if name, ok := typeName(t.Elem()); ok {
+			return "[]" + name, true
+		}
+	case reflect.Map:
+		if name, ok := typeName(t.Elem()); ok && t.Key().Kind() == reflect.String {
+			return "map[string]" + name, true
+		}
+	}
+
+	return "", false
+}
+
+func defaultValue(v reflect.Value) string {
+	if v.Kind() == reflect.Interface && v.IsNil() {
+		return ""
+	}
+
+	if isZero(v) {
+		return ""
+	}
+
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if text, err := m.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+
+	if v.Kind() == reflect.String {
+		return fmt.Sprintf("%q", v.String())
+	}
+
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+func fields(v reflect.Value) []Field {
+	result := []Field{}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+
+		tag := f.Tag.Get("toml")
+
+		// embedded configuration structs
+		if f.Anonymous && tag == "" {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+
+				fv = fv.Elem()
+			}
+
+			if fv.Kind() == reflect.Struct {
+				result = append(result, fields(fv)...)
+			}
+
+			continue
+		}
+
+		if f.PkgPath != "" || tag == "-" {
+			continue
+		}
+
+		typ, ok := typeName(f.Type)
+		if !ok {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+
+		result = append(result, Field{
+			Name:     name,
+			Type:     typ,
+			Default:  defaultValue(fv),
+			Required: f.Tag.Get("required") == "true",
+			Doc:      f.Tag.Get("doc"),
+			Secret:   f.Tag.Get("secret") == "true",
+		})
+	}
+
+	return result
+}
+
+// Fields returns the configuration fields of the struct v.
+func Fields(v interface{}) []Field {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return []Field{}
+		}
+
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return []Field{}
+	}
+
+	return fields(rv)
+}
@@ -0,0 +1,660 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package credentials
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:credentials")
+
+// keyPrefix is the prefix of the keys of the pairs in the backend.
+const keyPrefix = "credential/"
+
+// maxSources limits the number of sources kept per pair.
+const maxSources = 100
+
+// Config contains the configuration of the credential tracker.
+type Config struct {
+	Enabled bool `toml:"enabled"`
+
+	// Decoys contains planted credentials as username:password, a username
+	// of * matches every username
+	Decoys []string `toml:"decoys"`
+
+	// DecoyFiles contain a decoy per line
+	DecoyFiles []string `toml:"decoy-files"`
+
+	// ReplayMaxSources is the maximum number of sources of a pair to be
+	// considered for replay detection, pairs of wordlists are used by many
+	// sources
+	ReplayMaxSources int `toml:"replay-max-sources"`
+
+	SummaryInterval config.Delay `toml:"summary-interval"`
+	SummaryTop      int          `toml:"summary-top"`
+
+	FlushInterval config.Delay `toml:"flush-interval"`
+
+	// MaxPairs is the maximum number of pairs tracked
+	MaxPairs int `toml:"max-pairs"`
+}
+
+// DefaultConfig contains the default configuration.
+var DefaultConfig = Config{
+	Decoys:           []string{},
+	DecoyFiles:       []string{},
+	ReplayMaxSources: 3,
+	SummaryInterval:  config.Delay(time.Hour),
+	SummaryTop:       10,
+	FlushInterval:    config.Delay(10 * time.Second),
+	MaxPairs:         1000000,
+}
+
+// Validate returns an error when the configuration is invalid.
+func (c Config) Validate() error {
+	for _, d := range c.Decoys {
+		if !strings.Contains(d, ":") {
+			return fmt.Errorf("invalid decoy %q, expected username:password", d)
+		}
+	}
+
+	if c.ReplayMaxSources < 0 {
+		return fmt.Errorf("invalid replay-max-sources %d", c.ReplayMaxSources)
+	} else if c.SummaryTop <= 0 {
+		return fmt.Errorf("invalid summary-top %d", c.SummaryTop)
+	} else if c.FlushInterval.Duration() <= 0 {
+		return fmt.Errorf("invalid flush-interval %s", c.FlushInterval.Duration())
+	} else if c.MaxPairs <= 0 {
+		return fmt.Errorf("invalid max-pairs %d", c.MaxPairs)
+	}
+
+	return nil
+}
+
+// Backend persists the pairs, the storage package provides a backend.
+type Backend interface {
+	Set(key string, data []byte) error
+	Range(prefix string, fn func(key string, data []byte) bool) error
+}
+
+// Pair is a username and password pair, with the sources which used it.
+type Pair struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Count    int    `json:"count"`
+
+	FirstSeen time.Time `json:"first-seen"`
+	LastSeen  time.Time `json:"last-seen"`
+
+	FirstSource  string `json:"first-source"`
+	FirstService string `json:"first-service"`
+
+	// Sources contains the number of attempts per source, SourceCount the
+	// number of sources, which keeps counting when Sources is full
+	Sources     map[string]int `json:"sources"`
+	SourceCount int            `json:"source-count"`
+}
+
+func pairKey(username, password string) string {
+	return username + "\x00" + password
+}
+
+// Store tracks the credentials of the login attempts.
+type Store struct {
+	Config
+
+	backend Backend
+	c       pushers.Channel
+
+	// decoys contains the decoy pairs, with * as username for every
+	// username
+	decoys map[string]bool
+
+	m     sync.Mutex
+	pairs map[string]*Pair
+	dirty map[string]bool
+	full  bool
+
+	// flushing serializes the writes, these are done without holding m
+	flushing sync.Mutex
+
+	// counters of the summary interval
+	attempts int
+	newPairs int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// ReadDecoys returns the decoys of the file, a username:password per line.
+func ReadDecoys(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	decoys := []string{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		} else if !strings.Contains(line, ":") {
+			return nil, fmt.Errorf("%s: invalid decoy %q, expected username:password", name, line)
+		}
+
+		decoys = append(decoys, line)
+	}
+
+	return decoys, scanner.Err()
+}
+
+// Open returns the store of the backend, reading the stored pairs. Events
+// are sent to the channel.
+func Open(c Config, backend Backend, channel pushers.Channel) (*Store, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		Config:  c,
+		backend: backend,
+		c:       channel,
+		decoys:  map[string]bool{},
+		pairs:   map[string]*Pair{},
+		dirty:   map[string]bool{},
+		done:    make(chan struct{}),
+	}
+
+	decoys := append([]string{}, c.Decoys...)
+	for _, name := range c.DecoyFiles {
+		d, err := ReadDecoys(name)
+		if err != nil {
+			return nil, err
+		}
+
+		decoys = append(decoys, d...)
+	}
+
+	for _, d := range decoys {
+		parts := strings.SplitN(d, ":", 2)
+		s.decoys[pairKey(parts[0], parts[1])] = true
+	}
+
+	err := backend.Range(keyPrefix, func(key string, data []byte) bool {
+		p := &Pair{}
+		if err := json.Unmarshal(data, p); err != nil {
+			log.Errorf("Error reading credential %q: %s", key, err.Error())
+			return true
+		}
+
+		s.pairs[pairKey(p.Username, p.Password)] = p
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Tracking %d credentials, %d decoys", len(s.pairs), len(s.decoys))
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s, nil
+}
+
+func (s *Store) run() {
+	defer s.wg.Done()
+
+	flush := time.NewTicker(s.FlushInterval.Duration())
+	defer flush.Stop()
+
+	// a nil channel never fires, when the summaries are disabled
+	var summary <-chan time.Time
+	if d := s.SummaryInterval.Duration(); d > 0 {
+		t := time.NewTicker(d)
+		defer t.Stop()
+
+		summary = t.C
+	}
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-flush.C:
+			if err := s.Flush(); err != nil {
+				log.Errorf("Error writing credentials: %s", err.Error())
+			}
+		case <-summary:
+			s.c.Send(s.Summary())
+		}
+	}
+}
+
+// Flush writes the modified pairs to the backend. The pairs are written
+// without holding the lock, enriching events doesn't wait for the backend.
+func (s *Store) Flush() error {
+	s.flushing.Lock()
+	defer s.flushing.Unlock()
+
+	s.m.Lock()
+
+	snapshot := map[string][]byte{}
+	for key := range s.dirty {
+		data, err := json.Marshal(s.pairs[key])
+		if err != nil {
+			s.m.Unlock()
+			return err
+		}
+
+		snapshot[key] = data
+	}
+
+	s.dirty = map[string]bool{}
+
+	s.m.Unlock()
+
+	for key, data := range snapshot {
+		if err := s.backend.Set(keyPrefix+key, data); err != nil {
+			// written with the next flush
+			s.m.Lock()
+			for key := range snapshot {
+				s.dirty[key] = true
+			}
+			s.m.Unlock()
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close writes the modified pairs and stops the store.
+func (s *Store) Close() error {
+	close(s.done)
+	s.wg.Wait()
+
+	return s.Flush()
+}
+
+func (s *Store) isDecoy(username, password string) bool {
+	return s.decoys[pairKey(username, password)] || s.decoys[pairKey("*", password)]
+}
+
+// attempt is the username and password pair of a login attempt, prefix is
+// the protocol of the fields, like ssh for ssh.username and ssh.password.
+type attempt struct {
+	prefix   string
+	username string
+	password string
+}
+
+// credentials returns the username and password pairs of the event, like
+// ssh.username and ssh.password, sorted by prefix.
+func credentials(e event.Event) []attempt {
+	attempts := []attempt{}
+
+	e.Range(func(key, value interface{}) bool {
+		name, ok := key.(string)
+		if !ok || !strings.HasSuffix(name, ".username") {
+			return true
+		}
+
+		prefix := strings.TrimSuffix(name, ".username")
+
+		username, _ := e.GetString(name)
+
+		if password, ok := e.GetString(prefix + ".password"); ok {
+			attempts = append(attempts, attempt{prefix, username, password})
+		}
+
+		return true
+	})
+
+	sort.Slice(attempts, func(i, j int) bool {
+		return attempts[i].prefix < attempts[j].prefix
+	})
+
+	return attempts
+}
+
+// Enrich implements enrichers.Enricher, the pairs of login attempts are
+// counted. The event gets the fields:
+//
+//	credential.new       the pair hasn't been seen before
+//	credential.count     the number of attempts with the pair
+//	credential.sources   the number of sources which used the pair
+//	credential.replayed  the pair has been used before by another source
+//	credential.decoy     the pair is a decoy
+//
+// Events with several pairs get these fields for every pair, prefixed with
+// the protocol of the pair, like ssh.credential.new. Once max-pairs pairs are
+// tracked, new pairs only get the decoy field.
+//
+// Replays and decoys are reported with credential-replayed and
+// credential-decoy events as well.
+func (s *Store) Enrich(e event.Event) error {
+	if e.Get("category") == "credentials" {
+		return nil
+	}
+
+	attempts := credentials(e)
+	if len(attempts) == 0 {
+		return nil
+	}
+
+	source := e.Get("source-ip")
+	now := time.Now()
+
+	events := []event.Event{}
+
+	s.m.Lock()
+
+	for _, a := range attempts {
+		username, password := a.username, a.password
+
+		field := func(name string) string {
+			if len(attempts) == 1 {
+				return "credential." + name
+			}
+
+			return a.prefix + ".credential." + name
+		}
+
+		s.attempts++
+
+		key := pairKey(username, password)
+
+		p, ok := s.pairs[key]
+		if !ok && len(s.pairs) >= s.MaxPairs {
+			if !s.full {
+				log.Warningf("Tracking the maximum of %d credentials, new credentials are ignored", s.MaxPairs)
+				s.full = true
+			}
+		} else if !ok {
+			p = &Pair{
+				Username:     username,
+				Password:     password,
+				FirstSeen:    now,
+				FirstSource:  source,
+				FirstService: e.Get("service"),
+				Sources:      map[string]int{},
+			}
+
+			s.pairs[key] = p
+			s.newPairs++
+		}
+
+		decoy := s.isDecoy(username, password)
+
+		if decoy {
+			events = append(events, alert(e, "credential-decoy", username, password, p))
+		}
+
+		e.Store(field("decoy"), decoy)
+
+		// untracked pairs are unknown, these could have been seen before
+		if p == nil {
+			continue
+		}
+
+		e.Store(field("new"), !ok)
+
+		// replayed by another source, unless the pair is used by many
+		// sources
+		_, knownSource := p.Sources[source]
+
+		replayed := ok && source != "" && !knownSource && p.FirstSource != source &&
+			p.SourceCount <= s.ReplayMaxSources
+
+		if replayed {
+			events = append(events, alert(e, "credential-replayed", username, password, p))
+		}
+
+		p.Count++
+		p.LastSeen = now
+
+		if source != "" && !knownSource {
+			p.SourceCount++
+		}
+
+		if _, ok := p.Sources[source]; source != "" && (ok || len(p.Sources) < maxSources) {
+			p.Sources[source]++
+		}
+
+		s.dirty[key] = true
+
+		e.Store(field("count"), p.Count)
+		e.Store(field("sources"), p.SourceCount)
+		e.Store(field("replayed"), replayed)
+	}
+
+	s.m.Unlock()
+
+	for _, e := range events {
+		s.c.Send(e)
+	}
+
+	return nil
+}
+
+// alert returns a credential-replayed or credential-decoy event for the
+// login attempt, p is nil for pairs which aren't tracked.
+func alert(e event.Event, typ, username, password string, p *Pair) event.Event {
+	options := []event.Option{
+		event.Sensor("honeytrap"),
+		event.Category("credentials"),
+		event.Type(typ),
+		event.Severity("warning"),
+		event.Custom("credential.username", username),
+		event.Custom("credential.password", password),
+	}
+
+	for _, name := range []string{"source-ip", "source-port", "destination-ip", "destination-port", "session-id", "service"} {
+		if v, ok := e.Load(name); ok {
+			options = append(options, event.Custom(name, v))
+		}
+	}
+
+	if p != nil {
+		options = append(options,
+			event.Custom("credential.first-seen", p.FirstSeen),
+			event.Custom("credential.first-source", p.FirstSource),
+			event.Custom("credential.first-service", p.FirstService),
+		)
+	}
+
+	return event.New(options...)
+}
+
+// Count is a value with the number of attempts.
+type Count struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Kind selects the values of the pairs: usernames, passwords or pairs.
+type Kind string
+
+// The kinds of values of Top and Wordlist.
+const (
+	Usernames Kind = "usernames"
+	Passwords Kind = "passwords"
+	Pairs     Kind = "pairs"
+)
+
+// ErrInvalidKind is returned for unknown kinds.
+var ErrInvalidKind = errors.New("invalid kind, expected usernames, passwords or pairs")
+
+// counts returns the values of the kind with their number of attempts,
+// the most used first. Only the pairs used by source count, when source is
+// set.
+func (s *Store) counts(kind Kind, source string) ([]Count, error) {
+	m := map[string]int{}
+
+	s.m.Lock()
+
+	for _, p := range s.pairs {
+		count := p.Count
+		if source != "" {
+			count = p.Sources[source]
+		}
+
+		if count == 0 {
+			continue
+		}
+
+		switch kind {
+		case Usernames:
+			m[p.Username] += count
+		case Passwords:
+			m[p.Password] += count
+		case Pairs:
+			m[p.Username+":"+p.Password] += count
+		default:
+			s.m.Unlock()
+			return nil, ErrInvalidKind
+		}
+	}
+
+	s.m.Unlock()
+
+	counts := make([]Count, 0, len(m))
+	for v, count := range m {
+		counts = append(counts, Count{v, count})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+
+		return counts[i].Value < counts[j].Value
+	})
+
+	return counts, nil
+}
+
+// Top returns the n most used values of the kind, of every source or of
+// the source.
+func (s *Store) Top(kind Kind, n int, source string) ([]Count, error) {
+	counts, err := s.counts(kind, source)
+	if err != nil {
+		return nil, err
+	}
+
+	if n > 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+
+	return counts, nil
+}
+
+// Wordlist writes the values of the kind used at least minCount times, a
+// value per line, the most used first.
+func (s *Store) Wordlist(w io.Writer, kind Kind, minCount int) error {
+	counts, err := s.counts(kind, "")
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+
+	for _, c := range counts {
+		if c.Count < minCount {
+			break
+		}
+
+		// values with line breaks would break the wordlist
+		if strings.ContainsAny(c.Value, "\r\n") {
+			continue
+		}
+
+		bw.WriteString(c.Value + "\n")
+	}
+
+	return bw.Flush()
+}
+
+func formatCounts(counts []Count) []string {
+	values := []string{}
+	for _, c := range counts {
+		values = append(values, fmt.Sprintf("%s (%d)", c.Value, c.Count))
+	}
+
+	return values
+}
+
+// Summary returns the credential-summary event, with the top values and
+// the counters since the previous summary.
+func (s *Store) Summary() event.Event {
+	pairs, _ := s.Top(Pairs, s.SummaryTop, "")
+	usernames, _ := s.Top(Usernames, s.SummaryTop, "")
+	passwords, _ := s.Top(Passwords, s.SummaryTop, "")
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	e := event.New(
+		event.Sensor("honeytrap"),
+		event.Category("credentials"),
+		event.Type("credential-summary"),
+		event.Severity("info"),
+		event.Custom("credentials.attempts", s.attempts),
+		event.Custom("credentials.new-pairs", s.newPairs),
+		event.Custom("credentials.pairs", len(s.pairs)),
+		event.Custom("credentials.top-pairs", formatCounts(pairs)),
+		event.Custom("credentials.top-usernames", formatCounts(usernames)),
+		event.Custom("credentials.top-passwords", formatCounts(passwords)),
+	)
+
+	s.attempts, s.newPairs = 0, 0
+	return e
+}
@@ -0,0 +1,236 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package credentials
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+type memory struct {
+	sync.Mutex
+	m map[string][]byte
+}
+
+func (b *memory) Set(key string, data []byte) error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.m[key] = data
+	return nil
+}
+
+func (b *memory) Range(prefix string, fn func(string, []byte) bool) error {
+	b.Lock()
+	defer b.Unlock()
+
+	keys := []string{}
+	for key := range b.m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) && !fn(key, b.m[key]) {
+			break
+		}
+	}
+
+	return nil
+}
+
+type events []event.Event
+
+func (c *events) Send(e event.Event) {
+	*c = append(*c, e)
+}
+
+func (c *events) types() []string {
+	types := []string{}
+	for _, e := range *c {
+		types = append(types, e.Get("type"))
+	}
+
+	return types
+}
+
+func TestStore(t *testing.T) {
+	backend := &memory{m: map[string][]byte{}}
+	c := &events{}
+
+	conf := DefaultConfig
+	conf.Decoys = []string{"*:Tr0ub4dor&3"}
+	conf.ReplayMaxSources = 1
+
+	s, err := Open(conf, backend, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(source, username, password string) event.Event {
+		e := event.New(
+			event.SourceIP(net.ParseIP(source)),
+			event.Service("ssh"),
+			event.Custom("ssh.username", username),
+			event.Custom("ssh.password", password),
+		)
+
+		if err := s.Enrich(e); err != nil {
+			t.Fatal(err)
+		}
+
+		return e
+	}
+
+	e := login("192.0.2.1", "root", "s3cret")
+	if isNew, _ := e.GetBool("credential.new"); !isNew {
+		t.Errorf("Expected new pair")
+	}
+
+	// the same source is no replay
+	e = login("192.0.2.1", "root", "s3cret")
+	if isNew, _ := e.GetBool("credential.new"); isNew {
+		t.Errorf("Expected known pair")
+	} else if replayed, _ := e.GetBool("credential.replayed"); replayed {
+		t.Errorf("Expected no replay from the same source")
+	}
+
+	e = login("198.51.100.7", "root", "s3cret")
+	if replayed, _ := e.GetBool("credential.replayed"); !replayed {
+		t.Errorf("Expected replay from another source")
+	} else if count, _ := e.GetInt("credential.count"); count != 3 {
+		t.Errorf("Expected 3 attempts, got %d", count)
+	}
+
+	// the pair has 2 sources now, more than replay-max-sources
+	e = login("203.0.113.9", "root", "s3cret")
+	if replayed, _ := e.GetBool("credential.replayed"); replayed {
+		t.Errorf("Expected no replay of a pair used by many sources")
+	}
+
+	login("203.0.113.9", "admin", "Tr0ub4dor&3")
+	login("203.0.113.9", "admin", "admin")
+
+	if types := c.types(); strings.Join(types, ",") != "credential-replayed,credential-decoy" {
+		t.Errorf("Expected replay and decoy events, got %v", types)
+	} else if e := (*c)[0]; e.Get("credential.first-source") != "192.0.2.1" || e.Get("source-ip") != "198.51.100.7" {
+		t.Errorf("Expected the first and replaying source, got %v", event.ToMap(e))
+	}
+
+	top, err := s.Top(Usernames, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(top) != 1 || top[0] != (Count{"root", 4}) {
+		t.Errorf("Expected root as top username, got %v", top)
+	}
+
+	if top, _ := s.Top(Pairs, 0, "203.0.113.9"); len(top) != 3 {
+		t.Errorf("Expected 3 pairs of the source, got %v", top)
+	}
+
+	summary := s.Summary()
+	if n, _ := summary.GetInt("credentials.attempts"); n != 6 {
+		t.Errorf("Expected 6 attempts, got %d", n)
+	} else if n, _ := summary.GetInt("credentials.new-pairs"); n != 3 {
+		t.Errorf("Expected 3 new pairs, got %d", n)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopen, the pairs are read from the backend
+	s, err = Open(conf, backend, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	buf := &bytes.Buffer{}
+	if err := s.Wordlist(buf, Passwords, 1); err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "s3cret\nTr0ub4dor&3\nadmin\n" {
+		t.Errorf("Unexpected wordlist %q", buf.String())
+	}
+
+	if err := s.Wordlist(buf, Kind("x"), 1); err != ErrInvalidKind {
+		t.Errorf("Expected invalid kind, got %v", err)
+	}
+}
+
+func TestStoreSeveralPairs(t *testing.T) {
+	conf := DefaultConfig
+	conf.MaxPairs = 1
+
+	s, err := Open(conf, &memory{m: map[string][]byte{}}, &events{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	e := event.New(
+		event.SourceIP(net.ParseIP("192.0.2.1")),
+		event.Custom("ftp.username", "anonymous"),
+		event.Custom("ftp.password", "guest"),
+		event.Custom("http.username", "admin"),
+		event.Custom("http.password", "admin"),
+	)
+
+	if err := s.Enrich(e); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first pair is tracked, the second exceeds max-pairs
+	if isNew, ok := e.GetBool("ftp.credential.new"); !ok || !isNew {
+		t.Errorf("Expected new ftp pair")
+	} else if count, _ := e.GetInt("ftp.credential.count"); count != 1 {
+		t.Errorf("Expected 1 attempt of the ftp pair, got %d", count)
+	}
+
+	if e.Has("http.credential.new") || e.Has("http.credential.count") {
+		t.Errorf("Expected untracked http pair to be unknown, got %v", event.ToMap(e))
+	} else if !e.Has("http.credential.decoy") {
+		t.Errorf("Expected decoy field of the http pair")
+	}
+
+	if e.Has("credential.new") {
+		t.Errorf("Expected the fields to be prefixed for several pairs")
+	}
+}
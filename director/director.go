@@ -34,6 +34,7 @@ import (
 	"net"
 
 	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/pushers"
 
 	logging "github.com/op/go-logging"
@@ -50,6 +51,38 @@ func Register(key string, fn func(...func(Director) error) (Director, error)) fu
 	return fn
 }
 
+func Range(fn func(string)) {
+	for k := range directors {
+		fn(k)
+	}
+}
+
+var (
+	descriptions = map[string]config.Description{}
+)
+
+// Describe registers the description of the director, the description will
+// be used for listing, describing and validating directors.
+func Describe(key string, d config.Description) config.Description {
+	d.Name = key
+	descriptions[key] = d
+	return d
+}
+
+// Description returns the description of the registered director.
+func Description(key string) (config.Description, bool) {
+	if _, ok := directors[key]; !ok {
+		return config.Description{}, false
+	}
+
+	d, ok := descriptions[key]
+	if !ok {
+		d = config.Description{Name: key}
+	}
+
+	return d, true
+}
+
 func Get(key string) (func(...func(Director) error) (Director, error), bool) {
 	d := Dummy
 
@@ -35,12 +35,19 @@ import (
 	"fmt"
 	"net"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/director"
 	"github.com/honeytrap/honeytrap/pushers"
 )
 
 var (
 	_ = director.Register("forward", New)
+	_ = director.Describe("forward", config.Description{
+		Description: "Forwards connections to a remote host",
+		Config: func() interface{} {
+			return &forwardDirector{}
+		},
+	})
 )
 
 func New(options ...func(director.Director) error) (director.Director, error) {
@@ -58,7 +65,7 @@ func New(options ...func(director.Director) error) (director.Director, error) {
 type forwardDirector struct {
 	eb pushers.Channel
 
-	Host string `toml:"host"`
+	Host string `toml:"host" doc:"Host to forward the connections to" required:"true"`
 }
 
 func (d *forwardDirector) SetChannel(eb pushers.Channel) {
@@ -65,6 +65,17 @@ func ContainerStartedEvent(name string) event.Event {
 	)
 }
 
+// ContainerDialEvent returns a container dial event object giving the associated data values.
+func ContainerDialEvent(name string, network string, port int) event.Event {
+	return event.New(
+		event.ContainerDial,
+		event.ContainersSensor,
+		event.Custom("container-name", name),
+		event.Custom("container-network", network),
+		event.Custom("container-port", port),
+	)
+}
+
 // ContainerErrorEvent returns a connection open event object giving the associated data values.
 func ContainerErrorEvent(name string, e error) event.Event {
 	return event.New(
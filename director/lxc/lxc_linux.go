@@ -39,7 +39,9 @@ import (
 	"net"
 	"time"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/director"
+	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 
 	"golang.org/x/sync/syncmap"
@@ -51,6 +53,10 @@ import (
 
 var (
 	_ = director.Register("lxc", New)
+	_ = director.Describe("lxc", config.Description{
+		Description: "Directs connections to lxc containers, started on demand",
+		Platforms:   []string{"linux"},
+	})
 )
 
 func New(options ...func(director.Director) error) (director.Director, error) {
@@ -86,12 +92,18 @@ func (d *lxcDirector) Dial(conn net.Conn) (net.Conn, error) {
 
 	name := fmt.Sprintf("honeytrap-%s", hex.EncodeToString(hash))
 
+	// the container events relate to the session of the connection
+	eb := pushers.OptionsChannel(d.eb,
+		event.SourceAddr(conn.RemoteAddr()),
+		event.DestinationAddr(conn.LocalAddr()),
+	)
+
 	c, ok := d.cache.Load(name)
 	// c := d.cache[name]
 	if !ok {
 		var err error
 
-		c, err = d.newContainer(name, d.template)
+		c, err = d.newContainer(name, d.template, eb)
 		if err != nil {
 			log.Errorf("Error creating container: %s", err.Error())
 			return nil, err
@@ -103,18 +115,30 @@ func (d *lxcDirector) Dial(conn net.Conn) (net.Conn, error) {
 		d.cache.Store(name, c)
 	}
 
-	if err := c.(*lxcContainer).ensureStarted(); err != nil {
+	if err := c.(*lxcContainer).ensureStarted(eb); err != nil {
 		log.Errorf("Error creating container: %s", err.Error())
 		return nil, err
 	}
 
+	var network string
+	var port int
+
 	if ta, ok := conn.LocalAddr().(*net.TCPAddr); ok {
-		return c.(*lxcContainer).Dial("tcp", ta.Port)
+		network, port = "tcp", ta.Port
 	} else if ta, ok := conn.LocalAddr().(*net.UDPAddr); ok {
-		return c.(*lxcContainer).Dial("udp", ta.Port)
+		network, port = "udp", ta.Port
 	} else {
 		return nil, errors.New("Unsupported protocol")
 	}
+
+	cconn, err := c.(*lxcContainer).Dial(network, port)
+	if err != nil {
+		eb.Send(ContainerErrorEvent(name, err))
+		return nil, err
+	}
+
+	eb.Send(ContainerDialEvent(name, network, port))
+	return cconn, nil
 }
 
 type lxcContainer struct {
@@ -131,7 +155,7 @@ type lxcContainer struct {
 }
 
 // NewContainer returns a new LxcContainer from the provider.
-func (d *lxcDirector) newContainer(name string, template string) (*lxcContainer, error) {
+func (d *lxcDirector) newContainer(name string, template string, eb pushers.Channel) (*lxcContainer, error) {
 	c := lxcContainer{
 		name:     name,
 		template: template,
@@ -145,7 +169,7 @@ func (d *lxcDirector) newContainer(name string, template string) (*lxcContainer,
 		return &c, nil
 	}
 
-	if err := c.clone(); err != nil {
+	if err := c.clone(eb); err != nil {
 		return nil, err
 	}
 
@@ -154,7 +178,7 @@ func (d *lxcDirector) newContainer(name string, template string) (*lxcContainer,
 }
 
 // clone attempts to clone the underline lxc.Container.
-func (c *lxcContainer) clone() error {
+func (c *lxcContainer) clone(eb pushers.Channel) error {
 	log.Debugf("Creating new container %s from template %s", c.name, c.d.template)
 
 	c1, err := lxc.NewContainer(c.template)
@@ -190,25 +214,25 @@ func (c *lxcContainer) clone() error {
 		return err
 	}
 
-	c.d.eb.Send(ContainerClonedEvent(c.name, c.template))
+	eb.Send(ContainerClonedEvent(c.name, c.template))
 
 	return nil
 }
 
 // start begins the call to the lxc.Container.
-func (c *lxcContainer) start() error {
+func (c *lxcContainer) start(eb pushers.Channel) error {
 	log.Infof("Starting container")
 
 	c.idle = time.Now()
 
 	if !c.c.Defined() {
-		if err := c.clone(); err != nil {
+		if err := c.clone(eb); err != nil {
 			log.Error(err.Error())
 			return err
 		}
 	}
 
-	c.d.eb.Send(ContainerStartedEvent(c.name))
+	eb.Send(ContainerStartedEvent(c.name))
 
 	// run independent of our process
 	c.c.WantDaemonize(true)
@@ -231,7 +255,7 @@ func (c *lxcContainer) start() error {
 }
 
 // unfreeze sets the internal container into an unfrozen state.
-func (c *lxcContainer) unfreeze() error {
+func (c *lxcContainer) unfreeze(eb pushers.Channel) error {
 	log.Infof("Unfreezing container: %s", c.name)
 
 	if err := c.c.Unfreeze(); err != nil {
@@ -242,7 +266,7 @@ func (c *lxcContainer) unfreeze() error {
 		return err
 	}
 
-	c.d.eb.Send(ContainerUnfrozenEvent(c.name, c.ip))
+	eb.Send(ContainerUnfrozenEvent(c.name, c.ip))
 
 	/*
 		if err := c.sf.Start(c.idevice); err != nil {
@@ -309,13 +333,13 @@ func (c *lxcContainer) settle() error {
 	return nil
 }
 
-func (c *lxcContainer) ensureStarted() error {
+func (c *lxcContainer) ensureStarted(eb pushers.Channel) error {
 	if c.isFrozen() {
-		return c.unfreeze()
+		return c.unfreeze(eb)
 	}
 
 	if c.isStopped() {
-		return c.start()
+		return c.start(eb)
 	}
 
 	// settle will fill the container with ip address and interface
@@ -37,12 +37,16 @@ import (
 	"errors"
 	"net"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/director"
 	"github.com/honeytrap/honeytrap/pushers"
 )
 
 var (
 	_ = director.Register("qemu", New)
+	_ = director.Describe("qemu", config.Description{
+		Description: "Directs connections to qemu virtual machines (not implemented)",
+	})
 )
 
 func New(options ...func(director.Director) error) (director.Director, error) {
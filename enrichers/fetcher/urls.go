@@ -0,0 +1,164 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package fetcher
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	urlRegexp = regexp.MustCompile(`(?i)\b(?:https?|tftp)://[^\s'"<>;|&` + "`" + `(){}\\]+`)
+
+	// hostPathRegexp matches arguments of wget and curl without scheme,
+	// like 192.0.2.1/bins.sh
+	hostPathRegexp = regexp.MustCompile(`^[a-zA-Z0-9.-]+\.[a-zA-Z0-9-]+(?::\d+)?/[^\s]*$`)
+
+	separatorRegexp = regexp.MustCompile(`[;|&` + "`" + `\n]+|\$\(`)
+)
+
+// unquote strips the quotes of the shell argument.
+func unquote(s string) string {
+	return strings.Trim(s, `'"`)
+}
+
+// tftpURL returns the url of the busybox and tftp-hpa style tftp commands,
+// like tftp -g -r bins.sh 192.0.2.1 and tftp 192.0.2.1 -c get bins.sh.
+func tftpURL(args []string) (string, bool) {
+	host, file := "", ""
+
+	for i := 0; i < len(args); i++ {
+		switch arg := unquote(args[i]); {
+		case arg == "-r" || arg == "-c" && i+2 < len(args) && unquote(args[i+1]) == "get":
+			if arg == "-c" {
+				i++
+			}
+
+			if i+1 < len(args) {
+				i++
+				file = unquote(args[i])
+			}
+		case arg == "-l" || arg == "-g" || arg == "-p" || arg == "-v":
+			// options without argument, or the local name
+			if arg == "-l" {
+				i++
+			}
+		case strings.HasPrefix(arg, "-"):
+		case host == "":
+			host = arg
+		}
+	}
+
+	if host == "" || file == "" {
+		return "", false
+	}
+
+	return "tftp://" + host + "/" + strings.TrimPrefix(file, "/"), true
+}
+
+// commandURLs returns the urls of the wget, curl and tftp commands without
+// scheme.
+func commandURLs(s string) []string {
+	urls := []string{}
+
+	for _, cmd := range separatorRegexp.Split(s, -1) {
+		args := strings.Fields(cmd)
+		if len(args) == 0 {
+			continue
+		}
+
+		// busybox applets, like busybox wget
+		if strings.HasSuffix(args[0], "busybox") {
+			args = args[1:]
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		switch name := args[0][strings.LastIndex(args[0], "/")+1:]; name {
+		case "wget", "curl":
+			for _, arg := range args[1:] {
+				if arg = unquote(arg); hostPathRegexp.MatchString(arg) {
+					urls = append(urls, "http://"+arg)
+				}
+			}
+		case "tftp":
+			if u, ok := tftpURL(args[1:]); ok {
+				urls = append(urls, u)
+			}
+		}
+	}
+
+	return urls
+}
+
+// Extract returns the http, https and tftp urls in the text, including the
+// urls of wget, curl and tftp commands. Url encoded text, like query
+// strings, is decoded first.
+func Extract(s string) []string {
+	if decoded, err := url.QueryUnescape(s); err == nil {
+		s = decoded
+	}
+
+	seen := map[string]bool{}
+	urls := []string{}
+
+	for _, u := range append(urlRegexp.FindAllString(s, -1), commandURLs(s)...) {
+		u = strings.TrimRight(u, ".,")
+
+		parsed, err := url.Parse(u)
+		if err != nil || parsed.Host == "" {
+			continue
+		}
+
+		parsed.Scheme = strings.ToLower(parsed.Scheme)
+
+		// tftp urls need a file to read
+		if parsed.Scheme == "tftp" && strings.Trim(parsed.Path, "/") == "" {
+			continue
+		}
+
+		parsed.Host = strings.ToLower(parsed.Host)
+		parsed.Fragment = ""
+
+		u = parsed.String()
+		if seen[u] {
+			continue
+		}
+
+		seen[u] = true
+		urls = append(urls, u)
+	}
+
+	return urls
+}
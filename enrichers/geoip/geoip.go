@@ -0,0 +1,206 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package geoip
+
+import (
+	"errors"
+	"net"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/enrichers"
+	"github.com/honeytrap/honeytrap/event"
+	logging "github.com/op/go-logging"
+)
+
+var (
+	_ = enrichers.Register("geoip", New)
+	_ = enrichers.Describe("geoip", config.Description{
+		Description: "Adds the country, city and autonomous system of the address, from MaxMind DB files",
+		Config: func() interface{} {
+			return &Config{
+				Field:     "source-ip",
+				Language:  "en",
+				CacheSize: defaultCacheSize,
+			}
+		},
+	})
+)
+
+var log = logging.MustGetLogger("honeytrap:enrichers:geoip")
+
+var defaultCacheSize = 10000
+
+// Config contains the configuration of the geoip enricher.
+type Config struct {
+	Databases []string `toml:"databases" doc:"MaxMind DB files, like GeoLite2-City.mmdb and GeoLite2-ASN.mmdb" required:"true"`
+	Field     string   `toml:"field" doc:"Field containing the address"`
+	Language  string   `toml:"language" doc:"Language of the country and city names"`
+	CacheSize int      `toml:"cache-size" doc:"Number of lookups to cache"`
+}
+
+// GeoIP adds the location and autonomous system of the address, as
+// <prefix>.country-code, <prefix>.country, <prefix>.city,
+// <prefix>.latitude, <prefix>.longitude, <prefix>.asn and <prefix>.as-org.
+// The fields found in the databases are combined, the first database
+// containing a field wins.
+type GeoIP struct {
+	Config
+
+	readers []*Reader
+	cache   *enrichers.Cache
+}
+
+// New returns a geoip enricher.
+func New(options ...func(enrichers.Enricher) error) (enrichers.Enricher, error) {
+	g := &GeoIP{
+		Config: Config{
+			Field:     "source-ip",
+			Language:  "en",
+			CacheSize: defaultCacheSize,
+		},
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(g); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(g.Databases) == 0 {
+		return nil, errors.New("GeoIP enricher: databases not set")
+	}
+
+	for _, name := range g.Databases {
+		r, err := Open(name)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Infof("Using %s database %s, built %s", r.Metadata.DatabaseType, name, r.Metadata.BuildEpoch.Format("2006-01-02"))
+
+		g.readers = append(g.readers, r)
+	}
+
+	// the databases don't change, lookups can be cached forever
+	g.cache = enrichers.NewCache(g.CacheSize, 0)
+	return g, nil
+}
+
+// value returns the value at path of the record.
+func value(v interface{}, path ...string) interface{} {
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		v = m[key]
+	}
+
+	return v
+}
+
+// fields returns the fields of the records, without prefix.
+func (g *GeoIP) fields(records []interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	set := func(name string, v interface{}) {
+		if _, ok := fields[name]; ok {
+			return
+		}
+
+		switch v := v.(type) {
+		case string:
+			fields[name] = v
+		case float64:
+			fields[name] = v
+		case uint64:
+			fields[name] = int64(v)
+		}
+	}
+
+	for _, r := range records {
+		set("country-code", value(r, "country", "iso_code"))
+		set("country", value(r, "country", "names", g.Language))
+		set("city", value(r, "city", "names", g.Language))
+		set("latitude", value(r, "location", "latitude"))
+		set("longitude", value(r, "location", "longitude"))
+		set("asn", value(r, "autonomous_system_number"))
+		set("as-org", value(r, "autonomous_system_organization"))
+	}
+
+	return fields
+}
+
+func (g *GeoIP) lookup(ip net.IP) (map[string]interface{}, error) {
+	records := []interface{}{}
+
+	for _, r := range g.readers {
+		v, err := r.Lookup(ip)
+		if err != nil {
+			return nil, err
+		} else if v != nil {
+			records = append(records, v)
+		}
+	}
+
+	return g.fields(records), nil
+}
+
+func (g *GeoIP) Enrich(e event.Event) error {
+	ip, ok := e.GetIP(g.Field)
+	if !ok {
+		return nil
+	}
+
+	var fields map[string]interface{}
+
+	if v, ok := g.cache.Get(ip.String()); ok {
+		fields = v.(map[string]interface{})
+	} else if v, err := g.lookup(ip); err != nil {
+		return err
+	} else {
+		fields = v
+		g.cache.Add(ip.String(), fields)
+	}
+
+	prefix := enrichers.Prefix(g.Field)
+	for name, v := range fields {
+		e.Store(prefix+"."+name, v)
+	}
+
+	return nil
+}
+
+// CacheStats returns the counters of the lookup cache.
+func (g *GeoIP) CacheStats() enrichers.CacheStats {
+	return g.cache.Stats()
+}
@@ -0,0 +1,141 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package geoip
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/enrichers"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+//go:generate go run testdata/generate.go
+
+func TestReader(t *testing.T) {
+	r, err := Open("testdata/asn.mmdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Metadata.DatabaseType != "GeoLite2-ASN" || r.Metadata.IPVersion != 4 || r.Metadata.RecordSize != 28 {
+		t.Fatalf("Unexpected metadata %+v", r.Metadata)
+	}
+
+	v, err := r.Lookup(net.ParseIP("198.51.100.20"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"autonomous_system_number":       uint64(64497),
+		"autonomous_system_organization": "Example Networks",
+	}
+
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, v)
+	}
+
+	for _, s := range []string{"192.0.2.200", "203.0.113.1", "2001:db8::1"} {
+		if v, err := r.Lookup(net.ParseIP(s)); err != nil {
+			t.Fatal(err)
+		} else if v != nil {
+			t.Errorf("Expected %s not to be found, got %#v", s, v)
+		}
+	}
+
+	if _, err := NewReader([]byte("not a database")); err == nil {
+		t.Errorf("Expected error for invalid database")
+	}
+}
+
+func TestGeoIP(t *testing.T) {
+	g, err := New(func(e enrichers.Enricher) error {
+		e.(*GeoIP).Databases = []string{"testdata/city.mmdb", "testdata/asn.mmdb"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip       string
+		expected map[string]interface{}
+	}{
+		{"192.0.2.10", map[string]interface{}{
+			"source.country-code": "NL",
+			"source.country":      "Netherlands",
+			"source.city":         "Amsterdam",
+			"source.latitude":     52.3759,
+			"source.longitude":    4.8975,
+			"source.asn":          int64(64496),
+			"source.as-org":       "Example Networks",
+		}},
+		{"192.0.2.200", map[string]interface{}{
+			"source.country-code": "NL",
+			"source.country":      "Netherlands",
+			"source.city":         "Amsterdam",
+			"source.latitude":     52.3759,
+			"source.longitude":    4.8975,
+		}},
+		{"2001:db8::1", map[string]interface{}{
+			"source.country-code": "DE",
+			"source.country":      "Germany",
+		}},
+		{"203.0.113.1", map[string]interface{}{}},
+	}
+
+	// twice, the second time from the cache
+	for i := 0; i < 2; i++ {
+		for _, tt := range tests {
+			e := event.New(event.SourceIP(net.ParseIP(tt.ip)))
+			if err := g.Enrich(e); err != nil {
+				t.Fatal(err)
+			}
+
+			fields := map[string]interface{}{}
+			for k, v := range event.ToMap(e) {
+				if k != "date" && k != "source-ip" {
+					fields[k] = v
+				}
+			}
+
+			if !reflect.DeepEqual(fields, tt.expected) {
+				t.Errorf("%s: expected %#v, got %#v", tt.ip, tt.expected, fields)
+			}
+		}
+	}
+
+	if cs := g.(enrichers.Cacher).CacheStats(); cs.Hits != 4 || cs.Misses != 4 {
+		t.Errorf("Expected 4 cache hits and misses, got %+v", cs)
+	}
+}
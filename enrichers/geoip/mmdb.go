@@ -0,0 +1,440 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+	"time"
+)
+
+// Reader looks up addresses in a MaxMind DB (.mmdb) file, like the GeoLite2
+// City and ASN databases. The database is read into memory.
+type Reader struct {
+	Metadata Metadata
+
+	tree []byte
+	data decoder
+
+	// ipv4Start is the node of ::/96 in IPv6 databases, where the IPv4
+	// addresses start
+	ipv4Start uint
+}
+
+// Metadata contains the metadata of the database.
+type Metadata struct {
+	DatabaseType string
+	Languages    []string
+	IPVersion    uint
+	NodeCount    uint
+	RecordSize   uint
+	BuildEpoch   time.Time
+}
+
+var (
+	metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+	errCorrupt = errors.New("corrupt mmdb database")
+)
+
+// Open reads the database in file name.
+func Open(name string) (*Reader, error) {
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewReader(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err.Error())
+	}
+
+	return r, nil
+}
+
+// NewReader returns a reader of the database in buf.
+func NewReader(buf []byte) (*Reader, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, errors.New("mmdb metadata not found")
+	}
+
+	v, _, err := decoder{buf[i+len(metadataMarker):]}.decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errCorrupt
+	}
+
+	md := Metadata{}
+	md.DatabaseType, _ = m["database_type"].(string)
+	md.IPVersion = uint(toUint(m["ip_version"]))
+	md.NodeCount = uint(toUint(m["node_count"]))
+	md.RecordSize = uint(toUint(m["record_size"]))
+	md.BuildEpoch = time.Unix(int64(toUint(m["build_epoch"])), 0)
+
+	if languages, ok := m["languages"].([]interface{}); ok {
+		for _, l := range languages {
+			if s, ok := l.(string); ok {
+				md.Languages = append(md.Languages, s)
+			}
+		}
+	}
+
+	switch md.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported mmdb record size %d", md.RecordSize)
+	}
+
+	if md.IPVersion != 4 && md.IPVersion != 6 {
+		return nil, fmt.Errorf("unsupported mmdb ip version %d", md.IPVersion)
+	}
+
+	// every node contains two records, followed by 16 zero bytes
+	treeSize := md.NodeCount * md.RecordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, errCorrupt
+	}
+
+	r := &Reader{
+		Metadata: md,
+		tree:     buf[:treeSize],
+		data:     decoder{buf[treeSize+16 : i]},
+	}
+
+	if md.IPVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < md.NodeCount; i++ {
+			node = r.record(node, 0)
+		}
+
+		r.ipv4Start = node
+	}
+
+	return r, nil
+}
+
+// record returns the left (0) or right (1) record of the node.
+func (r *Reader) record(node uint, bit uint) uint {
+	t := r.tree
+
+	switch r.Metadata.RecordSize {
+	case 24:
+		off := node*6 + bit*3
+		return uint(t[off])<<16 | uint(t[off+1])<<8 | uint(t[off+2])
+	case 28:
+		off := node * 7
+		if bit == 0 {
+			return (uint(t[off+3])&0xf0)<<20 | uint(t[off])<<16 | uint(t[off+1])<<8 | uint(t[off+2])
+		}
+
+		return (uint(t[off+3])&0x0f)<<24 | uint(t[off+4])<<16 | uint(t[off+5])<<8 | uint(t[off+6])
+	default:
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(t[off:]))
+	}
+}
+
+// Lookup returns the data of the network containing ip, or nil when the
+// address isn't part of the database.
+func (r *Reader) Lookup(ip net.IP) (interface{}, error) {
+	node := uint(0)
+
+	addr := ip.To4()
+	if addr != nil && r.Metadata.IPVersion == 6 {
+		node = r.ipv4Start
+	} else if addr == nil && r.Metadata.IPVersion == 4 {
+		return nil, nil
+	} else if addr == nil {
+		addr = ip.To16()
+	}
+
+	if addr == nil {
+		return nil, fmt.Errorf("invalid address %s", ip)
+	}
+
+	count := r.Metadata.NodeCount
+
+	for i := uint(0); i < uint(len(addr))*8 && node < count; i++ {
+		bit := uint(addr[i/8]>>(7-i%8)) & 1
+		node = r.record(node, bit)
+	}
+
+	if node == count {
+		return nil, nil
+	} else if node < count {
+		return nil, errCorrupt
+	}
+
+	off := node - count - 16
+	if off >= uint(len(r.data.buf)) {
+		return nil, errCorrupt
+	}
+
+	v, _, err := r.data.decode(off, 0)
+	return v, err
+}
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth limits the nesting of maps and arrays, pointers of corrupt
+// databases could loop otherwise.
+const maxDepth = 32
+
+// decoder decodes the data section of a database.
+type decoder struct {
+	buf []byte
+}
+
+func (d decoder) bytes(off, n uint) ([]byte, error) {
+	if off+n > uint(len(d.buf)) || off+n < off {
+		return nil, errCorrupt
+	}
+
+	return d.buf[off : off+n], nil
+}
+
+func (d decoder) uint(off, n uint) (uint64, error) {
+	b, err := d.bytes(off, n)
+	if err != nil {
+		return 0, err
+	}
+
+	v := uint64(0)
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+
+	return v, nil
+}
+
+// decode returns the value at off, and the offset of the next value.
+func (d decoder) decode(off uint, depth int) (interface{}, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errCorrupt
+	}
+
+	b, err := d.bytes(off, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctrl := b[0]
+	off++
+
+	typ := uint(ctrl >> 5)
+
+	if typ == typePointer {
+		n := uint(ctrl>>3)&0x3 + 1
+
+		p, err := d.uint(off, n)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch n {
+		case 1:
+			p |= uint64(ctrl&0x7) << 8
+		case 2:
+			p = p | uint64(ctrl&0x7)<<16 + 2048
+		case 3:
+			p = p | uint64(ctrl&0x7)<<24 + 526336
+		}
+
+		v, _, err := d.decode(uint(p), depth+1)
+		return v, off + n, err
+	}
+
+	if typ == typeExtended {
+		b, err := d.bytes(off, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		typ = 7 + uint(b[0])
+		off++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+
+		v, err := d.uint(off, n)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch n {
+		case 1:
+			size = 29 + uint(v)
+		case 2:
+			size = 285 + uint(v)
+		case 3:
+			size = 65821 + uint(v)
+		}
+
+		off += n
+	}
+
+	switch typ {
+	case typeString:
+		b, err := d.bytes(off, size)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return string(b), off + size, nil
+	case typeBytes:
+		b, err := d.bytes(off, size)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return append([]byte{}, b...), off + size, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errCorrupt
+		}
+
+		v, err := d.uint(off, size)
+		return math.Float64frombits(v), off + size, err
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errCorrupt
+		}
+
+		v, err := d.uint(off, size)
+		return float64(math.Float32frombits(uint32(v))), off + size, err
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errCorrupt
+		}
+
+		v, err := d.uint(off, size)
+		return v, off + size, err
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errCorrupt
+		}
+
+		v, err := d.uint(off, size)
+		return int64(int32(uint32(v))), off + size, err
+	case typeUint128:
+		b, err := d.bytes(off, size)
+		if err != nil || size > 16 {
+			return nil, 0, errCorrupt
+		}
+
+		return new(big.Int).SetBytes(b), off + size, nil
+	case typeBool:
+		return size != 0, off, nil
+	case typeMap:
+		m := map[string]interface{}{}
+
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errCorrupt
+			}
+
+			v, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			m[key] = v
+			off = next
+		}
+
+		return m, off, nil
+	case typeArray:
+		a := []interface{}{}
+
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			a = append(a, v)
+			off = next
+		}
+
+		return a, off, nil
+	}
+
+	return nil, 0, errCorrupt
+}
+
+func toUint(v interface{}) uint64 {
+	switch v := v.(type) {
+	case uint64:
+		return v
+	case int64:
+		return uint64(v)
+	case *big.Int:
+		return v.Uint64()
+	}
+
+	return 0
+}
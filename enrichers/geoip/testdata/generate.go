@@ -0,0 +1,297 @@
+// +build ignore
+
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// This program generates the MaxMind DB fixtures of the geoip tests:
+//
+//	go run testdata/generate.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net"
+	"sort"
+	"time"
+)
+
+const empty = -1
+
+type writer struct {
+	ipVersion  int
+	recordSize int
+
+	// nodes contains the records of the nodes, records pointing to data
+	// contain -(2 + offset)
+	nodes [][2]int
+
+	data    bytes.Buffer
+	strings map[string]int
+}
+
+func newWriter(ipVersion, recordSize int) *writer {
+	return &writer{
+		ipVersion:  ipVersion,
+		recordSize: recordSize,
+		nodes:      [][2]int{{empty, empty}},
+		strings:    map[string]int{},
+	}
+}
+
+func (w *writer) insert(cidr string, v interface{}) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+
+	ones, _ := network.Mask.Size()
+
+	addr := network.IP.To16()
+	if ip4 := network.IP.To4(); ip4 != nil && w.ipVersion == 4 {
+		addr = ip4
+	} else if ip4 != nil {
+		// ipv4 addresses are stored in ::/96
+		addr = append(make([]byte, 12), ip4...)
+		ones += 96
+	}
+
+	offset := w.encode(&w.data, v, true)
+
+	node := 0
+	for i := 0; i < ones; i++ {
+		bit := int(addr[i/8]>>(7-uint(i%8))) & 1
+
+		if i == ones-1 {
+			w.nodes[node][bit] = -(2 + offset)
+			break
+		}
+
+		if w.nodes[node][bit] == empty {
+			w.nodes = append(w.nodes, [2]int{empty, empty})
+			w.nodes[node][bit] = len(w.nodes) - 1
+		}
+
+		node = w.nodes[node][bit]
+	}
+}
+
+func control(buf *bytes.Buffer, typ int, size int) {
+	ctrl := byte(0)
+	if typ <= 7 {
+		ctrl = byte(typ << 5)
+	}
+
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+	case size < 65821:
+		ctrl |= 30
+	default:
+		ctrl |= 31
+	}
+
+	buf.WriteByte(ctrl)
+
+	if typ > 7 {
+		buf.WriteByte(byte(typ - 7))
+	}
+
+	switch {
+	case size < 29:
+	case size < 285:
+		buf.WriteByte(byte(size - 29))
+	case size < 65821:
+		buf.Write([]byte{byte((size - 285) >> 8), byte(size - 285)})
+	default:
+		buf.Write([]byte{byte((size - 65821) >> 16), byte((size - 65821) >> 8), byte(size - 65821)})
+	}
+}
+
+// encode writes the value to buf, returning its offset. Repeated strings
+// are written as pointers when dedup is set.
+func (w *writer) encode(buf *bytes.Buffer, v interface{}, dedup bool) int {
+	offset := buf.Len()
+
+	switch v := v.(type) {
+	case string:
+		if p, ok := w.strings[v]; ok && dedup && len(v) > 3 {
+			buf.Write([]byte{byte(1<<5 | p>>8), byte(p)})
+			break
+		}
+
+		if dedup {
+			w.strings[v] = offset
+		}
+
+		control(buf, 2, len(v))
+		buf.WriteString(v)
+	case float64:
+		control(buf, 3, 8)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case int:
+		b := []byte{}
+		for n := uint32(v); n > 0; n >>= 8 {
+			b = append([]byte{byte(n)}, b...)
+		}
+
+		control(buf, 6, len(b))
+		buf.Write(b)
+	case []interface{}:
+		control(buf, 11, len(v))
+		for _, item := range v {
+			w.encode(buf, item, dedup)
+		}
+	case map[string]interface{}:
+		keys := []string{}
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		control(buf, 7, len(keys))
+		for _, key := range keys {
+			w.encode(buf, key, dedup)
+			w.encode(buf, v[key], dedup)
+		}
+	default:
+		panic("unsupported type")
+	}
+
+	return offset
+}
+
+func (w *writer) record(v int) uint32 {
+	count := len(w.nodes)
+
+	switch {
+	case v == empty:
+		return uint32(count)
+	case v < empty:
+		return uint32(count + 16 + (-v - 2))
+	default:
+		return uint32(v)
+	}
+}
+
+func (w *writer) write(name string, databaseType string) {
+	buf := bytes.Buffer{}
+
+	for _, n := range w.nodes {
+		left, right := w.record(n[0]), w.record(n[1])
+
+		switch w.recordSize {
+		case 24:
+			buf.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left)})
+			buf.Write([]byte{byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			buf.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left)})
+			buf.WriteByte(byte(left>>24)<<4 | byte(right>>24)&0x0f)
+			buf.Write([]byte{byte(right >> 16), byte(right >> 8), byte(right)})
+		case 32:
+			binary.Write(&buf, binary.BigEndian, left)
+			binary.Write(&buf, binary.BigEndian, right)
+		}
+	}
+
+	buf.Write(make([]byte, 16))
+	buf.Write(w.data.Bytes())
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+
+	w.encode(&buf, map[string]interface{}{
+		"binary_format_major_version": 2,
+		"binary_format_minor_version": 0,
+		"build_epoch":                 int(time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC).Unix()),
+		"database_type":               databaseType,
+		"description":                 map[string]interface{}{"en": "Honeytrap test database"},
+		"ip_version":                  w.ipVersion,
+		"languages":                   []interface{}{"de", "en"},
+		"node_count":                  len(w.nodes),
+		"record_size":                 w.recordSize,
+	}, false)
+
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		panic(err)
+	}
+}
+
+func names(en, de string) map[string]interface{} {
+	return map[string]interface{}{
+		"en": en,
+		"de": de,
+	}
+}
+
+func main() {
+	city := newWriter(6, 24)
+
+	city.insert("192.0.2.0/24", map[string]interface{}{
+		"city": map[string]interface{}{
+			"names": names("Amsterdam", "Amsterdam"),
+		},
+		"country": map[string]interface{}{
+			"iso_code": "NL",
+			"names":    names("Netherlands", "Niederlande"),
+		},
+		"location": map[string]interface{}{
+			"latitude":  52.3759,
+			"longitude": 4.8975,
+		},
+	})
+
+	city.insert("2001:db8::/32", map[string]interface{}{
+		"country": map[string]interface{}{
+			"iso_code": "DE",
+			"names":    names("Germany", "Deutschland"),
+		},
+	})
+
+	city.write("testdata/city.mmdb", "GeoLite2-City")
+
+	asn := newWriter(4, 28)
+
+	asn.insert("192.0.2.0/25", map[string]interface{}{
+		"autonomous_system_number":       64496,
+		"autonomous_system_organization": "Example Networks",
+	})
+
+	asn.insert("198.51.100.0/24", map[string]interface{}{
+		"autonomous_system_number":       64497,
+		"autonomous_system_organization": "Example Networks",
+	})
+
+	asn.write("testdata/asn.mmdb", "GeoLite2-ASN")
+}
@@ -0,0 +1,399 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package ioc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/honeytrap/honeytrap/enrichers/iplist"
+)
+
+// Indicator types.
+const (
+	TypeIP     = "ip"
+	TypeDomain = "domain"
+	TypeURL    = "url"
+	TypeHash   = "hash"
+	TypeRule   = "rule"
+)
+
+// Indicator is an indicator of compromise of a feed.
+type Indicator struct {
+	Feed       string
+	Type       string
+	Value      string
+	Confidence int
+}
+
+// Feeds contains the indicators of the feeds, indexed by type.
+type Feeds struct {
+	networks *iplist.Networks
+	domains  map[string][]*Indicator
+	urls     map[string][]*Indicator
+	hashes   map[string][]*Indicator
+
+	rules []*ruleIndicator
+
+	// count contains the number of indicators per feed
+	count map[string]int
+}
+
+type ruleIndicator struct {
+	*Indicator
+
+	rule *Rule
+}
+
+// NewFeeds returns an empty set of feeds.
+func NewFeeds() *Feeds {
+	return &Feeds{
+		networks: iplist.NewNetworks(),
+		domains:  map[string][]*Indicator{},
+		urls:     map[string][]*Indicator{},
+		hashes:   map[string][]*Indicator{},
+		count:    map[string]int{},
+	}
+}
+
+var hashRegexp = regexp.MustCompile(`^([0-9a-fA-F]{32}|[0-9a-fA-F]{40}|[0-9a-fA-F]{64})$`)
+
+// normalizeURL returns the url without scheme and fragment, with the host
+// in lower case.
+func normalizeURL(s string) string {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return strings.ToLower(s)
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	return strings.ToLower(u.Host) + path
+}
+
+// Add adds the indicator, the type is detected from the value when empty.
+func (f *Feeds) Add(i *Indicator) error {
+	if i.Type == "" {
+		switch {
+		case hashRegexp.MatchString(i.Value):
+			i.Type = TypeHash
+		case strings.Contains(i.Value, "://"):
+			i.Type = TypeURL
+		case net.ParseIP(i.Value) != nil:
+			i.Type = TypeIP
+		case strings.Contains(i.Value, "/"):
+			if _, _, err := net.ParseCIDR(i.Value); err == nil {
+				i.Type = TypeIP
+			} else {
+				i.Type = TypeURL
+			}
+		case strings.Contains(i.Value, "."):
+			i.Type = TypeDomain
+		default:
+			return fmt.Errorf("unknown indicator %q", i.Value)
+		}
+	}
+
+	switch i.Type {
+	case TypeIP:
+		network, err := iplist.ParseNetwork(i.Value)
+		if err != nil {
+			return err
+		}
+
+		f.networks.AddValue(network, i)
+	case TypeDomain:
+		domain := strings.TrimSuffix(strings.ToLower(i.Value), ".")
+		f.domains[domain] = append(f.domains[domain], i)
+	case TypeURL:
+		u := normalizeURL(i.Value)
+		f.urls[u] = append(f.urls[u], i)
+	case TypeHash:
+		hash := strings.ToLower(i.Value)
+		f.hashes[hash] = append(f.hashes[hash], i)
+	default:
+		return fmt.Errorf("unknown indicator type %s", i.Type)
+	}
+
+	f.count[i.Feed]++
+	return nil
+}
+
+// AddRule adds the rule to the feed.
+func (f *Feeds) AddRule(feed string, confidence int, r *Rule) {
+	if r.Confidence > 0 {
+		confidence = r.Confidence
+	}
+
+	f.rules = append(f.rules, &ruleIndicator{
+		Indicator: &Indicator{
+			Feed:       feed,
+			Type:       TypeRule,
+			Value:      r.Name,
+			Confidence: confidence,
+		},
+		rule: r,
+	})
+
+	f.count[feed]++
+}
+
+// Count returns the number of indicators per feed.
+func (f *Feeds) Count() map[string]int {
+	count := map[string]int{}
+	for k, v := range f.count {
+		count[k] = v
+	}
+
+	return count
+}
+
+// MatchIP returns the indicators matching the address.
+func (f *Feeds) MatchIP(ip net.IP) []*Indicator {
+	indicators := []*Indicator{}
+	for _, v := range f.networks.Lookup(ip) {
+		indicators = append(indicators, v.(*Indicator))
+	}
+
+	return indicators
+}
+
+// MatchDomain returns the indicators matching the domain or one of its
+// parent domains.
+func (f *Feeds) MatchDomain(domain string) []*Indicator {
+	indicators := []*Indicator{}
+
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	for domain != "" {
+		indicators = append(indicators, f.domains[domain]...)
+
+		i := strings.Index(domain, ".")
+		if i < 0 {
+			break
+		}
+
+		domain = domain[i+1:]
+	}
+
+	return indicators
+}
+
+// MatchURL returns the indicators matching the url, with or without its
+// query.
+func (f *Feeds) MatchURL(s string) []*Indicator {
+	u := normalizeURL(s)
+
+	indicators := append([]*Indicator{}, f.urls[u]...)
+	if i := strings.Index(u, "?"); i >= 0 {
+		indicators = append(indicators, f.urls[u[:i]]...)
+	}
+
+	return indicators
+}
+
+// MatchHash returns the indicators matching the hex encoded hash.
+func (f *Feeds) MatchHash(hash string) []*Indicator {
+	return append([]*Indicator{}, f.hashes[strings.ToLower(hash)]...)
+}
+
+// HasHashes returns true if the feeds contain hashes.
+func (f *Feeds) HasHashes() bool {
+	return len(f.hashes) > 0
+}
+
+// MatchRules returns the indicators of the rules matching the data.
+func (f *Feeds) MatchRules(data []byte) []*Indicator {
+	indicators := []*Indicator{}
+	for _, r := range f.rules {
+		if r.rule.Match(data) {
+			indicators = append(indicators, r.Indicator)
+		}
+	}
+
+	return indicators
+}
+
+// ReadIndicators adds the indicators in r to the feed, one indicator per
+// line, optionally followed by its confidence. Comments start with #, the
+// comments "# feed: <name>" and "# confidence: <n>" change the feed and the
+// confidence of the indicators that follow.
+func (f *Feeds) ReadIndicators(r io.Reader, feed string, confidence int) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "#") {
+			parts := strings.SplitN(strings.TrimSpace(line[1:]), ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+
+			value := strings.TrimSpace(parts[1])
+
+			switch strings.TrimSpace(parts[0]) {
+			case "feed":
+				feed = value
+			case "confidence":
+				c, err := strconv.Atoi(value)
+				if err != nil || c < 0 || c > 100 {
+					return fmt.Errorf("line %d: invalid confidence %q", n, value)
+				}
+
+				confidence = c
+			}
+
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		i := &Indicator{
+			Feed:       feed,
+			Value:      fields[0],
+			Confidence: confidence,
+		}
+
+		if len(fields) > 1 {
+			c, err := strconv.Atoi(fields[1])
+			if err != nil || c < 0 || c > 100 {
+				return fmt.Errorf("line %d: invalid confidence %q", n, fields[1])
+			}
+
+			i.Confidence = c
+		}
+
+		if err := f.Add(i); err != nil {
+			return fmt.Errorf("line %d: %s", n, err.Error())
+		}
+	}
+
+	return scanner.Err()
+}
+
+// ruleExtensions contains the extensions of rule files.
+var ruleExtensions = map[string]bool{
+	".yar":   true,
+	".yara":  true,
+	".rules": true,
+}
+
+// LoadFile adds the indicators or rules of the file, the feed is named
+// after the file without extension.
+func (f *Feeds) LoadFile(name string, confidence int) error {
+	r, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	ext := filepath.Ext(name)
+	feed := strings.TrimSuffix(filepath.Base(name), ext)
+
+	if !ruleExtensions[ext] {
+		if err := f.ReadIndicators(r, feed, confidence); err != nil {
+			return fmt.Errorf("%s: %s", name, err.Error())
+		}
+
+		return nil
+	}
+
+	rules, err := ParseRules(r)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err.Error())
+	}
+
+	for _, rule := range rules {
+		f.AddRule(feed, confidence, rule)
+	}
+
+	return nil
+}
+
+// Files returns the files of the paths, the files of directories are
+// included in alphabetical order, skipping hidden files.
+func Files(paths []string) ([]string, error) {
+	files := []string{}
+
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(p, "*"))
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Strings(matches)
+
+		for _, m := range matches {
+			if strings.HasPrefix(filepath.Base(m), ".") {
+				continue
+			}
+
+			if fi, err := os.Stat(m); err == nil && !fi.IsDir() {
+				files = append(files, m)
+			}
+		}
+	}
+
+	return files, nil
+}
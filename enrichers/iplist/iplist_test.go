@@ -0,0 +1,116 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package iplist
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/enrichers"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func TestNetworks(t *testing.T) {
+	n := NewNetworks()
+
+	invalid, err := n.ReadNetworks(strings.NewReader(`# scanners
+192.0.2.1
+198.51.100.0/24 # research
+2001:db8::/32
+not-an-address
+
+ExitNode 0011BD2485AD45D984EC4159C88FC066E5E3300E
+Published 2018-01-01 00:00:00
+ExitAddress 203.0.113.7 2018-01-01 00:10:00
+`))
+	if err != nil {
+		t.Fatal(err)
+	} else if invalid != 1 {
+		t.Errorf("Expected 1 invalid line, got %d", invalid)
+	} else if n.Len() != 4 {
+		t.Errorf("Expected 4 networks, got %d", n.Len())
+	}
+
+	for s, expected := range map[string]bool{
+		"192.0.2.1":       true,
+		"192.0.2.2":       false,
+		"198.51.100.77":   true,
+		"2001:db8::42":    true,
+		"2001:db9::42":    false,
+		"203.0.113.7":     true,
+		"::ffff:c000:201": true,
+	} {
+		if n.Contains(net.ParseIP(s)) != expected {
+			t.Errorf("Expected contains %s to be %t", s, expected)
+		}
+	}
+}
+
+func TestScanner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iplist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "shodan.txt")
+	if err := ioutil.WriteFile(name, []byte("192.0.2.0/24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewScanner(func(e enrichers.Enricher) error {
+		e.(*Scanner).Name = "shodan"
+		e.(*Scanner).Files = []string{name}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := event.New(event.SourceIP(net.ParseIP("192.0.2.10")))
+	if err := s.Enrich(e); err != nil {
+		t.Fatal(err)
+	} else if e.Get("source.scanner") != "shodan" {
+		t.Errorf("Expected source.scanner to be shodan, got %q", e.Get("source.scanner"))
+	}
+
+	e = event.New(event.SourceIP(net.ParseIP("198.51.100.10")))
+	if err := s.Enrich(e); err != nil {
+		t.Fatal(err)
+	} else if e.Has("source.scanner") {
+		t.Errorf("Expected source.scanner not to be set")
+	}
+}
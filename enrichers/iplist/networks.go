@@ -0,0 +1,195 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package iplist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Networks is a set of networks, addresses are stored as networks with a
+// full mask. Values can be stored with the networks.
+type Networks struct {
+	// lengths contains the prefix lengths of the networks, longest
+	// first
+	lengths []int
+
+	networks map[int]map[string][]interface{}
+}
+
+// NewNetworks returns an empty set.
+func NewNetworks() *Networks {
+	return &Networks{
+		networks: map[int]map[string][]interface{}{},
+	}
+}
+
+// Add adds the network to the set.
+func (n *Networks) Add(network *net.IPNet) {
+	n.AddValue(network, nil)
+}
+
+// AddValue adds the network to the set, storing v with the network. Values
+// of networks added multiple times are kept.
+func (n *Networks) AddValue(network *net.IPNet, v interface{}) {
+	ones, bits := network.Mask.Size()
+	if bits == 32 {
+		ones += 96
+	}
+
+	set, ok := n.networks[ones]
+	if !ok {
+		set = map[string][]interface{}{}
+
+		n.networks[ones] = set
+		n.lengths = append(n.lengths, ones)
+
+		sort.Sort(sort.Reverse(sort.IntSlice(n.lengths)))
+	}
+
+	key := string(network.IP.To16().Mask(net.CIDRMask(ones, 128)))
+
+	values := set[key]
+	if v != nil {
+		values = append(values, v)
+	}
+
+	set[key] = values
+}
+
+// Contains returns true if the address is part of one of the networks.
+func (n *Networks) Contains(ip net.IP) bool {
+	ip = ip.To16()
+	if ip == nil {
+		return false
+	}
+
+	for _, ones := range n.lengths {
+		if _, ok := n.networks[ones][string(ip.Mask(net.CIDRMask(ones, 128)))]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Lookup returns the values of the networks containing the address, of the
+// most specific network first.
+func (n *Networks) Lookup(ip net.IP) []interface{} {
+	values := []interface{}{}
+
+	ip = ip.To16()
+	if ip == nil {
+		return values
+	}
+
+	for _, ones := range n.lengths {
+		values = append(values, n.networks[ones][string(ip.Mask(net.CIDRMask(ones, 128)))]...)
+	}
+
+	return values
+}
+
+// Len returns the number of networks in the set.
+func (n *Networks) Len() int {
+	count := 0
+	for _, set := range n.networks {
+		count += len(set)
+	}
+
+	return count
+}
+
+// ParseNetwork parses an address or a network in CIDR notation.
+func ParseNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", s)
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// ReadNetworks adds the networks listed in r to the set, one address or
+// network per line. Empty lines and comments starting with # are skipped,
+// as are the other lines of the Tor bulk exit list format, of which the
+// ExitAddress lines are used. Returns the number of invalid lines.
+func (n *Networks) ReadNetworks(r io.Reader) (int, error) {
+	invalid := 0
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "ExitAddress":
+			if len(fields) < 2 {
+				invalid++
+				continue
+			}
+
+			fields = fields[1:]
+		case "ExitNode", "Published", "LastStatus":
+			continue
+		}
+
+		network, err := ParseNetwork(fields[0])
+		if err != nil {
+			invalid++
+			continue
+		}
+
+		n.Add(network)
+	}
+
+	return invalid, scanner.Err()
+}
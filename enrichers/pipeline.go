@@ -0,0 +1,136 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package enrichers
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Stats contains the counters of an enricher in the pipeline.
+type Stats struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	Events uint64 `json:"events"`
+	Errors uint64 `json:"errors"`
+
+	// Time is the number of seconds spent enriching events
+	Time float64 `json:"time"`
+
+	Cache *CacheStats `json:"cache,omitempty"`
+}
+
+// Stage is an enricher of the pipeline, the name identifies the enricher
+// in the stats and the logging.
+type Stage struct {
+	Name string
+	Type string
+
+	Enricher Enricher
+}
+
+type stage struct {
+	Stage
+
+	events uint64
+	errors uint64
+	nanos  int64
+}
+
+// Pipeline applies the enrichers in order.
+type Pipeline struct {
+	stages []*stage
+}
+
+// NewPipeline returns a pipeline applying the enrichers of the stages in
+// order.
+func NewPipeline(stages ...Stage) *Pipeline {
+	p := &Pipeline{}
+
+	for _, s := range stages {
+		p.stages = append(p.stages, &stage{Stage: s})
+	}
+
+	return p
+}
+
+// Enrich applies the enrichers to the event, errors are logged and don't
+// stop the other enrichers.
+func (p *Pipeline) Enrich(e event.Event) {
+	if p == nil {
+		return
+	}
+
+	for _, s := range p.stages {
+		start := time.Now()
+
+		err := s.Enricher.Enrich(e)
+
+		atomic.AddInt64(&s.nanos, int64(time.Since(start)))
+		atomic.AddUint64(&s.events, 1)
+
+		if err != nil {
+			atomic.AddUint64(&s.errors, 1)
+
+			log.Debugf("Error enriching event with %s(%s): %s", s.Name, s.Type, err.Error())
+		}
+	}
+}
+
+// Stats returns the counters of the enrichers.
+func (p *Pipeline) Stats() []Stats {
+	stats := []Stats{}
+	if p == nil {
+		return stats
+	}
+
+	for _, s := range p.stages {
+		st := Stats{
+			Name:   s.Name,
+			Type:   s.Type,
+			Events: atomic.LoadUint64(&s.events),
+			Errors: atomic.LoadUint64(&s.errors),
+			Time:   time.Duration(atomic.LoadInt64(&s.nanos)).Seconds(),
+		}
+
+		if c, ok := s.Enricher.(Cacher); ok {
+			cs := c.CacheStats()
+			st.Cache = &cs
+		}
+
+		stats = append(stats, st)
+	}
+
+	return stats
+}
@@ -0,0 +1,243 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package rdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/enrichers"
+	"github.com/honeytrap/honeytrap/event"
+	logging "github.com/op/go-logging"
+)
+
+var (
+	_ = enrichers.Register("rdns", New)
+	_ = enrichers.Describe("rdns", config.Description{
+		Description: "Adds the hostname of the address, using reverse dns",
+		Config: func() interface{} {
+			return &Config{
+				Field:     "source-ip",
+				Timeout:   config.Delay(defaultTimeout),
+				CacheSize: defaultCacheSize,
+				CacheTTL:  config.Delay(defaultCacheTTL),
+				Workers:   defaultWorkers,
+				QueueSize: defaultQueueSize,
+			}
+		},
+	})
+)
+
+var log = logging.MustGetLogger("honeytrap:enrichers:rdns")
+
+var (
+	defaultTimeout   = 500 * time.Millisecond
+	defaultCacheSize = 10000
+	defaultCacheTTL  = time.Hour
+	defaultWorkers   = 4
+	defaultQueueSize = 1000
+)
+
+// Config contains the configuration of the rdns enricher.
+type Config struct {
+	Field     string       `toml:"field" doc:"Field containing the address"`
+	Server    string       `toml:"server" doc:"Dns server to query, like 127.0.0.1:53, the system resolver when empty"`
+	Timeout   config.Delay `toml:"timeout" doc:"Timeout of a lookup"`
+	CacheSize int          `toml:"cache-size" doc:"Number of lookups to cache"`
+	CacheTTL  config.Delay `toml:"cache-ttl" doc:"Time lookups are cached"`
+	Workers   int          `toml:"workers" doc:"Number of concurrent lookups"`
+	QueueSize int          `toml:"queue-size" doc:"Number of queued lookups, addresses are dropped when the queue is full"`
+}
+
+// RDNS sets <prefix>.hostname to the hostname of the address. Addresses
+// are looked up in the background, so slow servers don't delay the events,
+// and events get the hostname once the lookup is cached. The cache
+// includes the addresses without hostname and the failed lookups.
+type RDNS struct {
+	Config
+
+	resolver *net.Resolver
+	cache    *enrichers.Cache
+
+	queue chan net.IP
+
+	// pending contains the addresses being looked up
+	pending map[string]bool
+	m       sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a rdns enricher.
+func New(options ...func(enrichers.Enricher) error) (enrichers.Enricher, error) {
+	r := &RDNS{
+		Config: Config{
+			Field:     "source-ip",
+			Timeout:   config.Delay(defaultTimeout),
+			CacheSize: defaultCacheSize,
+			CacheTTL:  config.Delay(defaultCacheTTL),
+			Workers:   defaultWorkers,
+			QueueSize: defaultQueueSize,
+		},
+		resolver: net.DefaultResolver,
+		pending:  map[string]bool{},
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.Server != "" {
+		server := r.Server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{}
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	if r.Workers <= 0 {
+		return nil, fmt.Errorf("Rdns enricher: invalid workers %d", r.Workers)
+	}
+
+	r.cache = enrichers.NewCache(r.CacheSize, r.CacheTTL.Duration())
+	r.queue = make(chan net.IP, r.QueueSize)
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+
+	for i := 0; i < r.Workers; i++ {
+		r.wg.Add(1)
+		go r.work()
+	}
+
+	return r, nil
+}
+
+// Close stops the lookups.
+func (r *RDNS) Close() error {
+	r.cancel()
+	r.wg.Wait()
+	return nil
+}
+
+func (r *RDNS) work() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case ip := <-r.queue:
+			hostname, err := r.lookup(ip)
+			if err != nil {
+				log.Debugf("Error looking up %s: %s", ip, err.Error())
+			}
+
+			r.cache.Add(ip.String(), hostname)
+
+			r.m.Lock()
+			delete(r.pending, ip.String())
+			r.m.Unlock()
+		}
+	}
+}
+
+func (r *RDNS) lookup(ip net.IP) (string, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.Timeout.Duration())
+	defer cancel()
+
+	names, err := r.resolver.LookupAddr(ctx, ip.String())
+	if dnsErr, ok := err.(*net.DNSError); ok && !dnsErr.Timeout() && !dnsErr.Temporary() {
+		// no hostname
+		return "", nil
+	} else if err != nil {
+		return "", err
+	} else if len(names) == 0 {
+		return "", nil
+	}
+
+	return strings.TrimSuffix(names[0], "."), nil
+}
+
+func (r *RDNS) Enrich(e event.Event) error {
+	ip, ok := e.GetIP(r.Field)
+	if !ok {
+		return nil
+	}
+
+	v, ok := r.cache.Get(ip.String())
+	if !ok {
+		r.enqueue(ip)
+		return nil
+	}
+
+	if hostname := v.(string); hostname != "" {
+		e.Store(enrichers.Prefix(r.Field)+".hostname", hostname)
+	}
+
+	return nil
+}
+
+// enqueue queues the address for lookup, once.
+func (r *RDNS) enqueue(ip net.IP) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.pending[ip.String()] {
+		return
+	}
+
+	select {
+	case r.queue <- ip:
+		r.pending[ip.String()] = true
+	default:
+		log.Debugf("Lookup queue full, dropped %s", ip)
+	}
+}
+
+// CacheStats returns the counters of the lookup cache.
+func (r *RDNS) CacheStats() enrichers.CacheStats {
+	return r.cache.Stats()
+}
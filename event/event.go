@@ -153,6 +153,13 @@ func Type(s string) Option {
 	}
 }
 
+// Severity returns an option for setting the severity value.
+func Severity(s string) Option {
+	return func(m Event) {
+		m.Store("severity", s)
+	}
+}
+
 // Sensor returns an option for setting the sensor value.
 func Sensor(s string) Option {
 	return func(m Event) {
@@ -163,9 +170,12 @@ func Sensor(s string) Option {
 // SourceAddr returns an option for setting the source-ip value.
 func SourceAddr(addr net.Addr) Option {
 	return func(m Event) {
-		if _, ok := addr.(*net.TCPAddr); ok {
-			m.Store("source-ip", addr.(*net.TCPAddr).IP.String())
-			m.Store("source-port", addr.(*net.TCPAddr).Port)
+		if ta, ok := addr.(*net.TCPAddr); ok {
+			m.Store("source-ip", ta.IP.String())
+			m.Store("source-port", ta.Port)
+		} else if ua, ok := addr.(*net.UDPAddr); ok {
+			m.Store("source-ip", ua.IP.String())
+			m.Store("source-port", ua.Port)
 		}
 	}
 }
@@ -173,8 +183,13 @@ func SourceAddr(addr net.Addr) Option {
 // DestinationAddr returns an option for setting the destination-ip value.
 func DestinationAddr(addr net.Addr) Option {
 	return func(m Event) {
-		m.Store("destination-ip", addr.(*net.TCPAddr).IP.String())
-		m.Store("destination-port", addr.(*net.TCPAddr).Port)
+		if ta, ok := addr.(*net.TCPAddr); ok {
+			m.Store("destination-ip", ta.IP.String())
+			m.Store("destination-port", ta.Port)
+		} else if ua, ok := addr.(*net.UDPAddr); ok {
+			m.Store("destination-ip", ua.IP.String())
+			m.Store("destination-port", ua.Port)
+		}
 	}
 }
 
@@ -192,7 +207,9 @@ func DestinationIP(ip net.IP) Option {
 	}
 }
 
-// RemoteAddr returns an option for setting the host-addr value.
+// RemoteAddr returns an option for setting the remote-addr value.
+//
+// Deprecated: use SourceAddr.
 func RemoteAddr(addr string) Option {
 	return func(m Event) {
 		m.Store("remote-addr", addr)
@@ -200,13 +217,17 @@ func RemoteAddr(addr string) Option {
 }
 
 // HostAddr returns an option for setting the host-addr value.
+//
+// Deprecated: use DestinationAddr.
 func HostAddr(addr string) Option {
 	return func(m Event) {
 		m.Store("host-addr", addr)
 	}
 }
 
-// RemoteAddrFrom returns an option for setting the host-addr value.
+// RemoteAddrFrom returns an option for setting the remote-addr value.
+//
+// Deprecated: use SourceAddr.
 func RemoteAddrFrom(addr net.Addr) Option {
 	return func(m Event) {
 		m.Store("remote-addr", addr.String())
@@ -214,6 +235,8 @@ func RemoteAddrFrom(addr net.Addr) Option {
 }
 
 // HostAddrFrom returns an option for setting the host-addr value.
+//
+// Deprecated: use DestinationAddr.
 func HostAddrFrom(addr net.Addr) Option {
 	return func(m Event) {
 		m.Store("host-addr", addr.String())
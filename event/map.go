@@ -31,7 +31,11 @@
 package event
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
 	"time"
 
 	"golang.org/x/sync/syncmap"
@@ -81,12 +85,22 @@ func (e Event) Store(s string, v interface{}) {
 	e.sm.Store(s, v)
 }
 
+// Delete removes the key from the event.
+func (e Event) Delete(s string) {
+	e.sm.Delete(s)
+}
+
 // Has returns true/false if the giving key exists.
 func (e Event) Has(s string) bool {
 	_, ok := e.sm.Load(s)
 	return ok
 }
 
+// Load returns the value for the key, with its type.
+func (e Event) Load(s string) (interface{}, bool) {
+	return e.sm.Load(s)
+}
+
 // Get retrieves a giving value for a key has string.
 func (e Event) Get(s string) string {
 	if v, ok := e.sm.Load(s); !ok {
@@ -97,3 +111,189 @@ func (e Event) Get(s string) string {
 		return v
 	}
 }
+
+// GetString returns the value of a key as string, values which aren't
+// strings are formatted.
+func (e Event) GetString(s string) (string, bool) {
+	v, ok := e.sm.Load(s)
+	if !ok {
+		return "", false
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case error:
+		return v.Error(), true
+	case fmt.Stringer:
+		return v.String(), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// GetInt returns the value of a key as integer, numbers stored as strings
+// are parsed.
+func (e Event) GetInt(s string) (int64, bool) {
+	v, ok := e.sm.Load(s)
+	if !ok {
+		return 0, false
+	}
+
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case float32:
+		return int64(v), float32(int64(v)) == v
+	case float64:
+		// numbers of decoded json events are floats
+		return int64(v), float64(int64(v)) == v
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// GetFloat returns the value of a key as float, numbers stored as strings
+// are parsed.
+func (e Event) GetFloat(s string) (float64, bool) {
+	v, ok := e.sm.Load(s)
+	if !ok {
+		return 0, false
+	}
+
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+
+	if i, ok := e.GetInt(s); ok {
+		return float64(i), true
+	}
+
+	return 0, false
+}
+
+// GetBool returns the value of a key as boolean, booleans stored as strings
+// are parsed.
+func (e Event) GetBool(s string) (bool, bool) {
+	v, ok := e.sm.Load(s)
+	if !ok {
+		return false, false
+	}
+
+	switch v := v.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(v)
+		return b, err == nil
+	default:
+		return false, false
+	}
+}
+
+// GetIP returns the value of a key as ip address, addresses stored as
+// strings are parsed.
+func (e Event) GetIP(s string) (net.IP, bool) {
+	v, ok := e.sm.Load(s)
+	if !ok {
+		return nil, false
+	}
+
+	switch v := v.(type) {
+	case net.IP:
+		return v, true
+	case string:
+		ip := net.ParseIP(v)
+		return ip, ip != nil
+	default:
+		return nil, false
+	}
+}
+
+// GetTime returns the value of a key as time, times stored as strings are
+// parsed as RFC3339.
+func (e Event) GetTime(s string) (time.Time, bool) {
+	v, ok := e.sm.Load(s)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	default:
+		return time.Time{}, false
+	}
+}
+
+// GetDuration returns the value of a key as duration, durations are stored
+// as seconds.
+func (e Event) GetDuration(s string) (time.Duration, bool) {
+	if v, ok := e.sm.Load(s); !ok {
+		return 0, false
+	} else if d, ok := v.(time.Duration); ok {
+		return d, true
+	}
+
+	f, ok := e.GetFloat(s)
+	return time.Duration(f * float64(time.Second)), ok
+}
+
+// GetPayload returns the payload of the event. The payload is decoded from
+// payload-hex, which contains the payload as is, unlike payload which
+// contains the payload as string.
+func (e Event) GetPayload() ([]byte, bool) {
+	if s, ok := e.sm.Load("payload-hex"); !ok {
+	} else if s, ok := s.(string); !ok {
+	} else if data, err := hex.DecodeString(s); err == nil {
+		return data, true
+	}
+
+	if v, ok := e.sm.Load("payload"); !ok {
+		return nil, false
+	} else if data, ok := v.([]byte); ok {
+		return data, true
+	} else if s, ok := v.(string); ok {
+		return []byte(s), true
+	}
+
+	return nil, false
+}
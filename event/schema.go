@@ -0,0 +1,202 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package event
+
+import (
+	"path"
+)
+
+// SchemaVersion is the version of the event schema, it changes when fields
+// are renamed or change type.
+const SchemaVersion = "1"
+
+// FieldType defines the type of the value of a field.
+type FieldType string
+
+// contains the types of the fields.
+const (
+	TypeString   FieldType = "string"
+	TypeInt      FieldType = "int"
+	TypeFloat    FieldType = "float"
+	TypeBool     FieldType = "bool"
+	TypeIP       FieldType = "ip"
+	TypeTime     FieldType = "time"
+	TypeDuration FieldType = "duration"
+	TypeObject   FieldType = "object"
+)
+
+// Field describes a field of the event schema. Names can contain a pattern
+// for the protocol prefix, like *.username.
+type Field struct {
+	Name        string
+	Type        FieldType
+	Description string
+
+	// Deprecated contains the replacement of deprecated fields
+	Deprecated string
+}
+
+// Schema contains the fields of the events. Fields of protocols are prefixed
+// with the name of the protocol, like ssh.username or http.url, the type of
+// fields missing from the schema isn't defined.
+var Schema = []Field{
+	{Name: "date", Type: TypeTime, Description: "Time the event occurred"},
+	{Name: "token", Type: TypeString, Description: "Token of the honeytrap instance"},
+	{Name: "sensor", Type: TypeString, Description: "Sensor creating the event, like services or honeytrap"},
+	{Name: "category", Type: TypeString, Description: "Category of the event, mostly the protocol"},
+	{Name: "type", Type: TypeString, Description: "Type of the event within the category"},
+	{Name: "severity", Type: TypeString, Description: "Severity: debug, info, notice, warning, error or critical"},
+	{Name: "message", Type: TypeString, Description: "Human readable description of the event"},
+	{Name: "error", Type: TypeString, Description: "Error that occurred"},
+	{Name: "stacktrace", Type: TypeString, Description: "Stack trace of the error"},
+	{Name: "component", Type: TypeString, Description: "Component creating the event, like service.<name> or director.<name>"},
+	{Name: "service", Type: TypeString, Description: "Name of the service handling the connection"},
+	{Name: "protocol", Type: TypeString, Description: "Transport protocol"},
+
+	{Name: "source-ip", Type: TypeIP, Description: "Address of the attacker"},
+	{Name: "source-port", Type: TypeInt, Description: "Port of the attacker"},
+	{Name: "destination-ip", Type: TypeIP, Description: "Address the attacker connected to"},
+	{Name: "destination-port", Type: TypeInt, Description: "Port the attacker connected to"},
+	{Name: "remote-addr", Type: TypeString, Description: "Address and port of the attacker", Deprecated: "source-ip and source-port"},
+	{Name: "host-addr", Type: TypeString, Description: "Address and port the attacker connected to", Deprecated: "destination-ip and destination-port"},
+
+	{Name: "session-id", Type: TypeString, Description: "Id shared by the events of a connection"},
+	{Name: "session-sequence", Type: TypeInt, Description: "Number of the event within the session"},
+	{Name: "duration", Type: TypeDuration, Description: "Duration in seconds"},
+	{Name: "bytes-received", Type: TypeInt, Description: "Bytes received from the attacker"},
+	{Name: "bytes-sent", Type: TypeInt, Description: "Bytes sent to the attacker"},
+
+	{Name: "payload", Type: TypeString, Description: "Data received, as string"},
+	{Name: "payload-hex", Type: TypeString, Description: "Data received, hex encoded"},
+	{Name: "payload-length", Type: TypeInt, Description: "Length of the data received"},
+
+	{Name: "*.username", Type: TypeString, Description: "Username used to authenticate"},
+	{Name: "*.password", Type: TypeString, Description: "Password used to authenticate"},
+	{Name: "*.user-agent", Type: TypeString, Description: "User agent of the client"},
+	{Name: "*.method", Type: TypeString, Description: "Method of the request"},
+	{Name: "*.headers", Type: TypeObject, Description: "Headers of the request"},
+	{Name: "ssh.client-version", Type: TypeString, Description: "Version string of the ssh client"},
+	{Name: "http.url", Type: TypeString, Description: "Url of the request"},
+	{Name: "http.host", Type: TypeString, Description: "Host header of the request"},
+
+	// added by the enrichers, for the source and destination address
+	{Name: "*.country-code", Type: TypeString, Description: "ISO code of the country of the address"},
+	{Name: "*.country", Type: TypeString, Description: "Country of the address"},
+	{Name: "*.city", Type: TypeString, Description: "City of the address"},
+	{Name: "*.latitude", Type: TypeFloat, Description: "Latitude of the location of the address"},
+	{Name: "*.longitude", Type: TypeFloat, Description: "Longitude of the location of the address"},
+	{Name: "*.asn", Type: TypeInt, Description: "Number of the autonomous system of the address"},
+	{Name: "*.as-org", Type: TypeString, Description: "Organization of the autonomous system of the address"},
+	{Name: "*.hostname", Type: TypeString, Description: "Hostname of the address, from reverse dns"},
+	{Name: "*.scanner", Type: TypeString, Description: "Name of the scanner list containing the address"},
+	{Name: "*.tor-exit", Type: TypeBool, Description: "Whether the address is a Tor exit node"},
+
+	{Name: "ioc.matches", Type: TypeObject, Description: "Indicators of compromise matching the event, with feed, type, indicator, confidence and field"},
+	{Name: "ioc.feeds", Type: TypeObject, Description: "Names of the feeds with matching indicators"},
+	{Name: "ioc.feed", Type: TypeString, Description: "Feed of the matching indicator with the highest confidence"},
+	{Name: "ioc.type", Type: TypeString, Description: "Type of the indicator: ip, domain, url, hash or rule"},
+	{Name: "ioc.indicator", Type: TypeString, Description: "Indicator with the highest confidence"},
+	{Name: "ioc.confidence", Type: TypeInt, Description: "Confidence of the indicator, 0-100"},
+
+	// added when the payload has been moved to the artifact store
+	{Name: "artifact.sha256", Type: TypeString, Description: "SHA256 hash of the stored payload"},
+	{Name: "artifact.sha1", Type: TypeString, Description: "SHA1 hash of the stored payload"},
+	{Name: "artifact.md5", Type: TypeString, Description: "MD5 hash of the stored payload"},
+	{Name: "artifact.size", Type: TypeInt, Description: "Size of the stored payload"},
+	{Name: "artifact.mime", Type: TypeString, Description: "Mime type of the stored payload"},
+
+	// download events of the fetcher
+	{Name: "download.url", Type: TypeString, Description: "Url of the download"},
+	{Name: "download.field", Type: TypeString, Description: "Field containing the url"},
+	{Name: "download.status", Type: TypeString, Description: "Status of the download: ok, error or disabled"},
+	{Name: "download.error", Type: TypeString, Description: "Error of the failed download"},
+	{Name: "download.cached", Type: TypeBool, Description: "Whether the url has been downloaded before"},
+	{Name: "download.sha256", Type: TypeString, Description: "SHA256 hash of the downloaded file"},
+	{Name: "download.sha1", Type: TypeString, Description: "SHA1 hash of the downloaded file"},
+	{Name: "download.md5", Type: TypeString, Description: "MD5 hash of the downloaded file"},
+	{Name: "download.ssdeep", Type: TypeString, Description: "Fuzzy ssdeep hash of the downloaded file"},
+	{Name: "download.size", Type: TypeInt, Description: "Size of the downloaded file"},
+	{Name: "download.mime", Type: TypeString, Description: "Mime type of the downloaded file"},
+
+	// added by the profiles, and the fields of attacker-profile-updated events
+	{Name: "profile.score", Type: TypeInt, Description: "Risk score of the profile of the source address, 0-100"},
+	{Name: "profile.key", Type: TypeString, Description: "Source address or fingerprint of the profile"},
+	{Name: "profile.kind", Type: TypeString, Description: "Kind of the profile: ip, or the field of the fingerprint"},
+	{Name: "profile.threshold", Type: TypeInt, Description: "Threshold the score reached"},
+	{Name: "profile.first-seen", Type: TypeTime, Description: "Time of the first event of the profile"},
+	{Name: "profile.events", Type: TypeInt, Description: "Number of events of the profile"},
+	{Name: "profile.sessions", Type: TypeInt, Description: "Number of sessions of the profile"},
+	{Name: "profile.services", Type: TypeString, Description: "Services touched, comma separated"},
+	{Name: "profile.credential-attempts", Type: TypeInt, Description: "Number of authentication attempts"},
+	{Name: "profile.commands", Type: TypeInt, Description: "Number of distinct commands"},
+	{Name: "profile.hashes", Type: TypeString, Description: "SHA256 hashes of payloads and downloads, comma separated"},
+	{Name: "profile.ports", Type: TypeInt, Description: "Number of ports scanned"},
+
+	// added to login attempts by the credential tracker
+	{Name: "credential.new", Type: TypeBool, Description: "Whether the username and password pair hasn't been seen before"},
+	{Name: "credential.count", Type: TypeInt, Description: "Number of attempts with the pair"},
+	{Name: "credential.sources", Type: TypeInt, Description: "Number of sources which used the pair"},
+	{Name: "credential.replayed", Type: TypeBool, Description: "Whether the pair has been used before by another source"},
+	{Name: "credential.decoy", Type: TypeBool, Description: "Whether the pair is a decoy"},
+
+	// added per pair to login attempts with several pairs
+	{Name: "*.credential.new", Type: TypeBool, Description: "Whether the pair of the protocol hasn't been seen before"},
+	{Name: "*.credential.count", Type: TypeInt, Description: "Number of attempts with the pair of the protocol"},
+	{Name: "*.credential.sources", Type: TypeInt, Description: "Number of sources which used the pair of the protocol"},
+	{Name: "*.credential.replayed", Type: TypeBool, Description: "Whether the pair of the protocol has been used before by another source"},
+	{Name: "*.credential.decoy", Type: TypeBool, Description: "Whether the pair of the protocol is a decoy"},
+
+	// credential-replayed and credential-decoy events
+	{Name: "credential.username", Type: TypeString, Description: "Username of the login attempt"},
+	{Name: "credential.password", Type: TypeString, Description: "Password of the login attempt"},
+	{Name: "credential.first-seen", Type: TypeTime, Description: "Time the pair was first used"},
+	{Name: "credential.first-source", Type: TypeString, Description: "Source which used the pair first"},
+	{Name: "credential.first-service", Type: TypeString, Description: "Service the pair was first used with"},
+
+	// credential-summary events
+	{Name: "credentials.attempts", Type: TypeInt, Description: "Number of login attempts since the previous summary"},
+	{Name: "credentials.new-pairs", Type: TypeInt, Description: "Number of new pairs since the previous summary"},
+	{Name: "credentials.pairs", Type: TypeInt, Description: "Number of pairs tracked"},
+	{Name: "credentials.top-pairs", Type: TypeObject, Description: "Most used pairs, with the number of attempts"},
+	{Name: "credentials.top-usernames", Type: TypeObject, Description: "Most used usernames, with the number of attempts"},
+	{Name: "credentials.top-passwords", Type: TypeObject, Description: "Most used passwords, with the number of attempts"},
+}
+
+// LookupField returns the schema field of the named field.
+func LookupField(name string) (Field, bool) {
+	for _, f := range Schema {
+		if ok, _ := path.Match(f.Name, name); ok {
+			return f, true
+		}
+	}
+
+	return Field{}, false
+}
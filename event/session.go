@@ -0,0 +1,103 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package event
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Session correlates the events of a connection. The events carry the id of
+// the session, a sequence number and the service handling the connection.
+type Session struct {
+	ID      string
+	Service string
+	Start   time.Time
+
+	sequence int64
+}
+
+// NewSession returns a session with a new unique id.
+func NewSession(service string) *Session {
+	return &Session{
+		ID:      uuid.NewV4().String(),
+		Service: service,
+		Start:   time.Now(),
+	}
+}
+
+// Next returns the next sequence number of the session.
+func (s *Session) Next() int64 {
+	return atomic.AddInt64(&s.sequence, 1)
+}
+
+// WithSession returns an option for setting the session-id, the next
+// session-sequence and the service of the session.
+func WithSession(s *Session) Option {
+	return func(m Event) {
+		m.Store("session-id", s.ID)
+		m.Store("session-sequence", s.Next())
+
+		if !m.Has("service") && s.Service != "" {
+			m.Store("service", s.Service)
+		}
+	}
+}
+
+type sessionKey struct{}
+
+// NewSessionContext returns a context carrying the session.
+func NewSessionContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// SessionFromContext returns the session of the context.
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionKey{}).(*Session)
+	return s, ok
+}
+
+// SessionOf returns the session of the connection, when the connection
+// belongs to a session.
+func SessionOf(conn net.Conn) (*Session, bool) {
+	sc, ok := conn.(interface {
+		Session() *Session
+	})
+	if !ok {
+		return nil, false
+	}
+
+	return sc.Session(), true
+}
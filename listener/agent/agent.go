@@ -38,6 +38,7 @@ import (
 	"net"
 
 	"github.com/fatih/color"
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/listener"
 	"github.com/mimoo/disco/libdisco"
 
@@ -49,6 +50,12 @@ var log = logging.MustGetLogger("listeners/agent")
 
 var (
 	_ = listener.Register("agent", New)
+	_ = listener.Describe("agent", config.Description{
+		Description: "Accepts connections forwarded by remote agents",
+		Config: func() interface{} {
+			return &agentConfig{}
+		},
+	})
 )
 
 type agentListener struct {
@@ -61,7 +68,7 @@ type agentListener struct {
 }
 
 type agentConfig struct {
-	Listen string `toml:"listen"`
+	Listen string `toml:"listen" doc:"Address the agents connect to"`
 }
 
 func (sc *agentListener) AddAddress(a net.Addr) {
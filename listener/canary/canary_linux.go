@@ -45,6 +45,7 @@ import (
 	"time"
 
 	"github.com/glycerine/rbuf"
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/listener"
 	"github.com/honeytrap/honeytrap/listener/canary/arp"
@@ -61,6 +62,15 @@ var log = logging.MustGetLogger("listeners/raw")
 
 var (
 	_ = listener.Register("raw", New)
+	_ = listener.Describe("raw", config.Description{
+		Description: "Raw socket listener detecting scans, and LLMNR, NBT-NS and mDNS poisoners",
+		Platforms:   []string{"linux"},
+		Config: func() interface{} {
+			return &Canary{
+				PoisonerInterval: defaultPoisonerInterval,
+			}
+		},
+	})
 )
 
 // first dns
@@ -102,11 +112,20 @@ const (
 	ProtocolICMP
 )
 
+var defaultPoisonerInterval = config.Delay(5 * time.Minute)
+
 // Canary contains the canary struct
 type Canary struct {
 	rt RouteTable
 
-	Interfaces []string `toml:"interfaces"`
+	Interfaces []string `toml:"interfaces" doc:"Interfaces to capture on" required:"true"`
+
+	// PoisonerNames contains the honey names to query for, enables the
+	// LLMNR, NBT-NS and mDNS poisoner detection.
+	PoisonerNames    []string     `toml:"poisoner-names" doc:"Names to query for, enables poisoner detection"`
+	PoisonerInterval config.Delay `toml:"poisoner-interval" doc:"Interval between poisoner queries"`
+
+	poisoners *poisonerTable
 
 	ch chan net.Conn
 
@@ -848,12 +867,21 @@ func New(options ...func(listener.Listener) error) (listener.Listener, error) {
 		m:                 sync.Mutex{},
 		ch:                ch,
 		buffer:            rbuf.NewFixedSizeRingBuf(65535),
+		poisoners: &poisonerTable{
+			poisoners: map[string]*Poisoner{},
+		},
+		PoisonerInterval: defaultPoisonerInterval,
 	}
 
 	for _, option := range options {
 		option(l)
 	}
 
+	l.events = &poisonerChannel{
+		Channel: l.events,
+		table:   l.poisoners,
+	}
+
 	for _, name := range l.Interfaces {
 		intf, err := net.InterfaceByName(name)
 		if err != nil {
@@ -977,6 +1005,10 @@ func (c *Canary) Start() error {
 
 	go c.knockDetector()
 
+	if len(c.PoisonerNames) > 0 {
+		go c.poisonerDetector()
+	}
+
 	var (
 		events [MaxEpollEvents]syscall.EpollEvent
 		buffer [DefaultBufferSize]byte
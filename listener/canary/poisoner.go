@@ -0,0 +1,419 @@
+// +build linux
+
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package canary
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/rs/xid"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+)
+
+// The poisoner detector periodically queries for non existing honey names
+// using LLMNR, NBT-NS and mDNS. Legitimate hosts won't answer these, but
+// poisoners like Responder and Inveigh answer every query.
+
+var (
+	// EventCategoryPoisoner contains events for name resolution poisoners
+	EventCategoryPoisoner = event.Category("poisoner")
+
+	llmnrAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 252), Port: 5355}
+	mdnsAddr  = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+	errInvalidNBNSResponse = errors.New("invalid nbns response")
+)
+
+// Poisoner contains a host which answered one of our honey name queries.
+type Poisoner struct {
+	ID string
+
+	IP  net.IP
+	MAC net.HardwareAddr
+
+	Name     string
+	Protocol string
+
+	FirstSeen time.Time
+}
+
+type poisonerTable struct {
+	m sync.Mutex
+
+	poisoners map[string]*Poisoner
+}
+
+// Add adds the poisoner, returning the existing entry when the host was
+// detected before.
+func (pt *poisonerTable) Add(p *Poisoner) *Poisoner {
+	pt.m.Lock()
+	defer pt.m.Unlock()
+
+	if existing, ok := pt.poisoners[p.IP.String()]; ok {
+		return existing
+	}
+
+	p.ID = xid.New().String()
+	pt.poisoners[p.IP.String()] = p
+	return p
+}
+
+// Get returns the poisoner with ip.
+func (pt *poisonerTable) Get(ip string) (*Poisoner, bool) {
+	pt.m.Lock()
+	defer pt.m.Unlock()
+
+	p, ok := pt.poisoners[ip]
+	return p, ok
+}
+
+// link adds the fields of the poisoner to events originating from a
+// detected poisoner.
+func (pt *poisonerTable) link(e event.Event) {
+	if e.Get("type") == "poisoner-detected" {
+		return
+	}
+
+	p, ok := pt.Get(e.Get("source-ip"))
+	if !ok {
+		return
+	}
+
+	event.Apply(e,
+		event.Severity("high"),
+		event.Custom("poisoner.id", p.ID),
+		event.Custom("poisoner.name", p.Name),
+	)
+}
+
+// poisonerChannel links the events of the canary to the poisoner detection.
+type poisonerChannel struct {
+	pushers.Channel
+
+	table *poisonerTable
+}
+
+func (pc *poisonerChannel) Send(e event.Event) {
+	pc.table.link(e)
+	pc.Channel.Send(e)
+}
+
+// Link implements listener.Linker, events of detected poisoners, like the
+// credentials they try against the decoy services, are linked to the
+// poisoner detection.
+func (c *Canary) Link(e event.Event) {
+	c.poisoners.link(e)
+}
+
+// dnsQuery returns a LLMNR or mDNS query for name.
+func dnsQuery(id uint16, name string) ([]byte, error) {
+	n, err := dnsmessage.NewName(name + ".")
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID: id,
+		},
+		Questions: []dnsmessage.Question{
+			{
+				Name:  n,
+				Type:  dnsmessage.TypeA,
+				Class: dnsmessage.ClassINET,
+			},
+		},
+	}
+
+	return msg.Pack()
+}
+
+// parseDNSAnswer returns the address of the A record answering name.
+func parseDNSAnswer(data []byte, name string) (net.IP, bool) {
+	msg := dnsmessage.Message{}
+	if err := msg.Unpack(data); err != nil {
+		return nil, false
+	}
+
+	if !msg.Header.Response {
+		return nil, false
+	}
+
+	for _, answer := range msg.Answers {
+		a, ok := answer.Body.(*dnsmessage.AResource)
+		if !ok {
+			continue
+		}
+
+		if !strings.EqualFold(strings.TrimSuffix(answer.Header.Name.String(), "."), name) {
+			continue
+		}
+
+		return net.IP(a.A[:]), true
+	}
+
+	return nil, false
+}
+
+// encodeNetBIOSName returns the first level encoding of a netbios name (RFC 1001).
+func encodeNetBIOSName(name string, suffix byte) []byte {
+	raw := []byte(strings.ToUpper(name))
+	if len(raw) > 15 {
+		raw = raw[:15]
+	}
+
+	raw = append(raw, bytes.Repeat([]byte{' '}, 15-len(raw))...)
+	raw = append(raw, suffix)
+
+	encoded := make([]byte, 0, 34)
+	encoded = append(encoded, 32)
+
+	for _, b := range raw {
+		encoded = append(encoded, 'A'+(b>>4), 'A'+(b&0x0f))
+	}
+
+	return append(encoded, 0)
+}
+
+// nbnsQuery returns a broadcast NetBIOS name query for name.
+func nbnsQuery(id uint16, name string) []byte {
+	data := make([]byte, 12)
+
+	binary.BigEndian.PutUint16(data[0:], id)
+	// recursion desired, broadcast
+	binary.BigEndian.PutUint16(data[2:], 0x0110)
+	binary.BigEndian.PutUint16(data[4:], 1)
+
+	data = append(data, encodeNetBIOSName(name, 0x20)...)
+
+	// type NB, class IN
+	return append(data, 0x00, 0x20, 0x00, 0x01)
+}
+
+// parseNBNSAnswer returns the address of a positive name query response.
+func parseNBNSAnswer(data []byte, id uint16, name string) (net.IP, error) {
+	if len(data) < 12+34+10+6 {
+		return nil, errInvalidNBNSResponse
+	}
+
+	if binary.BigEndian.Uint16(data[0:]) != id {
+		return nil, errInvalidNBNSResponse
+	}
+
+	flags := binary.BigEndian.Uint16(data[2:])
+	if flags&0x8000 == 0 || flags&0x000f != 0 {
+		return nil, errInvalidNBNSResponse
+	}
+
+	if binary.BigEndian.Uint16(data[6:]) == 0 {
+		return nil, errInvalidNBNSResponse
+	}
+
+	if !bytes.Equal(data[12:12+33], encodeNetBIOSName(name, 0x20)[:33]) {
+		return nil, errInvalidNBNSResponse
+	}
+
+	// skip name, type, class, ttl and rdlength, and the nb flags
+	offset := 12 + 34 + 10 + 2
+
+	return net.IP(append([]byte{}, data[offset:offset+4]...)), nil
+}
+
+func interfaceIPv4(intf net.Interface) (*net.IPNet, bool) {
+	addrs, err := intf.Addrs()
+	if err != nil {
+		return nil, false
+	}
+
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); !ok {
+		} else if ip4 := ipnet.IP.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: ipnet.Mask}, true
+		}
+	}
+
+	return nil, false
+}
+
+func broadcastAddr(ipnet *net.IPNet) net.IP {
+	broadcast := make(net.IP, 4)
+	for i := range broadcast {
+		broadcast[i] = ipnet.IP[i] | ^ipnet.Mask[len(ipnet.Mask)-4+i]
+	}
+
+	return broadcast
+}
+
+// probe sends honey name queries from intf, and reports hosts answering them.
+func (c *Canary) probe(intf net.Interface, name string) {
+	ipnet, ok := interfaceIPv4(intf)
+	if !ok {
+		return
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: ipnet.IP})
+	if err != nil {
+		log.Errorf("Could not create poisoner probe socket: %s", err.Error())
+		return
+	}
+
+	defer conn.Close()
+
+	pc := ipv4.NewPacketConn(conn)
+	if err := pc.SetMulticastInterface(&intf); err != nil {
+		log.Errorf("Could not set multicast interface: %s", err.Error())
+	}
+
+	pc.SetMulticastTTL(1)
+
+	id := uint16(rand.Intn(65536))
+
+	if data, err := dnsQuery(id, name); err != nil {
+		log.Errorf("Could not create llmnr query: %s", err.Error())
+	} else if _, err := conn.WriteToUDP(data, llmnrAddr); err != nil {
+		log.Errorf("Could not send llmnr query: %s", err.Error())
+	}
+
+	if data, err := dnsQuery(0, name+".local"); err != nil {
+		log.Errorf("Could not create mdns query: %s", err.Error())
+	} else if _, err := conn.WriteToUDP(data, mdnsAddr); err != nil {
+		log.Errorf("Could not send mdns query: %s", err.Error())
+	}
+
+	if _, err := conn.WriteToUDP(nbnsQuery(id, name), &net.UDPAddr{IP: broadcastAddr(ipnet), Port: 137}); err != nil {
+		log.Errorf("Could not send nbns query: %s", err.Error())
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// deadline reached
+			return
+		}
+
+		if addr.IP.Equal(ipnet.IP) {
+			continue
+		}
+
+		var (
+			answer   net.IP
+			protocol string
+		)
+
+		switch addr.Port {
+		case 5355:
+			protocol = "llmnr"
+			answer, ok = parseDNSAnswer(buf[:n], name)
+		case 5353:
+			protocol = "mdns"
+			answer, ok = parseDNSAnswer(buf[:n], name+".local")
+		case 137:
+			protocol = "nbns"
+			answer, err = parseNBNSAnswer(buf[:n], id, name)
+			ok = err == nil
+		default:
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		c.poisonerDetected(addr.IP, answer, name, protocol)
+	}
+}
+
+func (c *Canary) poisonerDetected(ip, answer net.IP, name, protocol string) {
+	mac := net.HardwareAddr{}
+
+	// refresh the arp cache, the poisoner will be in it after answering
+	if ac, err := parseARPCache("/proc/net/arp"); err != nil {
+	} else if ae := ac.Get(ip); ae != nil {
+		mac = ae.HardwareAddress
+	} else if ae := c.ac.Get(ip); ae != nil {
+		mac = ae.HardwareAddress
+	}
+
+	p := c.poisoners.Add(&Poisoner{
+		IP:        ip,
+		MAC:       mac,
+		Name:      name,
+		Protocol:  protocol,
+		FirstSeen: time.Now(),
+	})
+
+	c.events.Send(event.New(
+		CanaryOptions,
+		EventCategoryPoisoner,
+		event.Type("poisoner-detected"),
+		event.Severity("high"),
+		event.SourceIP(ip),
+		event.Custom("source-mac", mac.String()),
+		event.Custom("poisoner.id", p.ID),
+		event.Custom("poisoner.name", name),
+		event.Custom("poisoner.protocol", protocol),
+		event.Custom("poisoner.answer", answer.String()),
+		event.Custom("poisoner.first-seen", p.FirstSeen),
+	))
+}
+
+// poisonerDetector periodically probes all interfaces with one of the
+// configured honey names.
+func (c *Canary) poisonerDetector() {
+	interval := c.PoisonerInterval.Duration()
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	for {
+		name := c.PoisonerNames[rand.Intn(len(c.PoisonerNames))]
+
+		for _, intf := range c.networkInterfaces {
+			go c.probe(intf, name)
+		}
+
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,212 @@
+// +build linux
+
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package canary
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// The packets are the queries for the honey name fileserver02, and the
+// answers of a poisoner like Responder claiming it with 192.168.1.66, as
+// laid out by RFC 4795 (LLMNR), RFC 6762 (mDNS) and RFC 1002 (NBT-NS).
+const (
+	llmnrQuery    = "1234000000010000000000000c66696c6573657276657230320000010001"
+	llmnrResponse = "1234800000010001000000000c66696c65736572766572303200000100010c66696c65736572766572303200000100010000001e0004c0a80142"
+	mdnsResponse  = "0000840000010001000000000c66696c657365727665723032056c6f63616c0000010001c00c00018001000000780004c0a80142"
+	nbnsQueryData = "123401100001000000000000204547454a454d45464644454646434647454646434441444343414341434143410000200001"
+	nbnsResponse  = "123485000000000100000000204547454a454d45464644454646434647454646434441444343414341434143410000200001000000a500060000c0a80142"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestDNSQuery(t *testing.T) {
+	data, err := dnsQuery(0x1234, "fileserver02")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := mustHex(t, llmnrQuery); !bytes.Equal(data, expected) {
+		t.Errorf("Expected %x, got %x", expected, data)
+	}
+}
+
+func TestParseDNSAnswer(t *testing.T) {
+	for _, v := range []struct {
+		name     string
+		data     string
+		query    string
+		expected string
+	}{
+		{"llmnr", llmnrResponse, "fileserver02", "192.168.1.66"},
+		{"llmnr case insensitive", llmnrResponse, "FileServer02", "192.168.1.66"},
+		{"mdns compressed name", mdnsResponse, "fileserver02.local", "192.168.1.66"},
+		{"other name", llmnrResponse, "wpad", ""},
+		{"query", llmnrQuery, "fileserver02", ""},
+		{"truncated", llmnrResponse[:60], "fileserver02", ""},
+	} {
+		ip, ok := parseDNSAnswer(mustHex(t, v.data), v.query)
+
+		if v.expected == "" {
+			if ok {
+				t.Errorf("%s: expected no answer, got %s", v.name, ip)
+			}
+		} else if !ok || !ip.Equal(net.ParseIP(v.expected)) {
+			t.Errorf("%s: expected %s, got %s", v.name, v.expected, ip)
+		}
+	}
+}
+
+func TestEncodeNetBIOSName(t *testing.T) {
+	for _, v := range []struct {
+		name     string
+		suffix   byte
+		expected string
+	}{
+		// example of RFC 1001, 14.1
+		{"FRED", 0x20, "EGFCEFEECACACACACACACACACACACACA"},
+		{"fred", 0x20, "EGFCEFEECACACACACACACACACACACACA"},
+		{"WORKSTATION", 0x00, "FHEPFCELFDFEEBFEEJEPEOCACACACAAA"},
+		// truncated to 15 characters
+		{"ABCDEFGHIJKLMNOPQ", 0x20, "EBECEDEEEFEGEHEIEJEKELEMENEOEPCA"},
+	} {
+		encoded := encodeNetBIOSName(v.name, v.suffix)
+
+		if len(encoded) != 34 || encoded[0] != 32 || encoded[33] != 0 {
+			t.Errorf("%s: expected length prefixed name, got %x", v.name, encoded)
+		} else if string(encoded[1:33]) != v.expected {
+			t.Errorf("%s: expected %s, got %s", v.name, v.expected, encoded[1:33])
+		}
+	}
+}
+
+func TestNBNSQuery(t *testing.T) {
+	if data, expected := nbnsQuery(0x1234, "fileserver02"), mustHex(t, nbnsQueryData); !bytes.Equal(data, expected) {
+		t.Errorf("Expected %x, got %x", expected, data)
+	}
+}
+
+func TestParseNBNSAnswer(t *testing.T) {
+	response := mustHex(t, nbnsResponse)
+
+	negative := append([]byte{}, response...)
+	// name error
+	negative[3] = 0x03
+
+	for _, v := range []struct {
+		name     string
+		data     []byte
+		id       uint16
+		query    string
+		expected string
+	}{
+		{"positive", response, 0x1234, "fileserver02", "192.168.1.66"},
+		{"other id", response, 0x4321, "fileserver02", ""},
+		{"other name", response, 0x1234, "wpad", ""},
+		{"negative", negative, 0x1234, "fileserver02", ""},
+		{"query", mustHex(t, nbnsQueryData), 0x1234, "fileserver02", ""},
+		{"truncated", response[:61], 0x1234, "fileserver02", ""},
+	} {
+		ip, err := parseNBNSAnswer(v.data, v.id, v.query)
+
+		if v.expected == "" {
+			if err == nil {
+				t.Errorf("%s: expected no answer, got %s", v.name, ip)
+			}
+		} else if err != nil || !ip.Equal(net.ParseIP(v.expected)) {
+			t.Errorf("%s: expected %s, got %s (%v)", v.name, v.expected, ip, err)
+		}
+	}
+}
+
+func TestBroadcastAddr(t *testing.T) {
+	for _, v := range []struct {
+		ip       string
+		mask     net.IPMask
+		expected string
+	}{
+		{"192.168.1.10", net.CIDRMask(24, 32), "192.168.1.255"},
+		{"10.1.2.3", net.CIDRMask(8, 32), "10.255.255.255"},
+		{"172.16.5.4", net.CIDRMask(20, 32), "172.16.15.255"},
+		// masks of interfaces can be 16 bytes
+		{"192.168.1.10", net.CIDRMask(120, 128), "192.168.1.255"},
+	} {
+		ipnet := &net.IPNet{IP: net.ParseIP(v.ip).To4(), Mask: v.mask}
+
+		if b := broadcastAddr(ipnet); !b.Equal(net.ParseIP(v.expected)) {
+			t.Errorf("Expected broadcast %s for %s, got %s", v.expected, ipnet, b)
+		}
+	}
+}
+
+func TestLink(t *testing.T) {
+	c := &Canary{
+		poisoners: &poisonerTable{
+			poisoners: map[string]*Poisoner{},
+		},
+	}
+
+	p := c.poisoners.Add(&Poisoner{
+		IP:   net.ParseIP("192.168.1.66"),
+		Name: "fileserver02",
+	})
+
+	e := event.New(
+		event.Category("smb"),
+		event.SourceIP(net.ParseIP("192.168.1.66")),
+		event.Custom("smb.username", "administrator"),
+	)
+
+	c.Link(e)
+
+	if e.Get("poisoner.id") != p.ID || e.Get("poisoner.name") != "fileserver02" || e.Get("severity") != "high" {
+		t.Errorf("Expected the event to be linked to the poisoner, got %v", event.ToMap(e))
+	}
+
+	e = event.New(event.SourceIP(net.ParseIP("192.168.1.67")))
+
+	if c.Link(e); e.Has("poisoner.id") {
+		t.Errorf("Expected events of other sources not to be linked")
+	}
+}
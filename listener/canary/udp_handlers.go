@@ -38,6 +38,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/textproto"
+	"strings"
 
 	"github.com/google/gopacket/layers"
 	"github.com/honeytrap/honeytrap/event"
@@ -116,22 +118,44 @@ func (c *Canary) DecodeSSDP(iph *ipv4.Header, udph *udp.Header) error {
 }
 
 var (
-	// EventCategorySIP contains events for ntp traffic
+	// EventCategorySIP contains events for sip traffic
 	EventCategorySIP = event.Category("sip")
 )
 
-// DecodeSIP will decode NTP packets
+// DecodeSIP will decode SIP packets
 func (c *Canary) DecodeSIP(iph *ipv4.Header, udph *udp.Header) error {
-	request, err := http.ReadRequest(
+	tp := textproto.NewReader(
 		bufio.NewReader(
 			bytes.NewReader(udph.Payload),
 		),
 	)
+
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil
+	}
+
+	// SIP requests look like HTTP requests, but have SIP/2.0 as protocol
+	// and can use compact header names.
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "SIP/") {
+		return nil
+	}
+
+	header, err := tp.ReadMIMEHeader()
 	if err != nil {
 		// log error / send error channel
 		return nil
 	}
 
+	get := func(long, compact string) string {
+		if v := header.Get(long); v != "" {
+			return v
+		}
+
+		return header.Get(compact)
+	}
+
 	// add specific detections, reflection attack detection etc
 	c.events.Send(event.New(
 		CanaryOptions,
@@ -143,16 +167,16 @@ func (c *Canary) DecodeSIP(iph *ipv4.Header, udph *udp.Header) error {
 		event.SourcePort(udph.Source),
 		event.DestinationPort(udph.Destination),
 
-		event.Custom("sip.method", request.Method),
-		event.Custom("sip.uri", request.RequestURI),
-		event.Custom("sip.proto", request.Proto),
-		event.Custom("sip.headers", request.Header),
-		event.Custom("sip.from", request.Header.Get("From")),
-		event.Custom("sip.to", request.Header.Get("To")),
-		event.Custom("sip.via", request.Header.Get("Via")),
-		event.Custom("sip.contact", request.Header.Get("Contact")),
-		event.Custom("sip.call-id", request.Header.Get("Call-ID")),
-		event.Custom("sip.user-agent", request.Header.Get("User-Agent")),
+		event.Custom("sip.method", parts[0]),
+		event.Custom("sip.uri", parts[1]),
+		event.Custom("sip.proto", parts[2]),
+		event.Custom("sip.headers", header),
+		event.Custom("sip.from", get("From", "F")),
+		event.Custom("sip.to", get("To", "T")),
+		event.Custom("sip.via", get("Via", "V")),
+		event.Custom("sip.contact", get("Contact", "M")),
+		event.Custom("sip.call-id", get("Call-Id", "I")),
+		event.Custom("sip.user-agent", header.Get("User-Agent")),
 	))
 
 	return nil
@@ -33,6 +33,8 @@ package listener
 import (
 	"net"
 
+	"github.com/honeytrap/honeytrap/config"
+
 	logging "github.com/op/go-logging"
 )
 
@@ -47,6 +49,32 @@ func Register(key string, fn func(...func(Listener) error) (Listener, error)) fu
 	return fn
 }
 
+var (
+	descriptions = map[string]config.Description{}
+)
+
+// Describe registers the description of the listener, the description will
+// be used for listing, describing and validating listeners.
+func Describe(key string, d config.Description) config.Description {
+	d.Name = key
+	descriptions[key] = d
+	return d
+}
+
+// Description returns the description of the registered listener.
+func Description(key string) (config.Description, bool) {
+	if _, ok := listeners[key]; !ok {
+		return config.Description{}, false
+	}
+
+	d, ok := descriptions[key]
+	if !ok {
+		d = config.Description{Name: key}
+	}
+
+	return d, true
+}
+
 func Get(key string) (func(...func(Listener) error) (Listener, error), bool) {
 	d := Dummy
 
@@ -37,6 +37,7 @@ import (
 	"fmt"
 	"net"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/listener"
 	"github.com/honeytrap/honeytrap/pushers"
@@ -63,13 +64,20 @@ var log = logging.MustGetLogger("listener/netstack")
 
 var (
 	_ = listener.Register("netstack", New)
+	_ = listener.Describe("netstack", config.Description{
+		Description: "Userspace tcp/ip stack accepting connections on all ports",
+		Platforms:   []string{"linux"},
+		Config: func() interface{} {
+			return &netstackConfig{}
+		},
+	})
 )
 
 type netstackConfig struct {
 	Addresses []net.Addr
 
-	Addr       string   `toml:"addr"`
-	Interfaces []string `toml:"interfaces"`
+	Addr       string   `toml:"addr" doc:"Address of the stack"`
+	Interfaces []string `toml:"interfaces" doc:"Interfaces to capture on" required:"true"`
 }
 
 func (nc *netstackConfig) AddAddress(a net.Addr) {
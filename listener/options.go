@@ -34,6 +34,7 @@ import (
 	"net"
 
 	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 )
 
@@ -41,6 +42,19 @@ type AddAddresser interface {
 	AddAddress(net.Addr)
 }
 
+// RemoveAddresser is implemented by listeners which can stop listening on
+// an address, when the services using it have been removed.
+type RemoveAddresser interface {
+	RemoveAddress(net.Addr)
+}
+
+// Linker is implemented by listeners adding fields to the events of
+// services and directors, like the canary linking the events of detected
+// poisoners to the detection.
+type Linker interface {
+	Link(event.Event)
+}
+
 func WithAddress(protocol, address string) func(Listener) error {
 	return func(l Listener) error {
 		if a, ok := l.(AddAddresser); ok {
@@ -31,10 +31,14 @@
 package network
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sync"
 
 	"github.com/fatih/color"
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/listener"
 	logging "github.com/op/go-logging"
 )
@@ -43,6 +47,9 @@ var log = logging.MustGetLogger("listeners/socket")
 
 var (
 	_ = listener.Register("socket", New)
+	_ = listener.Describe("socket", config.Description{
+		Description: "Listens on the ports of the configured services",
+	})
 )
 
 type socketListener struct {
@@ -51,6 +58,11 @@ type socketListener struct {
 	ch chan net.Conn
 
 	net.Listener
+
+	m       sync.Mutex
+	started bool
+	closers map[string]io.Closer
+	closed  chan struct{}
 }
 
 type socketConfig struct {
@@ -67,6 +79,8 @@ func New(options ...func(listener.Listener) error) (listener.Listener, error) {
 	l := socketListener{
 		socketConfig: socketConfig{},
 		ch:           ch,
+		closers:      map[string]io.Closer{},
+		closed:       make(chan struct{}),
 	}
 
 	for _, option := range options {
@@ -76,63 +90,175 @@ func New(options ...func(listener.Listener) error) (listener.Listener, error) {
 	return &l, nil
 }
 
+// AddAddress adds the address, when the listener has been started already it
+// will start listening on the address immediately.
+func (sl *socketListener) AddAddress(a net.Addr) {
+	sl.m.Lock()
+	started := sl.started
+	sl.m.Unlock()
+
+	sl.socketConfig.AddAddress(a)
+
+	if started {
+		sl.listen(a)
+	}
+}
+
+// RemoveAddress stops listening on the address, active connections are
+// not affected.
+func (sl *socketListener) RemoveAddress(a net.Addr) {
+	sl.m.Lock()
+	defer sl.m.Unlock()
+
+	key := addrKey(a)
+
+	for i, address := range sl.Addresses {
+		if addrKey(address) == key {
+			sl.Addresses = append(sl.Addresses[:i], sl.Addresses[i+1:]...)
+			break
+		}
+	}
+
+	if c, ok := sl.closers[key]; ok {
+		delete(sl.closers, key)
+		c.Close()
+
+		log.Infof("Listener stopped: %s", a)
+	}
+}
+
+func addrKey(a net.Addr) string {
+	return a.Network() + "/" + a.String()
+}
+
 func (sl *socketListener) Start() error {
+	sl.m.Lock()
+	sl.started = true
+	sl.m.Unlock()
+
 	for _, address := range sl.Addresses {
-		if _, ok := address.(*net.TCPAddr); ok {
-			l, err := net.Listen(address.Network(), address.String())
-			if err != nil {
-				fmt.Println(color.RedString("Error starting listener: %s", err.Error()))
-				continue
-			}
+		sl.listen(address)
+	}
+
+	return nil
+}
+
+func (sl *socketListener) listen(address net.Addr) {
+	if _, ok := address.(*net.TCPAddr); ok {
+		l, err := net.Listen(address.Network(), address.String())
+		if err != nil {
+			fmt.Println(color.RedString("Error starting listener: %s", err.Error()))
+			return
+		}
 
-			log.Infof("Listener started: %s", address)
+		log.Infof("Listener started: %s", address)
 
-			go func() {
-				for {
-					c, err := l.Accept()
-					if err != nil {
-						log.Errorf("Error accepting connection: %s", err.Error())
-						continue
-					}
+		sl.addCloser(address, l)
 
-					sl.ch <- c
+		go func() {
+			for {
+				c, err := l.Accept()
+				if sl.isClosed() || sl.isRemoved(address, l) {
+					return
+				} else if err != nil {
+					log.Errorf("Error accepting connection: %s", err.Error())
+					continue
+				}
+
+				select {
+				case sl.ch <- c:
+				case <-sl.closed:
+					c.Close()
+					return
 				}
-			}()
-		} else if ua, ok := address.(*net.UDPAddr); ok {
-			l, err := net.ListenUDP(address.Network(), ua)
-			if err != nil {
-				fmt.Println(color.RedString("Error starting listener: %s", err.Error()))
-				continue
 			}
+		}()
+	} else if ua, ok := address.(*net.UDPAddr); ok {
+		l, err := net.ListenUDP(address.Network(), ua)
+		if err != nil {
+			fmt.Println(color.RedString("Error starting listener: %s", err.Error()))
+			return
+		}
 
-			log.Infof("Listener started: %s", address)
+		log.Infof("Listener started: %s", address)
 
-			go func() {
+		sl.addCloser(address, l)
 
-				for {
-					var buf [65535]byte
+		go func() {
 
-					n, raddr, err := l.ReadFromUDP(buf[:])
-					if err != nil {
-						log.Error("Error reading udp:", err.Error())
-						continue
-					}
+			for {
+				var buf [65535]byte
 
-					sl.ch <- &listener.DummyUDPConn{
-						Buffer: buf[:n],
-						Laddr:  ua,
-						Raddr:  raddr,
-						C:      l,
-					}
+				n, raddr, err := l.ReadFromUDP(buf[:])
+				if sl.isClosed() || sl.isRemoved(address, l) {
+					return
+				} else if err != nil {
+					log.Error("Error reading udp:", err.Error())
+					continue
 				}
-			}()
-		}
+
+				select {
+				case sl.ch <- &listener.DummyUDPConn{
+					Buffer: buf[:n],
+					Laddr:  ua,
+					Raddr:  raddr,
+					C:      l,
+				}:
+				case <-sl.closed:
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (sl *socketListener) addCloser(a net.Addr, c io.Closer) {
+	sl.m.Lock()
+	defer sl.m.Unlock()
+
+	sl.closers[addrKey(a)] = c
+}
+
+// isRemoved returns whether c no longer listens on the address.
+func (sl *socketListener) isRemoved(a net.Addr, c io.Closer) bool {
+	sl.m.Lock()
+	defer sl.m.Unlock()
+
+	return sl.closers[addrKey(a)] != c
+}
+
+func (sl *socketListener) isClosed() bool {
+	select {
+	case <-sl.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops listening on all addresses.
+func (sl *socketListener) Close() error {
+	sl.m.Lock()
+	defer sl.m.Unlock()
+
+	if sl.isClosed() {
+		return nil
+	}
+
+	close(sl.closed)
+
+	for _, c := range sl.closers {
+		c.Close()
 	}
 
 	return nil
 }
 
 func (sl *socketListener) Accept() (net.Conn, error) {
-	c := <-sl.ch
-	return c, nil
+	select {
+	case c := <-sl.ch:
+		return c, nil
+	case <-sl.closed:
+		return nil, errors.New("listener closed")
+	}
 }
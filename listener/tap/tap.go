@@ -34,6 +34,7 @@ import (
 	"fmt"
 	"net"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/listener"
 	"github.com/honeytrap/honeytrap/pushers"
 	logging "github.com/op/go-logging"
@@ -47,6 +48,9 @@ var log = logging.MustGetLogger("honeytrap:listener:tap")
 
 var (
 	_ = listener.Register("tap", New)
+	_ = listener.Describe("tap", config.Description{
+		Description: "Accepts connections from a tap device",
+	})
 )
 
 type tapConfig struct {
@@ -33,6 +33,7 @@ package tun
 import (
 	"net"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/listener"
 	"github.com/honeytrap/honeytrap/pushers"
@@ -51,6 +52,9 @@ var log = logging.MustGetLogger("listener/tun")
 
 var (
 	_ = listener.Register("tun", New)
+	_ = listener.Describe("tun", config.Description{
+		Description: "Accepts connections from a tun device",
+	})
 )
 
 type tunConfig struct {
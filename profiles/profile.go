@@ -0,0 +1,240 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package profiles
+
+import (
+	"strings"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// limits of the values kept per profile, the counters keep counting.
+const (
+	maxServices    = 64
+	maxCredentials = 1000
+	maxCommands    = 1000
+	maxHashes      = 100
+	maxPorts       = 1000
+	maxSources     = 100
+)
+
+// Credential is a username and password pair, with the number of attempts.
+type Credential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Count    int    `json:"count"`
+}
+
+// Profile aggregates the events of an attacker, identified by the source
+// address or by a fingerprint, like the ssh client version.
+type Profile struct {
+	// Key is the source address or the fingerprint, Kind is ip or the
+	// field of the fingerprint
+	Key  string `json:"key"`
+	Kind string `json:"kind"`
+
+	FirstSeen time.Time `json:"first-seen"`
+	LastSeen  time.Time `json:"last-seen"`
+
+	Events   int `json:"events"`
+	Sessions int `json:"sessions"`
+
+	// Services contains the number of events per service
+	Services map[string]int `json:"services"`
+
+	Credentials        []Credential `json:"credentials"`
+	CredentialAttempts int          `json:"credential-attempts"`
+
+	// Commands contains the number of times per command
+	Commands map[string]int `json:"commands"`
+
+	// Hashes contains the sha256 hashes of the payloads and downloads
+	Hashes []string `json:"hashes"`
+
+	// Ports contains the ports scanned, detected by the canary
+	Ports []string `json:"ports"`
+
+	// Sources contains the addresses of fingerprint profiles
+	Sources []string `json:"sources,omitempty"`
+
+	// IOCConfidence is the highest confidence of matching indicators of
+	// compromise
+	IOCConfidence int `json:"ioc-confidence"`
+
+	Score int `json:"score"`
+
+	// Threshold is the highest threshold the score has reached
+	Threshold int `json:"threshold"`
+}
+
+func newProfile(kind, key string) *Profile {
+	return &Profile{
+		Key:         key,
+		Kind:        kind,
+		Services:    map[string]int{},
+		Credentials: []Credential{},
+		Commands:    map[string]int{},
+		Hashes:      []string{},
+		Ports:       []string{},
+	}
+}
+
+func appendUnique(values []string, max int, s string) []string {
+	if s == "" || len(values) >= max {
+		return values
+	}
+
+	for _, v := range values {
+		if v == s {
+			return values
+		}
+	}
+
+	return append(values, s)
+}
+
+func (p *Profile) addCredential(username, password string) {
+	p.CredentialAttempts++
+
+	for i := range p.Credentials {
+		if c := &p.Credentials[i]; c.Username == username && c.Password == password {
+			c.Count++
+			return
+		}
+	}
+
+	if len(p.Credentials) < maxCredentials {
+		p.Credentials = append(p.Credentials, Credential{username, password, 1})
+	}
+}
+
+// fieldsWithSuffix returns the string values of the fields ending with
+// suffix, like ssh.username for .username.
+func fieldsWithSuffix(e event.Event, suffix string) map[string]string {
+	m := map[string]string{}
+
+	e.Range(func(key, value interface{}) bool {
+		if name, ok := key.(string); !ok {
+		} else if !strings.HasSuffix(name, suffix) {
+		} else if s, ok := e.GetString(name); ok {
+			m[strings.TrimSuffix(name, suffix)] = s
+		}
+
+		return true
+	})
+
+	return m
+}
+
+// update aggregates the event.
+func (p *Profile) update(e event.Event, now time.Time) {
+	if p.FirstSeen.IsZero() {
+		p.FirstSeen = now
+	}
+
+	p.LastSeen = now
+	p.Events++
+
+	if e.Get("type") == "session-start" {
+		p.Sessions++
+	}
+
+	if service := e.Get("service"); service == "" {
+	} else if _, ok := p.Services[service]; ok || len(p.Services) < maxServices {
+		p.Services[service]++
+	}
+
+	for prefix, username := range fieldsWithSuffix(e, ".username") {
+		if password, ok := e.GetString(prefix + ".password"); ok {
+			p.addCredential(username, password)
+		}
+	}
+
+	commands := fieldsWithSuffix(e, ".command")
+	if command, ok := e.GetString("command"); ok {
+		commands[""] = command
+	}
+
+	for _, command := range commands {
+		if _, ok := p.Commands[command]; ok || len(p.Commands) < maxCommands {
+			p.Commands[command]++
+		}
+	}
+
+	for _, name := range []string{"artifact.sha256", "download.sha256"} {
+		p.Hashes = appendUnique(p.Hashes, maxHashes, e.Get(name))
+	}
+
+	if v, ok := e.Load("portscan.ports"); !ok {
+	} else if ports, ok := v.([]string); ok {
+		for _, port := range ports {
+			p.Ports = appendUnique(p.Ports, maxPorts, port)
+		}
+	}
+
+	if p.Kind != "ip" {
+		p.Sources = appendUnique(p.Sources, maxSources, e.Get("source-ip"))
+	}
+
+	if confidence, ok := e.GetInt("ioc.confidence"); ok && int(confidence) > p.IOCConfidence {
+		p.IOCConfidence = int(confidence)
+	}
+
+	p.Score = p.score()
+}
+
+func atMost(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// score returns the risk score of the profile, 0-100:
+//
+//	services      5 per service, at most 20
+//	credentials   1 per 10 attempts, at most 20
+//	commands      2 per command, at most 20
+//	hashes        15 per payload or download, at most 30
+//	ports         1 per 10 ports scanned, at most 10
+//	ioc           a fifth of the ioc confidence, at most 20
+func (p *Profile) score() int {
+	score := atMost(5*len(p.Services), 20) +
+		atMost(p.CredentialAttempts/10, 20) +
+		atMost(2*len(p.Commands), 20) +
+		atMost(15*len(p.Hashes), 30) +
+		atMost(len(p.Ports)/10, 10) +
+		atMost(p.IOCConfidence/5, 20)
+
+	return atMost(score, 100)
+}
@@ -0,0 +1,468 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package profiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:profiles")
+
+// ErrNotFound is returned for unknown profiles.
+var ErrNotFound = errors.New("profile not found")
+
+// keyPrefix is the prefix of the keys of the profiles in the backend.
+const keyPrefix = "profile/"
+
+// Config contains the configuration of the profiles.
+type Config struct {
+	Enabled bool `toml:"enabled"`
+
+	// Fingerprints contains the fields which identify attackers besides
+	// the source address, like ssh.client-version
+	Fingerprints []string `toml:"fingerprints"`
+
+	// Thresholds of the score, an attacker-profile-updated event is sent
+	// when the score of a profile reaches a threshold
+	Thresholds []int `toml:"thresholds"`
+
+	FlushInterval config.Delay `toml:"flush-interval"`
+
+	// MaxProfiles is the number of profiles kept in memory
+	MaxProfiles int `toml:"max-profiles"`
+}
+
+// DefaultConfig contains the default configuration.
+var DefaultConfig = Config{
+	Fingerprints:  []string{},
+	Thresholds:    []int{25, 50, 75},
+	FlushInterval: config.Delay(10 * time.Second),
+	MaxProfiles:   10000,
+}
+
+// Validate returns an error when the configuration is invalid.
+func (c Config) Validate() error {
+	for _, t := range c.Thresholds {
+		if t <= 0 || t > 100 {
+			return fmt.Errorf("invalid threshold %d, expected 1-100", t)
+		}
+	}
+
+	if c.FlushInterval.Duration() <= 0 {
+		return fmt.Errorf("invalid flush-interval %s", c.FlushInterval.Duration())
+	} else if c.MaxProfiles <= 0 {
+		return fmt.Errorf("invalid max-profiles %d", c.MaxProfiles)
+	}
+
+	return nil
+}
+
+// Backend persists the profiles, the storage package provides a backend.
+type Backend interface {
+	Get(key string) ([]byte, error)
+	Set(key string, data []byte) error
+	Range(prefix string, fn func(key string, data []byte) bool) error
+}
+
+// Store aggregates the events into profiles per source address and
+// fingerprint. The profiles are kept in memory, and written to the backend
+// periodically.
+type Store struct {
+	Config
+
+	backend Backend
+	c       pushers.Channel
+
+	m        sync.Mutex
+	profiles map[string]*Profile
+	dirty    map[string]bool
+
+	// stored contains the keys of the profiles in the backend, profiles of
+	// new sources are created without reading the backend
+	stored map[string]bool
+
+	// writing contains the keys of the profiles being written
+	writing map[string]bool
+
+	// flushing serializes the writes, these are done without holding m
+	flushing sync.Mutex
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open returns the store of the backend, events are sent to the channel.
+func Open(c Config, backend Backend, channel pushers.Channel) (*Store, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	thresholds := append([]int{}, c.Thresholds...)
+	sort.Ints(thresholds)
+
+	c.Thresholds = thresholds
+
+	s := &Store{
+		Config:   c,
+		backend:  backend,
+		c:        channel,
+		profiles: map[string]*Profile{},
+		dirty:    map[string]bool{},
+		stored:   map[string]bool{},
+		writing:  map[string]bool{},
+		done:     make(chan struct{}),
+	}
+
+	err := backend.Range(keyPrefix, func(key string, data []byte) bool {
+		s.stored[key] = true
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s, nil
+}
+
+func storeKey(kind, key string) string {
+	return keyPrefix + kind + "/" + key
+}
+
+func (s *Store) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.FlushInterval.Duration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				log.Errorf("Error writing profiles: %s", err.Error())
+			}
+		}
+	}
+}
+
+// Flush writes the modified profiles to the backend. The profiles are
+// written without holding the lock, enriching events doesn't wait for the
+// backend.
+func (s *Store) Flush() error {
+	s.flushing.Lock()
+	defer s.flushing.Unlock()
+
+	s.m.Lock()
+
+	snapshot := map[string][]byte{}
+	for key := range s.dirty {
+		data, err := json.Marshal(s.profiles[key])
+		if err != nil {
+			s.m.Unlock()
+			return err
+		}
+
+		snapshot[key] = data
+		s.writing[key] = true
+	}
+
+	s.dirty = map[string]bool{}
+
+	s.m.Unlock()
+
+	var err error
+	for key, data := range snapshot {
+		if err = s.backend.Set(key, data); err != nil {
+			break
+		}
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for key := range snapshot {
+		delete(s.writing, key)
+
+		if err != nil {
+			// written with the next flush
+			s.dirty[key] = true
+		} else {
+			s.stored[key] = true
+		}
+	}
+
+	return err
+}
+
+// Close writes the modified profiles and stops the store.
+func (s *Store) Close() error {
+	close(s.done)
+	s.wg.Wait()
+
+	return s.Flush()
+}
+
+// evict removes the least recently seen profiles from memory, when there
+// are more than max-profiles. Only stored profiles are evicted, modified
+// profiles are evicted after the next flush. The lock must be held.
+func (s *Store) evict() {
+	if len(s.profiles) <= s.MaxProfiles {
+		return
+	}
+
+	keys := make([]string, 0, len(s.profiles))
+	for key := range s.profiles {
+		if s.stored[key] && !s.dirty[key] && !s.writing[key] {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return s.profiles[keys[i]].LastSeen.Before(s.profiles[keys[j]].LastSeen)
+	})
+
+	// evict a tenth, so eviction doesn't happen for every new profile
+	n := len(s.profiles) - s.MaxProfiles*9/10
+	if n > len(keys) {
+		n = len(keys)
+	}
+
+	for _, key := range keys[:n] {
+		delete(s.profiles, key)
+	}
+}
+
+// load returns the profile from memory or from the backend. The lock must
+// be held.
+func (s *Store) load(kind, key string) (*Profile, bool) {
+	sk := storeKey(kind, key)
+	if p, ok := s.profiles[sk]; ok {
+		return p, true
+	} else if !s.stored[sk] {
+		return nil, false
+	}
+
+	data, err := s.backend.Get(sk)
+	if err != nil {
+		return nil, false
+	}
+
+	p := newProfile(kind, key)
+	if err := json.Unmarshal(data, p); err != nil {
+		log.Errorf("Error reading profile %s: %s", sk, err.Error())
+		return nil, false
+	}
+
+	s.profiles[sk] = p
+	return p, true
+}
+
+func clone(p *Profile) *Profile {
+	data, _ := json.Marshal(p)
+
+	c := &Profile{}
+	json.Unmarshal(data, c)
+	return c
+}
+
+// Get returns the profile of the kind, ip or the field of the fingerprint.
+func (s *Store) Get(kind, key string) (*Profile, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	p, ok := s.load(kind, key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return clone(p), nil
+}
+
+// List returns the profiles with at least the score, the highest scores
+// first. Limit restricts the number of profiles, 0 returns every profile.
+func (s *Store) List(minScore, limit int) ([]*Profile, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+
+	list := []*Profile{}
+
+	err := s.backend.Range(keyPrefix, func(key string, data []byte) bool {
+		p := &Profile{}
+		if err := json.Unmarshal(data, p); err != nil {
+			log.Errorf("Error reading profile %s: %s", key, err.Error())
+		} else if p.Score >= minScore {
+			list = append(list, p)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+
+		return list[i].LastSeen.After(list[j].LastSeen)
+	})
+
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+
+	return list, nil
+}
+
+// updated returns the attacker-profile-updated event of the profile.
+func updated(p *Profile) event.Event {
+	services := []string{}
+	for service := range p.Services {
+		services = append(services, service)
+	}
+
+	sort.Strings(services)
+
+	options := []event.Option{
+		event.Sensor("honeytrap"),
+		event.Category("profile"),
+		event.Type("attacker-profile-updated"),
+		event.Severity("warning"),
+		event.Custom("profile.key", p.Key),
+		event.Custom("profile.kind", p.Kind),
+		event.Custom("profile.score", p.Score),
+		event.Custom("profile.threshold", p.Threshold),
+		event.Custom("profile.first-seen", p.FirstSeen),
+		event.Custom("profile.events", p.Events),
+		event.Custom("profile.sessions", p.Sessions),
+		event.Custom("profile.services", strings.Join(services, ",")),
+		event.Custom("profile.credential-attempts", p.CredentialAttempts),
+		event.Custom("profile.commands", len(p.Commands)),
+		event.Custom("profile.hashes", strings.Join(p.Hashes, ",")),
+		event.Custom("profile.ports", len(p.Ports)),
+		event.Message("Profile %s reached score %d", p.Key, p.Score),
+	}
+
+	if p.Kind == "ip" {
+		options = append(options, event.Custom("source-ip", p.Key))
+	}
+
+	return event.New(options...)
+}
+
+// Enrich implements enrichers.Enricher, the event is aggregated into the
+// profiles of the source address and the fingerprints. The event gets
+// profile.score, the score of the source address.
+func (s *Store) Enrich(e event.Event) error {
+	// the events of the store itself
+	if e.Get("category") == "profile" {
+		return nil
+	}
+
+	type key struct{ kind, key string }
+
+	keys := []key{}
+
+	if ip := e.Get("source-ip"); ip != "" {
+		keys = append(keys, key{"ip", ip})
+	}
+
+	for _, field := range s.Fingerprints {
+		if v, ok := e.GetString(field); ok && v != "" {
+			keys = append(keys, key{field, v})
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	events := []event.Event{}
+
+	s.m.Lock()
+
+	for _, k := range keys {
+		p, ok := s.load(k.kind, k.key)
+		if !ok {
+			p = newProfile(k.kind, k.key)
+			s.profiles[storeKey(k.kind, k.key)] = p
+		}
+
+		p.update(e, now)
+		s.dirty[storeKey(k.kind, k.key)] = true
+
+		if k.kind == "ip" {
+			e.Store("profile.score", p.Score)
+		}
+
+		threshold := p.Threshold
+		for _, t := range s.Thresholds {
+			if p.Score >= t {
+				threshold = t
+			}
+		}
+
+		if threshold > p.Threshold {
+			p.Threshold = threshold
+			events = append(events, updated(p))
+		}
+	}
+
+	s.evict()
+
+	s.m.Unlock()
+
+	// sent without the lock, as the events are enriched as well
+	for _, e := range events {
+		s.c.Send(e)
+	}
+
+	return nil
+}
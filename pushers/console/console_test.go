@@ -29,3 +29,56 @@
 * must display the words "Powered by Honeytrap" and retain the original copyright notice.
  */
 package console_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/pushers/console"
+)
+
+// slowWriter takes a while to write, like a blocked terminal.
+type slowWriter struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(100 * time.Millisecond)
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.buf.Write(p)
+}
+
+func (w *slowWriter) Len() int {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.buf.Len()
+}
+
+func TestFlush(t *testing.T) {
+	w := &slowWriter{}
+
+	c, err := console.New(func(c pushers.Channel) error {
+		c.(*console.Console).Writer = w
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Send(event.New(event.Sensor("test"), event.Category("flush")))
+
+	if !pushers.Flush(c, time.Second) {
+		t.Fatal("Expected flush to finish")
+	} else if w.Len() == 0 {
+		t.Errorf("Expected the event to be written after flush")
+	}
+}
@@ -0,0 +1,228 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pushers
+
+import (
+	"net"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// ECSVersion is the version of the Elastic Common Schema the events are
+// normalised to.
+const ECSVersion = "1.12.0"
+
+// ecsFields maps the fields of the event schema to ecs fields.
+var ecsFields = map[string]string{
+	"date":                "@timestamp",
+	"message":             "message",
+	"sensor":              "event.provider",
+	"type":                "event.action",
+	"token":               "agent.id",
+	"service":             "service.name",
+	"protocol":            "network.transport",
+	"error":               "error.message",
+	"stacktrace":          "error.stack_trace",
+	"source-ip":           "source.ip",
+	"source-port":         "source.port",
+	"destination-ip":      "destination.ip",
+	"destination-port":    "destination.port",
+	"duration":            "event.duration",
+	"bytes-received":      "source.bytes",
+	"bytes-sent":          "destination.bytes",
+	"http.url":            "url.original",
+	"http.host":           "url.domain",
+	"http.method":         "http.request.method",
+	"http.referer":        "http.request.referrer",
+	"http.content-length": "http.request.body.bytes",
+
+	// fields added by the enrichers
+	"source.country-code":      "source.geo.country_iso_code",
+	"source.country":           "source.geo.country_name",
+	"source.city":              "source.geo.city_name",
+	"source.latitude":          "source.geo.location.lat",
+	"source.longitude":         "source.geo.location.lon",
+	"source.asn":               "source.as.number",
+	"source.as-org":            "source.as.organization.name",
+	"source.hostname":          "source.domain",
+	"destination.country-code": "destination.geo.country_iso_code",
+	"destination.country":      "destination.geo.country_name",
+	"destination.city":         "destination.geo.city_name",
+	"destination.latitude":     "destination.geo.location.lat",
+	"destination.longitude":    "destination.geo.location.lon",
+	"destination.asn":          "destination.as.number",
+	"destination.as-org":       "destination.as.organization.name",
+	"destination.hostname":     "destination.domain",
+
+	// payloads moved to the artifact store
+	"artifact.sha256": "file.hash.sha256",
+	"artifact.sha1":   "file.hash.sha1",
+	"artifact.md5":    "file.hash.md5",
+	"artifact.size":   "file.size",
+	"artifact.mime":   "file.mime_type",
+
+	// files downloaded by the fetcher
+	"download.url":    "url.original",
+	"download.sha256": "file.hash.sha256",
+	"download.sha1":   "file.hash.sha1",
+	"download.md5":    "file.hash.md5",
+	"download.ssdeep": "file.hash.ssdeep",
+	"download.size":   "file.size",
+	"download.mime":   "file.mime_type",
+}
+
+// ecsPatterns maps the fields of protocols to ecs fields.
+var ecsPatterns = []struct {
+	pattern string
+	field   string
+}{
+	{"*.username", "user.name"},
+	{"*.user-agent", "user_agent.original"},
+}
+
+func ecsField(name string) (string, bool) {
+	if field, ok := ecsFields[name]; ok {
+		return field, true
+	}
+
+	for _, p := range ecsPatterns {
+		if ok, _ := path.Match(p.pattern, name); ok {
+			return p.field, true
+		}
+	}
+
+	return "", false
+}
+
+// ecsValue returns the value of the field, converted to the type of the
+// field in the event schema.
+func ecsValue(e event.Event, name string, v interface{}) interface{} {
+	f, ok := event.LookupField(name)
+	if !ok {
+		return v
+	}
+
+	switch f.Type {
+	case event.TypeString:
+		if s, ok := e.GetString(name); ok {
+			return s
+		}
+	case event.TypeInt:
+		if i, ok := e.GetInt(name); ok {
+			return i
+		}
+	case event.TypeIP:
+		if ip, ok := e.GetIP(name); ok {
+			return ip.String()
+		}
+	case event.TypeTime:
+		if t, ok := e.GetTime(name); ok {
+			return t
+		}
+	case event.TypeDuration:
+		// ecs durations are in nanoseconds
+		if d, ok := e.GetDuration(name); ok {
+			return d.Nanoseconds()
+		}
+	}
+
+	return v
+}
+
+// ECS returns the event normalised to the Elastic Common Schema. Fields
+// without ecs equivalent are kept in the honeytrap namespace, like
+// honeytrap.ssh.password.
+func ECS(e event.Event) event.Event {
+	n := event.New()
+	n.Delete("date")
+
+	n.Store("ecs.version", ECSVersion)
+	n.Store("event.module", "honeytrap")
+	n.Store("honeytrap.schema-version", event.SchemaVersion)
+
+	severity := SeverityOf(e)
+
+	n.Store("event.severity", severity)
+	if severity >= severities["warning"] {
+		n.Store("event.kind", "alert")
+	} else {
+		n.Store("event.kind", "event")
+	}
+
+	e.Range(func(key, value interface{}) bool {
+		name, ok := key.(string)
+		if !ok {
+			return true
+		}
+
+		switch name {
+		case "category":
+			n.Store("event.dataset", "honeytrap."+e.Get("category"))
+		case "severity":
+			n.Store("log.level", strings.ToLower(e.Get("severity")))
+		case "payload":
+			n.Store("honeytrap.payload.text", value)
+		case "payload-hex":
+			n.Store("honeytrap.payload.hex", value)
+		case "payload-length":
+			n.Store("honeytrap.payload.length", ecsValue(e, name, value))
+		case "remote-addr", "host-addr":
+			prefix := "source"
+			if name == "host-addr" {
+				prefix = "destination"
+			}
+
+			// deprecated, used when the event lacks the address fields
+			if e.Has(prefix + "-ip") {
+			} else if host, port, err := net.SplitHostPort(e.Get(name)); err != nil {
+				n.Store("honeytrap."+name, value)
+			} else if port, err := strconv.Atoi(port); err != nil {
+				n.Store("honeytrap."+name, value)
+			} else {
+				n.Store(prefix+".ip", host)
+				n.Store(prefix+".port", int64(port))
+			}
+		default:
+			if field, ok := ecsField(name); ok {
+				n.Store(field, ecsValue(e, name, value))
+			} else {
+				n.Store("honeytrap."+name, ecsValue(e, name, value))
+			}
+		}
+
+		return true
+	})
+
+	return n
+}
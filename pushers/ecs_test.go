@@ -0,0 +1,97 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pushers
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func TestECS(t *testing.T) {
+	e := event.New(
+		event.Category("http"),
+		event.Type("request"),
+		event.Severity("warning"),
+		event.SourceAddr(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 52812}),
+		event.DestinationAddr(&net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 80}),
+		event.Custom("http.url", "/login"),
+		event.Custom("http.username", "admin"),
+		event.Custom("http.password", "secret"),
+		event.Custom("duration", 1.5),
+	)
+
+	n := ECS(e)
+
+	expected := map[string]interface{}{
+		"ecs.version":             ECSVersion,
+		"event.dataset":           "honeytrap.http",
+		"event.action":            "request",
+		"event.kind":              "alert",
+		"source.ip":               "192.0.2.1",
+		"source.port":             int64(52812),
+		"destination.ip":          "198.51.100.7",
+		"destination.port":        int64(80),
+		"url.original":            "/login",
+		"user.name":               "admin",
+		"honeytrap.http.password": "secret",
+		"event.duration":          int64(1500 * time.Millisecond),
+	}
+
+	for field, value := range expected {
+		if v, ok := n.Load(field); !ok {
+			t.Errorf("Expected field %s", field)
+		} else if v != value {
+			t.Errorf("Expected %s to be %#v, got %#v", field, value, v)
+		}
+	}
+
+	if _, ok := n.Load("@timestamp"); !ok {
+		t.Errorf("Expected field @timestamp")
+	} else if n.Has("date") {
+		t.Errorf("Expected date to be mapped")
+	}
+}
+
+func TestFormatChannel(t *testing.T) {
+	if _, err := FormatChannel(MustDummy(), "xml"); err == nil {
+		t.Errorf("Expected error for unknown format")
+	}
+
+	c := MustDummy()
+	if d, err := FormatChannel(c, "honeytrap"); err != nil {
+		t.Fatal(err)
+	} else if d != c {
+		t.Errorf("Expected honeytrap format to send the events as is")
+	}
+}
@@ -32,6 +32,8 @@ package elasticsearch
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 
 	"time"
 
@@ -39,6 +41,7 @@ import (
 
 	elastic "gopkg.in/olivere/elastic.v5"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 
@@ -47,6 +50,17 @@ import (
 
 var (
 	_ = pushers.Register("elasticsearch", New)
+	_ = pushers.Describe("elasticsearch", config.Description{
+		Description: "Indexes the events in elasticsearch",
+		Config: func() interface{} {
+			// Config is decoded by UnmarshalTOML
+			return &struct {
+				URL      string `toml:"url" doc:"Url of the server, including the index" required:"true"`
+				Username string `toml:"username" doc:"Username for basic authentication"`
+				Password string `toml:"password" doc:"Password for basic authentication" secret:"true"`
+			}{}
+		},
+	})
 )
 
 var log = logging.MustGetLogger("channels/elasticsearch")
@@ -58,13 +72,20 @@ type ElasticSearchBackend struct {
 
 	es *elastic.Client
 	ch chan map[string]interface{}
+
+	// flush requests the bulk to be executed before it is full
+	flush chan struct{}
+
+	pending *pushers.Pending
 }
 
 func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	ch := make(chan map[string]interface{}, 100)
 
 	c := ElasticSearchBackend{
-		ch: ch,
+		ch:      ch,
+		flush:   make(chan struct{}),
+		pending: &pushers.Pending{},
 	}
 
 	for _, optionFn := range options {
@@ -95,39 +116,83 @@ func (hc ElasticSearchBackend) run() {
 	for {
 		select {
 		case doc := <-hc.ch:
-			messageID := uuid.NewV4()
-
-			bulk = bulk.Add(elastic.NewBulkIndexRequest().
-				Index(hc.Index).
-				Type("event").
-				Id(messageID.String()).
-				Doc(doc),
-			)
+			bulk = bulk.Add(hc.request(doc))
 
 			if bulk.NumberOfActions() < 10 {
 				continue
 			}
+		case <-hc.flush:
 		case <-time.After(time.Second * 10):
 		}
 
 		if bulk.NumberOfActions() == 0 {
-		} else if response, err := bulk.Do(context.Background()); err != nil {
+			continue
+		}
+
+		n := bulk.NumberOfActions()
+
+		if err := hc.do(bulk); err != nil {
 			log.Errorf("Error indexing: %s", err.Error())
 		} else {
-			indexed := response.Indexed()
-			count += len(indexed)
+			count += n
 
-			for _, item := range response.Failed() {
-				log.Errorf("Error indexing item: %s with error: %+v", item.Id, *item.Error)
-			}
+			log.Debugf("Bulk indexing: %d total %d", n, count)
+		}
 
-			log.Debugf("Bulk indexing: %d total %d", len(indexed), count)
+		// the actions are kept for the next bulk when the request failed
+		if bulk.NumberOfActions() == 0 {
+			hc.pending.Done(n)
 		}
 	}
 }
 
-// Send delivers the giving push messages into the internal elastic search endpoint.
-func (hc ElasticSearchBackend) Send(message event.Event) {
+func (hc ElasticSearchBackend) request(doc map[string]interface{}) *elastic.BulkIndexRequest {
+	messageID := uuid.NewV4()
+
+	return elastic.NewBulkIndexRequest().
+		Index(hc.Index).
+		Type("event").
+		Id(messageID.String()).
+		Doc(doc)
+}
+
+// do executes the bulk request, an error is returned when the request or
+// items failed because elasticsearch is unavailable or overloaded. Other
+// failures of items won't succeed when retried, these are only logged.
+func (hc ElasticSearchBackend) do(bulk *elastic.BulkService) error {
+	response, err := bulk.Do(context.Background())
+	if err != nil {
+		return err
+	}
+
+	retry := 0
+	for _, item := range response.Failed() {
+		if item.Status == http.StatusTooManyRequests || item.Status >= 500 {
+			retry++
+			continue
+		}
+
+		log.Errorf("Error indexing item: %s with error: %+v", item.Id, item.Error)
+	}
+
+	if retry > 0 {
+		return fmt.Errorf("%d items failed, elasticsearch is unavailable", retry)
+	}
+
+	return nil
+}
+
+// Flush executes the bulk, and waits until the queued events are delivered.
+func (hc ElasticSearchBackend) Flush() {
+	for hc.pending.Len() > 0 {
+		select {
+		case hc.flush <- struct{}{}:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func eventMap(message event.Event) map[string]interface{} {
 	mp := make(map[string]interface{})
 
 	message.Range(func(key, value interface{}) bool {
@@ -137,5 +202,23 @@ func (hc ElasticSearchBackend) Send(message event.Event) {
 		return true
 	})
 
-	hc.ch <- mp
+	return mp
+}
+
+// Send delivers the giving push messages into the internal elastic search endpoint.
+func (hc ElasticSearchBackend) Send(message event.Event) {
+	hc.pending.Add(1)
+	hc.ch <- eventMap(message)
+}
+
+// Deliver indexes the events at once, and returns an error when these
+// should be retried.
+func (hc ElasticSearchBackend) Deliver(events []event.Event) error {
+	bulk := hc.es.Bulk()
+
+	for _, e := range events {
+		bulk = bulk.Add(hc.request(eventMap(e)))
+	}
+
+	return hc.do(bulk)
 }
@@ -29,3 +29,103 @@
 * must display the words "Powered by Honeytrap" and retain the original copyright notice.
  */
 package elasticsearch_test
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/pushers/elasticsearch"
+)
+
+func TestDeliver(t *testing.T) {
+	var m sync.Mutex
+
+	status := http.StatusServiceUnavailable
+	documents := []string{}
+
+	// the stub stands in for elasticsearch, bulk requests fail until the
+	// status is changed
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" {
+			fmt.Fprint(w, `{}`)
+			return
+		}
+
+		m.Lock()
+		defer m.Unlock()
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		items := []string{}
+
+		scanner := bufio.NewScanner(r.Body)
+		for i := 0; scanner.Scan(); i++ {
+			// every action is followed by the document
+			if i%2 == 0 {
+				continue
+			}
+
+			documents = append(documents, scanner.Text())
+			items = append(items, `{"index":{"_index":"honeytrap","status":201}}`)
+		}
+
+		fmt.Fprintf(w, `{"took":1,"errors":false,"items":[%s]}`, strings.Join(items, ","))
+	}))
+
+	defer ts.Close()
+
+	s := struct {
+		P toml.Primitive
+	}{}
+
+	if _, err := toml.Decode(fmt.Sprintf("[P]\nurl=\"%s/honeytrap\"", ts.URL), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := elasticsearch.New(
+		pushers.WithConfig(s.P),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, ok := c.(pushers.Deliverer)
+	if !ok {
+		t.Fatal("Expected the channel to be a Deliverer")
+	}
+
+	events := []event.Event{
+		event.New(event.Category("test"), event.Custom("sequence", 1)),
+		event.New(event.Category("test"), event.Custom("sequence", 2)),
+	}
+
+	if err := d.Deliver(events); err == nil {
+		t.Fatal("Expected an error while elasticsearch is unavailable")
+	}
+
+	m.Lock()
+	status = http.StatusOK
+	m.Unlock()
+
+	if err := d.Deliver(events); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if len(documents) != 2 || !strings.Contains(documents[1], `"sequence":2`) {
+		t.Fatalf("Unexpected documents %v", documents)
+	}
+}
@@ -31,6 +31,9 @@
 package eventbus
 
 import (
+	"errors"
+	"sync"
+
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 	logging "github.com/op/go-logging"
@@ -39,9 +42,12 @@ import (
 var log = logging.MustGetLogger("eventbus")
 
 // EventBus defines a structure which provides a pubsub bus where message.Events
-// are sent along it's wires for delivery
+// are sent along it's wires for delivery. Every subscriber has its own queue,
+// a slow subscriber doesn't hold up the others.
 type EventBus struct {
-	subscribers []pushers.Channel
+	m sync.RWMutex
+
+	subscribers []*Queue
 }
 
 // NewEventBus returns a new instance of a EventBus.
@@ -49,15 +55,111 @@ func New() *EventBus {
 	return &EventBus{}
 }
 
+// SubscribeOption configures the queue of a subscriber.
+type SubscribeOption func(*subscription)
+
+type subscription struct {
+	name string
+	QueueConfig
+}
+
+// WithName sets the name of the subscriber, used in the stats.
+func WithName(name string) SubscribeOption {
+	return func(s *subscription) {
+		s.name = name
+	}
+}
+
+// WithQueueConfig sets the queue configuration of the subscriber.
+func WithQueueConfig(qc QueueConfig) SubscribeOption {
+	return func(s *subscription) {
+		s.QueueConfig = qc
+	}
+}
+
 // Subscribe adds the giving channel to the list of subscribers for the giving bus.
-func (eb *EventBus) Subscribe(channel pushers.Channel) error {
-	eb.subscribers = append(eb.subscribers, channel)
+func (eb *EventBus) Subscribe(channel pushers.Channel, options ...SubscribeOption) error {
+	s := subscription{
+		QueueConfig: DefaultQueueConfig,
+	}
+
+	for _, fn := range options {
+		fn(&s)
+	}
+
+	eb.m.Lock()
+	defer eb.m.Unlock()
+
+	if s.name == "" {
+		s.name = "subscriber"
+	}
+
+	q, err := NewQueue(s.name, channel, s.QueueConfig)
+	if err != nil {
+		return err
+	}
+
+	eb.subscribers = append(eb.subscribers, q)
 	return nil
 }
 
+// Unsubscribe removes the channel from the subscribers, after the queued
+// events have been delivered.
+func (eb *EventBus) Unsubscribe(channel pushers.Channel) error {
+	eb.m.Lock()
+
+	var q *Queue
+
+	for i, subscriber := range eb.subscribers {
+		if subscriber.Channel() != channel {
+			continue
+		}
+
+		q = subscriber
+		eb.subscribers = append(eb.subscribers[:i:i], eb.subscribers[i+1:]...)
+		break
+	}
+
+	eb.m.Unlock()
+
+	if q == nil {
+		return errors.New("Channel not subscribed")
+	}
+
+	q.Flush()
+	return q.stop()
+}
+
 // Send deliverers the slice of messages to all subscribers.
 func (eb *EventBus) Send(e event.Event) {
+	eb.m.RLock()
+	defer eb.m.RUnlock()
+
 	for _, subscriber := range eb.subscribers {
 		subscriber.Send(e)
 	}
 }
+
+// Flush flushes all subscribers.
+func (eb *EventBus) Flush() {
+	eb.m.RLock()
+	subscribers := append([]*Queue{}, eb.subscribers...)
+	eb.m.RUnlock()
+
+	for _, subscriber := range subscribers {
+		subscriber.Flush()
+	}
+}
+
+// Stats returns the counters of the subscriber queues.
+func (eb *EventBus) Stats() []QueueStats {
+	eb.m.RLock()
+	defer eb.m.RUnlock()
+
+	stats := []QueueStats{}
+	for _, subscriber := range eb.subscribers {
+		stats = append(stats, subscriber.Stats())
+	}
+
+	return stats
+}
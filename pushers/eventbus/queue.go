@@ -0,0 +1,373 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package eventbus
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/pushers/spool"
+)
+
+// Overflow policies of queues.
+const (
+	DropOldest = "drop-oldest"
+	DropNewest = "drop-newest"
+	Block      = "block"
+	Spill      = "spill"
+)
+
+// QueueConfig contains the configuration of a subscriber queue.
+type QueueConfig struct {
+	Size int `toml:"queue-size"`
+
+	// Overflow is the policy when the queue is full, one of drop-oldest,
+	// drop-newest, block or spill.
+	Overflow string `toml:"overflow"`
+
+	// Timeout is the time Send blocks with the block policy, before the
+	// event is dropped.
+	Timeout config.Delay `toml:"overflow-timeout"`
+
+	// SpillPath is the directory events are spilled to with the spill
+	// policy.
+	SpillPath string `toml:"spill-path"`
+
+	// SpillMaxSize is the maximum size of the spill file, the oldest
+	// events are dropped beyond it.
+	SpillMaxSize int64 `toml:"spill-max-size"`
+}
+
+// DefaultQueueConfig contains the defaults of subscriber queues.
+var DefaultQueueConfig = QueueConfig{
+	Size:         1024,
+	Overflow:     DropOldest,
+	Timeout:      config.Delay(time.Second),
+	SpillMaxSize: 100 * 1024 * 1024,
+}
+
+// Validate checks the configuration.
+func (qc QueueConfig) Validate() error {
+	if qc.Size <= 0 {
+		return fmt.Errorf("invalid queue-size %d", qc.Size)
+	}
+
+	switch qc.Overflow {
+	case DropOldest, DropNewest, Block:
+	case Spill:
+		if qc.SpillPath == "" {
+			return fmt.Errorf("spill-path not set for overflow policy spill")
+		} else if qc.SpillMaxSize <= 0 {
+			return fmt.Errorf("invalid spill-max-size %d", qc.SpillMaxSize)
+		}
+	default:
+		return fmt.Errorf("invalid overflow policy %q, expected drop-oldest, drop-newest, block or spill", qc.Overflow)
+	}
+
+	return nil
+}
+
+// QueueStats contains the counters of a queue.
+type QueueStats struct {
+	Name     string `json:"name"`
+	Overflow string `json:"overflow"`
+	Size     int    `json:"size"`
+	Length   int    `json:"length"`
+
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"`
+	Spilled   uint64 `json:"spilled"`
+
+	// Spool contains the metrics of the spool of the channel
+	Spool *spool.ChannelStats `json:"spool,omitempty"`
+}
+
+// Queue delivers the events to the channel from its own worker, Send
+// doesn't wait for the channel. When the queue is full the overflow policy
+// applies.
+type Queue struct {
+	QueueConfig
+
+	name    string
+	channel pushers.Channel
+
+	ch chan event.Event
+
+	spill *spill
+
+	// pending counts the queued events and the event being delivered
+	pending int64
+
+	delivered uint64
+	dropped   uint64
+	spilled   uint64
+
+	closed chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewQueue returns a queue delivering to channel. The name identifies the
+// queue in the stats and the spill file, queues replacing a queue with the
+// same name share its spill.
+func NewQueue(name string, channel pushers.Channel, qc QueueConfig) (*Queue, error) {
+	if err := qc.Validate(); err != nil {
+		return nil, err
+	}
+
+	q := &Queue{
+		QueueConfig: qc,
+		name:        name,
+		channel:     channel,
+		ch:          make(chan event.Event, qc.Size),
+		closed:      make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	if qc.Overflow == Spill {
+		s, err := openSpill(filepath.Join(qc.SpillPath, name+".spill"), qc.SpillMaxSize)
+		if err != nil {
+			return nil, err
+		}
+
+		q.spill = s
+	}
+
+	go q.run()
+
+	return q, nil
+}
+
+// Channel returns the channel the queue delivers to.
+func (q *Queue) Channel() pushers.Channel {
+	return q.channel
+}
+
+// Send queues the event.
+func (q *Queue) Send(e event.Event) {
+	// keep the order, new events are spilled until the spill is replayed
+	if q.spill != nil && q.spill.Active() {
+		q.spillEvent(e)
+		return
+	}
+
+	atomic.AddInt64(&q.pending, 1)
+
+	select {
+	case q.ch <- e:
+		return
+	default:
+	}
+
+	switch q.Overflow {
+	case DropNewest:
+	case DropOldest:
+		for {
+			select {
+			case q.ch <- e:
+				return
+			default:
+			}
+
+			select {
+			case <-q.ch:
+				q.drop()
+			default:
+			}
+		}
+	case Block:
+		timer := time.NewTimer(q.Timeout.Duration())
+		defer timer.Stop()
+
+		select {
+		case q.ch <- e:
+			return
+		case <-timer.C:
+		}
+	case Spill:
+		atomic.AddInt64(&q.pending, -1)
+		q.spillEvent(e)
+		return
+	}
+
+	q.drop()
+}
+
+func (q *Queue) drop() {
+	atomic.AddInt64(&q.pending, -1)
+	atomic.AddUint64(&q.dropped, 1)
+}
+
+func (q *Queue) spillEvent(e event.Event) {
+	dropped, err := q.spill.Write(e)
+
+	atomic.AddUint64(&q.dropped, uint64(dropped))
+
+	if err != nil {
+		log.Errorf("Could not spill event of %s: %s", q.name, err.Error())
+		atomic.AddUint64(&q.dropped, 1)
+		return
+	}
+
+	atomic.AddUint64(&q.spilled, 1)
+}
+
+func (q *Queue) deliver(e event.Event) {
+	q.channel.Send(e)
+
+	atomic.AddUint64(&q.delivered, 1)
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+
+	if q.spill != nil {
+		defer q.spill.Close()
+	}
+
+	var replay <-chan time.Time
+	if q.spill != nil {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+
+		replay = ticker.C
+	}
+
+	for {
+		select {
+		case e := <-q.ch:
+			q.deliver(e)
+			atomic.AddInt64(&q.pending, -1)
+		case <-replay:
+			// spilled events are newer than the queued events
+			if len(q.ch) > 0 {
+				continue
+			}
+
+			events, err := q.spill.Read(100)
+			if err != nil {
+				log.Errorf("Could not read spilled events of %s: %s", q.name, err.Error())
+			}
+
+			for _, e := range events {
+				q.deliver(e)
+			}
+		case <-q.closed:
+			for {
+				select {
+				case e := <-q.ch:
+					q.deliver(e)
+					atomic.AddInt64(&q.pending, -1)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Len returns the number of events waiting for delivery, including the
+// spilled events.
+func (q *Queue) Len() int {
+	n := int(atomic.LoadInt64(&q.pending))
+	if q.spill != nil {
+		n += q.spill.Len()
+	}
+
+	return n
+}
+
+// Flush waits for the queued events to be delivered, and flushes the
+// channel.
+func (q *Queue) Flush() {
+	for q.Len() > 0 {
+		select {
+		case <-q.done:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if f, ok := q.channel.(pushers.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// stop delivers the queued events and stops the worker. Spilled events are
+// kept for the next start.
+func (q *Queue) stop() error {
+	q.once.Do(func() {
+		close(q.closed)
+	})
+
+	<-q.done
+	return nil
+}
+
+// Close stops the queue, and closes the channel when it is a Closer.
+func (q *Queue) Close() error {
+	if err := q.stop(); err != nil {
+		return err
+	}
+
+	if c, ok := q.channel.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// Stats returns the counters of the queue.
+func (q *Queue) Stats() QueueStats {
+	var spooled *spool.ChannelStats
+	if sc, ok := q.channel.(*spool.Channel); ok {
+		st := sc.Stats()
+		spooled = &st
+	}
+
+	return QueueStats{
+		Name:      q.name,
+		Overflow:  q.Overflow,
+		Size:      q.Size,
+		Length:    q.Len(),
+		Delivered: atomic.LoadUint64(&q.delivered),
+		Dropped:   atomic.LoadUint64(&q.dropped),
+		Spilled:   atomic.LoadUint64(&q.spilled),
+		Spool:     spooled,
+	}
+}
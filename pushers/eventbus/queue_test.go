@@ -0,0 +1,259 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package eventbus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// gateChannel blocks delivery until it is opened, and records the events.
+type gateChannel struct {
+	m      sync.Mutex
+	gate   chan struct{}
+	events []string
+}
+
+func (c *gateChannel) Send(e event.Event) {
+	<-c.gate
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.events = append(c.events, e.Get("sequence"))
+}
+
+func (c *gateChannel) received() []string {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return append([]string{}, c.events...)
+}
+
+func sequence(s string) event.Event {
+	return event.New(event.Custom("sequence", s))
+}
+
+func testQueue(t *testing.T, qc QueueConfig, expected []string, dropped uint64) {
+	c := &gateChannel{gate: make(chan struct{})}
+
+	q, err := NewQueue("test", c, qc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first event is taken by the worker, which blocks on the gate
+	q.Send(sequence("0"))
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	for _, s := range []string{"1", "2", "3", "4"} {
+		q.Send(sequence(s))
+	}
+
+	if time.Since(start) > time.Second {
+		t.Fatalf("%s: send blocked", qc.Overflow)
+	}
+
+	close(c.gate)
+	q.Flush()
+	q.Close()
+
+	received := c.received()
+	if len(received) != len(expected) {
+		t.Fatalf("%s: expected %v, got %v", qc.Overflow, expected, received)
+	}
+
+	for i := range expected {
+		if received[i] != expected[i] {
+			t.Fatalf("%s: expected %v, got %v", qc.Overflow, expected, received)
+		}
+	}
+
+	if stats := q.Stats(); stats.Dropped != dropped {
+		t.Fatalf("%s: expected %d dropped events, got %d", qc.Overflow, dropped, stats.Dropped)
+	}
+}
+
+func TestQueueOverflow(t *testing.T) {
+	testQueue(t, QueueConfig{Size: 2, Overflow: DropOldest}, []string{"0", "3", "4"}, 2)
+	testQueue(t, QueueConfig{Size: 2, Overflow: DropNewest}, []string{"0", "1", "2"}, 2)
+	testQueue(t, QueueConfig{Size: 2, Overflow: Block, Timeout: config.Delay(10 * time.Millisecond)}, []string{"0", "1", "2"}, 2)
+
+	dir, err := ioutil.TempDir("", "eventbus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	testQueue(t, QueueConfig{Size: 2, Overflow: Spill, SpillPath: dir, SpillMaxSize: 1024}, []string{"0", "1", "2", "3", "4"}, 0)
+}
+
+func TestSpillMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventbus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "test.spill")
+
+	s, err := openSpill(name, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	dropped := 0
+	for i := 0; i < 20; i++ {
+		n, err := s.Write(sequence(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dropped += n
+	}
+
+	if fi, err := os.Stat(name); err != nil {
+		t.Fatal(err)
+	} else if fi.Size() > 200 {
+		t.Errorf("Expected spill of at most 200 bytes, got %d", fi.Size())
+	}
+
+	events, err := s.Read(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dropped == 0 || dropped+len(events) != 20 {
+		t.Fatalf("Expected dropped and read events to add up to 20, got %d and %d", dropped, len(events))
+	}
+
+	// the newest events are kept, in order
+	for i, e := range events {
+		if expected := strconv.Itoa(dropped + i); e.Get("sequence") != expected {
+			t.Errorf("Expected event %s, got %s", expected, e.Get("sequence"))
+		}
+	}
+}
+
+func TestSpillShared(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventbus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "test.spill")
+
+	a, err := openSpill(name, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.Write(sequence("0"))
+
+	// a reload opens the spill of the replaced queue
+	b, err := openSpill(name, 1024)
+	if err != nil {
+		t.Fatal(err)
+	} else if a != b {
+		t.Fatal("Expected spill to be shared")
+	}
+
+	a.Close()
+
+	b.Write(sequence("1"))
+
+	events, err := b.Read(100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(events) != 2 || events[0].Get("sequence") != "0" || events[1].Get("sequence") != "1" {
+		t.Errorf("Expected events 0 and 1, got %d events", len(events))
+	}
+
+	b.Close()
+}
+
+func TestEventBusUnsubscribe(t *testing.T) {
+	bus := New()
+
+	a := &gateChannel{gate: make(chan struct{})}
+	b := &gateChannel{gate: make(chan struct{})}
+
+	close(b.gate)
+
+	bus.Subscribe(a)
+	bus.Subscribe(b)
+
+	// a doesn't hold up b
+	bus.Send(sequence("0"))
+	bus.Send(sequence("1"))
+
+	time.Sleep(50 * time.Millisecond)
+
+	if received := b.received(); len(received) != 2 {
+		t.Fatalf("Expected 2 events, got %v", received)
+	}
+
+	close(a.gate)
+
+	if err := bus.Unsubscribe(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if received := a.received(); len(received) != 2 {
+		t.Fatalf("Expected queued events to be delivered on unsubscribe, got %v", received)
+	}
+
+	bus.Send(sequence("2"))
+	bus.Flush()
+
+	if len(a.received()) != 2 || len(b.received()) != 3 {
+		t.Fatalf("Expected events to be delivered to subscribed channels only")
+	}
+
+	if err := bus.Unsubscribe(a); err == nil {
+		t.Fatal("Expected error unsubscribing twice")
+	}
+}
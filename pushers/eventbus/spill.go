@@ -0,0 +1,298 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package eventbus
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// spill stores the events overflowing a queue in a file, as json lines. The
+// events are read back in order, and the file is truncated once all events
+// have been read. When the file exceeds its maximum size, the oldest unread
+// events are dropped. A spill that is already open is shared, which happens
+// when a queue is replaced by a reload.
+type spill struct {
+	m sync.Mutex
+
+	name    string
+	maxSize int64
+
+	w *os.File
+
+	f *os.File
+	r *bufio.Reader
+
+	// count contains the number of unread events, size the size of the
+	// file and offset the position of the reader
+	count  int
+	size   int64
+	offset int64
+
+	refs int
+}
+
+var (
+	spills  = map[string]*spill{}
+	spillsM sync.Mutex
+)
+
+func openSpill(name string, maxSize int64) (*spill, error) {
+	name = filepath.Clean(name)
+
+	spillsM.Lock()
+	defer spillsM.Unlock()
+
+	if s, ok := spills[name]; ok {
+		s.m.Lock()
+		s.refs++
+		s.maxSize = maxSize
+		s.m.Unlock()
+
+		return s, nil
+	}
+
+	s := &spill{
+		name:    name,
+		maxSize: maxSize,
+		refs:    1,
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	// events spilled before a restart
+	for {
+		line, err := s.r.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+
+		s.count++
+		s.size += int64(len(line))
+	}
+
+	if err := s.rewind(); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	spills[name] = s
+	return s, nil
+}
+
+func (s *spill) open() error {
+	w, err := os.OpenFile(s.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(s.name)
+	if err != nil {
+		w.Close()
+		return err
+	}
+
+	s.w, s.f = w, f
+	s.r = bufio.NewReader(f)
+	return nil
+}
+
+func (s *spill) close() error {
+	s.f.Close()
+	return s.w.Close()
+}
+
+func (s *spill) rewind() error {
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	s.r.Reset(s.f)
+	s.offset = 0
+	return nil
+}
+
+// Active returns true when the spill contains unread events.
+func (s *spill) Active() bool {
+	return s.Len() > 0
+}
+
+func (s *spill) Len() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.count
+}
+
+// Write appends the event, it returns the number of old events dropped to
+// stay within the maximum size.
+func (s *spill) Write(e event.Event) (int, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+
+	data = append(data, '\n')
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	dropped := 0
+
+	if s.maxSize > 0 && s.size+int64(len(data)) > s.maxSize {
+		if int64(len(data)) > s.maxSize {
+			return 0, errors.New("event exceeds spill-max-size")
+		}
+
+		if dropped, err = s.compact(s.maxSize / 2); err != nil {
+			return dropped, err
+		}
+	}
+
+	if _, err := s.w.Write(data); err != nil {
+		return dropped, err
+	}
+
+	s.count++
+	s.size += int64(len(data))
+	return dropped, nil
+}
+
+// compact rewrites the file with the newest unread events, up to size
+// bytes, and returns the number of dropped events. The lock should be held.
+func (s *spill) compact(size int64) (int, error) {
+	dropped := 0
+
+	// drop the oldest events, until the remaining events fit
+	for s.count > 0 && s.size-s.offset > size {
+		line, err := s.r.ReadBytes('\n')
+		if err != nil {
+			return dropped, err
+		}
+
+		s.offset += int64(len(line))
+		s.count--
+		dropped++
+	}
+
+	tmp, err := os.OpenFile(s.name+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return dropped, err
+	}
+
+	n, err := io.Copy(tmp, s.r)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return dropped, err
+	}
+
+	if err := os.Rename(tmp.Name(), s.name); err != nil {
+		return dropped, err
+	}
+
+	s.close()
+
+	if err := s.open(); err != nil {
+		return dropped, err
+	}
+
+	s.size, s.offset = n, 0
+	return dropped, nil
+}
+
+// Read returns at most n events, the file is truncated when all events have
+// been read.
+func (s *spill) Read(n int) ([]event.Event, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	events := []event.Event{}
+
+	for len(events) < n && s.count > 0 {
+		line, err := s.r.ReadBytes('\n')
+		if err != nil {
+			return events, err
+		}
+
+		s.offset += int64(len(line))
+		s.count--
+
+		m := map[string]interface{}{}
+		if err := json.Unmarshal(line, &m); err != nil {
+			continue
+		}
+
+		events = append(events, event.New(event.CopyFrom(m)))
+	}
+
+	if s.count > 0 {
+		return events, nil
+	}
+
+	if err := s.w.Truncate(0); err != nil {
+		return events, err
+	}
+
+	s.size = 0
+	return events, s.rewind()
+}
+
+// Close closes the spill, when it isn't shared anymore.
+func (s *spill) Close() error {
+	spillsM.Lock()
+	defer spillsM.Unlock()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+
+	delete(spills, s.name)
+	return s.close()
+}
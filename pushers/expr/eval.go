@@ -0,0 +1,292 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package expr
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"strconv"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+type valueKind int
+
+const (
+	valueString valueKind = iota
+	valueNumber
+	valueBool
+	valueIP
+	valueNetwork
+)
+
+// value contains a literal of the expression.
+type value struct {
+	kind valueKind
+	text string
+	pos  int
+
+	s       string
+	n       float64
+	b       bool
+	ip      net.IP
+	network *net.IPNet
+}
+
+func parseLiteral(s string) (value, bool) {
+	if b, err := strconv.ParseBool(s); err == nil && (s == "true" || s == "false") {
+		return value{kind: valueBool, text: s, b: b}, true
+	}
+
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return value{kind: valueNumber, text: s, n: n}, true
+	}
+
+	if _, network, err := net.ParseCIDR(s); err == nil {
+		return value{kind: valueNetwork, text: s, network: network}, true
+	}
+
+	if ip := net.ParseIP(s); ip != nil {
+		return value{kind: valueIP, text: s, ip: ip}, true
+	}
+
+	return value{}, false
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	if s, ok := v.(string); ok {
+		n, err := strconv.ParseFloat(s, 64)
+		return n, err == nil
+	}
+
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+
+	return 0, false
+}
+
+func toBool(v interface{}) (bool, bool) {
+	switch v := v.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(v)
+		return b, err == nil
+	}
+
+	return false, false
+}
+
+func toIP(v interface{}) net.IP {
+	switch v := v.(type) {
+	case net.IP:
+		return v
+	case string:
+		return net.ParseIP(v)
+	}
+
+	return nil
+}
+
+// equal returns true when the field value equals the literal, and whether
+// the value could be converted to the type of the literal.
+func (l value) equal(v interface{}) (bool, bool) {
+	switch l.kind {
+	case valueNumber:
+		n, ok := toNumber(v)
+		return ok && n == l.n, ok
+	case valueBool:
+		b, ok := toBool(v)
+		return ok && b == l.b, ok
+	case valueIP:
+		ip := toIP(v)
+		return ip != nil && ip.Equal(l.ip), ip != nil
+	case valueNetwork:
+		ip := toIP(v)
+		return ip != nil && l.network.Contains(ip), ip != nil
+	default:
+		return toString(v) == l.s, true
+	}
+}
+
+// compare returns -1, 0 or 1 comparing the field value to the literal, and
+// whether the value could be converted to the type of the literal.
+func (l value) compare(v interface{}) (int, bool) {
+	if l.kind == valueNumber {
+		n, ok := toNumber(v)
+		switch {
+		case !ok:
+			return 0, false
+		case n < l.n:
+			return -1, true
+		case n > l.n:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+
+	return bytes.Compare([]byte(toString(v)), []byte(l.s)), true
+}
+
+type node interface {
+	eval(event.Event) bool
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n *orNode) eval(e event.Event) bool {
+	return n.left.eval(e) || n.right.eval(e)
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n *andNode) eval(e event.Event) bool {
+	return n.left.eval(e) && n.right.eval(e)
+}
+
+type notNode struct {
+	node node
+}
+
+func (n *notNode) eval(e event.Event) bool {
+	return !n.node.eval(e)
+}
+
+type existsNode struct {
+	field string
+}
+
+func (n *existsNode) eval(e event.Event) bool {
+	return e.Has(n.field)
+}
+
+type compareNode struct {
+	field string
+	op    string
+	value value
+}
+
+func (n *compareNode) eval(e event.Event) bool {
+	v, ok := e.Load(n.field)
+	if !ok {
+		return false
+	}
+
+	switch n.op {
+	case "==":
+		eq, _ := n.value.equal(v)
+		return eq
+	case "!=":
+		eq, ok := n.value.equal(v)
+		return ok && !eq
+	}
+
+	c, ok := n.value.compare(v)
+	if !ok {
+		return false
+	}
+
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+type matchNode struct {
+	field  string
+	rx     *regexp.Regexp
+	negate bool
+}
+
+func (n *matchNode) eval(e event.Event) bool {
+	v, ok := e.Load(n.field)
+	if !ok {
+		return false
+	}
+
+	return n.rx.MatchString(toString(v)) != n.negate
+}
+
+type inNode struct {
+	field  string
+	values []value
+	negate bool
+}
+
+func (n *inNode) eval(e event.Event) bool {
+	v, ok := e.Load(n.field)
+	if !ok {
+		return false
+	}
+
+	for _, l := range n.values {
+		if eq, _ := l.equal(v); eq {
+			return !n.negate
+		}
+	}
+
+	return n.negate
+}
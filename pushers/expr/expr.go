@@ -0,0 +1,349 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package expr implements the expression language of filters, like
+//
+//	category == "ssh" && source-ip in 10.0.0.0/8 && payload-length > 100
+//
+// Fields are compared with literals: quoted strings, numbers, booleans, ip
+// addresses and networks. The operators are ==, !=, <, <=, >, >=, in and
+// not in (with a network or a list of values), =~ and !~ (with a regular
+// expression), combined with &&, || and !. A field without operator tests
+// whether the event contains the field. Comparisons with fields which are
+// missing, or can't be converted to the type of the literal, are false.
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Error is returned when an expression can't be compiled.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos+1, e.Msg)
+}
+
+func errorf(pos int, format string, args ...interface{}) error {
+	return &Error{
+		Pos: pos,
+		Msg: fmt.Sprintf(format, args...),
+	}
+}
+
+// Expression contains a compiled expression.
+type Expression struct {
+	source string
+	root   node
+}
+
+// Compile parses the expression.
+func Compile(s string) (*Expression, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		tokens: tokens,
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, errorf(t.pos, "unexpected %s", t)
+	}
+
+	return &Expression{
+		source: s,
+		root:   root,
+	}, nil
+}
+
+// MustCompile parses the expression, and panics when it can't be compiled.
+func MustCompile(s string) *Expression {
+	x, err := Compile(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return x
+}
+
+// Match returns true when the event matches the expression.
+func (x *Expression) Match(e event.Event) bool {
+	return x.root.eval(e)
+}
+
+func (x *Expression) String() string {
+	return x.source
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+
+	return t
+}
+
+func (p *parser) is(t token, texts ...string) bool {
+	if t.kind != tokenOperator && t.kind != tokenWord {
+		return false
+	}
+
+	for _, text := range texts {
+		if t.text == text {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.is(p.peek(), "||") {
+		p.next()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &orNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.is(p.peek(), "&&") {
+		p.next()
+
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &andNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if t := p.peek(); t.kind == tokenOperator && t.text == "!" {
+		p.next()
+
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return &notNode{n}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+
+	switch {
+	case t.kind == tokenOperator && t.text == "(":
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if c := p.next(); c.kind != tokenOperator || c.text != ")" {
+			return nil, errorf(c.pos, "expected ) instead of %s", c)
+		}
+
+		return n, nil
+	case t.kind == tokenWord:
+		if _, err := strconv.ParseFloat(t.text, 64); err == nil {
+			return nil, errorf(t.pos, "expected field instead of %s", t)
+		}
+
+		return p.parseComparison(t.text)
+	default:
+		return nil, errorf(t.pos, "expected field instead of %s", t)
+	}
+}
+
+func (p *parser) parseComparison(field string) (node, error) {
+	op := p.peek()
+
+	switch {
+	case p.is(op, "==", "!="):
+		p.next()
+
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		return &compareNode{field: field, op: op.text, value: v}, nil
+	case p.is(op, "<", "<=", ">", ">="):
+		p.next()
+
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		if v.kind != valueNumber && v.kind != valueString {
+			return nil, errorf(v.pos, "%s expects a number or a string, got %s", op.text, v.text)
+		}
+
+		return &compareNode{field: field, op: op.text, value: v}, nil
+	case p.is(op, "=~", "!~", "matches"):
+		p.next()
+
+		t := p.next()
+		if t.kind != tokenString {
+			return nil, errorf(t.pos, "%s expects a quoted regular expression, got %s", op.text, t)
+		}
+
+		rx, err := regexp.Compile(t.text)
+		if err != nil {
+			return nil, errorf(t.pos, "invalid regular expression: %s", err.Error())
+		}
+
+		return &matchNode{field: field, rx: rx, negate: op.text == "!~"}, nil
+	case p.is(op, "in"):
+		p.next()
+		return p.parseIn(field, false)
+	case p.is(op, "not"):
+		p.next()
+
+		if t := p.next(); !p.is(t, "in") {
+			return nil, errorf(t.pos, "expected in after not, got %s", t)
+		}
+
+		return p.parseIn(field, true)
+	default:
+		return &existsNode{field: field}, nil
+	}
+}
+
+func (p *parser) parseIn(field string, negate bool) (node, error) {
+	n := &inNode{
+		field:  field,
+		negate: negate,
+	}
+
+	if t := p.peek(); t.kind != tokenOperator || t.text != "[" {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		if v.kind != valueNetwork && v.kind != valueIP {
+			return nil, errorf(v.pos, "in expects a network or a list, got %s", v.text)
+		}
+
+		n.values = []value{v}
+		return n, nil
+	}
+
+	p.next()
+
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		n.values = append(n.values, v)
+
+		t := p.next()
+		if t.kind == tokenOperator && t.text == "]" {
+			return n, nil
+		} else if t.kind != tokenOperator || t.text != "," {
+			return nil, errorf(t.pos, "expected , or ] instead of %s", t)
+		}
+	}
+}
+
+func (p *parser) parseValue() (value, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenString:
+		return value{kind: valueString, text: strconv.Quote(t.text), pos: t.pos, s: t.text}, nil
+	case tokenWord:
+		if v, ok := parseLiteral(t.text); ok {
+			v.pos = t.pos
+			return v, nil
+		}
+
+		if strings.Contains(t.text, "/") {
+			return value{}, errorf(t.pos, "invalid network %s", t.text)
+		}
+
+		return value{}, errorf(t.pos, "invalid value %s, strings need to be quoted", t.text)
+	default:
+		return value{}, errorf(t.pos, "expected value instead of %s", t)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package expr
+
+import (
+	"net"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func TestMatch(t *testing.T) {
+	e := event.New(
+		event.Sensor("services"),
+		event.Category("ssh"),
+		event.SourceIP(net.ParseIP("10.1.2.3")),
+		event.DestinationPort(22),
+		event.Payload([]byte("SSH-2.0-libssh_0.6.0")),
+		event.Custom("ssh.success", false),
+	)
+
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{`category == "ssh"`, true},
+		{`category != "ssh"`, false},
+		{`category == "ssh" && source-ip in 10.0.0.0/8 && payload-length > 10`, true},
+		{`source-ip in 192.168.0.0/16`, false},
+		{`source-ip not in [192.168.0.0/16, 172.16.0.0/12]`, true},
+		{`source-ip == 10.1.2.3`, true},
+		{`destination-port == 22`, true},
+		{`destination-port in [22, 2222]`, true},
+		{`destination-port >= 1024`, false},
+		{`payload-length < 100 && payload-length <= 20`, true},
+		{`payload =~ "^SSH-2\\.0-libssh"`, true},
+		{"payload !~ `libssh`", false},
+		{`payload matches "(?i)LIBSSH"`, true},
+		{`ssh.success == false`, true},
+		{`payload`, true},
+		{`!ssh.username`, true},
+		{`ssh.username == "root"`, false},
+		{`ssh.username != "root"`, false},
+		{`category == "http" || (category == "ssh" && !(destination-port == 2222))`, true},
+		{`category in ["http", "telnet"]`, false},
+		{`category > "http"`, true},
+	}
+
+	for _, tt := range tests {
+		x, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %s", tt.expr, err.Error())
+			continue
+		}
+
+		if x.Match(e) != tt.expected {
+			t.Errorf("%s: expected %t", tt.expr, tt.expected)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{`category == ssh`, `position 13: invalid value ssh, strings need to be quoted`},
+		{`category == "ssh`, `position 13: unterminated string`},
+		{`(category == "ssh"`, `position 19: expected ) instead of end of expression`},
+		{`payload =~ "("`, "position 12: invalid regular expression: error parsing regexp: missing closing ): `(`"},
+		{`source-ip in "10.0.0.0/8"`, `position 14: in expects a network or a list, got "10.0.0.0/8"`},
+		{`source-ip in 10.0.0.0/33`, `position 14: invalid network 10.0.0.0/33`},
+		{`payload-length > true`, `position 18: > expects a number or a string, got true`},
+		{`category == "ssh" &&`, `position 21: expected field instead of end of expression`},
+		{`category == "ssh" category`, `position 19: unexpected "category"`},
+		{`category = "ssh"`, `position 10: unexpected character '='`},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(tt.expr)
+		if err == nil {
+			t.Errorf("%s: expected error", tt.expr)
+		} else if err.Error() != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.expr, tt.expected, err.Error())
+		}
+	}
+}
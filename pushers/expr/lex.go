@@ -0,0 +1,136 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	// tokenWord contains field names, keywords, numbers and addresses
+	tokenWord
+	tokenString
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+var operators = []string{
+	"==", "!=", "<=", ">=", "=~", "!~", "&&", "||",
+	"<", ">", "!", "(", ")", "[", "]", ",",
+}
+
+func isWord(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+
+	return strings.IndexByte("_.-:/", c) != -1
+}
+
+func lex(s string) ([]token, error) {
+	tokens := []token{}
+
+	i := 0
+
+next:
+	for i < len(s) {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if c == '"' && s[j] == '\\' {
+					j++
+				}
+			}
+
+			if j >= len(s) {
+				return nil, errorf(i, "unterminated string")
+			}
+
+			text, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return nil, errorf(i, "invalid string %s", s[i:j+1])
+			}
+
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i})
+			i = j + 1
+			continue
+		case isWord(c):
+			j := i
+			for j < len(s) && isWord(s[j]) {
+				j++
+			}
+
+			tokens = append(tokens, token{kind: tokenWord, text: s[i:j], pos: i})
+			i = j
+			continue
+		}
+
+		for _, op := range operators {
+			if strings.HasPrefix(s[i:], op) {
+				tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+				i += len(op)
+				continue next
+			}
+		}
+
+		return nil, errorf(i, "unexpected character %q", c)
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(s)}), nil
+}
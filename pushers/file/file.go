@@ -49,6 +49,14 @@ import (
 
 var (
 	_ = pushers.Register("file", New)
+	_ = pushers.Describe("file", config.Description{
+		Description: "Writes the events to a file",
+		Config: func() interface{} {
+			return &FileConfig{
+				MaxSize: defaultMaxSize,
+			}
+		},
+	})
 )
 
 var (
@@ -88,9 +96,9 @@ func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 
 // FileConfig defines the config used to setup the FileBackend.
 type FileConfig struct {
-	MaxSize int    `toml:"maxsize"`
-	File    string `toml:"filename"`
-	Timeout string `toml:"timeout"`
+	MaxSize int    `toml:"maxsize" doc:"Size at which the file is rotated"`
+	File    string `toml:"filename" doc:"File to write to, relative to the working directory" required:"true"`
+	Timeout string `toml:"timeout" doc:"Interval between writes"`
 }
 
 // FileBackend defines a struct which implements the pushers.Pusher interface
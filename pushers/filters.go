@@ -31,7 +31,11 @@
 package pushers
 
 import (
+	"fmt"
+	"net"
+	"path"
 	"regexp"
+	"strings"
 
 	"github.com/honeytrap/honeytrap/event"
 )
@@ -60,6 +64,13 @@ func (mc filterChannel) Send(e event.Event) {
 	mc.Channel.Send(e)
 }
 
+// Flush flushes the underlying channel.
+func (mc filterChannel) Flush() {
+	if f, ok := mc.Channel.(Flusher); ok {
+		f.Flush()
+	}
+}
+
 // FilterFunc defines a function for event filtering.
 type FilterFunc func(event.Event) bool
 
@@ -83,6 +94,190 @@ func RegexFilterFunc(field string, expressions []string) FilterFunc {
 	}
 }
 
+// patterns splits the patterns into including patterns and excluding
+// patterns, which start with an exclamation mark.
+func patterns(values []string) ([]string, []string) {
+	include, exclude := []string{}, []string{}
+
+	for _, v := range values {
+		if strings.HasPrefix(v, "!") {
+			exclude = append(exclude, v[1:])
+		} else {
+			include = append(include, v)
+		}
+	}
+
+	return include, exclude
+}
+
+// matchFilterFunc returns a function matching the value of field, events
+// matching an excluding pattern are filtered, otherwise events need to match
+// one of the including patterns if any.
+func matchFilterFunc(field string, include, exclude []func(string) bool) FilterFunc {
+	return func(e event.Event) bool {
+		val := e.Get(field)
+
+		for _, match := range exclude {
+			if match(val) {
+				return false
+			}
+		}
+
+		if len(include) == 0 {
+			return true
+		}
+
+		for _, match := range include {
+			if match(val) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func compile(values []string, fn func(string) (func(string) bool, error)) ([]func(string) bool, []func(string) bool, error) {
+	include, exclude := patterns(values)
+
+	compiled := [2][]func(string) bool{}
+	for i, values := range [][]string{include, exclude} {
+		for _, v := range values {
+			match, err := fn(v)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			compiled[i] = append(compiled[i], match)
+		}
+	}
+
+	return compiled[0], compiled[1], nil
+}
+
+// GlobFilterFunc returns a function for filtering event values with glob
+// patterns, like service.*. Patterns starting with ! exclude the matching
+// events.
+func GlobFilterFunc(field string, values []string) (FilterFunc, error) {
+	include, exclude, err := compile(values, func(pattern string) (func(string) bool, error) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", pattern, err.Error())
+		}
+
+		return func(v string) bool {
+			matched, _ := path.Match(pattern, v)
+			return matched
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matchFilterFunc(field, include, exclude), nil
+}
+
+// PatternFilterFunc returns a function for filtering event values with
+// regular expressions. Expressions starting with ! exclude the matching
+// events.
+func PatternFilterFunc(field string, values []string) (FilterFunc, error) {
+	include, exclude, err := compile(values, func(expr string) (func(string) bool, error) {
+		rx, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression %q: %s", expr, err.Error())
+		}
+
+		return rx.MatchString, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matchFilterFunc(field, include, exclude), nil
+}
+
+// CIDRFilterFunc returns a function for filtering events on the ip address
+// in field, with networks in cidr notation or single addresses. Networks
+// starting with ! exclude the matching events.
+func CIDRFilterFunc(field string, values []string) (FilterFunc, error) {
+	include, exclude, err := compile(values, func(cidr string) (func(string) bool, error) {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip == nil {
+			} else if ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", cidr)
+		}
+
+		return func(v string) bool {
+			ip := net.ParseIP(v)
+			return ip != nil && network.Contains(ip)
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matchFilterFunc(field, include, exclude), nil
+}
+
+// severities contains the order of the severities, names of logging levels
+// are accepted as well.
+var severities = map[string]int{
+	"debug":    0,
+	"info":     1,
+	"low":      1,
+	"notice":   2,
+	"warning":  3,
+	"medium":   3,
+	"error":    4,
+	"high":     4,
+	"critical": 5,
+	"fatal":    5,
+}
+
+// SeverityOf returns the order of the severity of the event, events without
+// severity are info.
+func SeverityOf(e event.Event) int {
+	if v, ok := severities[strings.ToLower(e.Get("severity"))]; ok {
+		return v
+	}
+
+	return severities["info"]
+}
+
+// SeverityFilterFunc returns a function filtering events with a severity
+// lower than min.
+func SeverityFilterFunc(min string) (FilterFunc, error) {
+	level, ok := severities[strings.ToLower(min)]
+	if !ok {
+		return nil, fmt.Errorf("invalid severity %q", min)
+	}
+
+	return func(e event.Event) bool {
+		return SeverityOf(e) >= level
+	}, nil
+}
+
+// AllFilterFunc returns a function for filtering events which don't match
+// all functions.
+func AllFilterFunc(fns ...FilterFunc) FilterFunc {
+	return func(e event.Event) bool {
+		for _, fn := range fns {
+			if !fn(e) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
 // FilterChannel defines a struct which handles the delivery of giving
 // messages to a specific sets of backend channels based on specific criteria.
 func FilterChannel(channel Channel, fn FilterFunc) Channel {
@@ -104,6 +299,13 @@ func (mc tokenChannel) Send(e event.Event) {
 	mc.Channel.Send(event.Apply(e, event.Token(mc.Token)))
 }
 
+// Flush flushes the underlying channel.
+func (mc tokenChannel) Flush() {
+	if f, ok := mc.Channel.(Flusher); ok {
+		f.Flush()
+	}
+}
+
 // TokenChannel returns a Channel to set token value.
 func TokenChannel(channel Channel, token string) Channel {
 	return tokenChannel{
@@ -111,3 +313,43 @@ func TokenChannel(channel Channel, token string) Channel {
 		Token:   token,
 	}
 }
+
+type mergeChannel struct {
+	Channel
+
+	data map[string]interface{}
+}
+
+// Send adds the values to the event, unless the event already contains them.
+func (mc mergeChannel) Send(e event.Event) {
+	mc.Channel.Send(event.Apply(e, event.MergeFrom(mc.data)))
+}
+
+// MergeChannel returns a Channel which adds the values to the events of a
+// component, like the name of the service sending the events.
+func MergeChannel(channel Channel, data map[string]interface{}) Channel {
+	return mergeChannel{
+		Channel: channel,
+		data:    data,
+	}
+}
+
+type optionsChannel struct {
+	Channel
+
+	options []event.Option
+}
+
+// Send applies the options to the event.
+func (oc optionsChannel) Send(e event.Event) {
+	oc.Channel.Send(event.Apply(e, oc.options...))
+}
+
+// OptionsChannel returns a Channel which applies the options to the events,
+// like the addresses of the connection the events relate to.
+func OptionsChannel(channel Channel, options ...event.Option) Channel {
+	return optionsChannel{
+		Channel: channel,
+		options: options,
+	}
+}
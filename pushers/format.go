@@ -0,0 +1,137 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pushers
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// FormatFunc converts an event to the format of a channel.
+type FormatFunc func(event.Event) event.Event
+
+// formats contains the event formats channels can select, honeytrap sends
+// the events as is.
+var formats = map[string]FormatFunc{
+	"honeytrap": nil,
+	"ecs":       ECS,
+}
+
+// Formats returns the names of the event formats.
+func Formats() []string {
+	names := []string{}
+	for name := range formats {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// ValidateFormat returns an error when the format is unknown.
+func ValidateFormat(format string) error {
+	if _, ok := formats[format]; !ok && format != "" {
+		return fmt.Errorf("unknown format %q, expected %s", format, strings.Join(Formats(), " or "))
+	}
+
+	return nil
+}
+
+type formatChannel struct {
+	Channel
+
+	fn FormatFunc
+}
+
+func (fc formatChannel) Send(e event.Event) {
+	fc.Channel.Send(fc.fn(e))
+}
+
+// Flush flushes the channel when it is a Flusher.
+func (fc formatChannel) Flush() {
+	if f, ok := fc.Channel.(Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close closes the channel when it is a Closer.
+func (fc formatChannel) Close() error {
+	if c, ok := fc.Channel.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+type formatDeliverer struct {
+	formatChannel
+}
+
+func (fd formatDeliverer) Deliver(events []event.Event) error {
+	formatted := make([]event.Event, len(events))
+	for i, e := range events {
+		formatted[i] = fd.fn(e)
+	}
+
+	return fd.Channel.(Deliverer).Deliver(formatted)
+}
+
+// FormatChannel returns a channel converting the events to the named
+// format, an empty name selects the honeytrap format.
+func FormatChannel(channel Channel, format string) (Channel, error) {
+	if format == "" {
+		return channel, nil
+	}
+
+	if err := ValidateFormat(format); err != nil {
+		return nil, err
+	}
+
+	fn := formats[format]
+	if fn == nil {
+		return channel, nil
+	}
+
+	fc := formatChannel{
+		Channel: channel,
+		fn:      fn,
+	}
+
+	if _, ok := channel.(Deliverer); ok {
+		return formatDeliverer{fc}, nil
+	}
+
+	return fc, nil
+}
@@ -32,6 +32,6 @@ package kafka
 
 // Config defines a struct which holds configuration values for a SearchBackend.
 type Config struct {
-	Brokers []string `toml:"brokers"`
-	Topic   string   `toml:"topic"`
+	Brokers []string `toml:"brokers" doc:"Kafka brokers" required:"true"`
+	Topic   string   `toml:"topic" doc:"Topic to produce to"`
 }
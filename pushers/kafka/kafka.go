@@ -35,6 +35,7 @@ import (
 
 	sarama "github.com/Shopify/sarama"
 
+	htconfig "github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 
@@ -43,6 +44,12 @@ import (
 
 var (
 	_ = pushers.Register("kafka", New)
+	_ = pushers.Describe("kafka", htconfig.Description{
+		Description: "Produces the events to a kafka topic",
+		Config: func() interface{} {
+			return &Config{}
+		},
+	})
 )
 
 var log = logging.MustGetLogger("channels/kafka")
@@ -54,14 +61,21 @@ type KafkaBackend struct {
 
 	producer sarama.AsyncProducer
 
+	// syncProducer delivers the events of Deliver
+	syncProducer sarama.SyncProducer
+
 	ch chan map[string]interface{}
+
+	// pending counts the events until these have been acknowledged
+	pending *pushers.Pending
 }
 
 func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	ch := make(chan map[string]interface{}, 100)
 
 	c := KafkaBackend{
-		ch: ch,
+		ch:      ch,
+		pending: &pushers.Pending{},
 	}
 
 	for _, optionFn := range options {
@@ -71,12 +85,23 @@ func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	config := sarama.NewConfig()
 	config.Producer.Return.Successes = true
 
-	if producer, err := sarama.NewAsyncProducer(c.Brokers, config); err != nil {
+	client, err := sarama.NewClient(c.Brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if producer, err := sarama.NewAsyncProducerFromClient(client); err != nil {
 		return nil, err
 	} else {
 		c.producer = producer
 	}
 
+	if producer, err := sarama.NewSyncProducerFromClient(client); err != nil {
+		return nil, err
+	} else {
+		c.syncProducer = producer
+	}
+
 	go c.run()
 
 	return &c, nil
@@ -85,10 +110,24 @@ func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 func (hc KafkaBackend) run() {
 	defer hc.producer.AsyncClose()
 
-	for doc := range <-hc.ch {
+	go func() {
+		for range hc.producer.Successes() {
+			hc.pending.Done(1)
+		}
+	}()
+
+	go func() {
+		for err := range hc.producer.Errors() {
+			log.Errorf("Error producing event: %s", err.Error())
+			hc.pending.Done(1)
+		}
+	}()
+
+	for doc := range hc.ch {
 		data, err := json.Marshal(doc)
 		if err != nil {
 			log.Errorf("Error marshaling event: %s", err.Error())
+			hc.pending.Done(1)
 			continue
 		}
 
@@ -100,8 +139,12 @@ func (hc KafkaBackend) run() {
 	}
 }
 
-// Send delivers the giving push messages into the internal elastic search endpoint.
-func (hc KafkaBackend) Send(message event.Event) {
+// Flush waits until the queued events are acknowledged.
+func (hc KafkaBackend) Flush() {
+	hc.pending.Wait()
+}
+
+func eventMap(message event.Event) map[string]interface{} {
 	mp := make(map[string]interface{})
 
 	message.Range(func(key, value interface{}) bool {
@@ -111,5 +154,32 @@ func (hc KafkaBackend) Send(message event.Event) {
 		return true
 	})
 
-	hc.ch <- mp
+	return mp
+}
+
+// Send delivers the giving push messages into the internal elastic search endpoint.
+func (hc KafkaBackend) Send(message event.Event) {
+	hc.pending.Add(1)
+	hc.ch <- eventMap(message)
+}
+
+// Deliver produces the events, and waits until these have been
+// acknowledged. Returns an error when the events should be retried.
+func (hc KafkaBackend) Deliver(events []event.Event) error {
+	messages := []*sarama.ProducerMessage{}
+
+	for _, e := range events {
+		data, err := json.Marshal(eventMap(e))
+		if err != nil {
+			log.Errorf("Error marshaling event: %s", err.Error())
+			continue
+		}
+
+		messages = append(messages, &sarama.ProducerMessage{
+			Topic: hc.Topic,
+			Value: sarama.ByteEncoder(data),
+		})
+	}
+
+	return hc.syncProducer.SendMessages(messages)
 }
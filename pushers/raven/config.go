@@ -32,6 +32,6 @@ package raven
 
 // Config defines a struct which holds configuration values for a SearchBackend.
 type Config struct {
-	Token  string `toml:"token"`
-	Server string `toml:"server"`
+	Token  string `toml:"token" doc:"Authentication token" secret:"true"`
+	Server string `toml:"server" doc:"Websocket url of the server" required:"true"`
 }
@@ -33,11 +33,13 @@ package raven
 import (
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/websocket"
+	htconfig "github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 
@@ -46,6 +48,12 @@ import (
 
 var (
 	_ = pushers.Register("raven", New)
+	_ = pushers.Describe("raven", htconfig.Description{
+		Description: "Sends the events to a raven server",
+		Config: func() interface{} {
+			return &Config{}
+		},
+	})
 )
 
 var log = logging.MustGetLogger("channels/raven")
@@ -56,13 +64,26 @@ type RavenBackend struct {
 	Config
 
 	ch chan event.Event
+
+	deliveries chan delivery
+
+	pending *pushers.Pending
+}
+
+// delivery contains the events of Deliver, the result of writing these is
+// sent to result.
+type delivery struct {
+	events []event.Event
+	result chan error
 }
 
 func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	ch := make(chan event.Event, 100)
 
 	c := RavenBackend{
-		ch: ch,
+		ch:         ch,
+		deliveries: make(chan delivery),
+		pending:    &pushers.Pending{},
 	}
 
 	for _, optionFn := range options {
@@ -124,16 +145,27 @@ func (hc RavenBackend) run() {
 
 						_ = data
 					case evt := <-hc.ch:
-						// we'll ignore heartbeats, those are generated within the protocol
-						if category := evt.Get("category"); category == "heartbeat" {
-						} else if data, err := json.Marshal(evt); err != nil {
-							// handle errors
-							log.Errorf("Error occurred while marshalling: %s", err.Error())
-							continue
-						} else if err := c.WriteMessage(websocket.BinaryMessage, data); err != nil {
+						err := write(c, evt)
+
+						hc.pending.Done(1)
+
+						if err != nil {
+							log.Errorf("Could not write: %s", err.Error())
+							return
+						}
+					case d := <-hc.deliveries:
+						var err error
+						for _, evt := range d.events {
+							if err = write(c, evt); err != nil {
+								break
+							}
+						}
+
+						d.result <- err
+
+						if err != nil {
 							log.Errorf("Could not write: %s", err.Error())
 							return
-						} else {
 						}
 					}
 				}
@@ -146,7 +178,46 @@ func (hc RavenBackend) run() {
 	}
 }
 
+func write(c *websocket.Conn, evt event.Event) error {
+	// we'll ignore heartbeats, those are generated within the protocol
+	if category := evt.Get("category"); category == "heartbeat" {
+		return nil
+	}
+
+	data, err := json.Marshal(evt)
+	if err != nil {
+		// handle errors
+		log.Errorf("Error occurred while marshalling: %s", err.Error())
+		return nil
+	}
+
+	return c.WriteMessage(websocket.BinaryMessage, data)
+}
+
+// Flush waits until the queued events are written.
+func (hc RavenBackend) Flush() {
+	hc.pending.Wait()
+}
+
 // Send delivers the giving push messages into the internal elastic search endpoint.
 func (hc RavenBackend) Send(message event.Event) {
+	hc.pending.Add(1)
 	hc.ch <- message
 }
+
+// Deliver writes the events to the raven server, and returns an error when
+// these couldn't be written or the channel isn't connected.
+func (hc RavenBackend) Deliver(events []event.Event) error {
+	d := delivery{
+		events: events,
+		result: make(chan error, 1),
+	}
+
+	select {
+	case hc.deliveries <- d:
+	case <-time.After(5 * time.Second):
+		return errors.New("Not connected to Raven server")
+	}
+
+	return <-d.result
+}
@@ -40,6 +40,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 	logging "github.com/op/go-logging"
@@ -49,15 +50,21 @@ var log = logging.MustGetLogger("honeytrap:channels:slack")
 
 var (
 	_ = pushers.Register("slack", New)
+	_ = pushers.Describe("slack", config.Description{
+		Description: "Posts the events to a slack webhook",
+		Config: func() interface{} {
+			return &Config{}
+		},
+	})
 )
 
 // Config defines a struct which holds configuration field values used by the
 // SlackBackend for it's message delivery to the slack channel API.
 type Config struct {
-	WebhookURL string `toml:"webhook_url"`
-	Username   string `toml:"username"`
-	IconURL    string `toml:"icon_url"`
-	IconEmoji  string `toml:"icon_emoji"`
+	WebhookURL string `toml:"webhook_url" doc:"Incoming webhook url" required:"true" secret:"true"`
+	Username   string `toml:"username" doc:"Username of the posts"`
+	IconURL    string `toml:"icon_url" doc:"Icon url of the posts"`
+	IconEmoji  string `toml:"icon_emoji" doc:"Icon emoji of the posts"`
 }
 
 // SlackBackend provides a struct which holds the configured means by which
@@ -214,6 +221,13 @@ func (b SlackBackend) run() {
 	}
 }
 
+// Flush waits until the queued events are delivered.
+func (b SlackBackend) Flush() {
+	for len(b.ch) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 // Send delivers the giving push messages to the required slack channel.
 // TODO: Ask if Send shouldnt return an error to allow proper delivery validation.
 func (b SlackBackend) Send(e event.Event) {
@@ -37,6 +37,7 @@ import (
 
 	hec "github.com/fuyufjh/splunk-hec-go"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 
@@ -45,6 +46,17 @@ import (
 
 var (
 	_ = pushers.Register("splunk", New)
+	_ = pushers.Describe("splunk", config.Description{
+		Description: "Sends the events to splunk http event collectors",
+		Config: func() interface{} {
+			// Config is decoded by UnmarshalTOML
+			return &struct {
+				Endpoints []string `toml:"endpoints" doc:"Urls of the event collectors" required:"true"`
+				Token     string   `toml:"token" doc:"Event collector token" required:"true" secret:"true"`
+				Verify    bool     `toml:"verify" doc:"Verify the certificates of the endpoints"`
+			}{}
+		},
+	})
 )
 
 var log = logging.MustGetLogger("channels:splunk")
@@ -54,20 +66,38 @@ var log = logging.MustGetLogger("channels:splunk")
 type Backend struct {
 	Config
 
+	client hec.HEC
+
 	ch chan map[string]interface{}
+
+	// flush requests the batch to be written before it is full
+	flush chan struct{}
+
+	pending *pushers.Pending
 }
 
 func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	ch := make(chan map[string]interface{}, 100)
 
 	c := Backend{
-		ch: ch,
+		ch:      ch,
+		flush:   make(chan struct{}),
+		pending: &pushers.Pending{},
 	}
 
 	for _, optionFn := range options {
 		optionFn(&c)
 	}
 
+	c.client = hec.NewCluster(
+		c.Config.Endpoints,
+		c.Config.Token,
+	)
+
+	c.client.SetHTTPClient(&http.Client{Transport: &http.Transport{
+		TLSClientConfig: c.tlsConfig,
+	}})
+
 	go c.run()
 
 	return &c, nil
@@ -77,15 +107,6 @@ func (hc Backend) run() {
 	log.Debug("Splunk indexer started...")
 	defer log.Debug("Splunk indexer stopped...")
 
-	client := hec.NewCluster(
-		hc.Config.Endpoints,
-		hc.Config.Token,
-	)
-
-	client.SetHTTPClient(&http.Client{Transport: &http.Transport{
-		TLSClientConfig: hc.tlsConfig,
-	}})
-
 	batch := []*hec.Event{}
 
 	count := 0
@@ -99,6 +120,7 @@ func (hc Backend) run() {
 			if len(batch) < 10 {
 				continue
 			}
+		case <-hc.flush:
 		case <-time.After(time.Second * 10):
 		}
 
@@ -106,20 +128,31 @@ func (hc Backend) run() {
 			continue
 		}
 
-		if err := client.WriteBatch(batch); err != nil {
+		if err := hc.client.WriteBatch(batch); err != nil {
 			log.Errorf("Error indexing: %s", err.Error())
 		} else {
 			count += len(batch)
 
 			log.Infof("Bulk indexing: %d total %d", len(batch), count)
 
+			hc.pending.Done(len(batch))
+
 			batch = []*hec.Event{}
 		}
 	}
 }
 
-// Send delivers the giving push messages into the internal elastic search endpoint.
-func (hc Backend) Send(message event.Event) {
+// Flush writes the batch, and waits until the queued events are delivered.
+func (hc Backend) Flush() {
+	for hc.pending.Len() > 0 {
+		select {
+		case hc.flush <- struct{}{}:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func eventMap(message event.Event) map[string]interface{} {
 	mp := make(map[string]interface{})
 
 	message.Range(func(key, value interface{}) bool {
@@ -129,5 +162,33 @@ func (hc Backend) Send(message event.Event) {
 		return true
 	})
 
-	hc.ch <- mp
+	return mp
+}
+
+// Send delivers the giving push messages into the internal elastic search endpoint.
+func (hc Backend) Send(message event.Event) {
+	hc.pending.Add(1)
+	hc.ch <- eventMap(message)
+}
+
+// Deliver writes the events at once to the event collectors, and returns an
+// error when these should be retried.
+func (hc Backend) Deliver(events []event.Event) error {
+	batch := []*hec.Event{}
+
+	for _, e := range events {
+		he := hec.NewEvent(eventMap(e))
+
+		if v, _ := e.Load("date"); v == nil {
+			he.SetTime(time.Now())
+		} else if t, ok := v.(time.Time); ok {
+			he.SetTime(t)
+		} else {
+			he.SetTime(time.Now())
+		}
+
+		batch = append(batch, he)
+	}
+
+	return hc.client.WriteBatch(batch)
 }
@@ -0,0 +1,323 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+// maxRetryInterval caps the interval between delivery attempts.
+const maxRetryInterval = time.Minute
+
+// batchSize is the maximum number of events delivered at once.
+const batchSize = 100
+
+// Config contains the spool options of a channel.
+type Config struct {
+	Path        string       `toml:"spool-path"`
+	MaxSize     int64        `toml:"spool-max-size"`
+	SegmentSize int64        `toml:"spool-segment-size"`
+	Retry       config.Delay `toml:"spool-retry-interval"`
+}
+
+// DefaultConfig contains the spool defaults, the spool is disabled until a
+// path is set.
+var DefaultConfig = Config{
+	MaxSize:     DefaultMaxSize,
+	SegmentSize: DefaultSegmentSize,
+	Retry:       config.Delay(time.Second),
+}
+
+// Enabled returns true when the spool path is set.
+func (c Config) Enabled() bool {
+	return c.Path != ""
+}
+
+// Validate checks the spool configuration.
+func (c Config) Validate() error {
+	if c.MaxSize < 0 {
+		return errors.New("spool-max-size should not be negative")
+	}
+
+	if c.SegmentSize <= 0 {
+		return errors.New("spool-segment-size should be positive")
+	}
+
+	if c.Retry.Duration() <= 0 {
+		return errors.New("spool-retry-interval should be positive")
+	}
+
+	return nil
+}
+
+// Channel writes the events to a spool, and delivers them in order from
+// there. Events which couldn't be delivered are retried until the backend
+// recovers, so events are delivered at least once.
+type Channel struct {
+	name    string
+	channel pushers.Deliverer
+
+	spool *Spool
+	retry time.Duration
+
+	notify chan struct{}
+
+	delivered uint64
+	retries   uint64
+	lastError atomic.Value
+
+	closed chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// New returns a channel spooling the events of channel to the directory
+// named name within the spool path. The channel needs to implement
+// pushers.Deliverer.
+func New(name string, channel pushers.Channel, c Config) (*Channel, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	d, ok := channel.(pushers.Deliverer)
+	if !ok {
+		return nil, fmt.Errorf("channel %s doesn't support spooling", name)
+	}
+
+	s, err := Open(
+		filepath.Join(c.Path, name),
+		WithMaxSize(c.MaxSize),
+		WithSegmentSize(c.SegmentSize),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &Channel{
+		name:    name,
+		channel: d,
+		spool:   s,
+		retry:   c.Retry.Duration(),
+		notify:  make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	sc.lastError.Store("")
+
+	if depth := s.Len(); depth > 0 {
+		log.Infof("Spool of %s contains %d events, replaying", name, depth)
+	}
+
+	go sc.run()
+
+	return sc, nil
+}
+
+// Send writes the event to the spool.
+func (c *Channel) Send(e event.Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Errorf("Could not marshal event of %s: %s", c.name, err.Error())
+		return
+	}
+
+	if err := c.spool.Append(time.Now(), data); err != nil {
+		log.Errorf("Could not spool event of %s: %s", c.name, err.Error())
+		return
+	}
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// deliver delivers the oldest spooled events, and returns the number of
+// records committed.
+func (c *Channel) deliver() (int, error) {
+	c.spool.consumer.Lock()
+	defer c.spool.consumer.Unlock()
+
+	records, err := c.spool.Peek(batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	events := []event.Event{}
+	for _, r := range records {
+		m := map[string]interface{}{}
+		if err := json.Unmarshal(r.Data, &m); err != nil {
+			log.Errorf("Skipping spooled event of %s: %s", c.name, err.Error())
+			continue
+		}
+
+		// the date is restored as time, like the other events
+		if s, ok := m["date"].(string); !ok {
+		} else if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			m["date"] = t
+		}
+
+		events = append(events, event.New(event.CopyFrom(m)))
+	}
+
+	if len(events) > 0 {
+		if err := c.channel.Deliver(events); err != nil {
+			return 0, err
+		}
+	}
+
+	atomic.AddUint64(&c.delivered, uint64(len(events)))
+
+	return len(records), c.spool.Commit()
+}
+
+func (c *Channel) run() {
+	defer close(c.done)
+
+	interval := c.retry
+	failing := false
+
+	for {
+		n, err := c.deliver()
+		if err != nil {
+			atomic.AddUint64(&c.retries, 1)
+			c.lastError.Store(err.Error())
+
+			if !failing {
+				log.Errorf("Could not deliver events of %s, retrying: %s", c.name, err.Error())
+			}
+
+			failing = true
+
+			select {
+			case <-time.After(interval):
+			case <-c.closed:
+				return
+			}
+
+			if interval *= 2; interval > maxRetryInterval {
+				interval = maxRetryInterval
+			}
+
+			continue
+		}
+
+		if failing {
+			log.Infof("Delivering events of %s again", c.name)
+		}
+
+		failing = false
+		interval = c.retry
+
+		if n > 0 {
+			continue
+		}
+
+		select {
+		case <-c.notify:
+		case <-time.After(time.Second):
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// Len returns the number of spooled events.
+func (c *Channel) Len() int {
+	return c.spool.Len()
+}
+
+// Flush waits for the spooled events to be delivered.
+func (c *Channel) Flush() {
+	for c.Len() > 0 {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// Close stops delivering, the spooled events are kept for the next start.
+// The channel is closed when it is a Closer.
+func (c *Channel) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+
+	<-c.done
+
+	if err := c.spool.Close(); err != nil {
+		return err
+	}
+
+	if closer, ok := c.channel.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// ChannelStats contains the metrics of the spool, and the delivery counters
+// of the channel.
+type ChannelStats struct {
+	Stats
+
+	Delivered uint64 `json:"delivered"`
+	Retries   uint64 `json:"retries"`
+	LastError string `json:"last-error,omitempty"`
+}
+
+// Stats returns the metrics of the channel.
+func (c *Channel) Stats() ChannelStats {
+	return ChannelStats{
+		Stats:     c.spool.Stats(),
+		Delivered: atomic.LoadUint64(&c.delivered),
+		Retries:   atomic.LoadUint64(&c.retries),
+		LastError: c.lastError.Load().(string),
+	}
+}
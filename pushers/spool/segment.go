@@ -0,0 +1,178 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A record is stored as a header, followed by the data. The header contains
+// the length of the data, the crc of the timestamp and data, and the
+// timestamp in nanoseconds.
+const headerSize = 16
+
+// maxRecordSize guards against allocating huge buffers for corrupt lengths.
+const maxRecordSize = 64 << 20
+
+var (
+	errCorrupt = errors.New("record is corrupt")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// Record contains the data of a spooled event, and the time it was spooled.
+type Record struct {
+	Time time.Time
+	Data []byte
+}
+
+func encodeRecord(t time.Time, data []byte) []byte {
+	buf := make([]byte, headerSize+len(data))
+
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(t.UnixNano()))
+	copy(buf[headerSize:], data)
+
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(buf[8:], crcTable))
+	return buf
+}
+
+// readRecord reads the record at offset off of r, and returns the offset of
+// the next record. Returns io.EOF when there is no complete record at off.
+func readRecord(r io.ReaderAt, off int64) (Record, int64, error) {
+	header := make([]byte, headerSize)
+	if _, err := r.ReadAt(header, off); err == io.EOF {
+		return Record{}, off, io.EOF
+	} else if err != nil {
+		return Record{}, off, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > maxRecordSize {
+		return Record{}, off, errCorrupt
+	}
+
+	buf := make([]byte, 8+length)
+	copy(buf, header[8:16])
+
+	if _, err := r.ReadAt(buf[8:], off+headerSize); err == io.EOF {
+		return Record{}, off, io.EOF
+	} else if err != nil {
+		return Record{}, off, err
+	}
+
+	if crc32.Checksum(buf, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return Record{}, off, errCorrupt
+	}
+
+	return Record{
+		Time: time.Unix(0, int64(binary.BigEndian.Uint64(buf[0:8]))),
+		Data: buf[8:],
+	}, off + headerSize + int64(length), nil
+}
+
+// segment is a file of the spool, records are appended to the last segment
+// only.
+type segment struct {
+	seq uint64
+	f   *os.File
+
+	size int64
+
+	// count contains the number of unread records
+	count int
+}
+
+func segmentName(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%016x.seg", seq))
+}
+
+func openSegment(dir string, seq uint64) (*segment, error) {
+	f, err := os.OpenFile(segmentName(dir, seq), os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &segment{
+		seq:  seq,
+		f:    f,
+		size: fi.Size(),
+	}, nil
+}
+
+// scan counts the records from offset off. The offset after the last valid
+// record is returned, which is smaller than the size of the segment when the
+// segment ends with a corrupt or partially written record.
+func (sg *segment) scan(off int64) (int64, error) {
+	sg.count = 0
+
+	for off < sg.size {
+		_, next, err := readRecord(sg.f, off)
+		if err == io.EOF || err == errCorrupt {
+			return off, nil
+		} else if err != nil {
+			return off, err
+		}
+
+		sg.count++
+		off = next
+	}
+
+	return off, nil
+}
+
+func (sg *segment) append(data []byte) error {
+	if _, err := sg.f.Write(data); err != nil {
+		return err
+	}
+
+	sg.size += int64(len(data))
+	sg.count++
+	return nil
+}
+
+func (sg *segment) remove() error {
+	sg.f.Close()
+	return os.Remove(sg.f.Name())
+}
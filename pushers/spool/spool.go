@@ -0,0 +1,565 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("channels/spool")
+
+// ErrTooLarge is returned when a record exceeds the maximum size of the
+// spool.
+var ErrTooLarge = errors.New("record exceeds the size of the spool")
+
+const (
+	// DefaultMaxSize is the default size cap of a spool.
+	DefaultMaxSize = 1 << 30
+
+	// DefaultSegmentSize is the default size of the segment files.
+	DefaultSegmentSize = 16 << 20
+)
+
+// OptionFn configures a spool.
+type OptionFn func(*Spool)
+
+// WithMaxSize caps the size of the segments of the spool, the oldest
+// segments are removed when the cap is exceeded.
+func WithMaxSize(n int64) OptionFn {
+	return func(s *Spool) {
+		s.maxSize = n
+	}
+}
+
+// WithSegmentSize sets the size at which a new segment file is started.
+func WithSegmentSize(n int64) OptionFn {
+	return func(s *Spool) {
+		s.segmentSize = n
+	}
+}
+
+type position struct {
+	seq uint64
+	off int64
+}
+
+// Spool is a persistent write-ahead log, records are appended to segment
+// files and read back in order. Records returned by Peek are read again
+// after a restart, until they are committed. Segments are removed once all
+// their records have been committed.
+//
+// Records aren't synced to disk on every write, they survive a restart or
+// crash of honeytrap, but not a crash of the host.
+type Spool struct {
+	dir string
+
+	maxSize     int64
+	segmentSize int64
+
+	m sync.Mutex
+
+	segments []*segment
+
+	// cursor is the position of the first uncommitted record
+	cursor position
+
+	// peeked contains the position after, and the segments of, the records
+	// returned by the last Peek
+	peeked position
+	peek   map[*segment]int
+
+	size  int64
+	depth int
+
+	dropped uint64
+	corrupt uint64
+
+	// consumer serializes the readers sharing the spool
+	consumer sync.Mutex
+
+	refs int
+}
+
+var (
+	spools  = map[string]*Spool{}
+	spoolsM sync.Mutex
+)
+
+// Open opens the spool in directory dir, the directory is created when it
+// doesn't exist. A spool that is already open is shared, which happens when
+// a channel is replaced by a reload.
+func Open(dir string, options ...OptionFn) (*Spool, error) {
+	dir = filepath.Clean(dir)
+
+	spoolsM.Lock()
+	defer spoolsM.Unlock()
+
+	if s, ok := spools[dir]; ok {
+		s.refs++
+		return s, nil
+	}
+
+	s := &Spool{
+		dir:         dir,
+		maxSize:     DefaultMaxSize,
+		segmentSize: DefaultSegmentSize,
+		refs:        1,
+	}
+
+	for _, fn := range options {
+		fn(s)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	if err := s.load(); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	spools[dir] = s
+	return s, nil
+}
+
+// load opens the segments, and counts the uncommitted records.
+func (s *Spool) load() error {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*.seg"))
+	if err != nil {
+		return err
+	}
+
+	seqs := []uint64{}
+	for _, name := range names {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), ".seg"), 16, 64)
+		if err != nil {
+			continue
+		}
+
+		seqs = append(seqs, seq)
+	}
+
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	s.cursor = s.loadCursor()
+
+	for i, seq := range seqs {
+		if seq < s.cursor.seq {
+			// committed before a restart
+			os.Remove(segmentName(s.dir, seq))
+			continue
+		}
+
+		sg, err := openSegment(s.dir, seq)
+		if err != nil {
+			return err
+		}
+
+		s.segments = append(s.segments, sg)
+
+		off := int64(0)
+		if seq == s.cursor.seq {
+			off = s.cursor.off
+		}
+
+		end, err := sg.scan(off)
+		if err != nil {
+			return err
+		}
+
+		// the last segment can end with a partially written record,
+		// which is truncated so new records can be read
+		if i == len(seqs)-1 && end < sg.size {
+			log.Warningf("Truncating segment %s at %d, it ends with a corrupt record", sg.f.Name(), end)
+
+			if err := sg.f.Truncate(end); err != nil {
+				return err
+			}
+
+			sg.size = end
+		}
+
+		s.size += sg.size
+		s.depth += sg.count
+	}
+
+	if len(s.segments) == 0 {
+		sg, err := openSegment(s.dir, s.cursor.seq+1)
+		if err != nil {
+			return err
+		}
+
+		s.segments = append(s.segments, sg)
+	}
+
+	if s.segments[0].seq != s.cursor.seq {
+		s.cursor = position{seq: s.segments[0].seq}
+	}
+
+	return nil
+}
+
+// The cursor file contains the position of the first uncommitted record,
+// followed by a crc.
+func (s *Spool) loadCursor() position {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, "cursor"))
+	if err != nil || len(data) != 20 {
+		return position{}
+	}
+
+	if crc32.Checksum(data[:16], crcTable) != binary.BigEndian.Uint32(data[16:20]) {
+		log.Warningf("Ignoring corrupt cursor of spool %s", s.dir)
+		return position{}
+	}
+
+	return position{
+		seq: binary.BigEndian.Uint64(data[0:8]),
+		off: int64(binary.BigEndian.Uint64(data[8:16])),
+	}
+}
+
+func (s *Spool) saveCursor() error {
+	data := make([]byte, 20)
+	binary.BigEndian.PutUint64(data[0:8], s.cursor.seq)
+	binary.BigEndian.PutUint64(data[8:16], uint64(s.cursor.off))
+	binary.BigEndian.PutUint32(data[16:20], crc32.Checksum(data[:16], crcTable))
+
+	name := filepath.Join(s.dir, "cursor")
+	if err := ioutil.WriteFile(name+".tmp", data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(name+".tmp", name)
+}
+
+func (s *Spool) last() *segment {
+	return s.segments[len(s.segments)-1]
+}
+
+func (s *Spool) rotate() error {
+	sg, err := openSegment(s.dir, s.last().seq+1)
+	if err != nil {
+		return err
+	}
+
+	s.segments = append(s.segments, sg)
+	return nil
+}
+
+// dropOldest removes the oldest segment, including its uncommitted records.
+func (s *Spool) dropOldest() error {
+	if len(s.segments) == 1 {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	sg := s.segments[0]
+	s.segments = s.segments[1:]
+
+	s.size -= sg.size
+	s.depth -= sg.count
+	s.dropped += uint64(sg.count)
+
+	if sg.count > 0 {
+		log.Warningf("Spool %s exceeds %d bytes, dropped %d records", s.dir, s.maxSize, sg.count)
+	}
+
+	if err := sg.remove(); err != nil {
+		return err
+	}
+
+	if s.cursor.seq > sg.seq {
+		return nil
+	}
+
+	// the records of the last peek can't be committed anymore
+	s.cursor = position{seq: s.segments[0].seq}
+	s.peek = nil
+
+	return s.saveCursor()
+}
+
+// Append writes the record to the spool. The oldest segments are removed
+// when the spool would exceed its maximum size.
+func (s *Spool) Append(t time.Time, data []byte) error {
+	rec := encodeRecord(t, data)
+	n := int64(len(rec))
+
+	if s.maxSize > 0 && n > s.maxSize {
+		return ErrTooLarge
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for s.maxSize > 0 && s.size+n > s.maxSize {
+		if err := s.dropOldest(); err != nil {
+			return err
+		}
+	}
+
+	if sg := s.last(); sg.size > 0 && sg.size+n > s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.last().append(rec); err != nil {
+		return err
+	}
+
+	s.size += n
+	s.depth++
+	return nil
+}
+
+func (s *Spool) segment(seq uint64) *segment {
+	for _, sg := range s.segments {
+		if sg.seq == seq {
+			return sg
+		}
+	}
+
+	return nil
+}
+
+// skip skips the remainder of a corrupt segment.
+func (s *Spool) skip(sg *segment, off int64) error {
+	log.Errorf("Skipping the remainder of segment %s, record at %d is corrupt", sg.f.Name(), off)
+
+	s.depth -= sg.count
+	s.corrupt++
+	sg.count = 0
+
+	if sg == s.last() {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	s.cursor = position{seq: sg.seq + 1}
+	s.peek = nil
+
+	return s.commit()
+}
+
+// Peek returns at most n uncommitted records, starting with the oldest. The
+// same records are returned until they are committed.
+func (s *Spool) Peek(n int) ([]Record, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	records := []Record{}
+
+	s.peek = map[*segment]int{}
+
+	pos := s.cursor
+	for len(records) < n {
+		sg := s.segment(pos.seq)
+		if sg == nil {
+			break
+		}
+
+		r, next, err := readRecord(sg.f, pos.off)
+		if err == io.EOF && sg != s.last() {
+			pos = position{seq: sg.seq + 1}
+			continue
+		} else if err == io.EOF {
+			break
+		} else if err == errCorrupt && len(records) == 0 {
+			if err := s.skip(sg, pos.off); err != nil {
+				return nil, err
+			}
+
+			s.peek = map[*segment]int{}
+
+			pos = s.cursor
+			continue
+		} else if err == errCorrupt {
+			// the records before are returned first
+			break
+		} else if err != nil {
+			return records, err
+		}
+
+		records = append(records, r)
+		s.peek[sg]++
+
+		pos.off = next
+	}
+
+	s.peeked = pos
+	return records, nil
+}
+
+// Commit commits the records returned by the last Peek, these won't be
+// returned again.
+func (s *Spool) Commit() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.peek == nil {
+		return nil
+	}
+
+	for sg, n := range s.peek {
+		sg.count -= n
+		s.depth -= n
+	}
+
+	s.peek = nil
+	s.cursor = s.peeked
+
+	return s.commit()
+}
+
+// commit removes the segments before the cursor, and saves the cursor.
+func (s *Spool) commit() error {
+	if sg := s.segment(s.cursor.seq); sg != nil && sg != s.last() && s.cursor.off >= sg.size {
+		s.cursor = position{seq: sg.seq + 1}
+	}
+
+	for len(s.segments) > 1 && s.segments[0].seq < s.cursor.seq {
+		sg := s.segments[0]
+		s.segments = s.segments[1:]
+
+		s.size -= sg.size
+
+		if err := sg.remove(); err != nil {
+			return err
+		}
+	}
+
+	return s.saveCursor()
+}
+
+// Stats contains the metrics of a spool.
+type Stats struct {
+	// Depth is the number of uncommitted records
+	Depth int   `json:"depth"`
+	Size  int64 `json:"size"`
+
+	// Oldest is the time the oldest uncommitted record was spooled, and
+	// Age the seconds since
+	Oldest time.Time `json:"oldest,omitempty"`
+	Age    float64   `json:"age"`
+
+	// Dropped counts the records removed to stay within the size cap,
+	// Corrupt the segments skipped because of a corrupt record
+	Dropped uint64 `json:"dropped"`
+	Corrupt uint64 `json:"corrupt"`
+}
+
+// Stats returns the metrics of the spool.
+func (s *Spool) Stats() Stats {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	st := Stats{
+		Depth:   s.depth,
+		Size:    s.size,
+		Dropped: s.dropped,
+		Corrupt: s.corrupt,
+	}
+
+	if s.depth == 0 {
+		return st
+	}
+
+	pos := s.cursor
+	for sg := s.segment(pos.seq); sg != nil; sg = s.segment(pos.seq) {
+		r, _, err := readRecord(sg.f, pos.off)
+		if err == io.EOF {
+			pos = position{seq: sg.seq + 1}
+			continue
+		} else if err != nil {
+			break
+		}
+
+		st.Oldest = r.Time
+		st.Age = time.Since(r.Time).Seconds()
+		break
+	}
+
+	return st
+}
+
+// Len returns the number of uncommitted records.
+func (s *Spool) Len() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.depth
+}
+
+func (s *Spool) close() error {
+	var err error
+	for _, sg := range s.segments {
+		if cerr := sg.f.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// Close closes the spool, when it isn't shared anymore.
+func (s *Spool) Close() error {
+	spoolsM.Lock()
+	defer spoolsM.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+
+	delete(spools, s.dir)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.close()
+}
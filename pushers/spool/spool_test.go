@@ -0,0 +1,295 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package spool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func peekAll(t *testing.T, s *Spool) []string {
+	records, err := s.Peek(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := []string{}
+	for _, r := range records {
+		values = append(values, string(r.Data))
+	}
+
+	return values
+}
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	// every segment holds two records
+	s, err := Open(dir, WithSegmentSize(2*(headerSize+2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := s.Append(time.Now(), []byte(fmt.Sprintf("e%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(s.segments) != 3 {
+		t.Fatalf("Expected 3 segments, got %d", len(s.segments))
+	}
+
+	if records, _ := s.Peek(2); len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	} else if err := s.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// uncommitted records are returned again after a restart
+	if _, err := s.Peek(2); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Close()
+
+	s, err = Open(dir, WithSegmentSize(2*(headerSize+2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, expected := peekAll(t, s), []string{"e2", "e3", "e4"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v after restart, got %v", expected, got)
+	}
+
+	if st := s.Stats(); st.Depth != 3 || st.Oldest.IsZero() {
+		t.Fatalf("Unexpected stats %+v", st)
+	}
+
+	// the first segment has been removed after the commit
+	if names, _ := filepath.Glob(filepath.Join(dir, "*.seg")); len(names) != 2 {
+		t.Fatalf("Expected 2 segment files, got %v", names)
+	}
+
+	s.Close()
+
+	// corrupt the record e3
+	name := segmentName(dir, 2)
+
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data[len(data)-1] ^= 0xff
+
+	if err := ioutil.WriteFile(name, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(dir, WithSegmentSize(2*(headerSize+2)), WithMaxSize(4*(headerSize+2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	if got, expected := peekAll(t, s), []string{"e2"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v before the corrupt record, got %v", expected, got)
+	} else if err := s.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, expected := peekAll(t, s), []string{"e4"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v after the corrupt record, got %v", expected, got)
+	}
+
+	// exceeding the size cap drops the oldest segment, with the
+	// uncommitted records e4 and e5
+	for i := 5; i < 9; i++ {
+		if err := s.Append(time.Now(), []byte(fmt.Sprintf("e%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, expected := peekAll(t, s), []string{"e6", "e7", "e8"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v after exceeding the cap, got %v", expected, got)
+	}
+
+	if st := s.Stats(); st.Dropped != 2 || st.Corrupt != 1 || st.Depth != 3 {
+		t.Fatalf("Unexpected stats %+v", st)
+	}
+}
+
+// httpChannel posts the events to a backend, like the elasticsearch and
+// splunk channels do.
+type httpChannel struct {
+	url string
+}
+
+func (c *httpChannel) Send(e event.Event) {
+	c.Deliver([]event.Event{e})
+}
+
+func (c *httpChannel) Deliver(events []event.Event) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(c.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func TestChannelOutage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	var m sync.Mutex
+
+	down := true
+	received := []string{}
+
+	// the stub backend is unavailable until it recovers
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		events := []map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		for _, e := range events {
+			received = append(received, fmt.Sprint(e["sequence"]))
+		}
+	}))
+
+	defer ts.Close()
+
+	c := DefaultConfig
+	c.Path = dir
+	c.Retry = config.Delay(10 * time.Millisecond)
+
+	sc, err := New("backend", &httpChannel{url: ts.URL}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		sc.Send(event.New(event.Custom("sequence", i)))
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if st := sc.Stats(); st.Depth != 3 || st.Retries == 0 || st.LastError == "" {
+		t.Fatalf("Expected the events to be spooled, got %+v", st)
+	}
+
+	// the spool survives a restart during the outage
+	if err := sc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sc, err = New("backend", &httpChannel{url: ts.URL}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sc.Close()
+
+	sc.Send(event.New(event.Custom("sequence", 3)))
+
+	m.Lock()
+	down = false
+	m.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		sc.Flush()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Spooled events haven't been delivered")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if expected := []string{"0", "1", "2", "3"}; !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Expected %v, got %v", expected, received)
+	}
+
+	if st := sc.Stats(); st.Depth != 0 || st.Delivered != 4 {
+		t.Fatalf("Unexpected stats %+v", st)
+	}
+}
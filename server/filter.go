@@ -0,0 +1,179 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"fmt"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/pushers/expr"
+)
+
+// filterConfig contains the configuration of a filter. Every criterium
+// matches an event when one of its patterns match, patterns starting with !
+// exclude the matching events. An event needs to match all criteria.
+type filterConfig struct {
+	Channels []string `toml:"channel"`
+
+	// Type is one of event, alert or logging. Alerts are events with at
+	// least warning severity, logging contains the framework logging.
+	Type string `toml:"type"`
+
+	// Components contains globs matching the component sending the event,
+	// like service.ssh01, director.lxc, listener.raw or the logging module.
+	Components []string `toml:"component"`
+
+	Sensors    []string `toml:"sensor"`
+	Categories []string `toml:"category"`
+	EventTypes []string `toml:"event-type"`
+	Service    []string `toml:"service"`
+
+	// Severity or Level is the minimum severity of the events.
+	Severity string `toml:"severity"`
+	Level    string `toml:"level"`
+
+	// Sources contains the networks of the source ip addresses.
+	Sources []string `toml:"source"`
+
+	// Fields contains regular expressions matching the event fields.
+	Fields map[string][]string `toml:"fields"`
+
+	// Expression contains an expression the events need to match, like
+	// category == "ssh" && payload-length > 100.
+	Expression string `toml:"expression"`
+
+	// Services and Categories contain regular expressions, they are kept
+	// for existing configurations.
+	Services       []string `toml:"services"`
+	CategoriesExpr []string `toml:"categories"`
+}
+
+// filter returns the function matching the events of the filter.
+func (fc filterConfig) filter() (pushers.FilterFunc, error) {
+	fns := []pushers.FilterFunc{}
+
+	notLogging := func(e event.Event) bool {
+		return !isLogging(e)
+	}
+
+	switch fc.Type {
+	case "", "event":
+		fns = append(fns, notLogging)
+	case "alert":
+		alert, _ := pushers.SeverityFilterFunc("warning")
+		fns = append(fns, notLogging, alert)
+	case "logging":
+		fns = append(fns, isLogging)
+	default:
+		return nil, fmt.Errorf("invalid type %q, expected event, alert or logging", fc.Type)
+	}
+
+	globs := []struct {
+		field  string
+		values []string
+	}{
+		{"component", fc.Components},
+		{"sensor", fc.Sensors},
+		{"category", fc.Categories},
+		{"type", fc.EventTypes},
+		{"service", fc.Service},
+	}
+
+	for _, g := range globs {
+		if len(g.values) == 0 {
+			continue
+		}
+
+		fn, err := pushers.GlobFilterFunc(g.field, g.values)
+		if err != nil {
+			return nil, err
+		}
+
+		fns = append(fns, fn)
+	}
+
+	expressions := map[string][]string{}
+	for field, values := range fc.Fields {
+		expressions[field] = values
+	}
+
+	if len(fc.Services) > 0 {
+		expressions["service"] = append(expressions["service"], fc.Services...)
+	}
+
+	if len(fc.CategoriesExpr) > 0 {
+		expressions["category"] = append(expressions["category"], fc.CategoriesExpr...)
+	}
+
+	for field, values := range expressions {
+		fn, err := pushers.PatternFilterFunc(field, values)
+		if err != nil {
+			return nil, err
+		}
+
+		fns = append(fns, fn)
+	}
+
+	if fc.Expression != "" {
+		x, err := expr.Compile(fc.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression %q: %s", fc.Expression, err.Error())
+		}
+
+		fns = append(fns, x.Match)
+	}
+
+	if len(fc.Sources) > 0 {
+		fn, err := pushers.CIDRFilterFunc("source-ip", fc.Sources)
+		if err != nil {
+			return nil, err
+		}
+
+		fns = append(fns, fn)
+	}
+
+	severity := fc.Severity
+	if severity == "" {
+		severity = fc.Level
+	}
+
+	if severity != "" {
+		fn, err := pushers.SeverityFilterFunc(severity)
+		if err != nil {
+			return nil, err
+		}
+
+		fns = append(fns, fn)
+	}
+
+	return pushers.AllFilterFunc(fns...), nil
+}
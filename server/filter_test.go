@@ -0,0 +1,112 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func TestFilter(t *testing.T) {
+	ssh := event.New(
+		event.Sensor("services"),
+		event.Category("ssh"),
+		event.Type("password-authentication"),
+		event.SourceIP(net.ParseIP("10.0.0.1")),
+		event.Custom("service", "ssh01"),
+		event.Custom("component", "service.ssh01"),
+		event.Custom("ssh.username", "root"),
+	)
+
+	poisoner := event.New(
+		event.Sensor("canary"),
+		event.Category("poisoner"),
+		event.Severity("high"),
+		event.SourceIP(net.ParseIP("192.168.1.5")),
+		event.Custom("component", "listener.raw"),
+	)
+
+	heartbeat := event.New(
+		event.Sensor("honeytrap"),
+		event.Category("heartbeat"),
+	)
+
+	debug := EventLogging("honeytrap/server", "debug", "Handling connection")
+	warning := EventLogging("services", "warning", "Could not read")
+
+	tests := []struct {
+		name     string
+		fc       filterConfig
+		expected []bool
+	}{
+		{"all events", filterConfig{}, []bool{true, true, true, false, false}},
+		{"alerts", filterConfig{Type: "alert"}, []bool{false, true, false, false, false}},
+		{"logging", filterConfig{Type: "logging", Level: "INFO"}, []bool{false, false, false, false, true}},
+		{"logging components", filterConfig{Type: "logging", Components: []string{"honeytrap/*"}}, []bool{false, false, false, true, false}},
+		{"components", filterConfig{Components: []string{"service.*", "listener.*"}}, []bool{true, true, false, false, false}},
+		{"negation", filterConfig{Categories: []string{"!heartbeat"}}, []bool{true, true, false, false, false}},
+		{"service", filterConfig{Service: []string{"ssh*"}}, []bool{true, false, false, false, false}},
+		{"sources", filterConfig{Sources: []string{"10.0.0.0/8", "!10.0.0.1"}}, []bool{false, false, false, false, false}},
+		{"source", filterConfig{Sources: []string{"192.168.1.0/24"}}, []bool{false, true, false, false, false}},
+		{"fields", filterConfig{Fields: map[string][]string{"ssh.username": {"^root$"}}}, []bool{true, false, false, false, false}},
+		{"services", filterConfig{Services: []string{"^ssh"}}, []bool{true, false, false, false, false}},
+		{"severity", filterConfig{Severity: "medium"}, []bool{false, true, false, false, false}},
+	}
+
+	for _, tt := range tests {
+		fn, err := tt.fc.filter()
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err.Error())
+		}
+
+		for i, e := range []event.Event{ssh, poisoner, heartbeat, debug, warning} {
+			if fn(e) != tt.expected[i] {
+				t.Errorf("%s: expected %t for event %d", tt.name, tt.expected[i], i)
+			}
+		}
+	}
+
+	invalid := []filterConfig{
+		{Type: "alerts"},
+		{Severity: "loud"},
+		{Sources: []string{"10.0.0.0/33"}},
+		{Fields: map[string][]string{"payload": {"("}}},
+		{Components: []string{"service.["}},
+	}
+
+	for _, fc := range invalid {
+		if _, err := fc.filter(); err == nil {
+			t.Errorf("Expected an error for %+v", fc)
+		}
+	}
+}
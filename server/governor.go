@@ -0,0 +1,390 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// limitsConfig contains the limits for connections to the sensor.
+type limitsConfig struct {
+	// MaxConnections is the maximum of concurrent connections
+	MaxConnections int `toml:"max-connections"`
+	// MaxConnectionsPerSource is the maximum of concurrent connections per
+	// source ip
+	MaxConnectionsPerSource int `toml:"max-connections-per-source"`
+
+	// Rate is the number of new connections per second per source ip,
+	// allowing bursts of Burst connections
+	Rate  float64 `toml:"rate"`
+	Burst int     `toml:"burst"`
+
+	// MaxBytes is the maximum of bytes read per connection
+	MaxBytes int64 `toml:"max-bytes"`
+	// MaxDuration is the maximum duration of a connection, when the service
+	// doesn't configure max-session
+	MaxDuration config.Delay `toml:"max-duration"`
+
+	// Action is the action for connections exceeding a limit, this can be
+	// close, reset or tarpit.
+	Action         string       `toml:"action"`
+	TarpitDuration config.Delay `toml:"tarpit-duration"`
+
+	// MaxTarpits is the maximum of concurrently tarpitted connections,
+	// connections above it are reset
+	MaxTarpits int `toml:"max-tarpits"`
+}
+
+var errLimitExceeded = errors.New("limit exceeded")
+
+// tokenBucket allows rate new connections per second, with bursts.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limitReport limits the number of limit-exceeded events per source.
+type limitReport struct {
+	last       time.Time
+	suppressed int
+}
+
+// governor guards the sensor against sources opening too many connections,
+// or sending too much data.
+type governor struct {
+	limitsConfig
+
+	m sync.Mutex
+
+	total      int
+	perSource  map[string]int
+	perService map[string]int
+
+	// tarpits is the number of tarpitted connections
+	tarpits int
+
+	buckets map[string]*tokenBucket
+	reports map[string]*limitReport
+
+	sweep time.Time
+}
+
+func newGovernor() *governor {
+	return &governor{
+		limitsConfig: limitsConfig{
+			Action:         "close",
+			TarpitDuration: config.Delay(time.Minute),
+			MaxTarpits:     100,
+			Burst:          1,
+		},
+		perSource:  map[string]int{},
+		perService: map[string]int{},
+		buckets:    map[string]*tokenBucket{},
+		reports:    map[string]*limitReport{},
+	}
+}
+
+// limits returns the current limits.
+func (g *governor) limits() limitsConfig {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	return g.limitsConfig
+}
+
+// setLimits replaces the limits, active connections are not affected.
+func (g *governor) setLimits(lc limitsConfig) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	g.limitsConfig = lc
+}
+
+func remoteIP(addr net.Addr) string {
+	switch v := addr.(type) {
+	case *net.TCPAddr:
+		return v.IP.String()
+	case *net.UDPAddr:
+		return v.IP.String()
+	}
+
+	host, _, _ := net.SplitHostPort(addr.String())
+	return host
+}
+
+// allow returns false when the source exceeded the connection rate.
+func (g *governor) allow(ip string) bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.Rate <= 0 {
+		return true
+	}
+
+	now := time.Now()
+
+	// remove buckets of sources which are refilled completely
+	if now.Sub(g.sweep) > time.Minute {
+		for key, b := range g.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*g.Rate >= float64(g.Burst) {
+				delete(g.buckets, key)
+			}
+		}
+
+		g.sweep = now
+	}
+
+	b, ok := g.buckets[ip]
+	if !ok {
+		b = &tokenBucket{
+			tokens: float64(g.Burst),
+			last:   now,
+		}
+
+		g.buckets[ip] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * g.Rate
+	if b.tokens > float64(g.Burst) {
+		b.tokens = float64(g.Burst)
+	}
+
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// acquire reserves a connection for the source, the returned function
+// releases it. Returns the limit when it is exceeded. Connections are
+// acquired before they are routed, the service is known after the peek.
+func (g *governor) acquire(ip string) (func(), string) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.MaxConnections > 0 && g.total >= g.MaxConnections {
+		return nil, "max-connections"
+	}
+
+	if g.MaxConnectionsPerSource > 0 && g.perSource[ip] >= g.MaxConnectionsPerSource {
+		return nil, "max-connections-per-source"
+	}
+
+	g.total++
+	g.perSource[ip]++
+
+	return func() {
+		g.m.Lock()
+		defer g.m.Unlock()
+
+		g.total--
+
+		if g.perSource[ip]--; g.perSource[ip] <= 0 {
+			delete(g.perSource, ip)
+		}
+	}, ""
+}
+
+// acquireService reserves a connection to the service, the returned
+// function releases it. Returns the limit when it is exceeded.
+func (g *governor) acquireService(sm *ServiceMap) (func(), string) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if sm.MaxConnections > 0 && g.perService[sm.Name] >= sm.MaxConnections {
+		return nil, "max-connections-per-service"
+	}
+
+	g.perService[sm.Name]++
+
+	return func() {
+		g.m.Lock()
+		defer g.m.Unlock()
+
+		g.perService[sm.Name]--
+	}, ""
+}
+
+// report returns true when the event of the limit, like limit-exceeded or
+// connection-unhandled, should be sent, and the number of events suppressed
+// since the last one. Sources will be reported at most every 10 seconds per
+// limit.
+func (g *governor) report(ip string, limit string) (bool, int) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	now := time.Now()
+
+	key := ip + "/" + limit
+
+	r, ok := g.reports[key]
+	if !ok {
+		r = &limitReport{}
+		g.reports[key] = r
+	} else if now.Sub(r.last) < 10*time.Second {
+		r.suppressed++
+		return false, 0
+	}
+
+	suppressed := r.suppressed
+
+	r.last = now
+	r.suppressed = 0
+
+	// forget sources not seen for a while
+	for k, r := range g.reports {
+		if now.Sub(r.last) > time.Minute {
+			delete(g.reports, k)
+		}
+	}
+
+	return true, suppressed
+}
+
+// EventLimitExceeded returns an event for a connection exceeding a limit.
+func EventLimitExceeded(conn net.Conn, service string, limit string, action string, suppressed int) event.Event {
+	return event.New(
+		event.Sensor("honeytrap"),
+		event.Category("governor"),
+		event.Type("limit-exceeded"),
+		event.SourceAddr(conn.RemoteAddr()),
+		event.DestinationAddr(conn.LocalAddr()),
+		event.Service(service),
+		event.Custom("limit", limit),
+		event.Custom("action", action),
+		event.Custom("suppressed", suppressed),
+	)
+}
+
+// tarpit reserves a tarpit, it returns false when max-tarpits connections
+// are tarpitted already.
+func (g *governor) tarpit() (func(), bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.tarpits >= g.MaxTarpits {
+		return nil, false
+	}
+
+	g.tarpits++
+
+	return func() {
+		g.m.Lock()
+		defer g.m.Unlock()
+
+		g.tarpits--
+	}, true
+}
+
+// limitExceeded reports the limit, and degrades the connection using the
+// configured action. Tarpits exceeding max-tarpits are reset instead, a
+// flood can't exhaust the sensor through its tarpits.
+func (hc *Honeytrap) limitExceeded(ctx context.Context, conn net.Conn, service string, limit string) {
+	g := hc.governor
+	lc := g.limits()
+
+	action := lc.Action
+
+	// udp datagrams are just dropped
+	_, udp := conn.LocalAddr().(*net.UDPAddr)
+
+	var release func()
+	if action == "tarpit" && !udp {
+		var ok bool
+		if release, ok = g.tarpit(); !ok {
+			action = "reset"
+		}
+	}
+
+	if ok, suppressed := g.report(remoteIP(conn.RemoteAddr()), limit); ok {
+		hc.bus.Send(EventLimitExceeded(conn, service, limit, action, suppressed))
+	}
+
+	if udp {
+		return
+	}
+
+	switch action {
+	case "reset":
+		// closing with linger 0 will send a RST
+		if tc, ok := conn.(*net.TCPConn); ok {
+			tc.SetLinger(0)
+		}
+	case "tarpit":
+		// keep the connection open, without reading from it
+		select {
+		case <-ctx.Done():
+		case <-time.After(lc.TarpitDuration.Duration()):
+		}
+
+		release()
+	}
+
+	conn.Close()
+}
+
+// limitedConn closes the connection after reading more than max bytes.
+type limitedConn struct {
+	net.Conn
+
+	max  int64
+	read int64
+
+	exceeded func()
+	once     sync.Once
+}
+
+func (lc *limitedConn) Read(b []byte) (int, error) {
+	if atomic.LoadInt64(&lc.read) >= lc.max {
+		lc.once.Do(lc.exceeded)
+		return 0, errLimitExceeded
+	}
+
+	if remaining := lc.max - atomic.LoadInt64(&lc.read); int64(len(b)) > remaining {
+		b = b[:remaining]
+	}
+
+	n, err := lc.Conn.Read(b)
+	atomic.AddInt64(&lc.read, int64(n))
+	return n, err
+}
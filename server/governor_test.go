@@ -0,0 +1,227 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers/eventbus"
+)
+
+func TestGovernorLimits(t *testing.T) {
+	g := newGovernor()
+	g.MaxConnectionsPerSource = 2
+	g.Rate = 1
+	g.Burst = 3
+
+	sm := &ServiceMap{Name: "ssh", MaxConnections: 3}
+
+	for i := 0; i < 3; i++ {
+		if !g.allow("10.0.0.1") {
+			t.Fatalf("Expected connection %d to be allowed", i)
+		}
+	}
+
+	if g.allow("10.0.0.1") {
+		t.Fatal("Expected connection rate to be exceeded")
+	}
+
+	release, _ := g.acquire("10.0.0.1")
+	g.acquire("10.0.0.1")
+
+	if _, limit := g.acquire("10.0.0.1"); limit != "max-connections-per-source" {
+		t.Fatalf("Expected max-connections-per-source, got %q", limit)
+	}
+
+	release()
+
+	if _, limit := g.acquire("10.0.0.1"); limit != "" {
+		t.Fatalf("Expected connection to be accepted after release, got %q", limit)
+	}
+
+	releaseService, _ := g.acquireService(sm)
+
+	for i := 0; i < 2; i++ {
+		g.acquireService(sm)
+	}
+
+	if _, limit := g.acquireService(sm); limit != "max-connections-per-service" {
+		t.Fatalf("Expected max-connections-per-service, got %q", limit)
+	}
+
+	releaseService()
+
+	if _, limit := g.acquireService(sm); limit != "" {
+		t.Fatalf("Expected service connection to be accepted after release, got %q", limit)
+	}
+}
+
+type events chan event.Event
+
+func (c events) Send(e event.Event) {
+	c <- e
+}
+
+func TestGovernorMaxTarpits(t *testing.T) {
+	c := make(events, 10)
+
+	hc := &Honeytrap{
+		bus:      eventbus.New(),
+		governor: newGovernor(),
+	}
+
+	hc.bus.Subscribe(c)
+
+	hc.governor.Action = "tarpit"
+	hc.governor.TarpitDuration = config.Delay(time.Minute)
+	hc.governor.MaxTarpits = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	limitExceeded := func(limit string) chan struct{} {
+		conn, client := net.Pipe()
+		defer client.Close()
+
+		done := make(chan struct{})
+
+		go func() {
+			hc.limitExceeded(ctx, conn, "ssh", limit)
+			close(done)
+		}()
+
+		return done
+	}
+
+	next := func() event.Event {
+		select {
+		case e := <-c:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("Expected limit-exceeded event")
+			return event.Event{}
+		}
+	}
+
+	tarpitted := limitExceeded("rate")
+
+	if e := next(); e.Get("action") != "tarpit" {
+		t.Fatalf("Expected connection to be tarpitted, got %v", event.ToMap(e))
+	}
+
+	// the second connection exceeds max-tarpits
+	done := limitExceeded("max-connections-per-source")
+
+	if e := next(); e.Get("action") != "reset" {
+		t.Fatalf("Expected connection above max-tarpits to be reset, got %v", event.ToMap(e))
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected connection above max-tarpits to be closed")
+	}
+
+	select {
+	case <-tarpitted:
+		t.Fatal("Expected first connection to be tarpitted still")
+	default:
+	}
+
+	cancel()
+	<-tarpitted
+
+	if _, ok := hc.governor.tarpit(); !ok {
+		t.Error("Expected tarpit to be released")
+	}
+}
+
+func TestGovernorLimitsBeforePeek(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	port := l.Addr().(*net.TCPAddr).Port
+
+	c := make(events, 10)
+
+	// the port has multiple services, connections are peeked at
+	hc := &Honeytrap{
+		bus:      eventbus.New(),
+		governor: newGovernor(),
+		sessions: newSessions(),
+		state: &state{matchers: []ServiceMap{
+			{Name: "a", Matcher: portMatcher(port), Service: &plainService{}},
+			{Name: "b", Matcher: portMatcher(port), Service: &plainService{}},
+		}},
+	}
+
+	hc.bus.Subscribe(c)
+
+	hc.governor.MaxConnectionsPerSource = 1
+
+	client, _ := serve(t, hc, l)
+	defer client.Close()
+
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+
+	second, done := serve(t, hc, l)
+	defer second.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected second connection to be closed")
+	}
+
+	if time.Since(start) >= peekTimeout {
+		t.Errorf("Expected connection to be limited before the peek, took %s", time.Since(start))
+	}
+
+	select {
+	case e := <-c:
+		if e.Get("limit") != "max-connections-per-source" {
+			t.Errorf("Expected max-connections-per-source, got %v", event.ToMap(e))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected limit-exceeded event")
+	}
+}
@@ -33,15 +33,20 @@ package server
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/fatih/color"
 
+	"github.com/honeytrap/honeytrap/artifacts"
 	"github.com/honeytrap/honeytrap/cmd"
 	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/credentials"
+	"github.com/honeytrap/honeytrap/profiles"
+	"github.com/honeytrap/honeytrap/storage"
 
 	"github.com/honeytrap/honeytrap/director"
 	_ "github.com/honeytrap/honeytrap/director/forward"
@@ -51,6 +56,7 @@ import (
 	"github.com/honeytrap/honeytrap/pushers/eventbus"
 
 	"github.com/honeytrap/honeytrap/services"
+	_ "github.com/honeytrap/honeytrap/services/adb"
 	_ "github.com/honeytrap/honeytrap/services/ssh"
 	_ "github.com/honeytrap/honeytrap/services/vnc"
 
@@ -77,6 +83,12 @@ import (
 	_ "github.com/honeytrap/honeytrap/pushers/slack"         // Registers slack backend.
 	_ "github.com/honeytrap/honeytrap/pushers/splunk"        // Registers splunk backend.
 
+	_ "github.com/honeytrap/honeytrap/enrichers/fetcher" // Registers fetcher enricher.
+	_ "github.com/honeytrap/honeytrap/enrichers/geoip"   // Registers geoip enricher.
+	_ "github.com/honeytrap/honeytrap/enrichers/ioc"     // Registers ioc enricher.
+	_ "github.com/honeytrap/honeytrap/enrichers/iplist"  // Registers scanner and tor enrichers.
+	_ "github.com/honeytrap/honeytrap/enrichers/rdns"    // Registers rdns enricher.
+
 	logging "github.com/op/go-logging"
 )
 
@@ -96,7 +108,40 @@ type Honeytrap struct {
 
 	token string
 
-	matchers []ServiceMap
+	configFile string
+
+	// state contains the channels, directors and services of the current
+	// configuration, it is replaced on reload
+	state *state
+	m     sync.RWMutex
+
+	reloading sync.Mutex
+
+	channels *channelGroup
+
+	listener  listener.Listener
+	addresses map[string]net.Addr
+
+	sessions *sessions
+
+	// cancelSessions cancels the active sessions on shutdown
+	cancelSessions context.CancelFunc
+
+	governor *governor
+
+	// artifacts stores the payloads, it is nil when the store isn't
+	// enabled
+	artifacts *artifacts.Store
+
+	// profiles aggregates the events per attacker, it is nil when the
+	// profiles aren't enabled
+	profiles *profiles.Store
+
+	// credentials tracks the credentials of logins, it is nil when the
+	// tracking isn't enabled
+	credentials *credentials.Store
+
+	logs *logBackend
 }
 
 // New returns a new instance of a Honeytrap struct.
@@ -108,10 +153,15 @@ func New(options ...OptionFn) (*Honeytrap, error) {
 	conf := &config.Default
 
 	h := &Honeytrap{
-		config:   conf,
-		director: director.MustDummy(),
-		bus:      bus,
-		profiler: profiler.Dummy(),
+		config:    conf,
+		director:  director.MustDummy(),
+		bus:       bus,
+		profiler:  profiler.Dummy(),
+		sessions:  newSessions(),
+		governor:  newGovernor(),
+		logs:      newLogBackend(),
+		channels:  &channelGroup{},
+		addresses: map[string]net.Addr{},
 	}
 
 	for _, fn := range options {
@@ -148,6 +198,13 @@ type ServiceMap struct {
 
 	Name string
 	Type string
+
+	Priority int
+
+	IdleTimeout time.Duration
+	MaxSession  time.Duration
+
+	MaxConnections int
 }
 
 func (hc *Honeytrap) heartbeat() {
@@ -170,117 +227,118 @@ func (hc *Honeytrap) heartbeat() {
 	}
 }
 
-// Run will start honeytrap
-func (hc *Honeytrap) Run(ctx context.Context) {
-	fmt.Println(color.YellowString("Honeytrap%c  starting (%s)...", 127855, hc.token))
-	fmt.Println(color.YellowString("Version: %s (%s)", cmd.Version, cmd.ShortCommitID))
+// openArtifacts opens the artifact store when it has been enabled.
+func (hc *Honeytrap) openArtifacts() {
+	ac := artifacts.DefaultConfig
+	if err := toml.PrimitiveDecode(hc.config.Artifacts, &ac); err != nil {
+		log.Errorf("Error parsing configuration of artifacts: %s", err.Error())
+		return
+	}
 
-	go hc.heartbeat()
+	if !ac.Enabled {
+		return
+	}
 
-	hc.profiler.Start()
+	store, err := artifacts.Open(ac)
+	if err != nil {
+		log.Errorf("Error opening artifact store: %s", err.Error())
+		return
+	}
 
-	w := web.New(
-		web.WithEventBus(hc.bus),
-	)
+	hc.artifacts = store
+}
 
-	go w.ListenAndServe()
+// openProfiles opens the profile store when it has been enabled, the
+// profiles are persisted in the storage.
+func (hc *Honeytrap) openProfiles() {
+	pc := profiles.DefaultConfig
+	if err := toml.PrimitiveDecode(hc.config.Profiles, &pc); err != nil {
+		log.Errorf("Error parsing configuration of profiles: %s", err.Error())
+		return
+	}
 
-	channels := map[string]pushers.Channel{}
-	// sane defaults!
+	if !pc.Enabled {
+		return
+	}
 
-	for key, s := range hc.config.Channels {
-		x := struct {
-			Type string `toml:"type"`
-		}{}
+	backend, err := storage.Namespace("profiles")
+	if err != nil {
+		log.Errorf("Error opening profile storage: %s", err.Error())
+		return
+	}
 
-		err := toml.PrimitiveDecode(s, &x)
-		if err != nil {
-			log.Error("Error parsing configuration of channel: %s", err.Error())
-			continue
-		}
+	store, err := profiles.Open(pc, backend, pushers.MergeChannel(hc.bus, map[string]interface{}{
+		"component": "profiles",
+	}))
+	if err != nil {
+		log.Errorf("Error opening profiles: %s", err.Error())
+		return
+	}
 
-		if x.Type == "" {
-			log.Error("Error parsing configuration of channel %s: type not set", key)
-			continue
-		}
+	hc.profiles = store
+}
 
-		if channelFunc, ok := pushers.Get(x.Type); !ok {
-			log.Error("Channel %s not supported on platform (%s)", x.Type, key)
-		} else if d, err := channelFunc(
-			pushers.WithConfig(s),
-		); err != nil {
-			log.Fatalf("Error initializing channel %s(%s): %s", key, x.Type, err)
-		} else {
-			channels[key] = d
-		}
+// openCredentials opens the credential tracker when it has been enabled,
+// the credentials are persisted in the storage.
+func (hc *Honeytrap) openCredentials() {
+	cc := credentials.DefaultConfig
+	if err := toml.PrimitiveDecode(hc.config.Credentials, &cc); err != nil {
+		log.Errorf("Error parsing configuration of credentials: %s", err.Error())
+		return
 	}
 
-	for _, s := range hc.config.Filters {
-		x := struct {
-			Channels   []string `toml:"channel"`
-			Services   []string `toml:"services"`
-			Categories []string `toml:"categories"`
-		}{}
-
-		err := toml.PrimitiveDecode(s, &x)
-		if err != nil {
-			log.Error("Error parsing configuration of filter: %s", err.Error())
-			continue
-		}
+	if !cc.Enabled {
+		return
+	}
 
-		for _, name := range x.Channels {
-			channel, ok := channels[name]
-			if !ok {
-				log.Error("Could not find channel %s for filter", name)
-				continue
-			}
+	backend, err := storage.Namespace("credentials")
+	if err != nil {
+		log.Errorf("Error opening credential storage: %s", err.Error())
+		return
+	}
 
-			channel = pushers.TokenChannel(channel, hc.token)
+	store, err := credentials.Open(cc, backend, pushers.MergeChannel(hc.bus, map[string]interface{}{
+		"component": "credentials",
+	}))
+	if err != nil {
+		log.Errorf("Error opening credentials: %s", err.Error())
+		return
+	}
 
-			if len(x.Categories) != 0 {
-				channel = pushers.FilterChannel(channel, pushers.RegexFilterFunc("category", x.Categories))
-			}
+	hc.credentials = store
+}
 
-			if len(x.Services) != 0 {
-				channel = pushers.FilterChannel(channel, pushers.RegexFilterFunc("service", x.Services))
-			}
+// Run will start honeytrap
+func (hc *Honeytrap) Run(ctx context.Context) {
+	fmt.Println(color.YellowString("Honeytrap%c  starting (%s)...", 127855, hc.token))
+	fmt.Println(color.YellowString("Version: %s (%s)", cmd.Version, cmd.ShortCommitID))
 
-			if err := hc.bus.Subscribe(channel); err != nil {
-				log.Error("Could not add channel %s to bus: %s", name, err.Error())
-			}
-		}
-	}
+	go hc.heartbeat()
 
-	// initialize directors
-	directors := map[string]director.Director{}
+	hc.profiler.Start()
 
-	for key, s := range hc.config.Directors {
-		x := struct {
-			Type string `toml:"type"`
-		}{}
+	hc.openArtifacts()
+	hc.openProfiles()
+	hc.openCredentials()
 
-		err := toml.PrimitiveDecode(s, &x)
-		if err != nil {
-			log.Error("Error parsing configuration of director: %s", err.Error())
-			continue
-		}
+	wc := web.DefaultConfig
+	if err := toml.PrimitiveDecode(hc.config.Web, &wc); err != nil {
+		log.Errorf("Error parsing configuration of web: %s", err.Error())
+		return
+	}
 
-		if x.Type == "" {
-			log.Error("Error parsing configuration of service %s: type not set", key)
-			continue
-		}
+	w := web.New(
+		web.WithConfig(wc),
+		web.WithEventBus(hc.bus),
+		web.WithReloader(hc.Reload),
+		web.WithQueueStats(hc.queueStats),
+		web.WithEnricherStats(hc.enricherStats),
+		web.WithArtifacts(hc.artifacts),
+		web.WithProfiles(hc.profiles),
+		web.WithCredentials(hc.credentials),
+	)
 
-		if directorFunc, ok := director.Get(x.Type); !ok {
-			log.Error("Director %s not supported on platform (%s)", x.Type, key)
-		} else if d, err := directorFunc(
-			director.WithChannel(hc.bus),
-			director.WithConfig(s),
-		); err != nil {
-			log.Fatalf("Error initializing director %s(%s): %s", key, x.Type, err)
-		} else {
-			directors[key] = d
-		}
-	}
+	go w.ListenAndServe()
 
 	// initialize listener
 	x := struct {
@@ -304,106 +362,39 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 	}
 
 	l, err := listenerFunc(
-		listener.WithChannel(hc.bus),
+		listener.WithChannel(pushers.MergeChannel(hc.bus, map[string]interface{}{
+			"component": "listener." + x.Type,
+		})),
 		listener.WithConfig(hc.config.Listener),
 	)
 	if err != nil {
 		log.Fatalf("Error initializing listener %s: %s", x.Type, err)
 	}
 
-	// same for proxies
-	for key, s := range hc.config.Services {
-		x := struct {
-			Type     string `toml:"type"`
-			Director string `toml:"director"`
-			Port     string `toml:"port"`
-		}{}
-
-		err := toml.PrimitiveDecode(s, &x)
-		if err != nil {
-			log.Error("Error parsing configuration of service %s(%s): %s", x.Type, key, err.Error())
-			continue
-		}
-
-		if x.Type == "" {
-			log.Error("Error parsing configuration of service %s: type not set", key)
-			continue
-		}
-
-		// individual configuration per service
-		options := []services.ServicerFunc{
-			services.WithChannel(hc.bus),
-			services.WithConfig(s),
-		}
-
-		fn, ok := services.Get(x.Type)
-		if !ok {
-			log.Error(color.RedString("Could not find type %s for service %s", x.Type, key))
-			continue
-		}
-
-		if x.Director == "" {
-		} else if d, ok := directors[x.Director]; ok {
-			options = append(options, services.WithDirector(d))
-		} else {
-			log.Error(color.RedString("Could not find director=%s for service=%s", x.Director, key))
-			continue
-		}
-
-		service := fn(options...)
-
-		parts := strings.Split(x.Port, "/")
-		if len(parts) == 2 {
-			log.Infof("Mapping port %s(%s) to service %s (%s)", parts[1], strings.ToLower(parts[0]), x.Type, key)
-
-			// add address to listener and create mapping between
-			// port and service
-			if strings.ToLower(parts[0]) == "tcp" {
-				addr, _ := net.ResolveTCPAddr("tcp", ":"+parts[1])
-				if a, ok := l.(listener.AddAddresser); ok {
-					a.AddAddress(addr)
-				}
+	hc.listener = l
 
-				fn := func(port int) func(net.Addr) bool {
-					return func(a net.Addr) bool {
-						if ta, ok := a.(*net.TCPAddr); ok {
-							return ta.Port == port
-						}
+	if err := toml.PrimitiveDecode(hc.config.Limits, &hc.governor.limitsConfig); err != nil {
+		log.Errorf("Error parsing configuration of limits: %s", err.Error())
+	}
 
-						return false
-					}
-				}
+	st, errs := hc.build(hc.config, nil)
+	for _, err := range errs {
+		log.Error(color.RedString(err.Error()))
+	}
 
-				hc.matchers = append(hc.matchers, ServiceMap{
-					Name:    key,
-					Type:    x.Type,
-					Matcher: fn(addr.Port),
-					Service: service,
-				})
-			} else if strings.ToLower(parts[0]) == "udp" {
-				addr, _ := net.ResolveUDPAddr("udp", ":"+parts[1])
-				if a, ok := l.(listener.AddAddresser); ok {
-					a.AddAddress(addr)
-				}
+	hc.setState(st)
+	hc.setLogging(hc.config)
+	hc.listen(st)
 
-				fn := func(port int) func(net.Addr) bool {
-					return func(a net.Addr) bool {
-						if ta, ok := a.(*net.UDPAddr); ok {
-							return ta.Port == port
-						}
+	go hc.logs.run(hc.channels)
 
-						return false
-					}
-				}
+	qc, err := eventQueueConfig(hc.config.Queue)
+	if err != nil {
+		log.Errorf("Error parsing configuration of queue: %s", err.Error())
+	}
 
-				hc.matchers = append(hc.matchers, ServiceMap{
-					Name:    key,
-					Type:    x.Type,
-					Matcher: fn(addr.Port),
-					Service: service,
-				})
-			}
-		}
+	if err := hc.bus.Subscribe(hc.channels, eventbus.WithName("channels"), eventbus.WithQueueConfig(qc)); err != nil {
+		log.Errorf("Could not add channels to bus: %s", err.Error())
 	}
 
 	if err := l.Start(); err != nil {
@@ -416,44 +407,232 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 		for {
 			conn, err := l.Accept()
 			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
 				panic(err)
 			}
 
-			incoming <- conn
+			select {
+			case incoming <- conn:
+			case <-ctx.Done():
+				conn.Close()
+				return
+			}
 		}
 	}()
 
+	// sessions will be cancelled after the grace period by Stop
+	sessionCtx, cancelSessions := context.WithCancel(context.Background())
+	hc.cancelSessions = cancelSessions
+
 	for {
 		select {
 		case <-ctx.Done():
+			// stop accepting new connections
+			if c, ok := l.(io.Closer); ok {
+				c.Close()
+			}
+
 			return
 		case conn := <-incoming:
-			go hc.handle(conn)
+			go hc.handle(sessionCtx, conn)
+		}
+	}
+}
+
+// shutdown gives active sessions the grace period to finish, before
+// cancelling them, flushing the channels and stopping the components.
+func (hc *Honeytrap) shutdown() {
+	st := hc.currentState()
+
+	gracePeriod := 10 * time.Second
+	if st != nil && st.config.GracePeriod.Duration() > 0 {
+		gracePeriod = st.config.GracePeriod.Duration()
+	}
+
+	// connections which are still being routed won't start a session
+	hc.sessions.Close()
+
+	if count := hc.sessions.Count(); count > 0 {
+		log.Infof("Waiting %s for %d active sessions to finish", gracePeriod, count)
+	}
+
+	if !hc.sessions.Wait(gracePeriod) {
+		log.Infof("Cancelling %d active sessions", hc.sessions.Count())
+	}
+
+	if hc.cancelSessions != nil {
+		hc.cancelSessions()
+	}
+
+	hc.sessions.Wait(time.Second)
+
+	if !pushers.Flush(hc.bus, gracePeriod) {
+		log.Warningf("Not all events have been delivered within %s", gracePeriod)
+	}
+
+	// stop the services, channels, directors and enrichers
+	if st != nil {
+		hc.release(st, &state{})
+	}
+
+	if hc.artifacts != nil {
+		hc.artifacts.Close()
+	}
+
+	if hc.profiles != nil {
+		if err := hc.profiles.Close(); err != nil {
+			log.Errorf("Error writing profiles: %s", err.Error())
+		}
+	}
+
+	if hc.credentials != nil {
+		if err := hc.credentials.Close(); err != nil {
+			log.Errorf("Error writing credentials: %s", err.Error())
 		}
 	}
 }
 
-func (hc *Honeytrap) handle(conn net.Conn) {
+func (hc *Honeytrap) handle(ctx context.Context, conn net.Conn) {
 	defer conn.Close()
 
-	for _, sm := range hc.matchers {
-		if !sm.Matcher(conn.LocalAddr()) {
-			continue
+	ip := remoteIP(conn.RemoteAddr())
+
+	if !hc.governor.allow(ip) {
+		hc.limitExceeded(ctx, conn, "", "rate")
+		return
+	}
+
+	raw := conn
+
+	// the connection counts against the limits while it is peeked at
+	release, limit := hc.governor.acquire(ip)
+	if limit != "" {
+		hc.limitExceeded(ctx, raw, "", limit)
+		return
+	}
+
+	defer release()
+
+	st := hc.currentState()
+
+	conn, sm, payload := hc.route(st, conn)
+	if sm == nil {
+		// udp floods to unmapped ports would report every datagram
+		if ok, suppressed := hc.governor.report(ip, "connection-unhandled"); ok {
+			hc.bus.Send(EventConnectionUnhandled(conn, payload, st.defaultService, suppressed))
 		}
 
-		log.Debug("Handling connection for %s => %s %s(%s)", conn.RemoteAddr(), conn.LocalAddr(), sm.Name, sm.Type)
+		if st.defaultService == nil {
+			return
+		}
 
-		func(service services.Servicer) {
-			err := service.Handle(conn)
-			if err != nil {
-				fmt.Println(color.RedString(err.Error()))
-			}
-		}(sm.Service)
+		sm = st.defaultService
+	}
+
+	releaseService, limit := hc.governor.acquireService(sm)
+	if limit != "" {
+		hc.limitExceeded(ctx, raw, sm.Name, limit)
+		return
+	}
+
+	defer releaseService()
+
+	log.Debug("Handling connection for %s => %s %s(%s)", conn.RemoteAddr(), conn.LocalAddr(), sm.Name, sm.Type)
+
+	limits := hc.governor.limits()
+
+	maxSession := sm.MaxSession
+	if maxSession == 0 {
+		maxSession = limits.MaxDuration.Duration()
+	}
+
+	var cancel context.CancelFunc
+	if maxSession > 0 {
+		ctx, cancel = context.WithTimeout(ctx, maxSession)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	defer cancel()
+
+	// every connection gets its own session, the events of the connection
+	// carry the id of the session
+	id := event.NewSession(sm.Name)
+	ctx = event.NewSessionContext(ctx, id)
+
+	// udp datagrams are handled at once, and services depend on the type
+	if _, ok := conn.(*listener.DummyUDPConn); ok {
+		s := &session{
+			Conn:    conn,
+			id:      id,
+			cancel:  cancel,
+			service: sm.Service,
+		}
+
+		if !hc.sessions.add(s) {
+			return
+		}
+
+		defer hc.sessions.remove(s)
+
+		if err := services.Handle(ctx, sm.Service, conn); err != nil {
+			fmt.Println(color.RedString(err.Error()))
+		}
+
+		return
+	}
+
+	if max := limits.MaxBytes; max > 0 {
+		conn = &limitedConn{
+			Conn: conn,
+			max:  max,
+			exceeded: func() {
+				if ok, suppressed := hc.governor.report(ip, "max-bytes"); ok {
+					hc.bus.Send(EventLimitExceeded(raw, sm.Name, "max-bytes", "close", suppressed))
+				}
+
+				cancel()
+			},
+		}
+	}
+
+	s := &session{
+		Conn:    conn,
+		id:      id,
+		cancel:  cancel,
+		service: sm.Service,
+	}
+
+	s.touch()
+
+	if !hc.sessions.add(s) {
+		return
+	}
+
+	defer hc.sessions.remove(s)
+
+	hc.bus.Send(EventSessionStarted(s))
+	defer func() {
+		hc.bus.Send(EventSessionEnded(s))
+	}()
+
+	if sm.IdleTimeout > 0 {
+		go s.watchIdle(ctx, sm.IdleTimeout)
+	}
+
+	if err := services.Handle(ctx, sm.Service, s); err != nil {
+		fmt.Println(color.RedString(err.Error()))
 	}
 }
 
-// Stop will stop Honeytrap
+// Stop will stop Honeytrap, after the active sessions finished and the
+// queued events have been delivered.
 func (hc *Honeytrap) Stop() {
+	hc.shutdown()
+
 	hc.profiler.Stop()
 
 	fmt.Println(color.YellowString("Honeytrap stopped."))
@@ -0,0 +1,108 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+)
+
+// EventLogging returns an event for a record of the framework logging.
+func EventLogging(module string, level string, message string) event.Event {
+	return event.New(
+		event.Sensor("honeytrap"),
+		event.Category("logging"),
+		event.Severity(level),
+		event.Custom("component", module),
+		event.Message("%s", message),
+	)
+}
+
+func isLogging(e event.Event) bool {
+	return e.Get("sensor") == "honeytrap" && e.Get("category") == "logging"
+}
+
+// logBackend delivers the framework logging to the channels, when a filter
+// with type logging has been configured. Records are dropped when the
+// channels can't keep up, logging of the channels themselves would block
+// otherwise.
+type logBackend struct {
+	enabled int32
+
+	events chan event.Event
+}
+
+func newLogBackend() *logBackend {
+	return &logBackend{
+		events: make(chan event.Event, 1000),
+	}
+}
+
+func (b *logBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+	if atomic.LoadInt32(&b.enabled) == 0 {
+		return nil
+	}
+
+	select {
+	case b.events <- EventLogging(rec.Module, strings.ToLower(level.String()), rec.Message()):
+	default:
+	}
+
+	return nil
+}
+
+func (b *logBackend) enable(v bool) {
+	if v {
+		atomic.StoreInt32(&b.enabled, 1)
+	} else {
+		atomic.StoreInt32(&b.enabled, 0)
+	}
+}
+
+// run delivers the logging events to the channel.
+func (b *logBackend) run(c pushers.Channel) {
+	for e := range b.events {
+		c.Send(e)
+	}
+}
+
+// setLogging sets the configured logging backends, together with the
+// backend delivering to the channels.
+func (hc *Honeytrap) setLogging(conf *config.Config) {
+	backends := append(conf.LoggingBackends(), hc.logs)
+	logging.SetBackend(backends...)
+}
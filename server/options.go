@@ -68,6 +68,7 @@ func WithConfig(s string) (OptionFn, error) {
 	}
 
 	return func(b *Honeytrap) error {
+		b.configFile = s
 		return b.config.Load(bytes.NewBuffer(data))
 	}, nil
 }
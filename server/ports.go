@@ -0,0 +1,182 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// PortRange contains a range of ports of a single protocol, as configured
+// with <PROTO/#> or <PROTO/#-#>.
+type PortRange struct {
+	Proto string
+
+	Start int
+	End   int
+}
+
+func (pr PortRange) String() string {
+	if pr.Start == pr.End {
+		return fmt.Sprintf("%s/%d", pr.Proto, pr.Start)
+	}
+
+	return fmt.Sprintf("%s/%d-%d", pr.Proto, pr.Start, pr.End)
+}
+
+// Addrs returns the addresses to listen on for the range.
+func (pr PortRange) Addrs() []net.Addr {
+	addrs := []net.Addr{}
+
+	for port := pr.Start; port <= pr.End; port++ {
+		if pr.Proto == "tcp" {
+			addrs = append(addrs, &net.TCPAddr{Port: port})
+		} else {
+			addrs = append(addrs, &net.UDPAddr{Port: port})
+		}
+	}
+
+	return addrs
+}
+
+// Match returns true if the address is in the range.
+func (pr PortRange) Match(a net.Addr) bool {
+	port := 0
+
+	switch v := a.(type) {
+	case *net.TCPAddr:
+		if pr.Proto != "tcp" {
+			return false
+		}
+
+		port = v.Port
+	case *net.UDPAddr:
+		if pr.Proto != "udp" {
+			return false
+		}
+
+		port = v.Port
+	default:
+		return false
+	}
+
+	return port >= pr.Start && port <= pr.End
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("port %d out of range", port)
+	}
+
+	return port, nil
+}
+
+// ParsePortRange parses a single <PROTO/#> or <PROTO/#-#> value.
+func ParsePortRange(s string) (PortRange, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) != 2 {
+		return PortRange{}, fmt.Errorf("invalid port %q, expected <PROTO/#> or <PROTO/#-#>", s)
+	}
+
+	pr := PortRange{
+		Proto: strings.ToLower(parts[0]),
+	}
+
+	if pr.Proto != "tcp" && pr.Proto != "udp" {
+		return PortRange{}, fmt.Errorf("invalid protocol %q in port %q, expected tcp or udp", parts[0], s)
+	}
+
+	var err error
+
+	bounds := strings.SplitN(parts[1], "-", 2)
+	if pr.Start, err = parsePort(bounds[0]); err != nil {
+		return PortRange{}, fmt.Errorf("%s in port %q", err.Error(), s)
+	}
+
+	pr.End = pr.Start
+
+	if len(bounds) == 1 {
+	} else if pr.End, err = parsePort(bounds[1]); err != nil {
+		return PortRange{}, fmt.Errorf("%s in port %q", err.Error(), s)
+	} else if pr.End < pr.Start {
+		return PortRange{}, fmt.Errorf("invalid range in port %q, end before start", s)
+	}
+
+	return pr, nil
+}
+
+// ParsePorts parses the port configuration of a service, which can be a
+// single value, or a list of values.
+func ParsePorts(v interface{}) ([]PortRange, error) {
+	values := []string{}
+
+	switch v := v.(type) {
+	case nil:
+		return nil, fmt.Errorf("port not set")
+	case string:
+		values = append(values, v)
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid port %v, expected string", item)
+			}
+
+			values = append(values, s)
+		}
+	default:
+		return nil, fmt.Errorf("invalid port %v, expected string or list of strings", v)
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("port not set")
+	}
+
+	ranges := []PortRange{}
+
+	for _, value := range values {
+		pr, err := ParsePortRange(value)
+		if err != nil {
+			return nil, err
+		}
+
+		ranges = append(ranges, pr)
+	}
+
+	return ranges, nil
+}
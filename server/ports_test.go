@@ -0,0 +1,65 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParsePorts(t *testing.T) {
+	ranges, err := ParsePorts([]interface{}{"TCP/80", "udp/9001-9003"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ranges) != 2 {
+		t.Fatalf("Expected 2 ranges, got %d", len(ranges))
+	}
+
+	if addrs := ranges[1].Addrs(); len(addrs) != 3 {
+		t.Fatalf("Expected 3 addresses, got %d", len(addrs))
+	}
+
+	if !ranges[1].Match(&net.UDPAddr{Port: 9002}) {
+		t.Errorf("Expected udp/9002 to match %s", ranges[1])
+	}
+
+	if ranges[1].Match(&net.TCPAddr{Port: 9002}) {
+		t.Errorf("Expected tcp/9002 not to match %s", ranges[1])
+	}
+
+	for _, v := range []interface{}{nil, "", "TCP", "SCTP/80", "TCP/0", "TCP/80-70", "UDP/abc", []interface{}{}, 80} {
+		if _, err := ParsePorts(v); err == nil {
+			t.Errorf("Expected error for port %#v", v)
+		}
+	}
+}
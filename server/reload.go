@@ -0,0 +1,303 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+func (hc *Honeytrap) currentState() *state {
+	hc.m.RLock()
+	defer hc.m.RUnlock()
+
+	return hc.state
+}
+
+func (hc *Honeytrap) setState(st *state) {
+	hc.m.Lock()
+	defer hc.m.Unlock()
+
+	hc.state = st
+	hc.channels.Set(st.pipeline, st.subscribers)
+	hc.logs.enable(st.logging)
+}
+
+// changes contains the names of added, removed and changed components.
+type changes struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+func (c changes) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+func diff(prev, st *state, kind string, keys func(*state) []string) changes {
+	c := changes{
+		Added:   []string{},
+		Removed: []string{},
+		Changed: []string{},
+	}
+
+	old := map[string]bool{}
+	for _, key := range keys(prev) {
+		old[key] = true
+	}
+
+	for _, key := range keys(st) {
+		if !old[key] {
+			c.Added = append(c.Added, key)
+		} else if !reflect.DeepEqual(prev.configs[kind+"."+key], st.configs[kind+"."+key]) {
+			c.Changed = append(c.Changed, key)
+		}
+
+		delete(old, key)
+	}
+
+	for key := range old {
+		c.Removed = append(c.Removed, key)
+	}
+
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	sort.Strings(c.Changed)
+	return c
+}
+
+// EventConfigReloaded returns an event summarizing the changes of the
+// reloaded configuration.
+func EventConfigReloaded(services, channels, directors changes, filters, enrichers bool) event.Event {
+	options := []event.Option{
+		event.Sensor("honeytrap"),
+		event.Category("config"),
+		event.Type("config-reloaded"),
+		event.Custom("filters.changed", filters),
+		event.Custom("enrichers.changed", enrichers),
+	}
+
+	for kind, c := range map[string]changes{
+		"services":  services,
+		"channels":  channels,
+		"directors": directors,
+	} {
+		options = append(options,
+			event.Custom(kind+".added", c.Added),
+			event.Custom(kind+".removed", c.Removed),
+			event.Custom(kind+".changed", c.Changed),
+		)
+	}
+
+	return event.New(options...)
+}
+
+// Reload reloads the configuration file. Services, channels and directors
+// with unchanged configuration are kept, new ones are started and removed
+// ones are stopped after their sessions finished. A configuration with
+// errors is rejected, and the current configuration keeps running.
+func (hc *Honeytrap) Reload() error {
+	if hc.configFile == "" {
+		return errors.New("No configuration file to reload")
+	}
+
+	hc.reloading.Lock()
+	defer hc.reloading.Unlock()
+
+	prev := hc.currentState()
+	if prev == nil {
+		return errors.New("Honeytrap not running")
+	}
+
+	data, err := ioutil.ReadFile(hc.configFile)
+	if err != nil {
+		return err
+	}
+
+	conf := &config.Config{}
+	if err := conf.Parse(bytes.NewBuffer(data)); err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(decodeConfig(prev.config.Listener), decodeConfig(conf.Listener)) {
+		log.Warning("Listener configuration changed, changes will be applied after restart")
+	}
+
+	if !reflect.DeepEqual(decodeConfig(prev.config.Web), decodeConfig(conf.Web)) {
+		log.Warning("Web configuration changed, changes will be applied after restart")
+	}
+
+	if !reflect.DeepEqual(decodeConfig(prev.config.Artifacts), decodeConfig(conf.Artifacts)) {
+		log.Warning("Artifacts configuration changed, changes will be applied after restart")
+	}
+
+	if !reflect.DeepEqual(decodeConfig(prev.config.Profiles), decodeConfig(conf.Profiles)) {
+		log.Warning("Profiles configuration changed, changes will be applied after restart")
+	}
+
+	if !reflect.DeepEqual(decodeConfig(prev.config.Credentials), decodeConfig(conf.Credentials)) {
+		log.Warning("Credentials configuration changed, changes will be applied after restart")
+	}
+
+	if !reflect.DeepEqual(decodeConfig(prev.config.Queue), decodeConfig(conf.Queue)) {
+		log.Warning("Queue configuration changed, changes will be applied after restart")
+	}
+
+	limits := newGovernor().limitsConfig
+	if err := toml.PrimitiveDecode(conf.Limits, &limits); err != nil {
+		return fmt.Errorf("Error parsing configuration of limits: %s", err.Error())
+	}
+
+	st, errs := hc.build(conf, prev)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Error(err.Error())
+		}
+
+		hc.release(st, prev)
+		return fmt.Errorf("Configuration rejected: %s", errs[0].Error())
+	}
+
+	// the logging outputs are opened once the configuration is accepted
+	if err := conf.OpenLogging(); err != nil {
+		hc.release(st, prev)
+		return fmt.Errorf("Configuration rejected: %s", err.Error())
+	}
+
+	hc.setState(st)
+	hc.setLogging(conf)
+	prev.config.CloseLogging()
+	hc.listen(st)
+	hc.governor.setLimits(limits)
+
+	serviceKeys := func(st *state) []string {
+		keys := []string{}
+		for key := range st.services {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+
+	channelKeys := func(st *state) []string {
+		keys := []string{}
+		for key := range st.channels {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+
+	directorKeys := func(st *state) []string {
+		keys := []string{}
+		for key := range st.directors {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+
+	sc := diff(prev, st, "service", serviceKeys)
+	cc := diff(prev, st, "channel", channelKeys)
+	dc := diff(prev, st, "director", directorKeys)
+
+	filters := !reflect.DeepEqual(prev.config.Filters, conf.Filters)
+
+	enrichers := len(prev.enrichers) != len(st.enrichers)
+	for key := range st.enrichers {
+		enrichers = enrichers || !st.reuse(prev, "enricher", key)
+	}
+
+	log.Infof("Configuration reloaded: services %+v, channels %+v, directors %+v", sc, cc, dc)
+
+	hc.bus.Send(EventConfigReloaded(sc, cc, dc, filters, enrichers))
+
+	// stop the components which have been replaced
+	go hc.release(prev, st)
+
+	return nil
+}
+
+// release stops the components of prev which aren't used by st, services
+// are stopped after their active sessions finished.
+func (hc *Honeytrap) release(prev, st *state) {
+	for key, sm := range prev.services {
+		if cur, ok := st.services[key]; ok && cur.Service == sm.Service {
+			continue
+		}
+
+		hc.sessions.WaitService(sm.Service)
+
+		if c, ok := sm.Service.(io.Closer); ok {
+			c.Close()
+		}
+	}
+
+	for key, c := range prev.channels {
+		if _, ok := st.channels[key]; ok && st.reuse(prev, "channel", key) {
+			continue
+		}
+
+		pushers.Flush(c, 10*time.Second)
+
+		if closer, ok := c.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+
+	for key, d := range prev.directors {
+		if _, ok := st.directors[key]; ok && st.reuse(prev, "director", key) {
+			continue
+		}
+
+		if closer, ok := d.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+
+	for key, e := range prev.enrichers {
+		if _, ok := st.enrichers[key]; ok && st.reuse(prev, "enricher", key) {
+			continue
+		}
+
+		if closer, ok := e.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
@@ -0,0 +1,206 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers/eventbus"
+
+	logging "github.com/op/go-logging"
+)
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "honeytrap-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config.toml")
+
+	conf := `
+[service.echo]
+type="echo"
+port="tcp/8007"
+
+[service.changed]
+type="echo"
+port="tcp/8008"
+
+[service.removed]
+type="echo"
+port="tcp/8009"
+`
+
+	hc := &Honeytrap{
+		bus:        eventbus.New(),
+		governor:   newGovernor(),
+		sessions:   newSessions(),
+		logs:       newLogBackend(),
+		channels:   &channelGroup{},
+		addresses:  map[string]net.Addr{},
+		configFile: filename,
+	}
+
+	c := make(events, 10)
+	hc.bus.Subscribe(c)
+
+	initial := &config.Config{}
+	if err := initial.Parse(bytes.NewBufferString(conf)); err != nil {
+		t.Fatal(err)
+	}
+
+	st, errs := hc.build(initial, nil)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	hc.setState(st)
+
+	reload := func(conf string) error {
+		if err := ioutil.WriteFile(filename, []byte(conf), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		return hc.Reload()
+	}
+
+	// a rejected configuration keeps the current one running, and doesn't
+	// open its logging outputs
+	rejected := filepath.Join(dir, "rejected.log")
+
+	if err := reload(`
+[service.echo]
+type="echo"
+port="tcp/8007"
+
+[service.unknown]
+type="does-not-exist"
+port="tcp/8010"
+
+[[logging]]
+output="` + rejected + `"
+level="debug"
+`); err == nil {
+		t.Fatal("Expected configuration to be rejected")
+	}
+
+	if hc.currentState() != st {
+		t.Error("Expected current configuration to be kept")
+	}
+
+	if _, err := os.Stat(rejected); !os.IsNotExist(err) {
+		t.Errorf("Expected logging output of rejected configuration not to be opened, got %v", err)
+	}
+
+	select {
+	case e := <-c:
+		t.Fatalf("Expected no event for a rejected configuration, got %v", event.ToMap(e))
+	default:
+	}
+
+	// an accepted configuration keeps the unchanged services
+	accepted := filepath.Join(dir, "accepted.log")
+
+	if err := reload(`
+[service.echo]
+type="echo"
+port="tcp/8007"
+
+[service.changed]
+type="echo"
+port="tcp/8018"
+
+[service.added]
+type="echo"
+port="tcp/8011"
+
+[[logging]]
+output="` + accepted + `"
+level="error"
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	defer hc.currentState().config.CloseLogging()
+	defer logging.SetBackend(logging.NewLogBackend(os.Stderr, "", 0))
+
+	cur := hc.currentState()
+	if cur == st {
+		t.Fatal("Expected configuration to be replaced")
+	}
+
+	if cur.services["echo"].Service != st.services["echo"].Service {
+		t.Error("Expected unchanged service to be kept")
+	}
+
+	if cur.services["changed"].Service == st.services["changed"].Service {
+		t.Error("Expected changed service to be replaced")
+	}
+
+	if _, err := os.Stat(accepted); err != nil {
+		t.Errorf("Expected logging output of accepted configuration to be opened: %s", err.Error())
+	}
+
+	var e event.Event
+
+	select {
+	case e = <-c:
+	case <-time.After(time.Second):
+		t.Fatal("Expected config-reloaded event")
+	}
+
+	if e.Get("type") != "config-reloaded" {
+		t.Fatalf("Expected config-reloaded event, got %v", event.ToMap(e))
+	}
+
+	for field, expected := range map[string][]string{
+		"services.added":   {"added"},
+		"services.removed": {"removed"},
+		"services.changed": {"changed"},
+		"channels.added":   {},
+	} {
+		if v, _ := e.Load(field); !reflect.DeepEqual(v, expected) {
+			t.Errorf("Expected %s to be %v, got %v", field, expected, v)
+		}
+	}
+}
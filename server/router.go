@@ -0,0 +1,170 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"bufio"
+	"net"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/listener"
+	"github.com/honeytrap/honeytrap/services"
+)
+
+// peekTimeout is the time we'll wait for the client to send data, clients
+// of server speaks first protocols won't send anything.
+const peekTimeout = 500 * time.Millisecond
+
+// peekConn allows reading the first bytes of a connection, without
+// consuming them.
+type peekConn struct {
+	net.Conn
+
+	r *bufio.Reader
+}
+
+func (pc *peekConn) Read(b []byte) (int, error) {
+	return pc.r.Read(b)
+}
+
+// Peek returns the data the client sent before the timeout.
+func (pc *peekConn) Peek(timeout time.Duration) []byte {
+	if err := pc.Conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil
+	}
+
+	defer pc.Conn.SetReadDeadline(time.Time{})
+
+	if _, err := pc.r.Peek(1); err != nil {
+		return nil
+	}
+
+	payload, _ := pc.r.Peek(pc.r.Buffered())
+	return payload
+}
+
+// route returns the service to handle the connection with, and the data
+// the client sent so far. Ports with a single service are routed at once,
+// clients of server speaks first protocols won't wait for the peek timeout.
+// Otherwise the first service of the port detecting its protocol in the
+// first bytes wins, or else the first service matching the port. Protocols
+// are detected over all services only for ports without services, services
+// won't take over the connections of other ports. Matchers are ordered by
+// priority.
+func (hc *Honeytrap) route(st *state, conn net.Conn) (net.Conn, *ServiceMap, []byte) {
+	matches := []ServiceMap{}
+
+	for _, sm := range st.matchers {
+		if sm.Matcher(conn.LocalAddr()) {
+			matches = append(matches, sm)
+		}
+	}
+
+	first := func() *ServiceMap {
+		if len(matches) == 0 {
+			return nil
+		}
+
+		return &matches[0]
+	}
+
+	// only stream connections can be peeked at
+	if _, ok := conn.LocalAddr().(*net.TCPAddr); !ok {
+		payload := []byte{}
+		if dc, ok := conn.(*listener.DummyUDPConn); ok {
+			payload = dc.Buffer
+		}
+
+		return conn, first(), payload
+	}
+
+	if len(matches) == 1 {
+		return conn, first(), nil
+	}
+
+	pc := &peekConn{
+		Conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+
+	payload := pc.Peek(peekTimeout)
+	if len(payload) == 0 {
+		return pc, first(), payload
+	}
+
+	detect := func(sms []ServiceMap) *ServiceMap {
+		for i, sm := range sms {
+			if ch, ok := sm.Service.(services.CanHandler); ok && ch.CanHandle(payload) {
+				return &sms[i]
+			}
+		}
+
+		return nil
+	}
+
+	if len(matches) > 0 {
+		if sm := detect(matches); sm != nil {
+			return pc, sm, payload
+		}
+
+		return pc, first(), payload
+	}
+
+	if sm := detect(st.matchers); sm != nil {
+		log.Debugf("Detected protocol of service %s(%s) for %s => %s", sm.Name, sm.Type, conn.RemoteAddr(), conn.LocalAddr())
+		return pc, sm, payload
+	}
+
+	return pc, nil, payload
+}
+
+// EventConnectionUnhandled returns an event for a connection no service
+// was configured for, with the number of events of the source suppressed
+// since the last one.
+func EventConnectionUnhandled(conn net.Conn, payload []byte, defaultService *ServiceMap, suppressed int) event.Event {
+	options := []event.Option{
+		event.Sensor("honeytrap"),
+		event.Category("router"),
+		event.Type("connection-unhandled"),
+		event.SourceAddr(conn.RemoteAddr()),
+		event.DestinationAddr(conn.LocalAddr()),
+		event.Custom("detected-protocol", services.Detect(payload)),
+		event.Payload(payload),
+		event.Custom("suppressed", suppressed),
+	}
+
+	if defaultService != nil {
+		options = append(options, event.Custom("default-service", defaultService.Name))
+	}
+
+	return event.New(options...)
+}
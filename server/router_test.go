@@ -0,0 +1,279 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/pushers/eventbus"
+)
+
+// detectService detects its protocol by the prefix of the payload.
+type detectService struct {
+	prefix string
+}
+
+func (s *detectService) Handle(conn net.Conn) error {
+	return nil
+}
+
+func (s *detectService) SetChannel(c pushers.Channel) {
+}
+
+func (s *detectService) CanHandle(payload []byte) bool {
+	return bytes.HasPrefix(payload, []byte(s.prefix))
+}
+
+// plainService doesn't detect its protocol.
+type plainService struct {
+}
+
+func (s *plainService) Handle(conn net.Conn) error {
+	return nil
+}
+
+func (s *plainService) SetChannel(c pushers.Channel) {
+}
+
+func portMatcher(port int) func(net.Addr) bool {
+	return func(addr net.Addr) bool {
+		ta, ok := addr.(*net.TCPAddr)
+		return ok && ta.Port == port
+	}
+}
+
+// dial returns the server side of a tcp connection, after the client sent
+// data.
+func dial(t *testing.T, l net.Listener, data string) net.Conn {
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data != "" {
+		client.Write([]byte(data))
+	}
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+func TestRoute(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	port := l.Addr().(*net.TCPAddr).Port
+
+	imap := ServiceMap{Name: "imaps", Matcher: portMatcher(port), Service: &plainService{}}
+	https := ServiceMap{Name: "https", Matcher: portMatcher(port + 1), Service: &detectService{"\x16\x03"}}
+	ssh := ServiceMap{Name: "ssh", Matcher: portMatcher(port), Service: &detectService{"SSH-"}}
+	http := ServiceMap{Name: "http", Matcher: portMatcher(port), Service: &detectService{"GET "}}
+
+	hc := &Honeytrap{}
+
+	for _, v := range []struct {
+		name     string
+		matchers []ServiceMap
+		data     string
+		expected string
+	}{
+		// the https service of another port doesn't take the connection
+		{"single service", []ServiceMap{https, imap}, "\x16\x03\x01\x00", "imaps"},
+		{"single service without data", []ServiceMap{imap}, "", "imaps"},
+		{"detected on the port", []ServiceMap{ssh, http}, "GET / HTTP/1.0\r\n", "http"},
+		{"first of the port", []ServiceMap{ssh, http}, "\x16\x03\x01\x00", "ssh"},
+		{"detected on other port", []ServiceMap{https}, "\x16\x03\x01\x00", "https"},
+		{"unhandled", []ServiceMap{https}, "GET / HTTP/1.0\r\n", ""},
+	} {
+		conn := dial(t, l, v.data)
+
+		start := time.Now()
+
+		_, sm, _ := hc.route(&state{matchers: v.matchers}, conn)
+
+		name := ""
+		if sm != nil {
+			name = sm.Name
+		}
+
+		if name != v.expected {
+			t.Errorf("%s: expected service %q, got %q", v.name, v.expected, name)
+		}
+
+		if len(v.matchers) == 1 && v.matchers[0].Name == "imaps" && time.Since(start) >= peekTimeout {
+			t.Errorf("%s: expected no peek for a single service", v.name)
+		}
+
+		conn.Close()
+	}
+}
+
+func TestRoutePriority(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	port := l.Addr().(*net.TCPAddr).Port
+
+	hc := &Honeytrap{}
+
+	for _, v := range []struct {
+		name     string
+		conf     string
+		expected string
+	}{
+		{"first by name", `
+[service.b]
+type="recorder"
+port="tcp/%[1]d"
+
+[service.a]
+type="echo"
+port="tcp/%[1]d"
+`, "a"},
+		{"higher priority first", `
+[service.a]
+type="echo"
+port="tcp/%[1]d"
+
+[service.b]
+type="recorder"
+port="tcp/%[1]d"
+priority=10
+`, "b"},
+		{"detected before priority", `
+[service.a]
+type="http"
+port="tcp/%[1]d"
+
+[service.b]
+type="recorder"
+port="tcp/%[1]d"
+priority=10
+`, "a"},
+	} {
+		conf := &config.Config{}
+		if err := conf.Parse(strings.NewReader(fmt.Sprintf(v.conf, port))); err != nil {
+			t.Fatal(err)
+		}
+
+		st, errs := hc.build(conf, nil)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		conn := dial(t, l, "GET / HTTP/1.0\r\n\r\n")
+
+		if _, sm, _ := hc.route(st, conn); sm == nil || sm.Name != v.expected {
+			t.Errorf("%s: expected service %s, got %+v", v.name, v.expected, sm)
+		}
+
+		conn.Close()
+	}
+}
+
+func TestHandleDefaultService(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	svc := &readService{started: make(chan struct{}, 2)}
+
+	hc := &Honeytrap{
+		bus:      eventbus.New(),
+		governor: newGovernor(),
+		sessions: newSessions(),
+		state: &state{
+			defaultService: &ServiceMap{Name: "recorder", Service: svc},
+		},
+	}
+
+	c := make(events, 10)
+	hc.bus.Subscribe(c)
+
+	next := func() (event.Event, bool) {
+		for {
+			select {
+			case e := <-c:
+				if e.Get("type") == "connection-unhandled" {
+					return e, true
+				}
+			case <-time.After(100 * time.Millisecond):
+				return event.Event{}, false
+			}
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		client, done := serve(t, hc, l)
+
+		select {
+		case <-svc.started:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected connection %d to be handled by the default service", i)
+		}
+
+		client.Close()
+		<-done
+
+		e, ok := next()
+		if i == 0 && !ok {
+			t.Fatal("Expected connection-unhandled event")
+		} else if i == 0 && e.Get("default-service") != "recorder" {
+			t.Errorf("Expected default service recorder, got %v", event.ToMap(e))
+		} else if i == 1 && ok {
+			// unhandled connections are reported once per source
+			t.Errorf("Expected connection-unhandled event to be suppressed, got %v", event.ToMap(e))
+		}
+	}
+}
@@ -0,0 +1,301 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/listener"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/services"
+)
+
+// session tracks an active connection, the last time data was read or
+// written and the bytes transferred. The events of the connection share the
+// id of the session.
+type session struct {
+	net.Conn
+
+	id *event.Session
+
+	cancel context.CancelFunc
+
+	service services.Servicer
+
+	last int64
+
+	received int64
+	sent     int64
+}
+
+// Session returns the session the events of the connection belong to.
+func (s *session) Session() *event.Session {
+	return s.id
+}
+
+func (s *session) touch() {
+	atomic.StoreInt64(&s.last, time.Now().UnixNano())
+}
+
+func (s *session) idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&s.last)))
+}
+
+func (s *session) Read(b []byte) (int, error) {
+	n, err := s.Conn.Read(b)
+	if n > 0 {
+		s.touch()
+		atomic.AddInt64(&s.received, int64(n))
+	}
+
+	return n, err
+}
+
+func (s *session) Write(b []byte) (int, error) {
+	n, err := s.Conn.Write(b)
+	if n > 0 {
+		s.touch()
+		atomic.AddInt64(&s.sent, int64(n))
+	}
+
+	return n, err
+}
+
+// watchIdle cancels the session when no data has been read or written for
+// the timeout.
+func (s *session) watchIdle(ctx context.Context, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		idle := s.idle()
+		if idle >= timeout {
+			log.Debugf("Session %s => %s idle for %s, closing", s.RemoteAddr(), s.LocalAddr(), idle)
+			s.cancel()
+			return
+		}
+
+		timer.Reset(timeout - idle)
+	}
+}
+
+// sessions contains the active sessions. Once closed, new sessions are
+// rejected and the active sessions can be drained.
+type sessions struct {
+	m sync.Mutex
+
+	active map[*session]struct{}
+
+	// addrs contains the active sessions by remote address
+	addrs map[string]*session
+
+	closed bool
+
+	// drained is closed when the sessions are closed and none are active
+	drained chan struct{}
+}
+
+func newSessions() *sessions {
+	return &sessions{
+		active:  map[*session]struct{}{},
+		addrs:   map[string]*session{},
+		drained: make(chan struct{}),
+	}
+}
+
+// add adds the session, it returns false when the sessions are closed.
+func (ss *sessions) add(s *session) bool {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+
+	if ss.closed {
+		return false
+	}
+
+	ss.active[s] = struct{}{}
+	ss.addrs[s.RemoteAddr().String()] = s
+	return true
+}
+
+func (ss *sessions) remove(s *session) {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+
+	delete(ss.active, s)
+
+	if ss.addrs[s.RemoteAddr().String()] == s {
+		delete(ss.addrs, s.RemoteAddr().String())
+	}
+
+	if ss.closed && len(ss.active) == 0 {
+		close(ss.drained)
+	}
+}
+
+// Close rejects new sessions, the active sessions are kept.
+func (ss *sessions) Close() {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+
+	if ss.closed {
+		return
+	}
+
+	ss.closed = true
+
+	if len(ss.active) == 0 {
+		close(ss.drained)
+	}
+}
+
+// lookup returns the active session of the source address of the event.
+func (ss *sessions) lookup(e event.Event) *session {
+	ip := e.Get("source-ip")
+
+	port, ok := e.Load("source-port")
+	if ip == "" || !ok {
+		return nil
+	}
+
+	ss.m.Lock()
+	defer ss.m.Unlock()
+
+	return ss.addrs[net.JoinHostPort(ip, fmt.Sprint(port))]
+}
+
+// Count returns the number of active sessions.
+func (ss *sessions) Count() int {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+
+	return len(ss.active)
+}
+
+// WaitService waits until the sessions of the service are done.
+func (ss *sessions) WaitService(service services.Servicer) {
+	for {
+		active := false
+
+		ss.m.Lock()
+		for s := range ss.active {
+			if s.service == service {
+				active = true
+				break
+			}
+		}
+		ss.m.Unlock()
+
+		if !active {
+			return
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+// Wait waits until all sessions are done after Close, or the timeout
+// expired. Returns false when sessions are still active.
+func (ss *sessions) Wait(timeout time.Duration) bool {
+	select {
+	case <-ss.drained:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// sessionChannel adds the session fields to the events of active sessions,
+// the session of an event is found by its source address. Events which
+// already belong to a session keep it. The listener can link the events as
+// well.
+type sessionChannel struct {
+	pushers.Channel
+
+	sessions *sessions
+
+	// linker adds the fields of the listener, it is nil when the listener
+	// doesn't link events
+	linker listener.Linker
+}
+
+func (sc sessionChannel) Send(e event.Event) {
+	if !e.Has("session-id") {
+		if s := sc.sessions.lookup(e); s != nil {
+			event.Apply(e, event.WithSession(s.id))
+		}
+	}
+
+	if sc.linker != nil {
+		sc.linker.Link(e)
+	}
+
+	sc.Channel.Send(e)
+}
+
+// EventSessionStarted returns the event of a session being started.
+func EventSessionStarted(s *session) event.Event {
+	return event.New(
+		event.Sensor("honeytrap"),
+		event.Category("session"),
+		event.Type("session-start"),
+		event.SourceAddr(s.RemoteAddr()),
+		event.DestinationAddr(s.LocalAddr()),
+		event.WithSession(s.id),
+	)
+}
+
+// EventSessionEnded returns the event of a session being ended, with the
+// duration and the bytes received and sent.
+func EventSessionEnded(s *session) event.Event {
+	return event.New(
+		event.Sensor("honeytrap"),
+		event.Category("session"),
+		event.Type("session-end"),
+		event.SourceAddr(s.RemoteAddr()),
+		event.DestinationAddr(s.LocalAddr()),
+		event.WithSession(s.id),
+		event.Custom("duration", time.Since(s.id.Start).Seconds()),
+		event.Custom("bytes-received", atomic.LoadInt64(&s.received)),
+		event.Custom("bytes-sent", atomic.LoadInt64(&s.sent)),
+	)
+}
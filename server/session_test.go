@@ -0,0 +1,291 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/pushers/eventbus"
+)
+
+type addrConn struct {
+	net.Conn
+
+	remote, local net.Addr
+}
+
+func (c addrConn) RemoteAddr() net.Addr { return c.remote }
+func (c addrConn) LocalAddr() net.Addr  { return c.local }
+
+type recordChannel []event.Event
+
+func (rc *recordChannel) Send(e event.Event) {
+	*rc = append(*rc, e)
+}
+
+func TestSessionChannel(t *testing.T) {
+	ss := newSessions()
+
+	s := &session{
+		Conn: addrConn{
+			remote: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 51234},
+			local:  &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 22},
+		},
+		id: event.NewSession("ssh"),
+	}
+
+	ss.add(s)
+
+	rc := &recordChannel{}
+	sc := sessionChannel{Channel: rc, sessions: ss}
+
+	sc.Send(event.New(event.SourceAddr(s.RemoteAddr())))
+	sc.Send(event.New(event.SourceAddr(s.RemoteAddr())))
+	sc.Send(event.New(event.SourceAddr(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 51235})))
+
+	ss.remove(s)
+
+	sc.Send(event.New(event.SourceAddr(s.RemoteAddr())))
+
+	for i, expected := range []int64{1, 2} {
+		e := (*rc)[i]
+
+		if e.Get("session-id") != s.id.ID || e.Get("service") != "ssh" {
+			t.Fatalf("Expected event %d to belong to the session, got %s", i, e.Get("session-id"))
+		}
+
+		if seq, _ := e.Load("session-sequence"); seq != expected {
+			t.Fatalf("Expected sequence %d, got %v", expected, seq)
+		}
+	}
+
+	for _, e := range (*rc)[2:] {
+		if e.Has("session-id") {
+			t.Fatal("Expected event not to belong to the session")
+		}
+	}
+}
+
+// sourceLinker links the events of a source, like the canary linking the
+// events of poisoners.
+type sourceLinker string
+
+func (sl sourceLinker) Link(e event.Event) {
+	if e.Get("source-ip") == string(sl) {
+		event.Apply(e, event.Custom("linked", true))
+	}
+}
+
+func TestSessionChannelLinker(t *testing.T) {
+	rc := &recordChannel{}
+	sc := sessionChannel{Channel: rc, sessions: newSessions(), linker: sourceLinker("10.0.0.1")}
+
+	sc.Send(event.New(event.SourceIP(net.ParseIP("10.0.0.1"))))
+	sc.Send(event.New(event.SourceIP(net.ParseIP("10.0.0.3"))))
+
+	if linked, _ := (*rc)[0].GetBool("linked"); !linked {
+		t.Errorf("Expected the event of the source to be linked")
+	} else if (*rc)[1].Has("linked") {
+		t.Errorf("Expected the event of another source not to be linked")
+	}
+}
+
+// readService reads until the connection is closed.
+type readService struct {
+	started chan struct{}
+}
+
+func (s *readService) Handle(conn net.Conn) error {
+	s.started <- struct{}{}
+
+	_, err := io.Copy(ioutil.Discard, conn)
+	return err
+}
+
+func (s *readService) SetChannel(c pushers.Channel) {
+}
+
+// serve handles a new connection to the service, and returns the client
+// side and a channel closed when the connection has been handled.
+func serve(t *testing.T, hc *Honeytrap, l net.Listener) (net.Conn, chan struct{}) {
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		hc.handle(context.Background(), conn)
+		close(done)
+	}()
+
+	return client, done
+}
+
+func testHoneytrap(t *testing.T, sm ServiceMap) (*Honeytrap, net.Listener) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sm.Matcher = portMatcher(l.Addr().(*net.TCPAddr).Port)
+
+	hc := &Honeytrap{
+		bus:      eventbus.New(),
+		governor: newGovernor(),
+		sessions: newSessions(),
+		state:    &state{matchers: []ServiceMap{sm}},
+	}
+
+	return hc, l
+}
+
+func TestSessionIdleTimeout(t *testing.T) {
+	svc := &readService{started: make(chan struct{}, 1)}
+
+	hc, l := testHoneytrap(t, ServiceMap{Name: "echo", Service: svc, IdleTimeout: 100 * time.Millisecond})
+	defer l.Close()
+
+	client, done := serve(t, hc, l)
+	defer client.Close()
+
+	start := time.Now()
+
+	<-svc.started
+
+	// the session stays active while data is received
+	for i := 0; i < 4; i++ {
+		time.Sleep(50 * time.Millisecond)
+		client.Write([]byte("data"))
+	}
+
+	select {
+	case <-done:
+		if time.Since(start) < 200*time.Millisecond {
+			t.Errorf("Expected active session not to be closed, closed after %s", time.Since(start))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected idle session to be closed")
+	}
+
+	if count := hc.sessions.Count(); count != 0 {
+		t.Errorf("Expected no active sessions, got %d", count)
+	}
+}
+
+func TestSessionMaxSession(t *testing.T) {
+	svc := &readService{started: make(chan struct{}, 1)}
+
+	hc, l := testHoneytrap(t, ServiceMap{Name: "echo", Service: svc, MaxSession: 200 * time.Millisecond})
+	defer l.Close()
+
+	client, done := serve(t, hc, l)
+	defer client.Close()
+
+	<-svc.started
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// an active session is closed as well
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			if _, err := client.Write([]byte("data")); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected session to be closed after max-session")
+	}
+}
+
+func TestSessionsDrain(t *testing.T) {
+	svc := &readService{started: make(chan struct{}, 2)}
+
+	hc, l := testHoneytrap(t, ServiceMap{Name: "echo", Service: svc})
+	defer l.Close()
+
+	client, done := serve(t, hc, l)
+
+	<-svc.started
+
+	hc.sessions.Close()
+
+	// connections after the shutdown started don't start a session
+	late, lateDone := serve(t, hc, l)
+	defer late.Close()
+
+	select {
+	case <-lateDone:
+	case <-time.After(time.Second):
+		t.Fatal("Expected connection to be rejected after close")
+	}
+
+	select {
+	case <-svc.started:
+		t.Error("Expected service not to handle the rejected connection")
+	default:
+	}
+
+	if hc.sessions.Wait(50 * time.Millisecond) {
+		t.Fatal("Expected active session to keep the sessions from draining")
+	}
+
+	client.Close()
+	<-done
+
+	if !hc.sessions.Wait(time.Second) {
+		t.Fatal("Expected sessions to be drained")
+	}
+}
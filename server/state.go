@@ -0,0 +1,643 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/artifacts"
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/director"
+	"github.com/honeytrap/honeytrap/enrichers"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/listener"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/pushers/eventbus"
+	"github.com/honeytrap/honeytrap/pushers/spool"
+	"github.com/honeytrap/honeytrap/services"
+)
+
+// state contains the channels, directors and services built from a
+// configuration. Components with unchanged configuration are taken over
+// from the previous state on reload.
+type state struct {
+	config *config.Config
+
+	channels  map[string]pushers.Channel
+	directors map[string]director.Director
+	services  map[string]*ServiceMap
+
+	// subscribers contains the filtered channels
+	subscribers []pushers.Channel
+
+	// enrichers contains the enrichers by their index in the
+	// configuration, pipeline applies them in order
+	enrichers map[string]enrichers.Enricher
+	pipeline  *enrichers.Pipeline
+
+	// logging is set when a filter delivers logging to the channels
+	logging bool
+
+	// configs contains the decoded configuration per component, to detect
+	// changes
+	configs map[string]map[string]interface{}
+
+	matchers []ServiceMap
+
+	// defaultService handles connections not matched by any service
+	defaultService *ServiceMap
+
+	// addresses contains the addresses of the services by network and
+	// address, the listener listens on them once the state is accepted
+	addresses map[string]net.Addr
+}
+
+// serviceConfig contains the configuration every service supports.
+type serviceConfig struct {
+	Type     string      `toml:"type"`
+	Director string      `toml:"director"`
+	Port     interface{} `toml:"port"`
+	Priority int         `toml:"priority"`
+	Default  bool        `toml:"default"`
+
+	IdleTimeout config.Delay `toml:"idle-timeout"`
+	MaxSession  config.Delay `toml:"max-session"`
+
+	MaxConnections int `toml:"max-connections"`
+}
+
+// enricherConfig contains the configuration every enricher supports, the
+// name identifies the enricher in the stats.
+type enricherConfig struct {
+	Type string `toml:"type"`
+	Name string `toml:"name"`
+}
+
+// queueConfig returns the queue configuration of a channel.
+func queueConfig(p toml.Primitive) (eventbus.QueueConfig, error) {
+	qc := eventbus.DefaultQueueConfig
+	if err := toml.PrimitiveDecode(p, &qc); err != nil {
+		return qc, err
+	}
+
+	return qc, qc.Validate()
+}
+
+// eventQueueConfig returns the configuration of the queue of the events to
+// the enrichers. The queue blocks by default, events dropped there never
+// reach the queues and spools of the channels.
+func eventQueueConfig(p toml.Primitive) (eventbus.QueueConfig, error) {
+	qc := eventbus.DefaultQueueConfig
+	qc.Overflow = eventbus.Block
+
+	if err := toml.PrimitiveDecode(p, &qc); err != nil {
+		return qc, err
+	}
+
+	return qc, qc.Validate()
+}
+
+// spoolConfig returns the spool configuration of a channel.
+func spoolConfig(p toml.Primitive) (spool.Config, error) {
+	sc := spool.DefaultConfig
+	if err := toml.PrimitiveDecode(p, &sc); err != nil {
+		return sc, err
+	}
+
+	return sc, sc.Validate()
+}
+
+// spooled returns the channel writing to a spool when the spool is enabled,
+// events are delivered from the spool once the backend is available.
+func spooled(key string, d pushers.Channel, sc spool.Config) (pushers.Channel, error) {
+	if !sc.Enabled() {
+		return d, nil
+	}
+
+	return spool.New(key, d, sc)
+}
+
+// formatConfig selects the format of the events sent to a channel.
+type formatConfig struct {
+	Format string `toml:"format"`
+}
+
+// formatted returns the channel converting events to the configured format,
+// the events are converted before they are delivered, so spooled events are
+// stored in the honeytrap format.
+func formatted(d pushers.Channel, p toml.Primitive) (pushers.Channel, error) {
+	fc := formatConfig{}
+	if err := toml.PrimitiveDecode(p, &fc); err != nil {
+		return nil, err
+	}
+
+	return pushers.FormatChannel(d, fc.Format)
+}
+
+func decodeConfig(p toml.Primitive) map[string]interface{} {
+	m := map[string]interface{}{}
+	toml.PrimitiveDecode(p, &m)
+	return m
+}
+
+// reuse returns true if the component has the same configuration in the
+// previous state.
+func (st *state) reuse(prev *state, kind, key string) bool {
+	if prev == nil {
+		return false
+	}
+
+	old, ok := prev.configs[kind+"."+key]
+	if !ok {
+		return false
+	}
+
+	return reflect.DeepEqual(old, st.configs[kind+"."+key])
+}
+
+// build builds the state for the configuration, collecting the service
+// addresses for the listener. Errors are collected, so the caller can
+// decide whether to continue with a partial state.
+func (hc *Honeytrap) build(conf *config.Config, prev *state) (*state, []error) {
+	errs := []error{}
+
+	st := &state{
+		config:    conf,
+		channels:  map[string]pushers.Channel{},
+		directors: map[string]director.Director{},
+		services:  map[string]*ServiceMap{},
+		enrichers: map[string]enrichers.Enricher{},
+		configs:   map[string]map[string]interface{}{},
+		addresses: map[string]net.Addr{},
+	}
+
+	// the listener can link the events of services and directors, like
+	// the canary linking the events of poisoners
+	linker, _ := hc.listener.(listener.Linker)
+
+	stages := []enrichers.Stage{}
+
+	for i, s := range conf.Enrichers {
+		key := strconv.Itoa(i)
+
+		st.configs["enricher."+key] = decodeConfig(s)
+
+		x := enricherConfig{}
+
+		err := toml.PrimitiveDecode(s, &x)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of enricher: %s", err.Error()))
+			continue
+		}
+
+		if x.Type == "" {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of enricher %d: type not set", i))
+			continue
+		}
+
+		if x.Name == "" {
+			x.Name = x.Type
+		}
+
+		var e enrichers.Enricher
+
+		// enrichers are reused when their configuration didn't change,
+		// keeping their caches
+		if st.reuse(prev, "enricher", key) {
+			e = prev.enrichers[key]
+		} else if enricherFunc, ok := enrichers.Get(x.Type); !ok {
+			errs = append(errs, fmt.Errorf("Enricher %s not supported on platform (%d)", x.Type, i))
+			continue
+		} else if e, err = enricherFunc(
+			enrichers.WithConfig(s),
+			enrichers.WithChannel(pushers.MergeChannel(hc.bus, map[string]interface{}{
+				"component": "enricher." + x.Name,
+			})),
+			enrichers.WithArtifacts(hc.artifacts),
+		); err != nil {
+			errs = append(errs, fmt.Errorf("Error initializing enricher %s(%s): %s", x.Name, x.Type, err))
+			continue
+		}
+
+		st.enrichers[key] = e
+
+		stages = append(stages, enrichers.Stage{
+			Name:     x.Name,
+			Type:     x.Type,
+			Enricher: e,
+		})
+	}
+
+	// the payloads are stored after the other enrichers, so the ioc
+	// enricher can still match them
+	if hc.artifacts != nil {
+		stages = append(stages, enrichers.Stage{
+			Name:     "artifacts",
+			Type:     "artifacts",
+			Enricher: artifacts.NewEnricher(hc.artifacts),
+		})
+	}
+
+	if hc.credentials != nil {
+		stages = append(stages, enrichers.Stage{
+			Name:     "credentials",
+			Type:     "credentials",
+			Enricher: hc.credentials,
+		})
+	}
+
+	// profiles aggregate the events last, including the hashes of the
+	// artifacts
+	if hc.profiles != nil {
+		stages = append(stages, enrichers.Stage{
+			Name:     "profiles",
+			Type:     "profiles",
+			Enricher: hc.profiles,
+		})
+	}
+
+	st.pipeline = enrichers.NewPipeline(stages...)
+
+	for key, s := range conf.Channels {
+		st.configs["channel."+key] = decodeConfig(s)
+
+		x := struct {
+			Type string `toml:"type"`
+		}{}
+
+		err := toml.PrimitiveDecode(s, &x)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of channel: %s", err.Error()))
+			continue
+		}
+
+		if x.Type == "" {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of channel %s: type not set", key))
+			continue
+		}
+
+		if st.reuse(prev, "channel", key) {
+			st.channels[key] = prev.channels[key]
+		} else if channelFunc, ok := pushers.Get(x.Type); !ok {
+			errs = append(errs, fmt.Errorf("Channel %s not supported on platform (%s)", x.Type, key))
+		} else if qc, err := queueConfig(s); err != nil {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of channel %s(%s): %s", key, x.Type, err))
+		} else if sc, err := spoolConfig(s); err != nil {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of channel %s(%s): %s", key, x.Type, err))
+		} else if d, err := channelFunc(
+			pushers.WithConfig(s),
+		); err != nil {
+			errs = append(errs, fmt.Errorf("Error initializing channel %s(%s): %s", key, x.Type, err))
+		} else if d, err = formatted(d, s); err != nil {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of channel %s(%s): %s", key, x.Type, err))
+		} else if d, err = spooled(key, d, sc); err != nil {
+			errs = append(errs, fmt.Errorf("Error initializing spool of channel %s(%s): %s", key, x.Type, err))
+		} else if q, err := eventbus.NewQueue(key, d, qc); err != nil {
+			errs = append(errs, fmt.Errorf("Error initializing channel %s(%s): %s", key, x.Type, err))
+		} else {
+			// every channel has its own queue, a slow channel doesn't
+			// hold up the others
+			st.channels[key] = q
+		}
+	}
+
+	for _, s := range conf.Filters {
+		x := filterConfig{}
+
+		err := toml.PrimitiveDecode(s, &x)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of filter: %s", err.Error()))
+			continue
+		}
+
+		fn, err := x.filter()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of filter: %s", err.Error()))
+			continue
+		}
+
+		if x.Type == "logging" {
+			st.logging = true
+		}
+
+		for _, name := range x.Channels {
+			channel, ok := st.channels[name]
+			if !ok {
+				errs = append(errs, fmt.Errorf("Could not find channel %s for filter", name))
+				continue
+			}
+
+			channel = pushers.TokenChannel(channel, hc.token)
+			channel = pushers.FilterChannel(channel, fn)
+
+			st.subscribers = append(st.subscribers, channel)
+		}
+	}
+
+	for key, s := range conf.Directors {
+		st.configs["director."+key] = decodeConfig(s)
+
+		x := struct {
+			Type string `toml:"type"`
+		}{}
+
+		err := toml.PrimitiveDecode(s, &x)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of director: %s", err.Error()))
+			continue
+		}
+
+		if x.Type == "" {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of director %s: type not set", key))
+			continue
+		}
+
+		if st.reuse(prev, "director", key) {
+			st.directors[key] = prev.directors[key]
+		} else if directorFunc, ok := director.Get(x.Type); !ok {
+			errs = append(errs, fmt.Errorf("Director %s not supported on platform (%s)", x.Type, key))
+		} else if d, err := directorFunc(
+			director.WithChannel(sessionChannel{
+				Channel: pushers.MergeChannel(hc.bus, map[string]interface{}{
+					"component": "director." + key,
+				}),
+				sessions: hc.sessions,
+				linker:   linker,
+			}),
+			director.WithConfig(s),
+		); err != nil {
+			errs = append(errs, fmt.Errorf("Error initializing director %s(%s): %s", key, x.Type, err))
+		} else {
+			st.directors[key] = d
+		}
+	}
+
+	// same for proxies
+	for key, s := range conf.Services {
+		st.configs["service."+key] = decodeConfig(s)
+
+		x := serviceConfig{}
+
+		err := toml.PrimitiveDecode(s, &x)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of service %s(%s): %s", x.Type, key, err.Error()))
+			continue
+		}
+
+		if x.Type == "" {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of service %s: type not set", key))
+			continue
+		}
+
+		// individual configuration per service
+		options := []services.ServicerFunc{
+			services.WithChannel(sessionChannel{
+				Channel: pushers.MergeChannel(hc.bus, map[string]interface{}{
+					"service":   key,
+					"component": "service." + key,
+				}),
+				sessions: hc.sessions,
+				linker:   linker,
+			}),
+			services.WithConfig(s),
+		}
+
+		fn, ok := services.Get(x.Type)
+		if !ok {
+			errs = append(errs, fmt.Errorf("Could not find type %s for service %s", x.Type, key))
+			continue
+		}
+
+		if x.Director == "" {
+		} else if d, ok := st.directors[x.Director]; ok {
+			options = append(options, services.WithDirector(d))
+		} else {
+			errs = append(errs, fmt.Errorf("Could not find director=%s for service=%s", x.Director, key))
+			continue
+		}
+
+		if x.Default && st.defaultService != nil {
+			errs = append(errs, fmt.Errorf("Error parsing configuration of service %s(%s): default service already set to %s", key, x.Type, st.defaultService.Name))
+			continue
+		}
+
+		var ranges []PortRange
+		if x.Port != nil || !x.Default {
+			// the default service doesn't need to listen on specific ports
+			if ranges, err = ParsePorts(x.Port); err != nil {
+				errs = append(errs, fmt.Errorf("Error parsing configuration of service %s(%s): %s", key, x.Type, err.Error()))
+				continue
+			}
+		}
+
+		var service services.Servicer
+
+		// services are reused when their configuration and director
+		// didn't change, keeping their state
+		if st.reuse(prev, "service", key) && (x.Director == "" || st.reuse(prev, "director", x.Director)) {
+			service = prev.services[key].Service
+		} else {
+			service = fn(options...)
+		}
+
+		for _, pr := range ranges {
+			log.Infof("Mapping port %s to service %s (%s)", pr, x.Type, key)
+
+			for _, addr := range pr.Addrs() {
+				st.addresses[addr.Network()+"/"+addr.String()] = addr
+			}
+		}
+
+		// create mapping between ports and service
+		matcher := func(ranges []PortRange) func(net.Addr) bool {
+			return func(a net.Addr) bool {
+				for _, pr := range ranges {
+					if pr.Match(a) {
+						return true
+					}
+				}
+
+				return false
+			}
+		}
+
+		sm := &ServiceMap{
+			Name:     key,
+			Type:     x.Type,
+			Matcher:  matcher(ranges),
+			Service:  service,
+			Priority: x.Priority,
+
+			IdleTimeout: x.IdleTimeout.Duration(),
+			MaxSession:  x.MaxSession.Duration(),
+
+			MaxConnections: x.MaxConnections,
+		}
+
+		st.services[key] = sm
+
+		if x.Default {
+			log.Infof("Using service %s (%s) for unhandled connections", x.Type, key)
+			st.defaultService = sm
+		}
+
+		if len(ranges) > 0 {
+			st.matchers = append(st.matchers, *sm)
+		}
+	}
+
+	// first match wins, services with higher priority are matched first
+	sort.SliceStable(st.matchers, func(i, j int) bool {
+		if st.matchers[i].Priority != st.matchers[j].Priority {
+			return st.matchers[i].Priority > st.matchers[j].Priority
+		}
+
+		return st.matchers[i].Name < st.matchers[j].Name
+	})
+
+	return st, errs
+}
+
+// listen adds the addresses of the accepted state to the listener, and
+// removes the addresses which are no longer used by any service.
+func (hc *Honeytrap) listen(st *state) {
+	if a, ok := hc.listener.(listener.AddAddresser); ok {
+		for key, addr := range st.addresses {
+			if _, ok := hc.addresses[key]; ok {
+				continue
+			}
+
+			hc.addresses[key] = addr
+			a.AddAddress(addr)
+		}
+	}
+
+	for key, addr := range hc.addresses {
+		if _, ok := st.addresses[key]; ok {
+			continue
+		}
+
+		r, ok := hc.listener.(listener.RemoveAddresser)
+		if !ok {
+			// the listener keeps listening, connections to the address
+			// are no longer matched by the removed service
+			continue
+		}
+
+		log.Infof("Removing address %s", key)
+
+		delete(hc.addresses, key)
+		r.RemoveAddress(addr)
+	}
+}
+
+// queueStats returns the counters of the eventbus subscribers and the
+// channel queues.
+func (hc *Honeytrap) queueStats() []eventbus.QueueStats {
+	stats := hc.bus.Stats()
+
+	st := hc.currentState()
+	if st == nil {
+		return stats
+	}
+
+	keys := []string{}
+	for key := range st.channels {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if q, ok := st.channels[key].(*eventbus.Queue); ok {
+			stats = append(stats, q.Stats())
+		}
+	}
+
+	return stats
+}
+
+// enricherStats returns the counters of the enrichers.
+func (hc *Honeytrap) enricherStats() []enrichers.Stats {
+	st := hc.currentState()
+	if st == nil {
+		return []enrichers.Stats{}
+	}
+
+	return st.pipeline.Stats()
+}
+
+// channelGroup delivers events to the filtered channels of the current
+// configuration, it is subscribed to the eventbus once and the channels
+// are replaced on reload. Events are enriched once, before they are
+// delivered to the channels.
+type channelGroup struct {
+	m sync.RWMutex
+
+	pipeline *enrichers.Pipeline
+	channels []pushers.Channel
+}
+
+func (cg *channelGroup) Set(pipeline *enrichers.Pipeline, channels []pushers.Channel) {
+	cg.m.Lock()
+	defer cg.m.Unlock()
+
+	cg.pipeline = pipeline
+	cg.channels = channels
+}
+
+func (cg *channelGroup) Send(e event.Event) {
+	cg.m.RLock()
+	defer cg.m.RUnlock()
+
+	cg.pipeline.Enrich(e)
+
+	for _, c := range cg.channels {
+		c.Send(e)
+	}
+}
+
+func (cg *channelGroup) Flush() {
+	cg.m.RLock()
+	defer cg.m.RUnlock()
+
+	for _, c := range cg.channels {
+		if f, ok := c.(pushers.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
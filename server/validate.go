@@ -0,0 +1,626 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/artifacts"
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/credentials"
+	"github.com/honeytrap/honeytrap/director"
+	"github.com/honeytrap/honeytrap/enrichers"
+	"github.com/honeytrap/honeytrap/listener"
+	"github.com/honeytrap/honeytrap/profiles"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/pushers/eventbus"
+	"github.com/honeytrap/honeytrap/pushers/spool"
+	"github.com/honeytrap/honeytrap/services"
+	"github.com/honeytrap/honeytrap/web"
+	logging "github.com/op/go-logging"
+)
+
+// checker decodes the configuration strictly, and collects the problems.
+type checker struct {
+	md toml.MetaData
+
+	conf config.Config
+
+	errs []error
+
+	// strict contains the key prefixes of sections which have been decoded
+	// completely, undecoded keys in these sections are reported.
+	strict []string
+}
+
+func (c *checker) errorf(format string, args ...interface{}) {
+	c.errs = append(c.errs, fmt.Errorf(format, args...))
+}
+
+func (c *checker) decode(prefix string, p toml.Primitive, v ...interface{}) bool {
+	for _, dst := range v {
+		if err := c.md.PrimitiveDecode(p, dst); err != nil {
+			c.errorf("%s: %s", prefix, err.Error())
+			return false
+		}
+	}
+
+	c.strict = append(c.strict, prefix)
+	return true
+}
+
+// decodeDescribed decodes the configuration into the configuration struct of
+// the component description, and checks the required fields have been set.
+func (c *checker) decodeDescribed(prefix string, p toml.Primitive, d config.Description) {
+	if d.Config == nil {
+		return
+	}
+
+	x := struct {
+		Type string `toml:"type"`
+	}{}
+
+	if !c.decode(prefix, p, &x, d.Config()) {
+		return
+	}
+
+	key := strings.Split(prefix, ".")
+
+	for _, f := range d.Fields() {
+		if f.Required && !c.md.IsDefined(append(key, f.Name)...) {
+			c.errorf("%s: %s not set", prefix, f.Name)
+		}
+	}
+}
+
+func (c *checker) typeOf(section string, key string, p toml.Primitive) (string, bool) {
+	x := struct {
+		Type string `toml:"type"`
+	}{}
+
+	if err := c.md.PrimitiveDecode(p, &x); err != nil {
+		c.errorf("%s.%s: %s", section, key, err.Error())
+		return "", false
+	}
+
+	if x.Type == "" {
+		c.errorf("%s.%s: type not set", section, key)
+		return "", false
+	}
+
+	return x.Type, true
+}
+
+func (c *checker) checkListener() {
+	x := struct {
+		Type string `toml:"type"`
+	}{}
+
+	if err := c.md.PrimitiveDecode(c.conf.Listener, &x); err != nil {
+		c.errorf("listener: %s", err.Error())
+	} else if x.Type == "" {
+		c.errorf("listener: type not set")
+	} else if d, ok := listener.Description(x.Type); !ok {
+		c.errorf("listener: type %s not supported on platform", x.Type)
+	} else {
+		c.decodeDescribed("listener", c.conf.Listener, d)
+	}
+}
+
+func (c *checker) checkChannels() {
+	for key, s := range c.conf.Channels {
+		if typ, ok := c.typeOf("channel", key, s); !ok {
+		} else if d, ok := pushers.Description(typ); !ok {
+			c.errorf("channel.%s: type %s not supported on platform", key, typ)
+		} else {
+			c.decodeDescribed("channel."+key, s, d)
+		}
+
+		// every channel has a queue
+		qc := eventbus.DefaultQueueConfig
+		if err := c.md.PrimitiveDecode(s, &qc); err != nil {
+			c.errorf("channel.%s: %s", key, err.Error())
+		} else if err := qc.Validate(); err != nil {
+			c.errorf("channel.%s: %s", key, err.Error())
+		}
+
+		sc := spool.DefaultConfig
+		if err := c.md.PrimitiveDecode(s, &sc); err != nil {
+			c.errorf("channel.%s: %s", key, err.Error())
+		} else if err := sc.Validate(); err != nil {
+			c.errorf("channel.%s: %s", key, err.Error())
+		}
+
+		fc := formatConfig{}
+		if err := c.md.PrimitiveDecode(s, &fc); err != nil {
+			c.errorf("channel.%s: %s", key, err.Error())
+		} else if err := pushers.ValidateFormat(fc.Format); err != nil {
+			c.errorf("channel.%s: %s", key, err.Error())
+		}
+	}
+}
+
+func (c *checker) checkFilters() {
+	for i, s := range c.conf.Filters {
+		prefix := fmt.Sprintf("filter[%d]", i)
+
+		x := filterConfig{}
+		if !c.decode("filter", s, &x) {
+			continue
+		}
+
+		if len(x.Channels) == 0 {
+			c.errorf("%s: channel not set", prefix)
+		}
+
+		for _, name := range x.Channels {
+			if _, ok := c.conf.Channels[name]; !ok {
+				c.errorf("%s: channel %s not found", prefix, name)
+			}
+		}
+
+		if _, err := x.filter(); err != nil {
+			c.errorf("%s: %s", prefix, err.Error())
+		}
+	}
+}
+
+func (c *checker) checkDirectors() {
+	for key, s := range c.conf.Directors {
+		if typ, ok := c.typeOf("director", key, s); !ok {
+		} else if d, ok := director.Description(typ); !ok {
+			c.errorf("director.%s: type %s not supported on platform", key, typ)
+		} else {
+			c.decodeDescribed("director."+key, s, d)
+		}
+	}
+}
+
+func (c *checker) checkEnrichers() {
+	for i, s := range c.conf.Enrichers {
+		prefix := fmt.Sprintf("enricher[%d]", i)
+
+		x := enricherConfig{}
+		if !c.decode("enricher", s, &x) {
+			continue
+		}
+
+		if x.Type == "" {
+			c.errorf("%s: type not set", prefix)
+			continue
+		}
+
+		d, ok := enrichers.Description(x.Type)
+		if !ok {
+			c.errorf("%s: type %s not supported on platform", prefix, x.Type)
+			continue
+		} else if d.Config == nil {
+			continue
+		}
+
+		if !c.decode(prefix, s, d.Config()) {
+			continue
+		}
+
+		// the keys of array tables can't be looked up by index
+		m := decodeConfig(s)
+
+		for _, f := range d.Fields() {
+			if _, ok := m[f.Name]; f.Required && !ok {
+				c.errorf("%s: %s not set", prefix, f.Name)
+			}
+		}
+	}
+}
+
+func (c *checker) checkServices() {
+	defaultService := ""
+
+	for key, s := range c.conf.Services {
+		prefix := "service." + key
+
+		x := serviceConfig{}
+		if err := c.md.PrimitiveDecode(s, &x); err != nil {
+			c.errorf("%s: %s", prefix, err.Error())
+			continue
+		}
+
+		if x.Type == "" {
+			c.errorf("%s: type not set", prefix)
+			continue
+		}
+
+		d, ok := services.Description(x.Type)
+		if !ok {
+			c.errorf("%s: type %s not found", prefix, x.Type)
+			continue
+		}
+
+		if x.Director == "" {
+		} else if _, ok := c.conf.Directors[x.Director]; !ok {
+			c.errorf("%s: director %s not found", prefix, x.Director)
+		}
+
+		if !x.Default {
+		} else if defaultService != "" {
+			c.errorf("%s: default service already set to %s", prefix, defaultService)
+		} else {
+			defaultService = key
+		}
+
+		if x.Port != nil || !x.Default {
+			if _, err := ParsePorts(x.Port); err != nil {
+				c.errorf("%s: %s", prefix, err.Error())
+			}
+		}
+
+		// decode the service specific configuration into the configuration of
+		// the service
+		c.decodeDescribed(prefix, s, d)
+	}
+}
+
+func (c *checker) checkLimits() {
+	lc := newGovernor().limitsConfig
+	if !c.decode("limits", c.conf.Limits, &lc) {
+		return
+	}
+
+	switch lc.Action {
+	case "close", "reset", "tarpit":
+	default:
+		c.errorf("limits: invalid action %q, expected close, reset or tarpit", lc.Action)
+	}
+
+	if lc.MaxTarpits < 0 {
+		c.errorf("limits: invalid max-tarpits %d", lc.MaxTarpits)
+	}
+}
+
+func (c *checker) checkQueue() {
+	qc := eventbus.QueueConfig{}
+	if !c.decode("queue", c.conf.Queue, &qc) {
+		return
+	}
+
+	if _, err := eventQueueConfig(c.conf.Queue); err != nil {
+		c.errorf("queue: %s", err.Error())
+	}
+}
+
+func (c *checker) checkWeb() {
+	wc := web.DefaultConfig
+	if !c.decode("web", c.conf.Web, &wc) {
+		return
+	}
+
+	if _, _, err := net.SplitHostPort(wc.Listen); err != nil {
+		c.errorf("web: invalid listen %q: %s", wc.Listen, err.Error())
+	}
+}
+
+func (c *checker) checkArtifacts() {
+	ac := artifacts.DefaultConfig
+	if !c.decode("artifacts", c.conf.Artifacts, &ac) {
+		return
+	}
+
+	if err := ac.Validate(); err != nil {
+		c.errorf("artifacts: %s", err.Error())
+	}
+}
+
+func (c *checker) checkProfiles() {
+	pc := profiles.DefaultConfig
+	if !c.decode("profiles", c.conf.Profiles, &pc) {
+		return
+	}
+
+	if err := pc.Validate(); err != nil {
+		c.errorf("profiles: %s", err.Error())
+	}
+}
+
+func (c *checker) checkCredentials() {
+	cc := credentials.DefaultConfig
+	if !c.decode("credentials", c.conf.Credentials, &cc) {
+		return
+	}
+
+	if err := cc.Validate(); err != nil {
+		c.errorf("credentials: %s", err.Error())
+	}
+
+	for _, name := range cc.DecoyFiles {
+		if _, err := credentials.ReadDecoys(name); err != nil {
+			c.errorf("credentials: %s", err.Error())
+		}
+	}
+}
+
+func (c *checker) checkLogging() {
+	for i, l := range c.conf.Logging {
+		if _, err := logging.LogLevel(l.Level); err != nil {
+			c.errorf("logging[%d]: invalid level %q", i, l.Level)
+		}
+	}
+}
+
+func (c *checker) checkUndecoded() {
+	for _, key := range c.md.Undecoded() {
+		// top level keys are decoded into config.Config
+		if len(key) == 1 {
+			c.errorf("unknown key %s", key)
+			continue
+		}
+
+		for _, prefix := range c.strict {
+			if strings.HasPrefix(key.String()+".", prefix+".") {
+				c.errorf("unknown key %s", key)
+				break
+			}
+		}
+	}
+}
+
+// Validate resolves every section of the configuration against the
+// registries and decodes them strictly, returning the problems found.
+func Validate(r io.Reader) []error {
+	c := &checker{}
+
+	md, err := toml.DecodeReader(r, &c.conf)
+	if err != nil {
+		return []error{err}
+	}
+
+	c.md = md
+
+	c.checkListener()
+	c.checkChannels()
+	c.checkFilters()
+	c.checkEnrichers()
+	c.checkDirectors()
+	c.checkServices()
+	c.checkLimits()
+	c.checkQueue()
+	c.checkWeb()
+	c.checkArtifacts()
+	c.checkProfiles()
+	c.checkCredentials()
+	c.checkLogging()
+	c.checkUndecoded()
+
+	sort.Slice(c.errs, func(i, j int) bool {
+		return c.errs[i].Error() < c.errs[j].Error()
+	})
+
+	// keys of array tables will be reported for each table
+	errs := []error{}
+	for i, err := range c.errs {
+		if i > 0 && err.Error() == c.errs[i-1].Error() {
+			continue
+		}
+
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Dump writes the effective configuration, with the defaults filled in for
+// the components which provide them.
+func Dump(r io.Reader, w io.Writer) error {
+	conf := config.Config{}
+
+	if _, err := toml.DecodeReader(r, &conf); err != nil {
+		return err
+	}
+
+	sections := map[string]interface{}{}
+
+	sections["grace-period"] = conf.GracePeriod
+
+	lc := newGovernor().limitsConfig
+	if err := toml.PrimitiveDecode(conf.Limits, &lc); err != nil {
+		return err
+	}
+
+	sections["limits"] = lc
+
+	qc, err := eventQueueConfig(conf.Queue)
+	if err != nil {
+		return err
+	}
+
+	sections["queue"] = qc
+
+	wc := web.DefaultConfig
+	if err := toml.PrimitiveDecode(conf.Web, &wc); err != nil {
+		return err
+	}
+
+	// the token is a secret, it is left out of the dump
+	if wc.Token != "" {
+		wc.Token = "<redacted>"
+	}
+
+	sections["web"] = wc
+
+	ac := artifacts.DefaultConfig
+	if err := toml.PrimitiveDecode(conf.Artifacts, &ac); err != nil {
+		return err
+	}
+
+	ac.Path = ac.Dir()
+	sections["artifacts"] = ac
+
+	pc := profiles.DefaultConfig
+	if err := toml.PrimitiveDecode(conf.Profiles, &pc); err != nil {
+		return err
+	}
+
+	sections["profiles"] = pc
+
+	cc := credentials.DefaultConfig
+	if err := toml.PrimitiveDecode(conf.Credentials, &cc); err != nil {
+		return err
+	}
+
+	sections["credentials"] = cc
+
+	lm := decodeConfig(conf.Listener)
+
+	typ, _ := lm["type"].(string)
+
+	d, _ := listener.Description(typ)
+	redact(lm, d)
+
+	sections["listener"] = lm
+
+	channels := map[string]interface{}{}
+	for key, s := range conf.Channels {
+		m := decodeConfig(s)
+
+		typ, _ := m["type"].(string)
+
+		d, _ := pushers.Description(typ)
+		redact(m, d)
+
+		channels[key] = m
+	}
+
+	sections["channel"] = channels
+
+	directors := map[string]interface{}{}
+	for key, s := range conf.Directors {
+		m := decodeConfig(s)
+
+		typ, _ := m["type"].(string)
+
+		d, _ := director.Description(typ)
+		redact(m, d)
+
+		directors[key] = m
+	}
+
+	sections["director"] = directors
+
+	filters := []interface{}{}
+	for _, s := range conf.Filters {
+		filters = append(filters, decodeConfig(s))
+	}
+
+	sections["filter"] = filters
+
+	pipeline := []interface{}{}
+	for _, s := range conf.Enrichers {
+		m := decodeConfig(s)
+
+		typ, _ := m["type"].(string)
+
+		d, _ := enrichers.Description(typ)
+		if d.Config != nil {
+			if v, err := effective(s, d.Config()); err == nil {
+				for k, val := range v {
+					m[k] = val
+				}
+			}
+		}
+
+		redact(m, d)
+
+		pipeline = append(pipeline, m)
+	}
+
+	sections["enricher"] = pipeline
+
+	svcs := map[string]interface{}{}
+	for key, s := range conf.Services {
+		m := decodeConfig(s)
+
+		typ, _ := m["type"].(string)
+
+		d, _ := services.Description(typ)
+		if d.Config != nil {
+			if v, err := effective(s, d.Config()); err == nil {
+				// keep the generic service options, which aren't part of
+				// the service configuration
+				for k, val := range v {
+					m[k] = val
+				}
+			}
+		}
+
+		redact(m, d)
+
+		svcs[key] = m
+	}
+
+	sections["service"] = svcs
+
+	return toml.NewEncoder(w).Encode(sections)
+}
+
+// redact replaces the values of the secret fields of the component, like
+// tokens and passwords.
+func redact(m map[string]interface{}, d config.Description) {
+	for _, f := range d.Fields() {
+		if v, ok := m[f.Name]; ok && f.Secret && v != "" {
+			m[f.Name] = "<redacted>"
+		}
+	}
+}
+
+// effective decodes the configuration into v, and returns the resulting
+// configuration values.
+func effective(p toml.Primitive, v interface{}) (map[string]interface{}, error) {
+	if err := toml.PrimitiveDecode(p, v); err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := toml.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{}
+	if _, err := toml.Decode(buf.String(), &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
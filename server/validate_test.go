@@ -0,0 +1,143 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	conf := `
+[listener]
+type="socket"
+
+[service.echo]
+type="echo"
+port="TCP/7"
+
+[service.unknown]
+type="does-not-exist"
+port="TCP/8"
+
+[service.ranges]
+type="echo"
+port="TCP/10-9"
+
+[service.typo]
+type="recorder"
+port="TCP/11"
+max-szie=10
+
+[channel.console]
+type="console"
+
+[channel.file]
+type="file"
+queue-size=100
+overflow="drop-latest"
+
+[[filter]]
+channel=["console", "missing"]
+
+[[enricher]]
+type="geoip"
+
+[[enricher]]
+type="whois"
+`
+
+	expected := []string{
+		"channel.file: filename not set",
+		"channel.file: invalid overflow policy \"drop-latest\", expected drop-oldest, drop-newest, block or spill",
+		"enricher[0]: databases not set",
+		"enricher[1]: type whois not supported on platform",
+		"filter[0]: channel missing not found",
+		"service.ranges: invalid range in port \"TCP/10-9\", end before start",
+		"service.unknown: type does-not-exist not found",
+		"unknown key service.typo.max-szie",
+	}
+
+	errs := Validate(strings.NewReader(conf))
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(expected), len(errs), errs)
+	}
+
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], err.Error())
+		}
+	}
+}
+
+func TestDumpRedactsSecrets(t *testing.T) {
+	conf := `
+[channel.splunk]
+type="splunk"
+endpoints=["https://splunk.example.com:8088"]
+token="splunk-token"
+
+[channel.elasticsearch]
+type="elasticsearch"
+url="https://elasticsearch.example.com/honeytrap"
+username="honeytrap"
+password="elasticsearch-password"
+
+[channel.slack]
+type="slack"
+webhook_url="https://hooks.slack.com/services/T0/B0/secret"
+
+[channel.raven]
+type="raven"
+server="wss://raven.example.com"
+token="raven-token"
+
+[web]
+token="web-token"
+`
+
+	buf := &bytes.Buffer{}
+	if err := Dump(strings.NewReader(conf), buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"splunk-token", "elasticsearch-password", "hooks.slack.com", "raven-token", "web-token"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("Expected %s to be redacted", secret)
+		}
+	}
+
+	// fields which aren't secret are kept
+	if !strings.Contains(buf.String(), `username = "honeytrap"`) {
+		t.Errorf("Expected username to be dumped, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,621 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package adb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/services"
+	"github.com/honeytrap/honeytrap/storage"
+
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("services/adb")
+
+/*
+Configuration
+
+[service.adb]
+type="adb"
+port="tcp/5555"
+banner="device::ro.product.name=...;ro.product.model=...;ro.product.device=...;"
+path="/var/lib/honeytrap/adb"
+max-size=33554432
+
+[service.adb.commands]
+"uname -a"="Linux localhost 3.10.0 #1 SMP PREEMPT armv7l\n"
+*/
+
+var (
+	_ = services.Register("adb", ADB)
+	_ = services.Describe("adb", config.Description{
+		Description: "Android Debug Bridge emulating a device, storing pushed files",
+		Port:        "TCP/5555",
+		Config: func() interface{} {
+			c := defaultConfig()
+			return &c
+		},
+	})
+)
+
+// defaultConfig returns the defaults of the adb service, the home dir is
+// resolved when the service is created.
+func defaultConfig() adbServiceConfig {
+	return adbServiceConfig{
+		Banner:  "device::ro.product.name=hi3798mv100;ro.product.model=Hi3798MV100;ro.product.device=Hi3798MV100;",
+		Prompt:  "shell@Hi3798MV100:/ $ ",
+		Path:    filepath.Join(storage.HomeDir(), "adb"),
+		MaxSize: 32 * 1024 * 1024,
+	}
+}
+
+// ADB returns an Android Debug Bridge service, which emulates a device
+// with debugging over tcp enabled.
+func ADB(options ...services.ServicerFunc) services.Servicer {
+	s := &adbService{
+		adbServiceConfig: defaultConfig(),
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+type adbServiceConfig struct {
+	Banner string `toml:"banner" doc:"Device banner sent in the connect message"`
+	Prompt string `toml:"prompt" doc:"Shell prompt"`
+
+	// Path is the directory where pushed files are stored by their sha256.
+	Path    string `toml:"path" doc:"Directory where pushed files are stored"`
+	MaxSize int    `toml:"max-size" doc:"Maximum size of pushed files"`
+
+	Commands map[string]string `toml:"commands" doc:"Shell command responses"`
+}
+
+type adbService struct {
+	adbServiceConfig
+
+	c pushers.Channel
+}
+
+func (s *adbService) SetChannel(c pushers.Channel) {
+	s.c = c
+}
+
+// defaultCommands contains canned output for commands commonly run by adb worms.
+var defaultCommands = map[string]string{
+	"id":                               "uid=2000(shell) gid=2000(shell) groups=1003(graphics),1004(input),1007(log),1011(adb),1015(sdcard_rw),1028(sdcard_r),3001(net_bt_admin),3002(net_bt),3003(inet),3006(net_bw_stats) context=u:r:shell:s0\n",
+	"whoami":                           "shell\n",
+	"pwd":                              "/\n",
+	"uname -a":                         "Linux localhost 3.18.24 #1 SMP PREEMPT Tue May 16 16:43:09 CST 2017 armv7l\n",
+	"uname -m":                         "armv7l\n",
+	"getprop ro.product.model":         "Hi3798MV100\n",
+	"getprop ro.product.cpu.abi":       "armeabi-v7a\n",
+	"getprop ro.build.version.release": "4.4.2\n",
+	"ls":                               "acct\ncache\nconfig\nd\ndata\ndefault.prop\ndev\netc\ninit\nmnt\nproc\nroot\nsbin\nsdcard\nstorage\nsys\nsystem\nvendor\n",
+	"ls /data/local/tmp":               "",
+	"cat /proc/cpuinfo":                "Processor\t: ARMv7 Processor rev 5 (v7l)\nprocessor\t: 0\nBogoMIPS\t: 1594.16\nFeatures\t: swp half thumb fastmult vfp edsp neon vfpv3 tls vfpv4 idiva idivt\nHardware\t: bigfish\n",
+}
+
+// directories are reported as existing on the device, which allows pushes
+// into these directories.
+var directories = map[string]struct{}{
+	"":                {},
+	"/data":           {},
+	"/data/local":     {},
+	"/data/local/tmp": {},
+	"/sdcard":         {},
+	"/system/bin":     {},
+	"/system/xbin":    {},
+}
+
+// session contains the state of a single adb connection.
+type session struct {
+	*adbService
+
+	conn net.Conn
+
+	streams map[uint32]*stream
+	nextID  uint32
+}
+
+type stream struct {
+	localID  uint32
+	remoteID uint32
+
+	// service contains the requested destination, eg. shell:id or sync:
+	service string
+
+	buf bytes.Buffer
+
+	// size is the expected size of a streamed install
+	size int
+
+	// push contains the file currently being pushed over the sync protocol
+	push *push
+}
+
+type push struct {
+	path string
+	data bytes.Buffer
+}
+
+var errQuit = errors.New("adb: sync quit")
+
+func (s *session) send(options ...event.Option) {
+	s.c.Send(event.New(
+		services.EventOptions,
+		event.Category("adb"),
+		event.SourceAddr(s.conn.RemoteAddr()),
+		event.DestinationAddr(s.conn.LocalAddr()),
+		event.NewWith(options...),
+	))
+}
+
+func (s *session) write(st *stream, data []byte) error {
+	return writeMessage(s.conn, cmdWRTE, st.localID, st.remoteID, data)
+}
+
+func (s *session) close(st *stream) error {
+	delete(s.streams, st.localID)
+	return writeMessage(s.conn, cmdCLSE, st.localID, st.remoteID, nil)
+}
+
+// store saves the data by its sha256 in the configured path and returns
+// the hash.
+func (s *adbService) store(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	if err := os.MkdirAll(s.Path, 0755); err != nil {
+		return hash, err
+	}
+
+	p := filepath.Join(s.Path, hash)
+	if _, err := os.Stat(p); err == nil {
+		return hash, nil
+	} else if !os.IsNotExist(err) {
+		return hash, err
+	}
+
+	return hash, ioutil.WriteFile(p, data, 0600)
+}
+
+// run returns the output of a (possibly chained) shell command.
+func (s *adbService) run(line string) string {
+	output := ""
+
+	for _, cmd := range strings.FieldsFunc(line, func(r rune) bool {
+		return r == ';' || r == '&' || r == '|' || r == '\n'
+	}) {
+		cmd = strings.TrimSpace(cmd)
+		if cmd == "" {
+			continue
+		}
+
+		if v, ok := s.Commands[cmd]; ok {
+			output += v
+			continue
+		} else if v, ok := defaultCommands[cmd]; ok {
+			output += v
+			continue
+		}
+
+		args := strings.Fields(cmd)
+		switch args[0] {
+		case "cd", "chmod", "rm", "mkdir", "export", "exit":
+		case "echo":
+			output += strings.Join(args[1:], " ") + "\n"
+		case "pm":
+			if len(args) > 1 && args[1] == "install" {
+				output += "Success\n"
+			}
+		default:
+			output += fmt.Sprintf("/system/bin/sh: %s: not found\n", args[0])
+		}
+	}
+
+	return output
+}
+
+func isInstall(cmd string) bool {
+	return strings.Contains(cmd, "pm install") || strings.Contains(cmd, "package install") || strings.Contains(cmd, "package 'install'")
+}
+
+func (s *session) open(m *message) error {
+	service := strings.TrimRight(string(m.Data), "\x00")
+
+	s.nextID++
+
+	st := &stream{
+		localID:  s.nextID,
+		remoteID: m.Arg0,
+		service:  service,
+	}
+
+	parts := strings.SplitN(service, ":", 2)
+	if len(parts) != 2 {
+		parts = append(parts, "")
+	}
+
+	switch parts[0] {
+	case "shell", "exec":
+	case "sync":
+	default:
+		s.send(
+			event.Type("open"),
+			event.Custom("adb.service", service),
+		)
+
+		return writeMessage(s.conn, cmdCLSE, 0, m.Arg0, nil)
+	}
+
+	s.streams[st.localID] = st
+
+	if err := writeMessage(s.conn, cmdOKAY, st.localID, st.remoteID, nil); err != nil {
+		return err
+	}
+
+	if parts[0] == "sync" {
+		return nil
+	}
+
+	cmd := strings.TrimSpace(parts[1])
+
+	if cmd == "" {
+		// interactive shell
+		s.send(
+			event.Type("shell"),
+			event.Custom("adb.service", service),
+		)
+
+		return s.write(st, []byte(s.Prompt))
+	}
+
+	if isInstall(cmd) {
+		s.send(
+			event.Type("install"),
+			event.Custom("adb.service", service),
+			event.Custom("adb.command", cmd),
+		)
+
+		if size, ok := installSize(cmd); ok && size > 0 && size <= s.MaxSize {
+			// streamed install, the apk will follow as stream data
+			st.size = size
+			return nil
+		}
+	} else {
+		s.send(
+			event.Type("shell"),
+			event.Custom("adb.service", service),
+			event.Custom("adb.command", cmd),
+		)
+	}
+
+	if output := s.run(cmd); output != "" {
+		if err := s.write(st, []byte(output)); err != nil {
+			return err
+		}
+	}
+
+	return s.close(st)
+}
+
+// installSize returns the size of a streamed install, as passed by
+// adb install using "exec:cmd package 'install' -S <size>".
+func installSize(cmd string) (int, bool) {
+	args := strings.Fields(cmd)
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] != "-S" {
+			continue
+		}
+
+		size, err := strconv.Atoi(args[i+1])
+		return size, err == nil
+	}
+
+	return 0, false
+}
+
+func (s *session) data(m *message) error {
+	st, ok := s.streams[m.Arg1]
+	if !ok {
+		return writeMessage(s.conn, cmdCLSE, 0, m.Arg0, nil)
+	}
+
+	if err := writeMessage(s.conn, cmdOKAY, st.localID, st.remoteID, nil); err != nil {
+		return err
+	}
+
+	if st.buf.Len()+len(m.Data) > s.MaxSize+maxPayload {
+		return s.close(st)
+	}
+
+	st.buf.Write(m.Data)
+
+	switch {
+	case st.service == "sync:":
+		if err := s.sync(st); err == errQuit {
+			return s.close(st)
+		} else if err != nil {
+			log.Errorf("Error handling sync request: %s", err.Error())
+			return s.close(st)
+		}
+
+		return nil
+	case st.size > 0:
+		if st.buf.Len() < st.size {
+			return nil
+		}
+
+		data := st.buf.Bytes()[:st.size]
+
+		hash, err := s.store(data)
+		if err != nil {
+			log.Errorf("Error storing installed file: %s", err.Error())
+		}
+
+		s.send(
+			event.Type("install"),
+			event.Custom("adb.service", st.service),
+			event.Custom("adb.sha256", hash),
+			event.Custom("adb.size", len(data)),
+		)
+
+		if err := s.write(st, []byte("Success\n")); err != nil {
+			return err
+		}
+
+		return s.close(st)
+	default:
+		// interactive shell, handle complete lines
+		for {
+			line, err := st.buf.ReadString('\n')
+			if err == io.EOF {
+				// put back partial line
+				rest := line
+				st.buf.Reset()
+				st.buf.WriteString(rest)
+				return nil
+			}
+
+			line = strings.TrimSpace(line)
+
+			s.send(
+				event.Type("shell"),
+				event.Custom("adb.service", st.service),
+				event.Custom("adb.command", line),
+			)
+
+			if line == "exit" {
+				return s.close(st)
+			}
+
+			if err := s.write(st, []byte(s.run(line)+s.Prompt)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sync handles the requests of the file sync protocol, which are framed
+// as a 4 byte id and a 4 byte little endian length.
+func (s *session) sync(st *stream) error {
+	for {
+		b := st.buf.Bytes()
+		if len(b) < 8 {
+			return nil
+		}
+
+		id := string(b[:4])
+		n := int(binary.LittleEndian.Uint32(b[4:8]))
+
+		switch id {
+		case "DONE":
+			// the length contains the modification time
+			st.buf.Next(8)
+
+			if st.push == nil {
+				return fmt.Errorf("adb: unexpected DONE")
+			}
+
+			data := st.push.data.Bytes()
+
+			hash, err := s.store(data)
+			if err != nil {
+				log.Errorf("Error storing pushed file: %s", err.Error())
+			}
+
+			s.send(
+				event.Type("push"),
+				event.Custom("adb.path", st.push.path),
+				event.Custom("adb.sha256", hash),
+				event.Custom("adb.size", len(data)),
+			)
+
+			st.push = nil
+
+			if err := s.write(st, []byte("OKAY\x00\x00\x00\x00")); err != nil {
+				return err
+			}
+
+			continue
+		case "QUIT":
+			return errQuit
+		case "DATA":
+			if n > 64*1024 {
+				return fmt.Errorf("adb: sync data chunk too large: %d", n)
+			}
+		case "SEND", "STAT", "LIST", "RECV":
+			if n > 1024 {
+				return fmt.Errorf("adb: sync path too long: %d", n)
+			}
+		default:
+			return fmt.Errorf("adb: unknown sync request: %q", id)
+		}
+
+		if len(b) < 8+n {
+			return nil
+		}
+
+		arg := make([]byte, n)
+		copy(arg, b[8:8+n])
+
+		st.buf.Next(8 + n)
+
+		var reply []byte
+
+		switch id {
+		case "DATA":
+			if st.push == nil {
+				return fmt.Errorf("adb: unexpected DATA")
+			}
+
+			if st.push.data.Len()+n > s.MaxSize {
+				msg := "file too large"
+				reply = append([]byte("FAIL"), le32(uint32(len(msg)))...)
+				reply = append(reply, msg...)
+
+				if err := s.write(st, reply); err != nil {
+					return err
+				}
+
+				return errQuit
+			}
+
+			st.push.data.Write(arg)
+			continue
+		case "SEND":
+			path := string(arg)
+			if i := strings.LastIndex(path, ","); i >= 0 {
+				path = path[:i]
+			}
+
+			st.push = &push{
+				path: path,
+			}
+
+			continue
+		case "STAT":
+			// report known directories as existing, everything else
+			// as non existent
+			mode := uint32(0)
+			if _, ok := directories[strings.TrimSuffix(string(arg), "/")]; ok {
+				mode = 040771
+			}
+
+			reply = append([]byte("STAT"), le32(mode)...)
+			reply = append(reply, make([]byte, 8)...)
+		case "LIST":
+			reply = append([]byte("DONE"), make([]byte, 16)...)
+		case "RECV":
+			msg := "No such file or directory"
+			reply = append([]byte("FAIL"), le32(uint32(len(msg)))...)
+			reply = append(reply, msg...)
+		}
+
+		if err := s.write(st, reply); err != nil {
+			return err
+		}
+	}
+}
+
+func le32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func (s *adbService) CanHandle(payload []byte) bool {
+	return bytes.HasPrefix(payload, []byte("CNXN"))
+}
+
+func (s *adbService) Handle(conn net.Conn) error {
+	defer conn.Close()
+
+	sess := &session{
+		adbService: s,
+		conn:       conn,
+		streams:    map[uint32]*stream{},
+	}
+
+	for {
+		m, err := readMessage(conn)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch m.Command {
+		case cmdCNXN:
+			sess.send(
+				event.Type("connect"),
+				event.Custom("adb.banner", strings.TrimRight(string(m.Data), "\x00")),
+			)
+
+			err = writeMessage(conn, cmdCNXN, adbVersion, maxPayload, []byte(s.Banner))
+		case cmdOPEN:
+			err = sess.open(m)
+		case cmdWRTE:
+			err = sess.data(m)
+		case cmdCLSE:
+			if st, ok := sess.streams[m.Arg1]; ok {
+				err = sess.close(st)
+			}
+		case cmdOKAY, cmdAUTH:
+		default:
+			log.Debugf("Unknown adb message: %s", m)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,129 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package adb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/services"
+)
+
+func expect(t *testing.T, conn net.Conn, command uint32) *message {
+	m, err := readMessage(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Command != command {
+		t.Fatalf("Expected %s, got %s", commandNames[command], m)
+	}
+
+	return m
+}
+
+func TestADBShellAndPush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	s := ADB(
+		services.WithChannel(pushers.MustDummy()),
+	).(*adbService)
+	s.Path = dir
+
+	go s.Handle(server)
+
+	go writeMessage(client, cmdCNXN, adbVersion, maxPayload, []byte("host::\x00"))
+
+	if m := expect(t, client, cmdCNXN); string(m.Data) != s.Banner {
+		t.Errorf("Expected banner %q, got %q", s.Banner, m.Data)
+	}
+
+	go writeMessage(client, cmdOPEN, 1, 0, []byte("shell:whoami\x00"))
+
+	okay := expect(t, client, cmdOKAY)
+
+	if m := expect(t, client, cmdWRTE); string(m.Data) != "shell\n" {
+		t.Errorf("Expected whoami output, got %q", m.Data)
+	}
+
+	if m := expect(t, client, cmdCLSE); m.Arg0 != okay.Arg0 || m.Arg1 != 1 {
+		t.Errorf("Expected close of stream, got %s", m)
+	}
+
+	go writeMessage(client, cmdOPEN, 2, 0, []byte("sync:\x00"))
+
+	okay = expect(t, client, cmdOKAY)
+
+	content := []byte("\x7fELF payload")
+
+	req := []byte{}
+	req = append(req, "SEND"...)
+	req = append(req, le32(uint32(len("/data/local/tmp/x,33261")))...)
+	req = append(req, "/data/local/tmp/x,33261"...)
+	req = append(req, "DATA"...)
+	req = append(req, le32(uint32(len(content)))...)
+	req = append(req, content...)
+	req = append(req, "DONE"...)
+	req = append(req, le32(0)...)
+
+	go writeMessage(client, cmdWRTE, 2, okay.Arg0, req)
+
+	expect(t, client, cmdOKAY)
+
+	if m := expect(t, client, cmdWRTE); string(m.Data[:4]) != "OKAY" {
+		t.Errorf("Expected sync OKAY, got %q", m.Data)
+	}
+
+	sum := sha256.Sum256(content)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, hex.EncodeToString(sum[:])))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != string(content) {
+		t.Errorf("Expected pushed content %q, got %q", content, data)
+	}
+}
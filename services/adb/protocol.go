@@ -0,0 +1,145 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package adb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Commands of the adb transport protocol, see
+// https://android.googlesource.com/platform/system/core/+/master/adb/protocol.txt
+const (
+	cmdSYNC = 0x434e5953
+	cmdCNXN = 0x4e584e43
+	cmdAUTH = 0x48545541
+	cmdOPEN = 0x4e45504f
+	cmdOKAY = 0x59414b4f
+	cmdCLSE = 0x45534c43
+	cmdWRTE = 0x45545257
+)
+
+const (
+	adbVersion = 0x01000000
+
+	// maxPayload is the maximum payload size we advertise and accept.
+	maxPayload = 256 * 1024
+)
+
+var commandNames = map[uint32]string{
+	cmdSYNC: "SYNC",
+	cmdCNXN: "CNXN",
+	cmdAUTH: "AUTH",
+	cmdOPEN: "OPEN",
+	cmdOKAY: "OKAY",
+	cmdCLSE: "CLSE",
+	cmdWRTE: "WRTE",
+}
+
+var (
+	errInvalidMagic = errors.New("adb: invalid message magic")
+	errTooLarge     = errors.New("adb: message payload too large")
+)
+
+type message struct {
+	Command uint32
+	Arg0    uint32
+	Arg1    uint32
+
+	Data []byte
+}
+
+func (m *message) String() string {
+	name, ok := commandNames[m.Command]
+	if !ok {
+		name = fmt.Sprintf("%08x", m.Command)
+	}
+
+	return fmt.Sprintf("%s(%d, %d, %d bytes)", name, m.Arg0, m.Arg1, len(m.Data))
+}
+
+func checksum(data []byte) uint32 {
+	sum := uint32(0)
+	for _, b := range data {
+		sum += uint32(b)
+	}
+
+	return sum
+}
+
+func readMessage(r io.Reader) (*message, error) {
+	var header [24]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	m := &message{
+		Command: binary.LittleEndian.Uint32(header[0:]),
+		Arg0:    binary.LittleEndian.Uint32(header[4:]),
+		Arg1:    binary.LittleEndian.Uint32(header[8:]),
+	}
+
+	length := binary.LittleEndian.Uint32(header[12:])
+	magic := binary.LittleEndian.Uint32(header[20:])
+
+	if magic != m.Command^0xffffffff {
+		return nil, errInvalidMagic
+	}
+
+	if length > maxPayload {
+		return nil, errTooLarge
+	}
+
+	m.Data = make([]byte, length)
+	if _, err := io.ReadFull(r, m.Data); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func writeMessage(w io.Writer, command, arg0, arg1 uint32, data []byte) error {
+	buf := make([]byte, 24+len(data))
+
+	binary.LittleEndian.PutUint32(buf[0:], command)
+	binary.LittleEndian.PutUint32(buf[4:], arg0)
+	binary.LittleEndian.PutUint32(buf[8:], arg1)
+	binary.LittleEndian.PutUint32(buf[12:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[16:], checksum(data))
+	binary.LittleEndian.PutUint32(buf[20:], command^0xffffffff)
+
+	copy(buf[24:], data)
+
+	_, err := w.Write(buf)
+	return err
+}
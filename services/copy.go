@@ -34,6 +34,7 @@ import (
 	"io"
 	"net"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/director"
 	"github.com/honeytrap/honeytrap/listener"
 	"github.com/honeytrap/honeytrap/pushers"
@@ -41,6 +42,9 @@ import (
 
 var (
 	_ = Register("copy", Copy)
+	_ = Describe("copy", config.Description{
+		Description: "Copies the connection to the director",
+	})
 )
 
 // Copy is a placeholder
@@ -81,7 +85,7 @@ func (s *copyService) Handle(conn net.Conn) error {
 		_, err = io.Copy(conn, conn2)
 
 		return nil
-	} else if _, ok := conn.(*net.TCPConn); ok {
+	} else if _, ok := conn.LocalAddr().(*net.TCPAddr); ok {
 		conn2, err := s.d.Dial(conn)
 		if err != nil {
 			return err
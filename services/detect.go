@@ -0,0 +1,152 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package services
+
+import (
+	"bytes"
+)
+
+// CanHandler is implemented by services that recognize their protocol
+// from the first bytes a client sends.
+type CanHandler interface {
+	CanHandle([]byte) bool
+}
+
+var httpMethods = [][]byte{
+	[]byte("GET "),
+	[]byte("HEAD "),
+	[]byte("POST "),
+	[]byte("PUT "),
+	[]byte("DELETE "),
+	[]byte("OPTIONS "),
+	[]byte("CONNECT "),
+	[]byte("TRACE "),
+	[]byte("PATCH "),
+	[]byte("PROPFIND "),
+}
+
+// IsHTTP returns true if payload starts with a HTTP request line.
+func IsHTTP(payload []byte) bool {
+	for _, method := range httpMethods {
+		if bytes.HasPrefix(payload, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsTLS returns true if payload starts with a TLS (or SSL 3.0)
+// ClientHello record.
+func IsTLS(payload []byte) bool {
+	if len(payload) < 6 {
+		return false
+	}
+
+	// handshake record, version 3.x, client hello
+	return payload[0] == 0x16 && payload[1] == 0x03 && payload[5] == 0x01
+}
+
+// IsSSH returns true if payload starts with a SSH version banner.
+func IsSSH(payload []byte) bool {
+	return bytes.HasPrefix(payload, []byte("SSH-"))
+}
+
+// IsRDP returns true if payload starts with a TPKT encapsulated X.224
+// connection request.
+func IsRDP(payload []byte) bool {
+	if len(payload) < 6 {
+		return false
+	}
+
+	return payload[0] == 0x03 && payload[1] == 0x00 && payload[5] == 0xe0
+}
+
+// IsSMB returns true if payload contains a SMB1 or SMB2 message in a
+// NetBIOS session message.
+func IsSMB(payload []byte) bool {
+	if len(payload) < 8 || payload[0] != 0x00 {
+		return false
+	}
+
+	return bytes.Equal(payload[5:8], []byte("SMB")) && (payload[4] == 0xff || payload[4] == 0xfe)
+}
+
+// IsRedis returns true if payload starts with a RESP array, or a common
+// inline redis command.
+func IsRedis(payload []byte) bool {
+	if len(payload) > 1 && payload[0] == '*' && payload[1] >= '0' && payload[1] <= '9' {
+		return true
+	}
+
+	for _, command := range []string{"PING", "INFO", "AUTH ", "CONFIG ", "KEYS "} {
+		if bytes.HasPrefix(bytes.ToUpper(payload), []byte(command)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsSIP returns true if payload starts with a SIP request line.
+func IsSIP(payload []byte) bool {
+	line := payload
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	return bytes.Contains(line, []byte(" sip:")) && bytes.Contains(line, []byte("SIP/2.0"))
+}
+
+var detectors = []struct {
+	Name string
+	Fn   func([]byte) bool
+}{
+	{"tls", IsTLS},
+	{"ssh", IsSSH},
+	{"sip", IsSIP},
+	{"http", IsHTTP},
+	{"rdp", IsRDP},
+	{"smb", IsSMB},
+	{"redis", IsRedis},
+}
+
+// Detect returns the name of the protocol recognized in payload, or an
+// empty string.
+func Detect(payload []byte) string {
+	for _, d := range detectors {
+		if d.Fn(payload) {
+			return d.Name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,52 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package services
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := map[string][]byte{
+		"tls":   {0x16, 0x03, 0x01, 0x02, 0x00, 0x01, 0x00, 0x01, 0xfc},
+		"ssh":   []byte("SSH-2.0-libssh_0.6.0\r\n"),
+		"sip":   []byte("OPTIONS sip:100@10.0.0.1 SIP/2.0\r\n"),
+		"http":  []byte("GET / HTTP/1.1\r\nHost: 10.0.0.1\r\n\r\n"),
+		"rdp":   {0x03, 0x00, 0x00, 0x13, 0x0e, 0xe0, 0x00, 0x00, 0x00, 0x00, 0x00},
+		"smb":   {0x00, 0x00, 0x00, 0x54, 0xff, 'S', 'M', 'B', 0x72},
+		"redis": []byte("*1\r\n$4\r\nPING\r\n"),
+		"":      []byte("\x00\x01garbage"),
+	}
+
+	for expected, payload := range tests {
+		if protocol := Detect(payload); protocol != expected {
+			t.Errorf("Expected %q, got %q for %q", expected, protocol, payload)
+		}
+	}
+}
@@ -34,6 +34,7 @@ import (
 	"io"
 	"net"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/director"
 	"github.com/honeytrap/honeytrap/listener"
 	"github.com/honeytrap/honeytrap/pushers"
@@ -41,6 +42,10 @@ import (
 
 var (
 	_ = Register("dns-proxy", DNSProxy)
+	_ = Describe("dns-proxy", config.Description{
+		Description: "Proxies dns queries to the director",
+		Port:        "UDP/53",
+	})
 )
 
 // Dns is a placeholder
@@ -98,7 +103,7 @@ func (s *dnsProxy) Handle(conn net.Conn) error {
 		}
 
 		return err
-	} else if _, ok := conn.(*net.TCPConn); ok {
+	} else if _, ok := conn.LocalAddr().(*net.TCPAddr); ok {
 		conn2, err := s.d.Dial(conn)
 		if err != nil {
 			return err
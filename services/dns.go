@@ -35,11 +35,16 @@ import (
 	"net"
 	"os"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/pushers"
 )
 
 var (
 	_ = Register("dns", DNS)
+	_ = Describe("dns", config.Description{
+		Description: "Prints the received dns requests",
+		Port:        "UDP/53",
+	})
 )
 
 // Dns is a placeholder
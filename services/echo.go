@@ -34,6 +34,7 @@ import (
 	"io"
 	"net"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/listener"
 	"github.com/honeytrap/honeytrap/pushers"
@@ -41,6 +42,10 @@ import (
 
 var (
 	_ = Register("echo", Echo)
+	_ = Describe("echo", config.Description{
+		Description: "Echoes all received data back",
+		Port:        "TCP/7",
+	})
 )
 
 // Echo is a placeholder
@@ -37,6 +37,7 @@ import (
 	"net"
 	"net/http"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/director"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
@@ -44,6 +45,10 @@ import (
 
 var (
 	_ = Register("http-proxy", HTTPProxy)
+	_ = Describe("http-proxy", config.Description{
+		Description: "Proxies http requests to the director",
+		Port:        "TCP/80",
+	})
 )
 
 // HTTP
@@ -105,13 +110,14 @@ func (s *httpProxy) Handle(conn net.Conn) error {
 			SensorLow,
 			event.Service("http-proxy"),
 			event.Category("http"),
-			event.Custom("method", req.Method),
-			event.Custom("host", req.Host),
-			event.Custom("user-agent", req.UserAgent()),
-			event.Custom("referer", req.Referer()),
-			event.Custom("url", req.URL.String()),
-			event.Custom("content-length", req.ContentLength),
-			event.RemoteAddr(conn.RemoteAddr().String()),
+			event.Custom("http.method", req.Method),
+			event.Custom("http.host", req.Host),
+			event.Custom("http.user-agent", req.UserAgent()),
+			event.Custom("http.referer", req.Referer()),
+			event.Custom("http.url", req.URL.String()),
+			event.Custom("http.content-length", req.ContentLength),
+			event.SourceAddr(conn.RemoteAddr()),
+			event.DestinationAddr(conn.LocalAddr()),
 			event.Payload(reqBody.Bytes()),
 		))
 
@@ -133,3 +139,7 @@ func (s *httpProxy) Handle(conn net.Conn) error {
 		}
 	}
 }
+
+func (s *httpProxy) CanHandle(payload []byte) bool {
+	return IsHTTP(payload)
+}
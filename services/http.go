@@ -36,20 +36,32 @@ import (
 	"net"
 	"net/http"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 )
 
 var (
 	_ = Register("http", HTTP)
+	_ = Describe("http", config.Description{
+		Description: "Web server logging the requests",
+		Port:        "TCP/80",
+		Config: func() interface{} {
+			c := defaultHTTPConfig
+			return &c
+		},
+	})
 )
 
+// defaultHTTPConfig contains the defaults of the http service.
+var defaultHTTPConfig = httpServiceConfig{
+	Server: "Apache",
+}
+
 // Http is a placeholder
 func HTTP(options ...ServicerFunc) Servicer {
 	s := &httpService{
-		httpServiceConfig: httpServiceConfig{
-			Server: "Apache",
-		},
+		httpServiceConfig: defaultHTTPConfig,
 	}
 
 	for _, o := range options {
@@ -60,7 +72,7 @@ func HTTP(options ...ServicerFunc) Servicer {
 }
 
 type httpServiceConfig struct {
-	Server string `toml:"server"`
+	Server string `toml:"server" doc:"Value of the Server header"`
 }
 
 type httpService struct {
@@ -73,6 +85,10 @@ func (s *httpService) SetChannel(c pushers.Channel) {
 	s.c = c
 }
 
+func (s *httpService) CanHandle(payload []byte) bool {
+	return IsHTTP(payload)
+}
+
 func (s *httpService) Handle(conn net.Conn) error {
 	for {
 		br := bufio.NewReader(conn)
@@ -31,22 +31,18 @@
 package services
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/tls"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"fmt"
-	"math/big"
 	"net"
-	"sync"
-	"time"
 
-	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/config"
 )
 
 var (
 	_ = Register("https", HTTPS)
+	_ = Describe("https", config.Description{
+		Description: "Web server over tls, with generated certificates",
+		Port:        "TCP/443",
+	})
 )
 
 func HTTPS(options ...ServicerFunc) Servicer {
@@ -56,10 +52,7 @@ func HTTPS(options ...ServicerFunc) Servicer {
 				Server: "Apache",
 			},
 		},
-		tlsConfig: &tls.Config{},
-		n:         0,
-		m:         sync.Mutex{},
-		cache:     map[string]*tls.Certificate{},
+		certificateCache: newCertificateCache(),
 	}
 
 	for _, o := range options {
@@ -72,80 +65,11 @@ func HTTPS(options ...ServicerFunc) Servicer {
 type httpsService struct {
 	httpService
 
-	tlsConfig *tls.Config
-
-	c pushers.Channel
-
-	n int64
-
-	m sync.Mutex
-
-	cache map[string]*tls.Certificate
-}
-
-func (s *httpsService) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
-	s.m.Lock()
-	defer s.m.Unlock()
-
-	if cert, ok := s.cache[hello.ServerName]; ok {
-		return cert, nil
-	}
-
-	s.n++
-
-	ca := &x509.Certificate{
-		SerialNumber: big.NewInt(s.n),
-		Subject: pkix.Name{
-			Country:            []string{""},
-			Organization:       []string{""},
-			OrganizationalUnit: []string{""},
-		},
-		Issuer: pkix.Name{
-			Country:            []string{""},
-			Organization:       []string{""},
-			OrganizationalUnit: []string{""},
-			Locality:           []string{""},
-			Province:           []string{""},
-			StreetAddress:      []string{""},
-			PostalCode:         []string{""},
-			SerialNumber:       fmt.Sprintf("%d", 0),
-			CommonName:         hello.ServerName,
-		},
-		SignatureAlgorithm:    x509.SHA512WithRSA,
-		PublicKeyAlgorithm:    x509.ECDSA,
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(1, 0, 0),
-		SubjectKeyId:          []byte{},
-		BasicConstraintsValid: true,
-		IsCA:        false,
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-	}
-
-	priv, _ := rsa.GenerateKey(rand.Reader, 4096)
-
-	pub := &priv.PublicKey
-
-	ca_b, err := x509.CreateCertificate(rand.Reader, ca, ca, pub, priv)
-	if err != nil {
-		return nil, err
-	}
-
-	cert := &tls.Certificate{
-		Certificate: [][]byte{ca_b},
-		PrivateKey:  priv,
-	}
-
-	s.cache[hello.ServerName] = cert
-
-	return cert, nil
+	*certificateCache
 }
 
 func (s *httpsService) Handle(conn net.Conn) error {
-	tlsConn := tls.Server(conn, &tls.Config{
-		Certificates:   []tls.Certificate{},
-		GetCertificate: s.getCertificate,
-	})
+	tlsConn := tls.Server(conn, s.tlsConfig())
 
 	if err := tlsConn.Handshake(); err != nil {
 		return err
@@ -153,3 +77,7 @@ func (s *httpsService) Handle(conn net.Conn) error {
 
 	return s.httpService.Handle(tlsConn)
 }
+
+func (s *httpsService) CanHandle(payload []byte) bool {
+	return IsTLS(payload)
+}
@@ -0,0 +1,574 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+/*
+Configuration
+
+[service.imap]
+type="imap"
+port="tcp/143"
+greeting="Dovecot ready."
+tls="starttls"
+credentials=["info:info"]
+mailbox=["/var/lib/honeytrap/inbox.mbox"]
+
+[service.imaps]
+type="imap"
+port="tcp/993"
+tls="implicit"
+*/
+
+var (
+	_ = Register("imap", IMAP)
+	_ = Describe("imap", config.Description{
+		Description: "IMAP server capturing credentials and serving configured mailboxes",
+		Port:        "TCP/143",
+		Config: func() interface{} {
+			c := defaultIMAPConfig
+			return &c
+		},
+	})
+)
+
+// defaultIMAPConfig contains the defaults of the imap service.
+var defaultIMAPConfig = mailServiceConfig{
+	Greeting: "Dovecot ready.",
+	TLS:      "starttls",
+}
+
+// IMAP returns an imap service which captures LOGIN and AUTHENTICATE PLAIN
+// credentials, and optionally serves a fake mailbox after a successful
+// login.
+func IMAP(options ...ServicerFunc) Servicer {
+	s := &imapService{
+		mailServiceConfig: defaultIMAPConfig,
+		certificateCache:  newCertificateCache(),
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	s.mailbox = s.loadMailbox()
+
+	return s
+}
+
+type imapService struct {
+	mailServiceConfig
+
+	*certificateCache
+
+	c pushers.Channel
+
+	mailbox *mailbox
+}
+
+func (s *imapService) SetChannel(c pushers.Channel) {
+	s.c = c
+}
+
+var (
+	imapLiteral = regexp.MustCompile(`\{(\d+)(\+?)\}$`)
+
+	errIMAPLiteralTooLarge = errors.New("imap: literal too large")
+	errIMAPCommandTooLarge = errors.New("imap: command too large")
+)
+
+type imapSession struct {
+	*imapService
+
+	conn net.Conn
+	br   *bufio.Reader
+
+	tls bool
+
+	user string
+
+	authenticated bool
+	selected      bool
+}
+
+func (s *imapSession) send(options ...event.Option) {
+	s.c.Send(event.New(
+		EventOptions,
+		event.Category("imap"),
+		event.Protocol("imap"),
+		event.SourceAddr(s.conn.RemoteAddr()),
+		event.DestinationAddr(s.conn.LocalAddr()),
+		event.Custom("imap.tls", s.tls),
+		event.NewWith(options...),
+	))
+}
+
+func (s *imapSession) writeLine(format string, a ...interface{}) error {
+	_, err := fmt.Fprintf(s.conn, format+"\r\n", a...)
+	return err
+}
+
+func (s *imapSession) capabilities() string {
+	capabilities := "IMAP4rev1 LITERAL+ SASL-IR ID IDLE AUTH=PLAIN"
+	if s.TLS == "starttls" && !s.tls {
+		capabilities += " STARTTLS"
+	}
+
+	return capabilities
+}
+
+// tokenize splits an imap command line in atoms and quoted strings.
+func tokenize(line string) []string {
+	tokens := []string{}
+
+	token := bytes.Buffer{}
+	quoted, escaped, inToken := false, false, false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			token.WriteRune(r)
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+			inToken = true
+		case !quoted && r == ' ':
+			if inToken {
+				tokens = append(tokens, token.String())
+			}
+
+			token.Reset()
+			inToken = false
+		default:
+			token.WriteRune(r)
+			inToken = true
+		}
+	}
+
+	if inToken {
+		tokens = append(tokens, token.String())
+	}
+
+	return tokens
+}
+
+// maxIMAPCommand is the maximum size of a command, including its literals.
+const maxIMAPCommand = 256 * 1024
+
+// readCommand reads a command, including the literals it contains.
+func (s *imapSession) readCommand() ([]string, error) {
+	tokens := []string{}
+
+	size := 0
+
+	for {
+		line, err := readLine(s.br)
+		if err != nil {
+			return nil, err
+		}
+
+		size += len(line)
+		if size > maxIMAPCommand {
+			return nil, errIMAPCommandTooLarge
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		match := imapLiteral.FindStringSubmatchIndex(line)
+		if match == nil {
+			return append(tokens, tokenize(line)...), nil
+		}
+
+		n, err := strconv.Atoi(line[match[2]:match[3]])
+		if err != nil || n > 64*1024 {
+			return nil, errIMAPLiteralTooLarge
+		}
+
+		size += n
+		if size > maxIMAPCommand {
+			return nil, errIMAPCommandTooLarge
+		}
+
+		tokens = append(tokens, tokenize(line[:match[0]])...)
+
+		// non synchronizing literals (LITERAL+) don't need continuation
+		if match[4] == match[5] {
+			if err := s.writeLine("+ Ready for literal data"); err != nil {
+				return nil, err
+			}
+		}
+
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(s.br, literal); err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, string(literal))
+	}
+}
+
+func (s *imapSession) login(tag, mechanism, username, password string) error {
+	s.user = username
+	s.authenticated = s.Credentials.valid(username, password)
+
+	s.send(
+		event.Type("login"),
+		event.Custom("imap.mechanism", mechanism),
+		event.Custom("imap.username", username),
+		event.Custom("imap.password", password),
+		event.Custom("imap.authenticated", s.authenticated),
+	)
+
+	if !s.authenticated {
+		return s.writeLine("%s NO [AUTHENTICATIONFAILED] Authentication failed.", tag)
+	}
+
+	return s.writeLine("%s OK [CAPABILITY %s] Logged in", tag, s.capabilities())
+}
+
+// sequence returns the message numbers of an imap sequence set, eg. 1:*
+// or 1,3:4.
+func (s *imapSession) sequence(set string) []int {
+	count := len(s.mailbox.messages)
+
+	number := func(v string) int {
+		if v == "*" {
+			return count
+		}
+
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+
+	numbers := []int{}
+	for _, r := range strings.Split(set, ",") {
+		parts := strings.SplitN(r, ":", 2)
+
+		from, to := number(parts[0]), number(parts[0])
+		if len(parts) == 2 {
+			to = number(parts[1])
+		}
+
+		if from > to {
+			from, to = to, from
+		}
+
+		for i := from; i <= to && i <= count; i++ {
+			if i >= 1 {
+				numbers = append(numbers, i)
+			}
+		}
+	}
+
+	return numbers
+}
+
+func (s *imapSession) fetch(tag string, uid bool, args []string) error {
+	if len(args) < 2 {
+		return s.writeLine("%s BAD Invalid arguments.", tag)
+	}
+
+	items := strings.ToUpper(strings.Join(args[1:], " "))
+
+	s.send(
+		event.Type("fetch"),
+		event.Custom("imap.username", s.user),
+		event.Custom("imap.sequence", args[0]),
+		event.Custom("imap.items", items),
+	)
+
+	for _, i := range s.sequence(args[0]) {
+		m := s.mailbox.messages[i-1]
+
+		header := m
+		if j := bytes.Index(m, []byte("\r\n\r\n")); j >= 0 {
+			header = m[:j+4]
+		}
+
+		parts := []string{}
+		if uid || strings.Contains(items, "UID") {
+			parts = append(parts, fmt.Sprintf("UID %d", i))
+		}
+
+		if strings.Contains(items, "FLAGS") || strings.Contains(items, "ALL") || strings.Contains(items, "FAST") {
+			parts = append(parts, `FLAGS (\Seen)`)
+		}
+
+		if strings.Contains(items, "RFC822.SIZE") || strings.Contains(items, "ALL") || strings.Contains(items, "FAST") {
+			parts = append(parts, fmt.Sprintf("RFC822.SIZE %d", len(m)))
+		}
+
+		if strings.Contains(items, "HEADER") {
+			parts = append(parts, fmt.Sprintf("BODY[HEADER] {%d}\r\n%s", len(header), header))
+		} else if strings.Contains(items, "BODY[]") || strings.Contains(items, "BODY.PEEK[]") || strings.Contains(items, "RFC822") && !strings.Contains(items, "RFC822.SIZE") {
+			parts = append(parts, fmt.Sprintf("BODY[] {%d}\r\n%s", len(m), m))
+		}
+
+		if err := s.writeLine("* %d FETCH (%s)", i, strings.Join(parts, " ")); err != nil {
+			return err
+		}
+	}
+
+	return s.writeLine("%s OK Fetch completed.", tag)
+}
+
+func (s *imapSession) authenticatedCommand(tag, command string, args []string) error {
+	count := len(s.mailbox.messages)
+
+	switch command {
+	case "LIST", "LSUB":
+		if err := s.writeLine(`* %s (\HasNoChildren) "." INBOX`, command); err != nil {
+			return err
+		}
+
+		return s.writeLine("%s OK %s completed.", tag, command)
+	case "SELECT", "EXAMINE":
+		if len(args) < 1 || strings.ToUpper(args[0]) != "INBOX" {
+			return s.writeLine("%s NO Mailbox doesn't exist.", tag)
+		}
+
+		s.selected = true
+
+		lines := []string{
+			`* FLAGS (\Answered \Flagged \Deleted \Seen \Draft)`,
+			fmt.Sprintf("* %d EXISTS", count),
+			"* 0 RECENT",
+			"* OK [UIDVALIDITY 1] UIDs valid",
+			fmt.Sprintf("* OK [UIDNEXT %d] Predicted next UID", count+1),
+		}
+
+		for _, line := range lines {
+			if err := s.writeLine(line); err != nil {
+				return err
+			}
+		}
+
+		return s.writeLine("%s OK [READ-WRITE] %s completed.", tag, command)
+	case "STATUS":
+		if err := s.writeLine("* STATUS INBOX (MESSAGES %d RECENT 0 UIDNEXT %d UIDVALIDITY 1 UNSEEN 0)", count, count+1); err != nil {
+			return err
+		}
+
+		return s.writeLine("%s OK Status completed.", tag)
+	case "CLOSE", "EXPUNGE", "CHECK", "STORE", "SUBSCRIBE", "UNSUBSCRIBE":
+		return s.writeLine("%s OK %s completed.", tag, command)
+	}
+
+	if !s.selected {
+		return s.writeLine("%s BAD No mailbox selected.", tag)
+	}
+
+	switch command {
+	case "FETCH":
+		return s.fetch(tag, false, args)
+	case "SEARCH":
+		numbers := []string{}
+		for i := 1; i <= count; i++ {
+			numbers = append(numbers, strconv.Itoa(i))
+		}
+
+		if err := s.writeLine("* SEARCH %s", strings.Join(numbers, " ")); err != nil {
+			return err
+		}
+
+		return s.writeLine("%s OK Search completed.", tag)
+	case "UID":
+		if len(args) < 1 {
+			return s.writeLine("%s BAD Invalid arguments.", tag)
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "FETCH":
+			return s.fetch(tag, true, args[1:])
+		case "SEARCH":
+			return s.authenticatedCommand(tag, "SEARCH", args[1:])
+		default:
+			return s.writeLine("%s OK UID completed.", tag)
+		}
+	default:
+		return s.writeLine("%s BAD Error in IMAP command received by server.", tag)
+	}
+}
+
+func (s *imapSession) serve() error {
+	for {
+		tokens, err := s.readCommand()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if len(tokens) < 2 {
+			if err := s.writeLine("* BAD Error in IMAP command received by server."); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		tag, command, args := tokens[0], strings.ToUpper(tokens[1]), tokens[2:]
+
+		switch command {
+		case "CAPABILITY":
+			if err = s.writeLine("* CAPABILITY %s", s.capabilities()); err == nil {
+				err = s.writeLine("%s OK Pre-login capabilities listed, post-login capabilities have more.", tag)
+			}
+		case "NOOP":
+			err = s.writeLine("%s OK NOOP completed.", tag)
+		case "ID":
+			if err = s.writeLine(`* ID ("name" "Dovecot")`); err == nil {
+				err = s.writeLine("%s OK ID completed.", tag)
+			}
+		case "LOGOUT":
+			if err = s.writeLine("* BYE Logging out"); err == nil {
+				err = s.writeLine("%s OK Logout completed.", tag)
+			}
+
+			return err
+		case "STARTTLS":
+			if s.TLS != "starttls" || s.tls {
+				err = s.writeLine("%s BAD TLS not available.", tag)
+				break
+			}
+
+			if err = s.writeLine("%s OK Begin TLS negotiation now.", tag); err != nil {
+				break
+			}
+
+			tlsConn := tls.Server(s.conn, s.tlsConfig())
+			if err = tlsConn.Handshake(); err != nil {
+				break
+			}
+
+			s.conn, s.br, s.tls = tlsConn, bufio.NewReader(tlsConn), true
+		case "LOGIN":
+			if len(args) < 2 {
+				err = s.writeLine("%s BAD Invalid arguments.", tag)
+				break
+			}
+
+			err = s.login(tag, "LOGIN", args[0], args[1])
+		case "AUTHENTICATE":
+			if len(args) < 1 || strings.ToUpper(args[0]) != "PLAIN" {
+				err = s.writeLine("%s NO Unsupported authentication mechanism.", tag)
+				break
+			}
+
+			response := ""
+			if len(args) > 1 {
+				response = args[1]
+			} else if err = s.writeLine("+ "); err != nil {
+				break
+			} else if response, err = readLine(s.br); err != nil {
+				break
+			}
+
+			if strings.TrimSpace(response) == "*" {
+				err = s.writeLine("%s BAD Authentication aborted by client.", tag)
+				break
+			}
+
+			username, password, ok := decodePlain(response)
+			if !ok {
+				err = s.writeLine("%s BAD Invalid base64 data.", tag)
+				break
+			}
+
+			err = s.login(tag, "PLAIN", username, password)
+		default:
+			if !s.authenticated {
+				err = s.writeLine("%s BAD Error in IMAP command received by server.", tag)
+				break
+			}
+
+			s.send(
+				event.Type("command"),
+				event.Custom("imap.username", s.user),
+				event.Custom("imap.command", strings.Join(tokens[1:], " ")),
+			)
+
+			err = s.authenticatedCommand(tag, command, args)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *imapService) Handle(conn net.Conn) error {
+	defer conn.Close()
+
+	session := &imapSession{
+		imapService: s,
+		conn:        conn,
+	}
+
+	if s.TLS == "implicit" {
+		tlsConn := tls.Server(conn, s.tlsConfig())
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+
+		session.conn, session.tls = tlsConn, true
+	}
+
+	session.br = bufio.NewReader(session.conn)
+
+	session.send(
+		event.Type("connect"),
+	)
+
+	if err := session.writeLine("* OK [CAPABILITY %s] %s", session.capabilities(), s.Greeting); err != nil {
+		return err
+	}
+
+	return session.serve()
+}
@@ -0,0 +1,125 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package services
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+func TestIMAPLogin(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	s := IMAP(
+		WithChannel(pushers.MustDummy()),
+	).(*imapService)
+
+	s.Credentials = mailCredentials{"info:sec ret"}
+
+	go s.Handle(server)
+
+	br := bufio.NewReader(client)
+
+	plain := base64.StdEncoding.EncodeToString([]byte("\x00info\x00sec ret"))
+
+	steps := []struct {
+		Command  string
+		Expected string
+	}{
+		{"", "* OK [CAPABILITY IMAP4rev1"},
+		{`a1 LOGIN info "wrong"`, "a1 NO [AUTHENTICATIONFAILED]"},
+		{"a2 LOGIN info {7+}\r\nsec ret", "a2 OK [CAPABILITY"},
+		{"a3 AUTHENTICATE PLAIN " + plain, "a3 OK [CAPABILITY"},
+		{"a4 SELECT INBOX", "* FLAGS"},
+		{"", "* 0 EXISTS"},
+		{"", "* 0 RECENT"},
+		{"", "* OK [UIDVALIDITY 1]"},
+		{"", "* OK [UIDNEXT 1]"},
+		{"", "a4 OK [READ-WRITE]"},
+		{"a5 LOGOUT", "* BYE"},
+	}
+
+	for _, step := range steps {
+		if step.Command != "" {
+			go client.Write([]byte(step.Command + "\r\n"))
+		}
+
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(line, step.Expected) {
+			t.Fatalf("%s: expected %q, got %q", step.Command, step.Expected, line)
+		}
+	}
+}
+
+func TestIMAPCommandTooLarge(t *testing.T) {
+	literals := "a1 LOGIN"
+	for i := 0; i < 5; i++ {
+		literals += " {60000+}\r\n" + strings.Repeat("x", 60000)
+	}
+
+	for name, command := range map[string]string{
+		"long line": "a1 LOGIN " + strings.Repeat("x", 10000),
+		"literals":  literals,
+	} {
+		server, client := net.Pipe()
+
+		s := IMAP(
+			WithChannel(pushers.MustDummy()),
+		).(*imapService)
+
+		go s.Handle(server)
+
+		br := bufio.NewReader(client)
+
+		if _, err := br.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+
+		go client.Write([]byte(command + "\r\n"))
+
+		// the connection is closed without a response
+		if line, err := br.ReadString('\n'); err == nil {
+			t.Errorf("%s: expected connection to be closed, got %q", name, line)
+		}
+
+		client.Close()
+	}
+}
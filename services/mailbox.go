@@ -0,0 +1,205 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+)
+
+// maxMailLine is the maximum length of a command line of the imap and pop3
+// services, longer lines close the connection.
+const maxMailLine = 8 * 1024
+
+var errMailLineTooLong = errors.New("line too long")
+
+// readLine reads a line, including the line ending, of at most maxMailLine
+// bytes.
+func readLine(br *bufio.Reader) (string, error) {
+	line := []byte{}
+
+	for {
+		b, err := br.ReadSlice('\n')
+
+		line = append(line, b...)
+		if len(line) > maxMailLine {
+			return "", errMailLineTooLong
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		return string(line), err
+	}
+}
+
+// mailbox contains the messages of a fake mailbox, served by the imap and
+// pop3 services after a successful login.
+type mailbox struct {
+	messages [][]byte
+}
+
+// loadMbox loads the messages of the mbox files at paths, with line endings
+// converted to CRLF.
+func loadMbox(paths ...string) (*mailbox, error) {
+	mb := &mailbox{}
+
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+
+		var message *bytes.Buffer
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+		for scanner.Scan() {
+			line := strings.TrimRight(scanner.Text(), "\r")
+
+			if strings.HasPrefix(line, "From ") {
+				if message != nil {
+					mb.messages = append(mb.messages, message.Bytes())
+				}
+
+				message = &bytes.Buffer{}
+				continue
+			} else if message == nil {
+				continue
+			}
+
+			// unescape mboxrd quoting
+			if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+				line = line[1:]
+			}
+
+			message.WriteString(line)
+			message.WriteString("\r\n")
+		}
+
+		if message != nil {
+			mb.messages = append(mb.messages, message.Bytes())
+		}
+
+		err = scanner.Err()
+		f.Close()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mb, nil
+}
+
+// size returns the total size of all messages.
+func (mb *mailbox) size() int {
+	n := 0
+	for _, m := range mb.messages {
+		n += len(m)
+	}
+
+	return n
+}
+
+// mailCredentials contains the configured user:password credentials that are
+// allowed to login to the fake mailbox.
+type mailCredentials []string
+
+func (c mailCredentials) password(username string) (string, bool) {
+	for _, credential := range c {
+		parts := strings.SplitN(credential, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		if parts[0] == username {
+			return parts[1], true
+		}
+	}
+
+	return "", false
+}
+
+func (c mailCredentials) valid(username, password string) bool {
+	p, ok := c.password(username)
+	return ok && p == password
+}
+
+// decodePlain decodes a SASL PLAIN response (RFC 4616).
+func decodePlain(s string) (string, string, bool) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return "", "", false
+	}
+
+	parts := strings.Split(string(data), "\x00")
+	if len(parts) != 3 {
+		return "", "", false
+	}
+
+	return parts[1], parts[2], true
+}
+
+// mailServiceConfig contains the configuration shared by the imap and pop3
+// services.
+type mailServiceConfig struct {
+	Greeting string `toml:"greeting" doc:"Greeting sent on connect"`
+
+	// TLS is one of none, starttls or implicit.
+	TLS string `toml:"tls" doc:"One of none, starttls or implicit"`
+
+	Credentials mailCredentials `toml:"credentials" doc:"Accepted credentials as user:password"`
+
+	// Mailbox contains the mbox files which will be served after a
+	// successful login.
+	Mailbox []string `toml:"mailbox" doc:"Mbox files served after login"`
+}
+
+func (c *mailServiceConfig) loadMailbox() *mailbox {
+	if len(c.Mailbox) == 0 {
+		return &mailbox{}
+	}
+
+	mb, err := loadMbox(c.Mailbox...)
+	if err != nil {
+		log.Errorf("Could not load mailbox: %s", err.Error())
+		return &mailbox{}
+	}
+
+	return mb
+}
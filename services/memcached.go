@@ -0,0 +1,694 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/listener"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+/*
+Configuration
+
+[service.memcached]
+type="memcached"
+port="udp/11211"
+version="1.4.25"
+max-response-size=1400
+response-factor=1
+max-responses=10
+seed-size=65536
+amplification-interval="1m"
+amplification-threshold=100
+*/
+
+var (
+	_ = Register("memcached", Memcached)
+	_ = Describe("memcached", config.Description{
+		Description: "Memcached server detecting amplification attacks",
+		Port:        "UDP/11211",
+		Config: func() interface{} {
+			c := defaultMemcachedConfig
+			return &c
+		},
+	})
+)
+
+// defaultMemcachedConfig contains the defaults of the memcached service.
+var defaultMemcachedConfig = memcachedServiceConfig{
+	Version:                "1.4.25",
+	MaxItemSize:            1024 * 1024,
+	MaxStoreSize:           64 * 1024 * 1024,
+	MaxResponseSize:        1400,
+	ResponseFactor:         1,
+	MaxResponses:           10,
+	SeedSize:               64 * 1024,
+	AmplificationInterval:  config.Delay(time.Minute),
+	AmplificationThreshold: 100,
+}
+
+// Memcached returns a memcached service, which supports the text protocol
+// over tcp and udp. Udp traffic is aggregated per (possibly spoofed) source
+// to detect reflection attacks. Udp responses are capped to the size of the
+// request, and the number of responses per source is limited, so the
+// service can't be abused as amplifier.
+func Memcached(options ...ServicerFunc) Servicer {
+	s := &memcachedService{
+		memcachedServiceConfig: defaultMemcachedConfig,
+
+		items:       map[string]memcachedItem{},
+		reflections: map[string]*memcachedReflection{},
+		started:     time.Now(),
+		done:        make(chan struct{}),
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+type memcachedServiceConfig struct {
+	Version string `toml:"version" doc:"Version reported by the server"`
+
+	MaxItemSize  int `toml:"max-item-size" doc:"Maximum size of a stored item"`
+	MaxStoreSize int `toml:"max-store-size" doc:"Maximum size of all stored items"`
+
+	// MaxResponseSize caps the size of udp responses, which are capped to
+	// ResponseFactor times the size of the request as well
+	MaxResponseSize int `toml:"max-response-size" doc:"Maximum size of udp responses"`
+	ResponseFactor  int `toml:"response-factor" doc:"Maximum size of udp responses, relative to the size of the request"`
+
+	// MaxResponses is the number of udp responses per source within the
+	// amplification interval, requests above it are dropped.
+	MaxResponses int `toml:"max-responses" doc:"Maximum of udp responses per source within the amplification interval"`
+
+	// SeedSize is the value size from which a stored value is reported as
+	// seeded for amplification.
+	SeedSize int `toml:"seed-size" doc:"Size from which stored values are reported as seeded"`
+
+	AmplificationInterval  config.Delay `toml:"amplification-interval" doc:"Interval of amplification reports per source"`
+	AmplificationThreshold int          `toml:"amplification-threshold" doc:"Number of udp requests within the interval from which a source is reported"`
+}
+
+type memcachedItem struct {
+	flags uint32
+	data  []byte
+}
+
+// memcachedReflection aggregates udp requests of a single target.
+type memcachedReflection struct {
+	first time.Time
+	last  time.Time
+
+	requests int
+
+	// responses is the number of responses sent, dropped the number of
+	// requests exceeding max-responses
+	responses int
+	dropped   int
+
+	// requested contains the size of the uncapped responses, sent the size
+	// of the responses actually sent.
+	requested int
+	sent      int
+
+	received int
+
+	commands map[string]int
+}
+
+type memcachedService struct {
+	memcachedServiceConfig
+
+	c pushers.Channel
+
+	m     sync.Mutex
+	items map[string]memcachedItem
+	size  int
+
+	reflections map[string]*memcachedReflection
+
+	started time.Time
+
+	// the flush loop is started by the first udp request
+	flushing sync.Once
+	done     chan struct{}
+	closing  sync.Once
+}
+
+func (s *memcachedService) SetChannel(c pushers.Channel) {
+	s.c = c
+}
+
+// Close stops the flush loop.
+func (s *memcachedService) Close() error {
+	s.closing.Do(func() {
+		close(s.done)
+	})
+
+	return nil
+}
+
+// flush periodically emits the aggregated udp requests per target, for
+// targets exceeding the amplification threshold.
+func (s *memcachedService) flush() {
+	interval := s.AmplificationInterval.Duration()
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		s.m.Lock()
+		reflections := s.reflections
+		s.reflections = map[string]*memcachedReflection{}
+		s.m.Unlock()
+
+		for target, r := range reflections {
+			if r.requests < s.AmplificationThreshold {
+				continue
+			}
+
+			commands := []string{}
+			for command := range r.commands {
+				commands = append(commands, command)
+			}
+
+			sort.Strings(commands)
+
+			factor := 0.0
+			if r.received > 0 {
+				factor = float64(r.requested) / float64(r.received)
+			}
+
+			s.c.Send(event.New(
+				EventOptions,
+				event.Category("memcached"),
+				event.Type("amplification"),
+				event.SourceIP(net.ParseIP(target)),
+				event.Custom("memcached.requests", r.requests),
+				event.Custom("memcached.responses", r.responses),
+				event.Custom("memcached.dropped", r.dropped),
+				event.Custom("memcached.commands", strings.Join(commands, ",")),
+				event.Custom("memcached.received-bytes", r.received),
+				event.Custom("memcached.requested-bytes", r.requested),
+				event.Custom("memcached.sent-bytes", r.sent),
+				event.Custom("memcached.amplification-factor", factor),
+				event.Custom("memcached.first-seen", r.first),
+				event.Custom("memcached.last-seen", r.last),
+			))
+		}
+	}
+}
+
+// reflection returns the aggregated udp requests of the target, the lock
+// should be held.
+func (s *memcachedService) reflection(addr net.Addr) *memcachedReflection {
+	host, _, _ := net.SplitHostPort(addr.String())
+
+	r, ok := s.reflections[host]
+	if !ok {
+		r = &memcachedReflection{
+			first:    time.Now(),
+			commands: map[string]int{},
+		}
+
+		s.reflections[host] = r
+	}
+
+	return r
+}
+
+// allow counts the udp request of the target, it returns false when the
+// target exceeded max-responses within the amplification interval.
+func (s *memcachedService) allow(addr net.Addr, received int) bool {
+	s.flushing.Do(func() {
+		go s.flush()
+	})
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	r := s.reflection(addr)
+	r.last = time.Now()
+	r.requests++
+	r.received += received
+
+	if r.responses >= s.MaxResponses {
+		r.dropped++
+		return false
+	}
+
+	r.responses++
+	return true
+}
+
+func (s *memcachedService) track(addr net.Addr, command string, requested, sent int) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	r := s.reflection(addr)
+	r.requested += requested
+	r.sent += sent
+	r.commands[command]++
+}
+
+func (s *memcachedService) store(key string, item memcachedItem, mode string) string {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	current, exists := s.items[key]
+
+	switch mode {
+	case "add":
+		if exists {
+			return "NOT_STORED"
+		}
+	case "replace":
+		if !exists {
+			return "NOT_STORED"
+		}
+	case "append":
+		if !exists {
+			return "NOT_STORED"
+		}
+
+		item.flags, item.data = current.flags, append(append([]byte{}, current.data...), item.data...)
+	case "prepend":
+		if !exists {
+			return "NOT_STORED"
+		}
+
+		item.flags, item.data = current.flags, append(append([]byte{}, item.data...), current.data...)
+	}
+
+	if len(item.data) > s.MaxItemSize {
+		return "SERVER_ERROR object too large for cache"
+	}
+
+	if s.size-len(current.data)+len(item.data) > s.MaxStoreSize {
+		return "SERVER_ERROR out of memory storing object"
+	}
+
+	s.size += len(item.data) - len(current.data)
+	s.items[key] = item
+	return "STORED"
+}
+
+func (s *memcachedService) stats() []byte {
+	s.m.Lock()
+	count, size := len(s.items), s.size
+	s.m.Unlock()
+
+	buf := bytes.Buffer{}
+
+	stats := []struct {
+		Name  string
+		Value interface{}
+	}{
+		{"pid", os.Getpid()},
+		{"uptime", int(time.Since(s.started).Seconds())},
+		{"time", time.Now().Unix()},
+		{"version", s.Version},
+		{"libevent", "2.0.21-stable"},
+		{"pointer_size", 64},
+		{"curr_connections", 10},
+		{"total_connections", 1024},
+		{"cmd_get", 0},
+		{"cmd_set", count},
+		{"curr_items", count},
+		{"total_items", count},
+		{"bytes", size},
+		{"limit_maxbytes", s.MaxStoreSize},
+		{"threads", 4},
+	}
+
+	for _, stat := range stats {
+		fmt.Fprintf(&buf, "STAT %s %v\r\n", stat.Name, stat.Value)
+	}
+
+	buf.WriteString("END\r\n")
+	return buf.Bytes()
+}
+
+// execute executes a single command line, storage commands read their data
+// block from br. It returns the response, which can be empty.
+func (s *memcachedService) execute(line string, br *bufio.Reader) ([]byte, bool, error) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return []byte("ERROR\r\n"), false, nil
+	}
+
+	switch command := strings.ToLower(args[0]); command {
+	case "get", "gets":
+		buf := bytes.Buffer{}
+
+		s.m.Lock()
+		for _, key := range args[1:] {
+			item, ok := s.items[key]
+			if !ok {
+				continue
+			}
+
+			if command == "gets" {
+				fmt.Fprintf(&buf, "VALUE %s %d %d %d\r\n", key, item.flags, len(item.data), 1)
+			} else {
+				fmt.Fprintf(&buf, "VALUE %s %d %d\r\n", key, item.flags, len(item.data))
+			}
+
+			buf.Write(item.data)
+			buf.WriteString("\r\n")
+		}
+		s.m.Unlock()
+
+		buf.WriteString("END\r\n")
+		return buf.Bytes(), false, nil
+	case "set", "add", "replace", "append", "prepend", "cas":
+		if len(args) < 5 {
+			return []byte("ERROR\r\n"), false, nil
+		}
+
+		flags, err := strconv.ParseUint(args[2], 10, 32)
+		if err != nil {
+			return []byte("CLIENT_ERROR bad command line format\r\n"), false, nil
+		}
+
+		n, err := strconv.Atoi(args[4])
+		if err != nil || n < 0 {
+			return []byte("CLIENT_ERROR bad command line format\r\n"), false, nil
+		}
+
+		if n > s.MaxItemSize {
+			// swallow the data block
+			if _, err := io.CopyN(ioutil.Discard, br, int64(n)+2); err != nil {
+				return nil, true, err
+			}
+
+			return []byte("SERVER_ERROR object too large for cache\r\n"), false, nil
+		}
+
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, true, err
+		}
+
+		if command == "cas" {
+			command = "set"
+		}
+
+		result := s.store(args[1], memcachedItem{
+			flags: uint32(flags),
+			data:  data[:n],
+		}, command)
+
+		if args[len(args)-1] == "noreply" {
+			return nil, false, nil
+		}
+
+		return []byte(result + "\r\n"), false, nil
+	case "delete":
+		if len(args) < 2 {
+			return []byte("ERROR\r\n"), false, nil
+		}
+
+		s.m.Lock()
+		item, ok := s.items[args[1]]
+		if ok {
+			s.size -= len(item.data)
+			delete(s.items, args[1])
+		}
+		s.m.Unlock()
+
+		if ok {
+			return []byte("DELETED\r\n"), false, nil
+		}
+
+		return []byte("NOT_FOUND\r\n"), false, nil
+	case "incr", "decr":
+		if len(args) < 3 {
+			return []byte("ERROR\r\n"), false, nil
+		}
+
+		delta, err := strconv.ParseUint(args[2], 10, 64)
+		if err != nil {
+			return []byte("CLIENT_ERROR invalid numeric delta argument\r\n"), false, nil
+		}
+
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		item, ok := s.items[args[1]]
+		if !ok {
+			return []byte("NOT_FOUND\r\n"), false, nil
+		}
+
+		v, err := strconv.ParseUint(string(item.data), 10, 64)
+		if err != nil {
+			return []byte("CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"), false, nil
+		}
+
+		if command == "incr" {
+			v += delta
+		} else if delta > v {
+			v = 0
+		} else {
+			v -= delta
+		}
+
+		data := []byte(strconv.FormatUint(v, 10))
+		s.size += len(data) - len(item.data)
+		s.items[args[1]] = memcachedItem{flags: item.flags, data: data}
+		return []byte(string(data) + "\r\n"), false, nil
+	case "stats":
+		return s.stats(), false, nil
+	case "version":
+		return []byte("VERSION " + s.Version + "\r\n"), false, nil
+	case "flush_all":
+		s.m.Lock()
+		s.items = map[string]memcachedItem{}
+		s.size = 0
+		s.m.Unlock()
+
+		return []byte("OK\r\n"), false, nil
+	case "verbosity":
+		return []byte("OK\r\n"), false, nil
+	case "quit":
+		return nil, true, nil
+	default:
+		return []byte("ERROR\r\n"), false, nil
+	}
+}
+
+// seed returns the key and size of storage commands storing values of at
+// least seed-size.
+func (s *memcachedService) seed(line string) (string, int, bool) {
+	args := strings.Fields(line)
+	if len(args) < 5 {
+		return "", 0, false
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "set", "add", "replace", "append", "prepend", "cas":
+		if n, err := strconv.Atoi(args[4]); err == nil && n >= s.SeedSize {
+			return args[1], n, true
+		}
+	}
+
+	return "", 0, false
+}
+
+func (s *memcachedService) commandEvent(conn net.Conn, line string) {
+	options := []event.Option{
+		EventOptions,
+		event.Category("memcached"),
+		event.Type("command"),
+		event.SourceAddr(conn.RemoteAddr()),
+		event.DestinationAddr(conn.LocalAddr()),
+		event.Custom("memcached.command", line),
+	}
+
+	if key, n, ok := s.seed(line); ok {
+		options = append(options,
+			event.Type("seed"),
+			event.Custom("memcached.key", key),
+			event.Custom("memcached.size", n),
+		)
+	}
+
+	s.c.Send(event.New(options...))
+}
+
+func (s *memcachedService) handleUDP(conn net.Conn) error {
+	buf := [65535]byte{}
+
+	n, err := conn.Read(buf[:])
+	if err != nil {
+		return err
+	}
+
+	// frame header: request id, sequence number, number of datagrams
+	// and a reserved field.
+	if n < 8 {
+		return nil
+	}
+
+	header := buf[:8]
+
+	br := bufio.NewReader(bytes.NewReader(buf[8:n]))
+
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	line = strings.TrimSpace(line)
+
+	// the source of udp requests can be spoofed, only seeds are reported
+	// per request, other requests are aggregated per target
+	if _, _, ok := s.seed(line); ok {
+		s.commandEvent(conn, line)
+	}
+
+	if !s.allow(conn.RemoteAddr(), n) {
+		return nil
+	}
+
+	response, _, err := s.execute(line, br)
+	if err != nil {
+		return err
+	}
+
+	command := ""
+	if args := strings.Fields(line); len(args) > 0 {
+		command = strings.ToLower(args[0])
+	}
+
+	// responses, including their frame header, are never larger than the
+	// request times the response factor, so the service doesn't amplify
+	max := s.MaxResponseSize
+	if limit := s.ResponseFactor*n - len(header); limit < max {
+		max = limit
+	}
+
+	requested := len(response)
+	if len(response) > max {
+		response = response[:max]
+	}
+
+	s.track(conn.RemoteAddr(), command, requested, len(response))
+
+	if len(response) == 0 {
+		return nil
+	}
+
+	reply := make([]byte, 8, 8+len(response))
+	copy(reply, header[:2])
+	binary.BigEndian.PutUint16(reply[2:], 0)
+	binary.BigEndian.PutUint16(reply[4:], 1)
+
+	_, err = conn.Write(append(reply, response...))
+	return err
+}
+
+var memcachedCommands = map[string]bool{
+	"get": true, "gets": true, "set": true, "add": true, "replace": true,
+	"append": true, "prepend": true, "cas": true, "delete": true, "incr": true,
+	"decr": true, "stats": true, "version": true, "flush_all": true,
+}
+
+func (s *memcachedService) CanHandle(payload []byte) bool {
+	line := string(payload)
+	if i := strings.IndexAny(line, " \r\n"); i >= 0 {
+		line = line[:i]
+	}
+
+	return memcachedCommands[line]
+}
+
+func (s *memcachedService) Handle(conn net.Conn) error {
+	defer conn.Close()
+
+	if _, ok := conn.(*listener.DummyUDPConn); ok {
+		return s.handleUDP(conn)
+	}
+
+	br := bufio.NewReader(conn)
+
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+
+		s.commandEvent(conn, line)
+
+		response, quit, err := s.execute(line, br)
+		if err != nil {
+			return err
+		} else if quit {
+			return nil
+		}
+
+		if _, err := conn.Write(response); err != nil {
+			return err
+		}
+	}
+}
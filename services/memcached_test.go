@@ -0,0 +1,193 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/listener"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+func TestMemcachedSetGet(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	s := Memcached(
+		WithChannel(pushers.MustDummy()),
+	)
+
+	go s.Handle(server)
+
+	br := bufio.NewReader(client)
+
+	go client.Write([]byte("set key 0 0 5\r\nvalue\r\n"))
+
+	if line, err := br.ReadString('\n'); err != nil {
+		t.Fatal(err)
+	} else if line != "STORED\r\n" {
+		t.Fatalf("Expected STORED, got %q", line)
+	}
+
+	go client.Write([]byte("get key\r\n"))
+
+	expected := []string{"VALUE key 0 5\r\n", "value\r\n", "END\r\n"}
+	for _, e := range expected {
+		if line, err := br.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		} else if line != e {
+			t.Fatalf("Expected %q, got %q", e, line)
+		}
+	}
+}
+
+// events collects the events sent by a service.
+type events chan event.Event
+
+func (c events) Send(e event.Event) {
+	c <- e
+}
+
+// udpRequest sends the memcached udp request to s, and returns the
+// response or nil when no response has been sent.
+func udpRequest(t *testing.T, s Servicer, request string) []byte {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Close()
+
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	err = s.Handle(&listener.DummyUDPConn{
+		Buffer: append([]byte{0, 1, 0, 0, 0, 1, 0, 0}, request...),
+		Laddr:  server.LocalAddr().(*net.UDPAddr),
+		Raddr:  client.LocalAddr().(*net.UDPAddr),
+		C:      server,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+	buf := make([]byte, 65535)
+
+	n, _, err := client.ReadFromUDP(buf)
+	if err, ok := err.(net.Error); ok && err.Timeout() {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf[:n]
+}
+
+func TestMemcachedUDPResponseCapped(t *testing.T) {
+	s := Memcached(
+		WithChannel(pushers.MustDummy()),
+	).(*memcachedService)
+
+	defer s.Close()
+
+	s.store("amplify", memcachedItem{data: bytes.Repeat([]byte("A"), 10000)}, "set")
+
+	request := "get amplify\r\n"
+
+	// the response isn't larger than the request
+	if response := udpRequest(t, s, request); len(response) != 8+len(request) {
+		t.Errorf("Expected response of %d bytes, got %d", 8+len(request), len(response))
+	} else if !strings.HasPrefix(string(response[8:]), "VALUE amplify") {
+		t.Errorf("Unexpected response: %q", response[8:])
+	}
+
+	s.ResponseFactor = 100
+	s.MaxResponseSize = 100
+
+	if response := udpRequest(t, s, request); len(response) != 8+s.MaxResponseSize {
+		t.Errorf("Expected response of %d bytes, got %d", 8+s.MaxResponseSize, len(response))
+	}
+
+	if r := s.reflections["127.0.0.1"]; r == nil || r.requests != 2 || r.requested <= r.sent {
+		t.Errorf("Expected reflection to be tracked, got %+v", r)
+	}
+}
+
+func TestMemcachedUDPMaxResponses(t *testing.T) {
+	c := make(events, 10)
+
+	s := Memcached(
+		WithChannel(c),
+	).(*memcachedService)
+
+	defer s.Close()
+
+	s.MaxResponses = 2
+	s.SeedSize = 10
+
+	for i := 0; i < 2; i++ {
+		if response := udpRequest(t, s, "version\r\n"); response == nil {
+			t.Fatalf("Expected response to request %d", i)
+		}
+	}
+
+	if response := udpRequest(t, s, "version\r\n"); response != nil {
+		t.Errorf("Expected requests above max-responses to be dropped, got %q", response)
+	}
+
+	if r := s.reflections["127.0.0.1"]; r == nil || r.requests != 3 || r.dropped != 1 {
+		t.Errorf("Expected dropped request to be tracked, got %+v", r)
+	}
+
+	// seeds are reported over udp, even when dropped
+	udpRequest(t, s, "set amplify 0 0 20\r\n"+strings.Repeat("A", 20)+"\r\n")
+
+	select {
+	case e := <-c:
+		if e.Get("type") != "seed" || e.Get("memcached.key") != "amplify" {
+			t.Errorf("Expected seed event, got %v", event.ToMap(e))
+		}
+	default:
+		t.Error("Expected seed event")
+	}
+}
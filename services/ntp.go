@@ -35,11 +35,16 @@ import (
 	"net"
 	"os"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/pushers"
 )
 
 var (
 	_ = Register("ntp", NTP)
+	_ = Describe("ntp", config.Description{
+		Description: "Prints the received ntp requests",
+		Port:        "UDP/123",
+	})
 )
 
 // Ntp is a placeholder
@@ -0,0 +1,499 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+/*
+Configuration
+
+[service.pop3]
+type="pop3"
+port="tcp/110"
+greeting="Dovecot ready."
+tls="starttls"
+credentials=["info:info"]
+mailbox=["/var/lib/honeytrap/inbox.mbox"]
+
+[service.pop3s]
+type="pop3"
+port="tcp/995"
+tls="implicit"
+hostname="mail"
+*/
+
+var (
+	_ = Register("pop3", POP3)
+	_ = Describe("pop3", config.Description{
+		Description: "POP3 server capturing credentials and serving configured mailboxes",
+		Port:        "TCP/110",
+		Config: func() interface{} {
+			c := defaultPOP3Config
+			return &c
+		},
+	})
+)
+
+// defaultPOP3Config contains the defaults of the pop3 service.
+var defaultPOP3Config = pop3ServiceConfig{
+	mailServiceConfig: mailServiceConfig{
+		Greeting: "Dovecot ready.",
+		TLS:      "starttls",
+	},
+	Hostname: "mail",
+}
+
+// POP3 returns a pop3 service which captures USER/PASS, APOP and AUTH PLAIN
+// credentials, and optionally serves a fake mailbox after a successful
+// login.
+func POP3(options ...ServicerFunc) Servicer {
+	s := &pop3Service{
+		pop3ServiceConfig: defaultPOP3Config,
+		certificateCache:  newCertificateCache(),
+		pid:               1000 + rand.Intn(30000),
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	s.mailbox = s.loadMailbox()
+
+	return s
+}
+
+type pop3ServiceConfig struct {
+	mailServiceConfig
+
+	// Hostname is the hostname in the APOP timestamp, the hostname of the
+	// sensor would give the sensor away.
+	Hostname string `toml:"hostname" doc:"Hostname in the APOP timestamp"`
+}
+
+type pop3Service struct {
+	pop3ServiceConfig
+
+	*certificateCache
+
+	c pushers.Channel
+
+	mailbox *mailbox
+
+	// pid is the fake process id in the APOP timestamps
+	pid int
+}
+
+func (s *pop3Service) SetChannel(c pushers.Channel) {
+	s.c = c
+}
+
+type pop3Session struct {
+	*pop3Service
+
+	conn net.Conn
+	br   *bufio.Reader
+
+	tls bool
+
+	// timestamp is the APOP timestamp sent in the greeting
+	timestamp string
+
+	user string
+
+	authenticated bool
+	deleted       map[int]bool
+}
+
+func (s *pop3Session) send(options ...event.Option) {
+	s.c.Send(event.New(
+		EventOptions,
+		event.Category("pop3"),
+		event.Protocol("pop3"),
+		event.SourceAddr(s.conn.RemoteAddr()),
+		event.DestinationAddr(s.conn.LocalAddr()),
+		event.Custom("pop3.tls", s.tls),
+		event.NewWith(options...),
+	))
+}
+
+func (s *pop3Session) writeLine(format string, a ...interface{}) error {
+	_, err := fmt.Fprintf(s.conn, format+"\r\n", a...)
+	return err
+}
+
+func (s *pop3Session) login(mechanism, username, password string) error {
+	s.authenticated = s.Credentials.valid(username, password)
+
+	s.send(
+		event.Type("login"),
+		event.Custom("pop3.mechanism", mechanism),
+		event.Custom("pop3.username", username),
+		event.Custom("pop3.password", password),
+		event.Custom("pop3.authenticated", s.authenticated),
+	)
+
+	return s.result()
+}
+
+func (s *pop3Session) result() error {
+	if !s.authenticated {
+		return s.writeLine("-ERR [AUTH] Authentication failed.")
+	}
+
+	s.deleted = map[int]bool{}
+	return s.writeLine("+OK Logged in.")
+}
+
+// message returns the message with the 1-based index in arg.
+func (s *pop3Session) message(arg string) (int, []byte, bool) {
+	i, err := strconv.Atoi(arg)
+	if err != nil || i < 1 || i > len(s.mailbox.messages) || s.deleted[i] {
+		return 0, nil, false
+	}
+
+	return i, s.mailbox.messages[i-1], true
+}
+
+// writeMessage writes the dot-stuffed message, optionally limited to the
+// headers and the first lines of the body.
+func (s *pop3Session) writeMessage(data []byte, lines int) error {
+	buf := bytes.Buffer{}
+
+	body := false
+	for _, line := range strings.SplitAfter(string(data), "\r\n") {
+		if line == "" {
+			continue
+		}
+
+		if body && lines >= 0 {
+			if lines == 0 {
+				break
+			}
+
+			lines--
+		}
+
+		if line == "\r\n" {
+			body = true
+		}
+
+		if strings.HasPrefix(line, ".") {
+			buf.WriteString(".")
+		}
+
+		buf.WriteString(line)
+	}
+
+	buf.WriteString(".\r\n")
+
+	_, err := s.conn.Write(buf.Bytes())
+	return err
+}
+
+func (s *pop3Session) transaction(command string, args []string) error {
+	switch command {
+	case "STAT":
+		count, size := 0, 0
+		for i, m := range s.mailbox.messages {
+			if !s.deleted[i+1] {
+				count++
+				size += len(m)
+			}
+		}
+
+		return s.writeLine("+OK %d %d", count, size)
+	case "LIST", "UIDL":
+		value := func(i int, m []byte) string {
+			if command == "UIDL" {
+				return fmt.Sprintf("%08x", i)
+			}
+
+			return strconv.Itoa(len(m))
+		}
+
+		if len(args) > 0 {
+			i, m, ok := s.message(args[0])
+			if !ok {
+				return s.writeLine("-ERR There's no message %s.", args[0])
+			}
+
+			return s.writeLine("+OK %d %s", i, value(i, m))
+		}
+
+		buf := bytes.Buffer{}
+		buf.WriteString("+OK\r\n")
+
+		for i, m := range s.mailbox.messages {
+			if !s.deleted[i+1] {
+				fmt.Fprintf(&buf, "%d %s\r\n", i+1, value(i+1, m))
+			}
+		}
+
+		buf.WriteString(".\r\n")
+
+		_, err := s.conn.Write(buf.Bytes())
+		return err
+	case "RETR", "TOP":
+		if len(args) < 1 || (command == "TOP" && len(args) < 2) {
+			return s.writeLine("-ERR Invalid arguments.")
+		}
+
+		_, m, ok := s.message(args[0])
+		if !ok {
+			return s.writeLine("-ERR There's no message %s.", args[0])
+		}
+
+		lines := -1
+		if command == "TOP" {
+			if n, err := strconv.Atoi(args[1]); err == nil && n >= 0 {
+				lines = n
+			}
+		}
+
+		s.send(
+			event.Type("retrieve"),
+			event.Custom("pop3.username", s.user),
+			event.Custom("pop3.message", args[0]),
+		)
+
+		if err := s.writeLine("+OK %d octets", len(m)); err != nil {
+			return err
+		}
+
+		return s.writeMessage(m, lines)
+	case "DELE":
+		if len(args) < 1 {
+			return s.writeLine("-ERR Invalid arguments.")
+		}
+
+		i, _, ok := s.message(args[0])
+		if !ok {
+			return s.writeLine("-ERR There's no message %s.", args[0])
+		}
+
+		s.deleted[i] = true
+		return s.writeLine("+OK Marked to be deleted.")
+	case "RSET":
+		s.deleted = map[int]bool{}
+		return s.writeLine("+OK")
+	case "NOOP":
+		return s.writeLine("+OK")
+	default:
+		return s.writeLine("-ERR Unknown command.")
+	}
+}
+
+func (s *pop3Session) serve() error {
+	for {
+		line, err := readLine(s.br)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			if err := s.writeLine("-ERR Unknown command."); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		command := strings.ToUpper(args[0])
+		args = args[1:]
+
+		if command == "QUIT" {
+			return s.writeLine("+OK Logging out.")
+		} else if s.authenticated {
+			if err := s.transaction(command, args); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		switch command {
+		case "CAPA":
+			capabilities := []string{"+OK", "TOP", "UIDL", "USER", "RESP-CODES", "SASL PLAIN"}
+			if s.TLS == "starttls" && !s.tls {
+				capabilities = append(capabilities, "STLS")
+			}
+
+			err = s.writeLine("%s\r\n.", strings.Join(capabilities, "\r\n"))
+		case "STLS":
+			if s.TLS != "starttls" || s.tls {
+				err = s.writeLine("-ERR TLS not available.")
+				break
+			}
+
+			if err = s.writeLine("+OK Begin TLS negotiation now."); err != nil {
+				break
+			}
+
+			tlsConn := tls.Server(s.conn, s.tlsConfig())
+			if err = tlsConn.Handshake(); err != nil {
+				break
+			}
+
+			s.conn, s.br, s.tls = tlsConn, bufio.NewReader(tlsConn), true
+		case "USER":
+			if len(args) < 1 {
+				err = s.writeLine("-ERR Invalid arguments.")
+				break
+			}
+
+			s.user = args[0]
+			err = s.writeLine("+OK")
+		case "PASS":
+			if s.user == "" {
+				err = s.writeLine("-ERR No username given.")
+				break
+			}
+
+			// passwords can contain spaces
+			password := strings.TrimRight(line, "\r\n")
+			if i := strings.Index(password, " "); i >= 0 {
+				password = password[i+1:]
+			} else {
+				password = ""
+			}
+
+			err = s.login("USER", s.user, password)
+		case "APOP":
+			if len(args) < 2 {
+				err = s.writeLine("-ERR Invalid arguments.")
+				break
+			}
+
+			s.user = args[0]
+
+			if password, ok := s.Credentials.password(args[0]); ok {
+				sum := md5.Sum([]byte(s.timestamp + password))
+				s.authenticated = hex.EncodeToString(sum[:]) == strings.ToLower(args[1])
+			}
+
+			s.send(
+				event.Type("login"),
+				event.Custom("pop3.mechanism", "APOP"),
+				event.Custom("pop3.username", args[0]),
+				event.Custom("pop3.apop-timestamp", s.timestamp),
+				event.Custom("pop3.apop-digest", args[1]),
+				event.Custom("pop3.authenticated", s.authenticated),
+			)
+
+			err = s.result()
+		case "AUTH":
+			if len(args) == 0 {
+				err = s.writeLine("+OK\r\nPLAIN\r\n.")
+				break
+			} else if strings.ToUpper(args[0]) != "PLAIN" {
+				err = s.writeLine("-ERR Unsupported authentication mechanism.")
+				break
+			}
+
+			response := ""
+			if len(args) > 1 {
+				response = args[1]
+			} else if err = s.writeLine("+ "); err != nil {
+				break
+			} else if response, err = readLine(s.br); err != nil {
+				break
+			}
+
+			username, password, ok := decodePlain(response)
+			if !ok {
+				err = s.writeLine("-ERR Invalid base64 data.")
+				break
+			}
+
+			s.user = username
+			err = s.login("PLAIN", username, password)
+		case "NOOP":
+			err = s.writeLine("+OK")
+		default:
+			err = s.writeLine("-ERR Unknown command.")
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *pop3Service) Handle(conn net.Conn) error {
+	defer conn.Close()
+
+	session := &pop3Session{
+		pop3Service: s,
+		conn:        conn,
+		timestamp:   fmt.Sprintf("<%d.%d@%s>", s.pid, time.Now().UnixNano(), s.Hostname),
+	}
+
+	if s.TLS == "implicit" {
+		tlsConn := tls.Server(conn, s.tlsConfig())
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+
+		session.conn, session.tls = tlsConn, true
+	}
+
+	session.br = bufio.NewReader(session.conn)
+
+	session.send(
+		event.Type("connect"),
+	)
+
+	if err := session.writeLine("+OK %s %s", s.Greeting, session.timestamp); err != nil {
+		return err
+	}
+
+	return session.serve()
+}
@@ -0,0 +1,164 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package services
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+const testMbox = `From alice@example.com Thu Jan  1 00:00:00 2017
+From: alice@example.com
+Subject: test
+
+.hidden line
+>From the archive
+`
+
+func TestPOP3Retrieve(t *testing.T) {
+	f, err := ioutil.TempFile("", "mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(f.Name())
+
+	f.WriteString(testMbox)
+	f.Close()
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	s := POP3(
+		WithChannel(pushers.MustDummy()),
+	).(*pop3Service)
+
+	s.Credentials = mailCredentials{"info:secret"}
+	s.Mailbox = []string{f.Name()}
+	s.mailbox = s.loadMailbox()
+
+	go s.Handle(server)
+
+	br := bufio.NewReader(client)
+
+	steps := []struct {
+		Command  string
+		Expected string
+	}{
+		{"", "+OK Dovecot ready. <"},
+		{"USER info", "+OK"},
+		{"PASS wrong", "-ERR [AUTH] Authentication failed."},
+		{"PASS secret", "+OK Logged in."},
+		{"STAT", "+OK 1 "},
+		{"RETR 1", "+OK "},
+		{"", "From: alice@example.com"},
+		{"", "Subject: test"},
+		{"", ""},
+		{"", "..hidden line"},
+		{"", "From the archive"},
+		{"", "."},
+		{"QUIT", "+OK Logging out."},
+	}
+
+	for _, step := range steps {
+		if step.Command != "" {
+			go client.Write([]byte(step.Command + "\r\n"))
+		}
+
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if !strings.HasPrefix(line, step.Expected) || (step.Expected == "" && line != "") {
+			t.Fatalf("%s: expected %q, got %q", step.Command, step.Expected, line)
+		}
+	}
+}
+
+func TestPOP3Greeting(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := make(events, 10)
+
+	s := POP3(
+		WithChannel(c),
+	).(*pop3Service)
+
+	s.Hostname = "mx.example.com"
+
+	go s.Handle(server)
+
+	br := bufio.NewReader(client)
+
+	line, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the timestamp doesn't reveal the sensor
+	if !strings.HasSuffix(strings.TrimSpace(line), "@mx.example.com>") {
+		t.Errorf("Expected the configured hostname in the timestamp, got %q", line)
+	} else if name, _ := os.Hostname(); strings.Contains(line, "@"+name+">") {
+		t.Errorf("Expected the hostname of the sensor to be hidden, got %q", line)
+	}
+
+	go io.Copy(ioutil.Discard, br)
+	go client.Write([]byte("USER info\r\nPASS secret\r\n"))
+
+	for {
+		select {
+		case e := <-c:
+			if e.Get("type") != "login" {
+				continue
+			}
+
+			if tls, ok := e.GetBool("pop3.tls"); !ok || tls {
+				t.Errorf("Expected pop3.tls to be false, got %v", event.ToMap(e))
+			}
+
+			return
+		case <-time.After(time.Second):
+			t.Fatal("Expected login event")
+		}
+	}
+}
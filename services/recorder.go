@@ -0,0 +1,162 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package services
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+/*
+Example:
+
+[service.recorder]
+type="recorder"
+default=true
+banner="220 ready\r\n"
+max-size=65536
+timeout="10s"
+*/
+
+var (
+	_ = Register("recorder", Recorder)
+	_ = Describe("recorder", config.Description{
+		Description: "Records the payload of unknown protocols",
+		Config: func() interface{} {
+			c := defaultRecorderConfig
+			return &c
+		},
+	})
+)
+
+// defaultRecorderConfig contains the defaults of the recorder service.
+var defaultRecorderConfig = recorderServiceConfig{
+	MaxSize: 64 * 1024,
+	Timeout: config.Delay(10 * time.Second),
+}
+
+// Recorder returns a service recording everything the client sends, which
+// is useful as default service for connections no other service handles.
+// Sending a banner will provoke clients waiting for the server to speak first.
+func Recorder(options ...ServicerFunc) Servicer {
+	s := &recorderService{
+		recorderServiceConfig: defaultRecorderConfig,
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+type recorderServiceConfig struct {
+	Banner string `toml:"banner" doc:"Banner sent on connect"`
+
+	MaxSize int          `toml:"max-size" doc:"Maximum size of the recorded payload"`
+	Timeout config.Delay `toml:"timeout" doc:"Time to wait for the payload"`
+}
+
+type recorderService struct {
+	recorderServiceConfig
+
+	c pushers.Channel
+}
+
+func (s *recorderService) SetChannel(c pushers.Channel) {
+	s.c = c
+}
+
+func (s *recorderService) Handle(conn net.Conn) error {
+	return s.HandleContext(context.Background(), conn)
+}
+
+func (s *recorderService) HandleContext(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+
+	if s.Banner != "" {
+		if _, err := io.WriteString(conn, s.Banner); err != nil {
+			return err
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// interrupt pending reads when the session ends
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	start := time.Now()
+
+	payload := []byte{}
+
+	buf := make([]byte, 4096)
+	for len(payload) < s.MaxSize && ctx.Err() == nil {
+		conn.SetReadDeadline(time.Now().Add(s.Timeout.Duration()))
+
+		n, err := conn.Read(buf)
+		payload = append(payload, buf[:n]...)
+
+		if err != nil || n == 0 {
+			break
+		}
+	}
+
+	if len(payload) > s.MaxSize {
+		payload = payload[:s.MaxSize]
+	}
+
+	s.c.Send(event.New(
+		EventOptions,
+		event.Category("recorder"),
+		event.Type("payload"),
+		event.SourceAddr(conn.RemoteAddr()),
+		event.DestinationAddr(conn.LocalAddr()),
+		event.Custom("recorder.detected-protocol", Detect(payload)),
+		event.Custom("recorder.duration", time.Since(start).String()),
+		event.Custom("recorder.size", len(payload)),
+		event.Payload(payload),
+	))
+
+	return nil
+}
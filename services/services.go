@@ -34,6 +34,7 @@ import (
 	"net"
 
 	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/director"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
@@ -60,6 +61,32 @@ func Range(fn func(string)) {
 	}
 }
 
+var (
+	descriptions = map[string]config.Description{}
+)
+
+// Describe registers the description of the service, the description will
+// be used for listing, describing and validating services.
+func Describe(key string, d config.Description) config.Description {
+	d.Name = key
+	descriptions[key] = d
+	return d
+}
+
+// Description returns the description of the registered service.
+func Description(key string) (config.Description, bool) {
+	if _, ok := services[key]; !ok {
+		return config.Description{}, false
+	}
+
+	d, ok := descriptions[key]
+	if !ok {
+		d = config.Description{Name: key}
+	}
+
+	return d, true
+}
+
 func Get(key string) (func(...ServicerFunc) Servicer, bool) {
 	d := Dummy
 
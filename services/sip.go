@@ -0,0 +1,506 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/listener"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+/*
+Configuration
+
+[service.sip]
+type="sip"
+port="udp/5060"
+user-agent="Asterisk PBX 13.1.0"
+realm="asterisk"
+credentials=["100:100"]
+*/
+
+var (
+	_ = Register("sip", SIP)
+	_ = Describe("sip", config.Description{
+		Description: "SIP registrar capturing digest authentication and calls",
+		Port:        "UDP/5060",
+		Config: func() interface{} {
+			c := defaultSIPConfig
+			return &c
+		},
+	})
+)
+
+// defaultSIPConfig contains the defaults of the sip service.
+var defaultSIPConfig = sipServiceConfig{
+	UserAgent: "Asterisk PBX 13.1.0",
+	Realm:     "asterisk",
+}
+
+// SIP returns a SIP user agent server which answers OPTIONS, challenges
+// REGISTER and INVITE requests with digest authentication and reports the
+// captured credentials.
+func SIP(options ...ServicerFunc) Servicer {
+	s := &sipService{
+		sipServiceConfig: defaultSIPConfig,
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+type sipServiceConfig struct {
+	UserAgent string `toml:"user-agent" doc:"Value of the User-Agent header"`
+	Realm     string `toml:"realm" doc:"Realm of the digest challenge"`
+
+	Credentials []string `toml:"credentials" doc:"Accepted credentials as user:password"`
+}
+
+type sipService struct {
+	sipServiceConfig
+
+	c pushers.Channel
+}
+
+func (s *sipService) SetChannel(c pushers.Channel) {
+	s.c = c
+}
+
+// sipCompactHeaders maps the compact header forms of RFC 3261 section 7.3.3
+// to their long form.
+var sipCompactHeaders = map[string]string{
+	"I": "Call-Id",
+	"M": "Contact",
+	"E": "Content-Encoding",
+	"L": "Content-Length",
+	"C": "Content-Type",
+	"F": "From",
+	"S": "Subject",
+	"K": "Supported",
+	"T": "To",
+	"V": "Via",
+}
+
+// sipScanners contains user agent fragments of well known sip scanners and
+// the tool they belong to.
+var sipScanners = []struct {
+	Pattern string
+	Tool    string
+}{
+	{"friendly-scanner", "sipvicious"},
+	{"sipvicious", "sipvicious"},
+	{"sipcli", "sipcli"},
+	{"sip-scan", "sip-scan"},
+	{"sipsak", "sipsak"},
+	{"sundayddr", "sundayddr"},
+	{"iwar", "iwar"},
+	{"smap", "smap"},
+	{"vaxsipuseragent", "vaxsipuseragent"},
+	{"pplsip", "pplsip"},
+}
+
+var errSIPMalformed = errors.New("malformed sip message")
+
+type sipMessage struct {
+	Method string
+	URI    string
+	Proto  string
+
+	Header textproto.MIMEHeader
+
+	Body []byte
+}
+
+func readSIPMessage(br *bufio.Reader) (*sipMessage, error) {
+	tp := textproto.NewReader(br)
+
+	line, err := tp.ReadLine()
+	for err == nil && line == "" {
+		// skip keep-alive CRLFs
+		line, err = tp.ReadLine()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "SIP/") {
+		return nil, errSIPMalformed
+	}
+
+	msg := &sipMessage{
+		Method: strings.ToUpper(parts[0]),
+		URI:    parts[1],
+		Proto:  parts[2],
+		Header: textproto.MIMEHeader{},
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range header {
+		if name, ok := sipCompactHeaders[k]; ok {
+			k = name
+		}
+
+		msg.Header[k] = append(msg.Header[k], v...)
+	}
+
+	if v := msg.Header.Get("Content-Length"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 65535 {
+			return nil, errSIPMalformed
+		}
+
+		msg.Body = make([]byte, n)
+		if _, err := io.ReadFull(br, msg.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
+
+// sipUser returns the user part of a sip uri, optionally enclosed in a name-addr
+// as used within the From, To and Contact headers.
+func sipUser(s string) string {
+	if i := strings.Index(s, "<"); i >= 0 {
+		s = s[i+1:]
+		if j := strings.Index(s, ">"); j >= 0 {
+			s = s[:j]
+		}
+	}
+
+	if i := strings.Index(s, ":"); i >= 0 {
+		s = s[i+1:]
+	}
+
+	if i := strings.Index(s, "@"); i >= 0 {
+		return s[:i]
+	}
+
+	return ""
+}
+
+// sipTool returns the scanner tool matching the user agent, if any.
+func sipTool(ua string) string {
+	ua = strings.ToLower(ua)
+
+	for _, scanner := range sipScanners {
+		if strings.Contains(ua, scanner.Pattern) {
+			return scanner.Tool
+		}
+	}
+
+	return ""
+}
+
+// parseDigest parses the parameters of a Digest Authorization header.
+func parseDigest(s string) (map[string]string, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) < 7 || !strings.EqualFold(s[:7], "digest ") {
+		return nil, false
+	}
+
+	params := map[string]string{}
+
+	s = s[7:]
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " \t,")
+
+		i := strings.Index(s, "=")
+		if i < 0 {
+			break
+		}
+
+		key := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = strings.TrimLeft(s[i+1:], " \t")
+
+		value := ""
+		if strings.HasPrefix(s, `"`) {
+			j := strings.Index(s[1:], `"`)
+			if j < 0 {
+				return nil, false
+			}
+
+			value, s = s[1:j+1], s[j+2:]
+		} else if j := strings.Index(s, ","); j >= 0 {
+			value, s = strings.TrimSpace(s[:j]), s[j:]
+		} else {
+			value, s = strings.TrimSpace(s), ""
+		}
+
+		params[key] = value
+	}
+
+	return params, true
+}
+
+func md5Hex(parts ...string) string {
+	h := md5.Sum([]byte(strings.Join(parts, ":")))
+	return hex.EncodeToString(h[:])
+}
+
+func digestResponse(method, password string, params map[string]string) string {
+	ha1 := md5Hex(params["username"], params["realm"], password)
+	ha2 := md5Hex(method, params["uri"])
+
+	if qop := params["qop"]; qop != "" {
+		return md5Hex(ha1, params["nonce"], params["nc"], params["cnonce"], qop, ha2)
+	}
+
+	return md5Hex(ha1, params["nonce"], ha2)
+}
+
+// hashcatDigest formats the digest in the format of hashcat mode 11400, to
+// allow offline cracking of the captured credentials.
+func hashcatDigest(server, client net.Addr, method string, params map[string]string) string {
+	host := func(addr net.Addr) string {
+		h, _, _ := net.SplitHostPort(addr.String())
+		return h
+	}
+
+	prefix, resource := "", params["uri"]
+	if i := strings.Index(resource, ":"); i >= 0 {
+		prefix, resource = resource[:i], resource[i+1:]
+	}
+
+	return strings.Join([]string{
+		"$sip$",
+		host(server),
+		host(client),
+		params["username"],
+		params["realm"],
+		method,
+		prefix,
+		resource,
+		"",
+		params["nonce"],
+		params["cnonce"],
+		params["nc"],
+		params["qop"],
+		"MD5",
+		params["response"],
+	}, "*")
+}
+
+func (s *sipService) authenticate(method string, params map[string]string) bool {
+	for _, credential := range s.Credentials {
+		parts := strings.SplitN(credential, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		if params["username"] != parts[0] {
+			continue
+		}
+
+		if digestResponse(method, parts[1], params) == strings.ToLower(params["response"]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *sipService) nonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *sipService) reply(w io.Writer, req *sipMessage, code int, reason string, headers ...string) error {
+	buf := bytes.Buffer{}
+
+	fmt.Fprintf(&buf, "SIP/2.0 %d %s\r\n", code, reason)
+
+	for _, via := range req.Header["Via"] {
+		fmt.Fprintf(&buf, "Via: %s\r\n", via)
+	}
+
+	to := req.Header.Get("To")
+	if code > 100 && !strings.Contains(strings.ToLower(to), ";tag=") {
+		to = fmt.Sprintf("%s;tag=%s", to, s.nonce()[:8])
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", req.Header.Get("From"))
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Call-ID: %s\r\n", req.Header.Get("Call-Id"))
+	fmt.Fprintf(&buf, "CSeq: %s\r\n", req.Header.Get("Cseq"))
+
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "%s\r\n", h)
+	}
+
+	fmt.Fprintf(&buf, "User-Agent: %s\r\n", s.UserAgent)
+	fmt.Fprintf(&buf, "Content-Length: 0\r\n\r\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+const sipAllow = "Allow: INVITE, ACK, CANCEL, OPTIONS, BYE, REGISTER"
+
+func (s *sipService) challenge(w io.Writer, req *sipMessage, proxy bool) error {
+	challenge := fmt.Sprintf(`Digest algorithm=MD5, realm="%s", nonce="%s"`, s.Realm, s.nonce())
+
+	if proxy {
+		return s.reply(w, req, 407, "Proxy Authentication Required", "Proxy-Authenticate: "+challenge)
+	}
+
+	return s.reply(w, req, 401, "Unauthorized", "WWW-Authenticate: "+challenge)
+}
+
+func (s *sipService) serve(conn net.Conn, req *sipMessage) error {
+	options := []event.Option{
+		EventOptions,
+		event.Category("sip"),
+		event.Type(strings.ToLower(req.Method)),
+		event.SourceAddr(conn.RemoteAddr()),
+		event.DestinationAddr(conn.LocalAddr()),
+		event.Custom("sip.method", req.Method),
+		event.Custom("sip.uri", req.URI),
+		event.Custom("sip.from", req.Header.Get("From")),
+		event.Custom("sip.to", req.Header.Get("To")),
+		event.Custom("sip.contact", req.Header.Get("Contact")),
+		event.Custom("sip.call-id", req.Header.Get("Call-Id")),
+		event.Custom("sip.user-agent", req.Header.Get("User-Agent")),
+	}
+
+	if tool := sipTool(req.Header.Get("User-Agent")); tool != "" {
+		options = append(options, event.Custom("sip.tool", tool))
+	}
+
+	if req.Method == "INVITE" {
+		options = append(options, event.Custom("sip.number", sipUser(req.URI)))
+	}
+
+	if len(req.Body) > 0 {
+		options = append(options, event.Payload(req.Body))
+	}
+
+	authorization := req.Header.Get("Authorization")
+	if req.Method == "INVITE" {
+		authorization = req.Header.Get("Proxy-Authorization")
+	}
+
+	params, authorized := parseDigest(authorization)
+	if authorized {
+		options = append(options,
+			event.Custom("sip.username", params["username"]),
+			event.Custom("sip.realm", params["realm"]),
+			event.Custom("sip.nonce", params["nonce"]),
+			event.Custom("sip.response", params["response"]),
+			event.Custom("sip.digest", hashcatDigest(conn.LocalAddr(), conn.RemoteAddr(), req.Method, params)),
+		)
+	}
+
+	s.c.Send(event.New(options...))
+
+	switch req.Method {
+	case "OPTIONS":
+		return s.reply(conn, req, 200, "OK", sipAllow, "Accept: application/sdp", "Supported: replaces, timer")
+	case "REGISTER":
+		if !authorized {
+			return s.challenge(conn, req, false)
+		} else if s.authenticate(req.Method, params) {
+			return s.reply(conn, req, 200, "OK", "Contact: "+req.Header.Get("Contact"), "Expires: 3600")
+		}
+
+		return s.reply(conn, req, 403, "Forbidden")
+	case "INVITE":
+		if !authorized {
+			return s.challenge(conn, req, true)
+		} else if err := s.reply(conn, req, 100, "Trying"); err != nil {
+			return err
+		}
+
+		return s.reply(conn, req, 486, "Busy Here")
+	case "ACK":
+		return nil
+	case "BYE", "CANCEL":
+		return s.reply(conn, req, 200, "OK")
+	default:
+		return s.reply(conn, req, 405, "Method Not Allowed", sipAllow)
+	}
+}
+
+func (s *sipService) Handle(conn net.Conn) error {
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+
+	if _, ok := conn.(*listener.DummyUDPConn); ok {
+		req, err := readSIPMessage(br)
+		if err != nil {
+			return err
+		}
+
+		return s.serve(conn, req)
+	}
+
+	for {
+		req, err := readSIPMessage(br)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := s.serve(conn, req); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *sipService) CanHandle(payload []byte) bool {
+	return IsSIP(payload)
+}
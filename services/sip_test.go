@@ -0,0 +1,249 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/listener"
+)
+
+const sipRegister = "REGISTER sip:127.0.0.1 SIP/2.0\r\n" +
+	"v: SIP/2.0/TCP 127.0.0.1:5061;branch=z9hG4bK-1\r\n" +
+	"f: <sip:100@127.0.0.1>;tag=abc\r\n" +
+	"t: <sip:100@127.0.0.1>\r\n" +
+	"i: 1234@127.0.0.1\r\n" +
+	"CSeq: %d REGISTER\r\n" +
+	"User-Agent: friendly-scanner\r\n" +
+	"%s" +
+	"Content-Length: 0\r\n\r\n"
+
+func TestSIPRegister(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := make(events, 10)
+
+	s := SIP(
+		WithChannel(c),
+	).(*sipService)
+	s.Credentials = []string{"100:secret"}
+
+	go s.Handle(server)
+
+	br := bufio.NewReader(client)
+
+	go fmt.Fprintf(client, sipRegister, 1, "")
+
+	resp, err := readSIPResponse(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Status != "401 Unauthorized" {
+		t.Fatalf("Expected 401 Unauthorized, got %s", resp.Status)
+	}
+
+	params, ok := parseDigest(resp.Header.Get("Www-Authenticate"))
+	if !ok {
+		t.Fatalf("Expected digest challenge, got %q", resp.Header.Get("Www-Authenticate"))
+	}
+
+	if resp.Header.Get("Call-Id") != "1234@127.0.0.1" {
+		t.Errorf("Expected Call-ID to be copied, got %q", resp.Header.Get("Call-Id"))
+	}
+
+	params["username"] = "100"
+	params["uri"] = "sip:127.0.0.1"
+	params["response"] = digestResponse("REGISTER", "secret", params)
+
+	authorization := fmt.Sprintf("Authorization: Digest username=\"%s\", realm=\"%s\", nonce=\"%s\", uri=\"%s\", response=\"%s\", algorithm=MD5\r\n",
+		params["username"], params["realm"], params["nonce"], params["uri"], params["response"])
+
+	go fmt.Fprintf(client, sipRegister, 2, authorization)
+
+	resp, err = readSIPResponse(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Status != "200 OK" {
+		t.Fatalf("Expected 200 OK, got %s", resp.Status)
+	}
+
+	e := <-c
+	if e.Get("sip.tool") != "sipvicious" {
+		t.Errorf("Expected sipvicious tool, got %q", e.Get("sip.tool"))
+	} else if e.Has("sip.digest") {
+		t.Errorf("Expected no digest without authorization")
+	}
+
+	// the addresses of a pipe have no host
+	digest := fmt.Sprintf("$sip$***100*asterisk*REGISTER*sip*127.0.0.1**%s****MD5*%s", params["nonce"], params["response"])
+
+	if e := <-c; e.Get("sip.digest") != digest {
+		t.Errorf("Expected digest %s, got %s", digest, e.Get("sip.digest"))
+	} else if e.Get("sip.username") != "100" {
+		t.Errorf("Expected username 100, got %q", e.Get("sip.username"))
+	}
+}
+
+func TestSIPHashcatDigest(t *testing.T) {
+	// example of hashcat mode 11400, the password is hashcat
+	params := map[string]string{
+		"username": "username",
+		"realm":    "asterisk",
+		"nonce":    "2b01df0b",
+		"uri":      "sip:192.168.100.121",
+	}
+
+	params["response"] = digestResponse("REGISTER", "hashcat", params)
+
+	digest := hashcatDigest(
+		&net.UDPAddr{IP: net.ParseIP("192.168.100.100"), Port: 5060},
+		&net.UDPAddr{IP: net.ParseIP("192.168.100.121"), Port: 5060},
+		"REGISTER",
+		params,
+	)
+
+	expected := "$sip$*192.168.100.100*192.168.100.121*username*asterisk*REGISTER*sip*192.168.100.121**2b01df0b****MD5*ad0520061ca07c120d7e8ce696a6df2d"
+	if digest != expected {
+		t.Errorf("Expected %s, got %s", expected, digest)
+	}
+}
+
+const sipInvite = "INVITE sip:0046701234567@127.0.0.1 SIP/2.0\r\n" +
+	"Via: SIP/2.0/UDP 127.0.0.1:5061;branch=z9hG4bK-2\r\n" +
+	"From: \"100\" <sip:100@127.0.0.1>;tag=def\r\n" +
+	"To: <sip:0046701234567@127.0.0.1>\r\n" +
+	"Call-ID: 5678@127.0.0.1\r\n" +
+	"CSeq: 1 INVITE\r\n" +
+	"User-Agent: sipcli/v1.8\r\n" +
+	"%s" +
+	"Content-Length: 0\r\n\r\n"
+
+func TestSIPInviteUDP(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Close()
+
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	c := make(events, 10)
+
+	s := SIP(
+		WithChannel(c),
+	)
+
+	authorization := "Proxy-Authorization: Digest username=\"100\", realm=\"asterisk\", nonce=\"abcdef\", " +
+		"uri=\"sip:0046701234567@127.0.0.1\", response=\"0123456789abcdef0123456789abcdef\", algorithm=MD5\r\n"
+
+	err = s.Handle(&listener.DummyUDPConn{
+		Buffer: []byte(fmt.Sprintf(sipInvite, authorization)),
+		Laddr:  server.LocalAddr().(*net.UDPAddr),
+		Raddr:  client.LocalAddr().(*net.UDPAddr),
+		C:      server,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+
+	buf := make([]byte, 65535)
+
+	n, _, err := client.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := readSIPResponse(bufio.NewReader(bytes.NewReader(buf[:n])))
+	if err != nil {
+		t.Fatal(err)
+	} else if resp.Status != "100 Trying" {
+		t.Errorf("Expected 100 Trying, got %s", resp.Status)
+	}
+
+	e := <-c
+	if e.Get("sip.number") != "0046701234567" {
+		t.Errorf("Expected number 0046701234567, got %q", e.Get("sip.number"))
+	} else if e.Get("sip.tool") != "sipcli" {
+		t.Errorf("Expected sipcli tool, got %q", e.Get("sip.tool"))
+	}
+
+	digest := "$sip$*127.0.0.1*127.0.0.1*100*asterisk*INVITE*sip*0046701234567@127.0.0.1**abcdef****MD5*0123456789abcdef0123456789abcdef"
+	if e.Get("sip.digest") != digest {
+		t.Errorf("Expected digest %s, got %s", digest, e.Get("sip.digest"))
+	}
+}
+
+type sipResponse struct {
+	Status string
+	Header textproto.MIMEHeader
+}
+
+func readSIPResponse(br *bufio.Reader) (*sipResponse, error) {
+	tp := textproto.NewReader(br)
+
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "SIP/2.0 ") {
+		return nil, fmt.Errorf("Unexpected response: %q", line)
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	return &sipResponse{
+		Status: strings.TrimPrefix(line, "SIP/2.0 "),
+		Header: header,
+	}, nil
+}
@@ -36,6 +36,7 @@ import (
 	"io"
 	"net"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/honeytrap/honeytrap/services"
@@ -45,6 +46,13 @@ import (
 
 var (
 	_ = services.Register("ssh-auth", SSHAuth)
+	_ = services.Describe("ssh-auth", config.Description{
+		Description: "SSH server capturing credentials, denying all logins",
+		Port:        "TCP/22",
+		Config: func() interface{} {
+			return &sshServiceConfig{Banner: defaultBanner}
+		},
+	})
 )
 
 func SSHAuth(options ...services.ServicerFunc) services.Servicer {
@@ -53,15 +61,13 @@ func SSHAuth(options ...services.ServicerFunc) services.Servicer {
 		log.Errorf("Could not initialize storage: ", err.Error())
 	}
 
-	banner := "SSH-2.0-OpenSSH_6.6.1p1 2020Ubuntu-2ubuntu2"
-
 	srvc := &sshAuthService{
-		key:    s.PrivateKey(),
-		Banner: banner,
+		sshServiceConfig: sshServiceConfig{Banner: defaultBanner},
+		key:              s.PrivateKey(),
 	}
 
 	config := ssh.ServerConfig{
-		ServerVersion: banner,
+		ServerVersion: defaultBanner,
 		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
 			srvc.c.Send(event.New(
 				services.EventOptions,
@@ -100,9 +106,9 @@ func SSHAuth(options ...services.ServicerFunc) services.Servicer {
 }
 
 type sshAuthService struct {
-	c pushers.Channel
+	sshServiceConfig
 
-	Banner string `toml:"banner"`
+	c pushers.Channel
 
 	key    *privateKey `toml:"private-key"`
 	config ssh.ServerConfig
@@ -112,6 +118,10 @@ func (s *sshAuthService) SetChannel(c pushers.Channel) {
 	s.c = c
 }
 
+func (s *sshAuthService) CanHandle(payload []byte) bool {
+	return services.IsSSH(payload)
+}
+
 func (s *sshAuthService) Handle(conn net.Conn) error {
 	defer conn.Close()
 
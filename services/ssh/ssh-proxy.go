@@ -40,6 +40,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/director"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
@@ -50,6 +51,13 @@ import (
 
 var (
 	_ = services.Register("ssh-proxy", SSHProxy)
+	_ = services.Describe("ssh-proxy", config.Description{
+		Description: "SSH server proxying sessions to the director",
+		Port:        "TCP/22",
+		Config: func() interface{} {
+			return &sshServiceConfig{Banner: defaultBanner}
+		},
+	})
 )
 
 func SSHProxy(options ...services.ServicerFunc) services.Servicer {
@@ -58,11 +66,9 @@ func SSHProxy(options ...services.ServicerFunc) services.Servicer {
 		log.Errorf("Could not initialize storage: ", err.Error())
 	}
 
-	banner := "SSH-2.0-OpenSSH_6.6.1p1 2020Ubuntu-2ubuntu2"
-
 	service := &sshProxyService{
-		key:    s.PrivateKey(),
-		Banner: banner,
+		sshServiceConfig: sshServiceConfig{Banner: defaultBanner},
+		key:              s.PrivateKey(),
 	}
 
 	for _, o := range options {
@@ -73,9 +79,9 @@ func SSHProxy(options ...services.ServicerFunc) services.Servicer {
 }
 
 type sshProxyService struct {
-	c pushers.Channel
+	sshServiceConfig
 
-	Banner string `toml:"banner"`
+	c pushers.Channel
 
 	key *privateKey `toml:"private-key"`
 
@@ -90,6 +96,10 @@ func (s *sshProxyService) SetDirector(d director.Director) {
 	s.d = d
 }
 
+func (s *sshProxyService) CanHandle(payload []byte) bool {
+	return services.IsSSH(payload)
+}
+
 func (s *sshProxyService) Handle(conn net.Conn) error {
 	var client *ssh.Client
 
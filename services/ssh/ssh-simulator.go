@@ -38,6 +38,7 @@ import (
 	"net"
 	"strings"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/honeytrap/honeytrap/services"
@@ -56,6 +57,13 @@ credentials=["root:root"]
 
 var (
 	_ = services.Register("ssh-simulator", SSHSimulator)
+	_ = services.Describe("ssh-simulator", config.Description{
+		Description: "SSH server with a simulated shell",
+		Port:        "TCP/22",
+		Config: func() interface{} {
+			return &sshSimulatorServiceConfig{Banner: defaultBanner}
+		},
+	})
 )
 
 func SSHSimulator(options ...services.ServicerFunc) services.Servicer {
@@ -64,11 +72,9 @@ func SSHSimulator(options ...services.ServicerFunc) services.Servicer {
 		log.Errorf("Could not initialize storage: ", err.Error())
 	}
 
-	banner := "SSH-2.0-OpenSSH_6.6.1p1 2020Ubuntu-2ubuntu2"
-
 	service := &sshSimulatorService{
-		key:    s.PrivateKey(),
-		Banner: banner,
+		sshSimulatorServiceConfig: sshSimulatorServiceConfig{Banner: defaultBanner},
+		key:                       s.PrivateKey(),
 	}
 
 	for _, o := range options {
@@ -78,19 +84,28 @@ func SSHSimulator(options ...services.ServicerFunc) services.Servicer {
 	return service
 }
 
+type sshSimulatorServiceConfig struct {
+	Banner string `toml:"banner" doc:"Server version banner"`
+
+	Credentials []string `toml:"credentials" doc:"Accepted credentials as user:password"`
+}
+
 type sshSimulatorService struct {
-	c pushers.Channel
+	sshSimulatorServiceConfig
 
-	Banner string `toml:"banner"`
+	c pushers.Channel
 
-	Credentials []string    `toml:"credentials"`
-	key         *privateKey `toml:"private-key"`
+	key *privateKey `toml:"private-key"`
 }
 
 func (s *sshSimulatorService) SetChannel(c pushers.Channel) {
 	s.c = c
 }
 
+func (s *sshSimulatorService) CanHandle(payload []byte) bool {
+	return services.IsSSH(payload)
+}
+
 func (s *sshSimulatorService) Handle(conn net.Conn) error {
 	config := ssh.ServerConfig{
 		ServerVersion: s.Banner,
@@ -101,6 +116,7 @@ func (s *sshSimulatorService) Handle(conn net.Conn) error {
 				event.Type("publickey-authentication"),
 				event.SourceAddr(conn.RemoteAddr()),
 				event.DestinationAddr(conn.LocalAddr()),
+				event.Custom("ssh.client-version", string(conn.ClientVersion())),
 				event.Custom("ssh.publickey-type", key.Type()),
 				event.Custom("ssh.publickey", hex.EncodeToString(key.Marshal())),
 			))
@@ -114,6 +130,7 @@ func (s *sshSimulatorService) Handle(conn net.Conn) error {
 				event.Type("password-authentication"),
 				event.SourceAddr(cm.RemoteAddr()),
 				event.DestinationAddr(cm.LocalAddr()),
+				event.Custom("ssh.client-version", string(cm.ClientVersion())),
 				event.Custom("ssh.username", cm.User()),
 				event.Custom("ssh.password", string(password)),
 			))
@@ -35,3 +35,10 @@ import (
 )
 
 var log = logging.MustGetLogger("services")
+
+// defaultBanner is the server version banner of the ssh services.
+const defaultBanner = "SSH-2.0-OpenSSH_6.6.1p1 2020Ubuntu-2ubuntu2"
+
+type sshServiceConfig struct {
+	Banner string `toml:"banner" doc:"Server version banner"`
+}
@@ -35,12 +35,17 @@ import (
 	"io"
 	"net"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 )
 
 var (
 	_ = Register("telnet", Telnet)
+	_ = Describe("telnet", config.Description{
+		Description: "Echoes and logs received lines",
+		Port:        "TCP/23",
+	})
 )
 
 // Telnet is a placeholder
@@ -40,6 +40,7 @@ import (
 
 	logging "github.com/op/go-logging"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/honeytrap/honeytrap/services"
@@ -49,6 +50,13 @@ var log = logging.MustGetLogger("services/vnc")
 
 var (
 	_ = services.Register("vnc", Vnc)
+	_ = services.Describe("vnc", config.Description{
+		Description: "VNC server showing a static image",
+		Port:        "TCP/5900",
+		Config: func() interface{} {
+			return &vncServiceConfig{}
+		},
+	})
 )
 
 func Vnc(options ...services.ServicerFunc) services.Servicer {
@@ -83,13 +91,17 @@ func Vnc(options ...services.ServicerFunc) services.Servicer {
 	return s
 }
 
+type vncServiceConfig struct {
+	ImagePath  string `toml:"image" doc:"Image shown to clients"`
+	ServerName string `toml:"server-name" doc:"Desktop name"`
+}
+
 type vncService struct {
+	vncServiceConfig
+
 	c pushers.Channel
 
 	li *LockableImage
-
-	ImagePath  string `toml:"image"`
-	ServerName string `toml:"server-name"`
 }
 
 func (s *vncService) SetChannel(c pushers.Channel) {
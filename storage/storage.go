@@ -132,3 +132,33 @@ func (s *badgeStorage) Set(key string, data []byte) error {
 		return err
 	})
 }
+
+func (s *badgeStorage) Delete(key string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	})
+}
+
+// Range calls fn with the keys having the prefix and their values, until fn
+// returns false.
+func (s *badgeStorage) Range(prefix string, fn func(key string, data []byte) bool) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+			item := it.Item()
+
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			if !fn(string(item.Key()), v) {
+				break
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,51 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package web
+
+// Config contains the configuration of the web interface.
+type Config struct {
+	Listen string `toml:"listen" doc:"Address of the web interface"`
+	Token  string `toml:"token" doc:"Token required for the api, as Authorization: Bearer {token}. The api is disabled without a token" secret:"true"`
+}
+
+// DefaultConfig contains the default configuration, the web interface only
+// listens on localhost.
+var DefaultConfig = Config{
+	Listen: "127.0.0.1:8089",
+}
+
+// WithConfig sets the configuration of the web interface.
+func WithConfig(c Config) func(*web) {
+	return func(w *web) {
+		w.Addr = c.Listen
+		w.token = c.Token
+	}
+}
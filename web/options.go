@@ -31,6 +31,10 @@
 package web
 
 import (
+	"github.com/honeytrap/honeytrap/artifacts"
+	"github.com/honeytrap/honeytrap/credentials"
+	"github.com/honeytrap/honeytrap/enrichers"
+	"github.com/honeytrap/honeytrap/profiles"
 	"github.com/honeytrap/honeytrap/pushers/eventbus"
 )
 
@@ -39,3 +43,51 @@ func WithEventBus(bus *eventbus.EventBus) func(*web) {
 		w.SetEventBus(bus)
 	}
 }
+
+// WithQueueStats enables the queues api, fn returns the counters of the
+// event queues.
+func WithQueueStats(fn func() []eventbus.QueueStats) func(*web) {
+	return func(w *web) {
+		w.SetQueueStats(fn)
+	}
+}
+
+// WithEnricherStats enables the enrichers api, fn returns the counters of
+// the enrichers.
+func WithEnricherStats(fn func() []enrichers.Stats) func(*web) {
+	return func(w *web) {
+		w.SetEnricherStats(fn)
+	}
+}
+
+// WithArtifacts enables the artifacts api, for listing and downloading
+// the stored artifacts.
+func WithArtifacts(store *artifacts.Store) func(*web) {
+	return func(w *web) {
+		w.SetArtifacts(store)
+	}
+}
+
+// WithProfiles enables the profiles api, for querying the attacker
+// profiles.
+func WithProfiles(store *profiles.Store) func(*web) {
+	return func(w *web) {
+		w.SetProfiles(store)
+	}
+}
+
+// WithCredentials enables the credentials api, for the top credentials
+// and the wordlists.
+func WithCredentials(store *credentials.Store) func(*web) {
+	return func(w *web) {
+		w.SetCredentials(store)
+	}
+}
+
+// WithReloader enables the reload api, fn will be called to reload the
+// configuration.
+func WithReloader(fn func() error) func(*web) {
+	return func(w *web) {
+		w.SetReloader(fn)
+	}
+}
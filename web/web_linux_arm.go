@@ -36,7 +36,11 @@ package web
 import (
 	"net/http"
 
+	"github.com/honeytrap/honeytrap/artifacts"
+	"github.com/honeytrap/honeytrap/credentials"
+	"github.com/honeytrap/honeytrap/enrichers"
 	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/profiles"
 	"github.com/honeytrap/honeytrap/pushers/eventbus"
 
 	logging "github.com/op/go-logging"
@@ -46,14 +50,15 @@ var log = logging.MustGetLogger("honeytrap:web")
 
 type web struct {
 	*http.Server
+
+	token string
 }
 
 func New(options ...func(*web)) *web {
 	handler := http.NewServeMux()
 
-	// TODO(nl5887): make configurable
 	server := &http.Server{
-		Addr:    ":8089",
+		Addr:    DefaultConfig.Listen,
 		Handler: handler,
 	}
 
@@ -69,7 +74,25 @@ func New(options ...func(*web)) *web {
 }
 
 func (web *web) SetEventBus(eb *eventbus.EventBus) {
-	eb.Subscribe(web)
+	eb.Subscribe(web, eventbus.WithName("web"))
+}
+
+func (web *web) SetQueueStats(fn func() []eventbus.QueueStats) {
+}
+
+func (web *web) SetEnricherStats(fn func() []enrichers.Stats) {
+}
+
+func (web *web) SetArtifacts(store *artifacts.Store) {
+}
+
+func (web *web) SetProfiles(store *profiles.Store) {
+}
+
+func (web *web) SetCredentials(store *credentials.Store) {
+}
+
+func (web *web) SetReloader(fn func() error) {
 }
 
 func (web *web) Send(e event.Event) {
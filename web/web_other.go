@@ -33,12 +33,23 @@
 package web
 
 import (
+	"bytes"
+	"crypto/subtle"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/honeytrap/honeytrap/artifacts"
 	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/credentials"
+	"github.com/honeytrap/honeytrap/enrichers"
 	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/profiles"
 	"github.com/honeytrap/honeytrap/pushers/eventbus"
 
 	assetfs "github.com/elazarl/go-bindata-assetfs"
@@ -58,10 +69,26 @@ type web struct {
 
 	config *config.Config
 
+	// token is required for the api
+	token string
+
 	eb *eventbus.EventBus
 
+	reload func() error
+
+	queueStats func() []eventbus.QueueStats
+
+	enricherStats func() []enrichers.Stats
+
+	artifacts *artifacts.Store
+
+	profiles *profiles.Store
+
+	credentials *credentials.Store
+
 	// Registered connections.
 	connections map[*connection]bool
+	m           sync.RWMutex
 
 	// Register requests from the connections.
 	register chan *connection
@@ -73,9 +100,8 @@ type web struct {
 func New(options ...func(*web)) *web {
 	handler := http.NewServeMux()
 
-	// TODO(nl5887): make configurable
 	server := &http.Server{
-		Addr:    ":8089",
+		Addr:    DefaultConfig.Listen,
 		Handler: handler,
 	}
 
@@ -101,6 +127,15 @@ func New(options ...func(*web)) *web {
 	})
 
 	handler.HandleFunc("/ws", hc.ServeWS)
+	handler.HandleFunc("/api/reload", hc.authorized(hc.ServeReload))
+	handler.HandleFunc("/api/queues", hc.authorized(hc.ServeQueues))
+	handler.HandleFunc("/api/enrichers", hc.authorized(hc.ServeEnrichers))
+	handler.HandleFunc("/api/artifacts", hc.authorized(hc.ServeArtifacts))
+	handler.HandleFunc("/api/artifacts/", hc.authorized(hc.ServeArtifact))
+	handler.HandleFunc("/api/profiles", hc.authorized(hc.ServeProfiles))
+	handler.HandleFunc("/api/profiles/", hc.authorized(hc.ServeProfile))
+	handler.HandleFunc("/api/credentials", hc.authorized(hc.ServeCredentials))
+	handler.HandleFunc("/api/credentials/wordlist", hc.authorized(hc.ServeWordlist))
 	handler.Handle("/", sh)
 
 	go hc.run()
@@ -144,9 +179,36 @@ func New(options ...func(*web)) *web {
 }
 
 func (w *web) ListenAndServe() {
-	log.Infof("Web interface started: %s", "8089")
+	log.Infof("Web interface started: %s", w.Addr)
+
+	if w.token == "" {
+		log.Warning("Web api disabled, set a token in the web section to enable it")
+	}
 
-	w.Server.ListenAndServe()
+	if err := w.Server.ListenAndServe(); err != nil {
+		log.Errorf("Error starting web interface: %s", err.Error())
+	}
+}
+
+// authorized returns a handler requiring the api token, as
+// Authorization: Bearer {token}. The token is never sent by browsers on
+// their own, which protects the api against cross site requests as well.
+func (web *web) authorized(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if web.token == "" {
+			http.Error(w, "Api disabled, no token configured", http.StatusForbidden)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(web.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		fn(w, r)
+	}
 }
 
 type Metadata struct {
@@ -168,27 +230,304 @@ var upgrader = websocket.Upgrader{
 }
 
 func (web *web) SetEventBus(eb *eventbus.EventBus) {
-	eb.Subscribe(web)
+	eb.Subscribe(web, eventbus.WithName("web"))
+}
+
+func (web *web) SetQueueStats(fn func() []eventbus.QueueStats) {
+	web.queueStats = fn
+}
+
+// ServeQueues returns the counters of the event queues, like the number of
+// dropped events.
+func (web *web) ServeQueues(w http.ResponseWriter, r *http.Request) {
+	if web.queueStats == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(web.queueStats())
+}
+
+func (web *web) SetEnricherStats(fn func() []enrichers.Stats) {
+	web.enricherStats = fn
+}
+
+// ServeEnrichers returns the counters of the enrichers, like the number of
+// errors and the cache hits.
+func (web *web) ServeEnrichers(w http.ResponseWriter, r *http.Request) {
+	if web.enricherStats == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(web.enricherStats())
+}
+
+func (web *web) SetArtifacts(store *artifacts.Store) {
+	web.artifacts = store
+}
+
+// ServeArtifacts returns the metadata of the stored artifacts.
+func (web *web) ServeArtifacts(w http.ResponseWriter, r *http.Request) {
+	if web.artifacts == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	list, err := web.artifacts.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// ServeArtifact downloads the artifact, which is always served as an
+// attachment, as it is probably malicious.
+func (web *web) ServeArtifact(w http.ResponseWriter, r *http.Request) {
+	if web.artifacts == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	a, rc, err := web.artifacts.Open(strings.TrimPrefix(r.URL.Path, "/api/artifacts/"))
+	if err == artifacts.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+a.SHA256+"\"")
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, rc)
+}
+
+func (web *web) SetProfiles(store *profiles.Store) {
+	web.profiles = store
+}
+
+// ServeProfiles returns the attacker profiles, the highest scores first.
+// The min-score and limit (100 by default) parameters select the profiles.
+func (web *web) ServeProfiles(w http.ResponseWriter, r *http.Request) {
+	if web.profiles == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	minScore, limit := 0, 100
+
+	q := r.URL.Query()
+	if v := q.Get("min-score"); v == "" {
+	} else if n, err := strconv.Atoi(v); err != nil {
+		http.Error(w, "invalid min-score", http.StatusBadRequest)
+		return
+	} else {
+		minScore = n
+	}
+
+	if v := q.Get("limit"); v == "" {
+	} else if n, err := strconv.Atoi(v); err != nil || n < 0 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	} else {
+		limit = n
+	}
+
+	list, err := web.profiles.List(minScore, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// ServeProfile returns the profile of an address, or of a fingerprint with
+// the field of the fingerprint as kind parameter.
+func (web *web) ServeProfile(w http.ResponseWriter, r *http.Request) {
+	if web.profiles == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	if kind == "" {
+		kind = "ip"
+	}
+
+	p, err := web.profiles.Get(kind, strings.TrimPrefix(r.URL.Path, "/api/profiles/"))
+	if err == profiles.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+func (web *web) SetCredentials(store *credentials.Store) {
+	web.credentials = store
+}
+
+// intParam returns the integer value of the query parameter, or def when
+// the parameter is missing.
+func intParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+
+	return n, nil
+}
+
+// credentialKind returns the kind parameter, pairs by default.
+func credentialKind(r *http.Request) credentials.Kind {
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		return credentials.Kind(kind)
+	}
+
+	return credentials.Pairs
+}
+
+// ServeCredentials returns the most used usernames, passwords or pairs,
+// selected by the kind parameter. The source parameter restricts the
+// credentials to a source address.
+func (web *web) ServeCredentials(w http.ResponseWriter, r *http.Request) {
+	if web.credentials == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	limit, err := intParam(r, "limit", 100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	counts, err := web.credentials.Top(credentialKind(r), limit, r.URL.Query().Get("source"))
+	if err == credentials.ErrInvalidKind {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
+
+// ServeWordlist returns the usernames, passwords or pairs as wordlist, the
+// most used first. The min-count parameter skips the rarely used values.
+func (web *web) ServeWordlist(w http.ResponseWriter, r *http.Request) {
+	if web.credentials == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	minCount, err := intParam(r, "min-count", 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	kind := credentialKind(r)
+
+	buf := &bytes.Buffer{}
+	if err := web.credentials.Wordlist(buf, kind, minCount); err == credentials.ErrInvalidKind {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+string(kind)+".txt\"")
+	buf.WriteTo(w)
+}
+
+func (web *web) SetReloader(fn func() error) {
+	web.reload = fn
+}
+
+// ServeReload reloads the configuration.
+func (web *web) ServeReload(w http.ResponseWriter, r *http.Request) {
+	if web.reload == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := web.reload(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "error",
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "ok",
+	})
 }
 
 func (web *web) run() {
 	for {
 		select {
 		case c := <-web.register:
+			web.m.Lock()
 			web.connections[c] = true
+			web.m.Unlock()
 		case c := <-web.unregister:
+			web.m.Lock()
 			if _, ok := web.connections[c]; ok {
 				delete(web.connections, c)
 
 				close(c.send)
 			}
+			web.m.Unlock()
 		}
 	}
 }
 
+// Send sends the event to the connections, events are dropped for
+// connections which can't keep up.
 func (web *web) Send(e event.Event) {
+	web.m.RLock()
+	defer web.m.RUnlock()
+
 	for c := range web.connections {
-		c.send <- &e
+		select {
+		case c.send <- &e:
+		default:
+		}
 	}
 }
 
@@ -202,7 +541,7 @@ func (web *web) ServeWS(w http.ResponseWriter, r *http.Request) {
 	c := &connection{
 		ws:   ws,
 		web:  web,
-		send: make(chan json.Marshaler),
+		send: make(chan json.Marshaler, 100),
 	}
 
 	log.Info("Connection upgraded.")